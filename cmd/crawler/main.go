@@ -0,0 +1,180 @@
+// Command crawler runs a distributed crawl: a coordinator owning the frontier
+// and worker processes leasing URLs from it over HTTP.
+//
+//	crawler -mode coordinator -seed https://example.com -output audits/example -spawn 4
+//	crawler -mode worker -coordinator http://127.0.0.1:9090
+//	crawler -mode coordinator -resume -output audits/example -spawn 4
+//	crawler -mode coordinator -seed https://example.com -output audits/replay -spawn 4 -replay audits/example/crawl.warc
+//
+// With -resume the coordinator continues the crawl checkpointed in -output,
+// e.g. after a crash.
+// With -replay the crawl is answered from a WARC archive instead of the
+// network, to re-run an audit offline.
+// With -spawn the coordinator starts its workers as local processes, which
+// is the easiest way to try the distributed mode on one machine.
+//
+// Workers authenticate to the coordinator with the shared -token, which
+// defaults to $CRAWLER_TOKEN. A coordinator listening on anything but a
+// loopback address refuses to start without one.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"time"
+
+	"firesalamander/internal/agents/crawler"
+	"firesalamander/internal/config"
+)
+
+func main() {
+	mode := flag.String("mode", "coordinator", "coordinator or worker")
+	configPath := flag.String("config", "config/crawler.yaml", "crawler configuration")
+	listen := flag.String("listen", "127.0.0.1:9090", "coordinator address")
+	coordinator := flag.String("coordinator", "http://127.0.0.1:9090", "coordinator URL, for workers")
+	seed := flag.String("seed", "", "seed URL, for the coordinator")
+	output := flag.String("output", "", "audit output directory, for the coordinator")
+	spawn := flag.Int("spawn", 0, "worker processes started by the coordinator")
+	resume := flag.Bool("resume", false, "continue the crawl checkpointed in -output, for the coordinator")
+	id := flag.String("id", "", "worker ID, defaults to host and PID")
+	replay := flag.String("replay", "", "WARC archive to replay the crawl from instead of the network")
+	token := flag.String("token", os.Getenv("CRAWLER_TOKEN"), "shared secret between the coordinator and its workers")
+	flag.Parse()
+
+	cfg, err := config.LoadCrawlerConfig(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load crawler config: %v", err)
+	}
+	if *replay != "" {
+		cfg.Archive.Replay = *replay
+	}
+	if *token != "" {
+		cfg.Distributed.Token = *token
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	switch *mode {
+	case "coordinator":
+		if *resume && *output == "" {
+			log.Fatal("-resume requires -output")
+		}
+		if *seed == "" && !*resume {
+			log.Fatal("-seed is required")
+		}
+		err = runCoordinator(ctx, *cfg, *listen, *seed, *output, *resume, *spawn, *configPath)
+	case "worker":
+		workerID := *id
+		if workerID == "" {
+			host, _ := os.Hostname()
+			workerID = host + "-" + strconv.Itoa(os.Getpid())
+		}
+		err = crawler.NewWorker(workerID, *coordinator, *cfg).Run(ctx)
+	default:
+		err = fmt.Errorf("unknown mode %q", *mode)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func runCoordinator(ctx context.Context, cfg config.CrawlerConfig, listen, seed, output string, resume bool, spawn int, configPath string) error {
+	if cfg.Distributed.Token == "" && !isLoopback(listen) {
+		return fmt.Errorf("listening on %s requires a -token shared with the workers", listen)
+	}
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		return err
+	}
+	coordinator := crawler.NewCoordinator(cfg)
+	server := &http.Server{Handler: coordinator.Handler()}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Coordinator server stopped: %v", err)
+		}
+	}()
+	log.Printf("Coordinator listening on %s", listener.Addr())
+
+	workers, err := spawnWorkers(spawn, "http://"+listener.Addr().String(), configPath, cfg.Archive.Replay, cfg.Distributed.Token)
+	if err != nil {
+		return err
+	}
+
+	var result *crawler.CrawlResult
+	var crawlErr error
+	if resume {
+		result, crawlErr = coordinator.Resume(ctx, output)
+	} else {
+		result, crawlErr = coordinator.Crawl(ctx, seed, output)
+	}
+
+	// Let the workers learn the crawl is over before the server goes away
+	drainCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	coordinator.Drain(drainCtx)
+	cancel()
+	_ = server.Close()
+	for _, worker := range workers {
+		_ = worker.Wait()
+	}
+
+	if crawlErr != nil {
+		return crawlErr
+	}
+	log.Printf("Crawl finished: %d pages in %d ms", result.Metadata.TotalPages, result.Metadata.DurationMs)
+	return nil
+}
+
+// isLoopback reports whether a listen address only accepts local
+// connections. An empty host listens on every interface.
+func isLoopback(listen string) bool {
+	host, _, err := net.SplitHostPort(listen)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// spawnWorkers starts worker processes running this binary. The token is
+// passed in their environment rather than on the command line, where other
+// users could read it.
+func spawnWorkers(n int, coordinatorURL, configPath, replay, token string) ([]*exec.Cmd, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	workers := make([]*exec.Cmd, 0, n)
+	for i := 0; i < n; i++ {
+		args := []string{"-mode", "worker", "-coordinator", coordinatorURL,
+			"-config", configPath, "-id", "worker-" + strconv.Itoa(i+1)}
+		if replay != "" {
+			args = append(args, "-replay", replay)
+		}
+		cmd := exec.Command(self, args...)
+		cmd.Env = append(os.Environ(), "CRAWLER_TOKEN="+token)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Start(); err != nil {
+			return workers, fmt.Errorf("failed to start worker %d: %w", i+1, err)
+		}
+		workers = append(workers, cmd)
+	}
+	return workers, nil
+}
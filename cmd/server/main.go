@@ -13,8 +13,11 @@ import (
 	"time"
 
 	v2 "firesalamander/internal/orchestrator"
+	"firesalamander/internal/config"
 	"firesalamander/internal/agents"
 	"firesalamander/internal/agents/broken"
+	"firesalamander/internal/agents/duplicate"
+	"firesalamander/internal/agents/international"
 	"firesalamander/internal/agents/keyword"
 	"firesalamander/internal/agents/linking" 
 	"firesalamander/internal/agents/technical"
@@ -153,6 +156,13 @@ func setupServer() *http.ServeMux {
 func registerAgents() {
 	log.Println("Registering agents...")
 	
+	// Audit thresholds come from tech_rules.yaml, or the shipped defaults
+	rules := config.DefaultTechRules()
+	if loaded, err := config.LoadTechRules(filepath.Join("config", "tech_rules.yaml")); err == nil {
+		rules = *loaded
+	} else {
+		log.Printf("Warning: %v, using the default audit thresholds", err)
+	}
 	
 	// Create agent instances - Sprint 3 complet avec agents sémantiques
 	agentList := []struct {
@@ -163,6 +173,8 @@ func registerAgents() {
 		{"keyword", keyword.NewKeywordExtractor()},
 		{"linking", linking.NewLinkingMapper()},
 		{"broken_links", broken.NewBrokenLinksDetector()},
+		{"international", international.NewInternationalAuditor()},
+		{"duplicate", duplicate.NewDuplicateDetectorWithThreshold(rules.Duplicates.SimilarityThreshold)},
 		{"page_profiler", page_profiler.NewPageProfiler()},
 		{"topic_clusterer", topic.NewTopicClusterer()},
 		{"semantic_recommender", recommender.NewSemanticRecommender()},
@@ -2,12 +2,14 @@ package broken
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"sync"
 	"time"
 
 	"firesalamander/internal/agents"
+	"firesalamander/internal/agents/crawler"
 	"firesalamander/internal/constants"
 )
 
@@ -124,9 +126,14 @@ func (b *BrokenLinksDetector) CheckLinks(urls []string) (*agents.BrokenLinksRepo
 
 	// Collecter les résultats
 	var brokenLinks []agents.BrokenLink
+	var uncheckedLinks []string
 	totalChecked := 0
 
 	for result := range resultChan {
+		if result.Unchecked {
+			uncheckedLinks = append(uncheckedLinks, result.URL)
+			continue
+		}
 		totalChecked++
 		if !result.IsValid {
 			brokenLinks = append(brokenLinks, agents.BrokenLink{
@@ -141,8 +148,9 @@ func (b *BrokenLinksDetector) CheckLinks(urls []string) (*agents.BrokenLinksRepo
 	return &agents.BrokenLinksReport{
 		TotalChecked: totalChecked,
 		BrokenCount:  len(brokenLinks),
-		BrokenLinks:  brokenLinks,
-		CheckedAt:    time.Now().Format(time.RFC3339),
+		BrokenLinks:    brokenLinks,
+		UncheckedLinks: uncheckedLinks,
+		CheckedAt:      time.Now().Format(time.RFC3339),
 	}, nil
 }
 
@@ -174,6 +182,16 @@ func (b *BrokenLinksDetector) ValidateLink(url string) (*agents.LinkStatus, erro
 
 	// Effectuer la requête
 	resp, err := b.client.Do(req)
+	if errors.Is(err, crawler.ErrNotArchived) {
+		// Un audit rejoué ne connaît que les pages crawlées : un lien absent
+		// de l'archive n'est pas vérifié, il n'est pas brisé pour autant
+		return &agents.LinkStatus{
+			URL:       url,
+			Unchecked: true,
+			Error:     fmt.Sprintf("not checked: %v", err),
+			CheckedAt: time.Now().Format(time.RFC3339),
+		}, nil
+	}
 	if err != nil {
 		return &agents.LinkStatus{
 			URL:        url,
@@ -206,6 +224,7 @@ type linkCheckResult struct {
 	URL        string
 	StatusCode int
 	IsValid    bool
+	Unchecked  bool
 	Error      string
 }
 
@@ -220,6 +239,7 @@ func (b *BrokenLinksDetector) worker(wg *sync.WaitGroup, urlChan <-chan string,
 			URL:        status.URL,
 			StatusCode: status.StatusCode,
 			IsValid:    status.IsValid,
+			Unchecked:  status.Unchecked,
 			Error:      status.Error,
 		}
 		
@@ -260,6 +280,12 @@ func (b *BrokenLinksDetector) SetTimeout(timeout time.Duration) {
 	}
 }
 
+// SetTransport remplace le transport HTTP, par exemple par un
+// crawler.WARCReplay pour rejouer un audit hors ligne
+func (b *BrokenLinksDetector) SetTransport(transport http.RoundTripper) {
+	b.client.Transport = transport
+}
+
 // GetStats retourne des statistiques sur la configuration actuelle
 func (b *BrokenLinksDetector) GetStats() map[string]interface{} {
 	return map[string]interface{}{
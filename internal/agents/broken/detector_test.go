@@ -5,9 +5,12 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"firesalamander/internal/agents/crawler"
+	"firesalamander/internal/config"
 	"firesalamander/internal/constants"
 )
 
@@ -407,4 +410,99 @@ func TestBrokenLinksDetector_HealthCheck(t *testing.T) {
 	if err != nil {
 		t.Logf("HealthCheck failed (may be expected in test environment): %v", err)
 	}
-}
\ No newline at end of file
+}
+
+func TestBrokenLinksDetector_ReplaysWARC(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><body><a href="/missing">Lien mort</a></body></html>`)
+	}))
+
+	// Crawl une fois en archivant, puis rejoue sans réseau
+	dir := t.TempDir()
+	recorder := crawler.NewCrawler(config.CrawlerConfig{
+		UserAgent:   "Test-Bot/1.0",
+		Limits:      config.Limits{MaxURLs: 10, MaxDepth: 2},
+		Performance: config.Performance{ConcurrentRequests: 1, RequestTimeout: 5 * time.Second},
+		Archive:     config.Archive{WARC: true},
+	})
+	if _, err := recorder.Crawl(context.Background(), server.URL+"/", dir); err != nil {
+		t.Fatalf("Crawl failed: %v", err)
+	}
+	server.Close()
+
+	replay, err := crawler.NewWARCReplay(filepath.Join(dir, crawler.WARCFileName))
+	if err != nil {
+		t.Fatalf("NewWARCReplay failed: %v", err)
+	}
+	defer replay.Close()
+
+	detector := NewBrokenLinksDetector()
+	detector.SetTransport(replay)
+	report, err := detector.CheckLinks([]string{server.URL + "/", server.URL + "/missing"})
+	if err != nil {
+		t.Fatalf("CheckLinks failed: %v", err)
+	}
+	if report.BrokenCount != 1 || report.BrokenLinks[0].URL != server.URL+"/missing" || report.BrokenLinks[0].StatusCode != http.StatusNotFound {
+		t.Errorf("Expected only /missing broken with HTTP 404, got %+v", report.BrokenLinks)
+	}
+}
+
+func TestBrokenLinksDetector_ReplayLeavesExternalLinksUnchecked(t *testing.T) {
+	external := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer external.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<html><body><a href="%s/partenaire">Partenaire</a></body></html>`, external.URL)
+	}))
+
+	// Le crawler n'archive que les pages du site, pas le lien externe
+	dir := t.TempDir()
+	recorder := crawler.NewCrawler(config.CrawlerConfig{
+		UserAgent:   "Test-Bot/1.0",
+		Limits:      config.Limits{MaxURLs: 10, MaxDepth: 2},
+		Performance: config.Performance{ConcurrentRequests: 1, RequestTimeout: 5 * time.Second},
+		Archive:     config.Archive{WARC: true},
+	})
+	if _, err := recorder.Crawl(context.Background(), server.URL+"/", dir); err != nil {
+		t.Fatalf("Crawl failed: %v", err)
+	}
+	server.Close()
+
+	replay, err := crawler.NewWARCReplay(filepath.Join(dir, crawler.WARCFileName))
+	if err != nil {
+		t.Fatalf("NewWARCReplay failed: %v", err)
+	}
+	defer replay.Close()
+
+	detector := NewBrokenLinksDetector()
+	detector.SetTransport(replay)
+	link := external.URL + "/partenaire"
+	report, err := detector.CheckLinks([]string{server.URL + "/", link})
+	if err != nil {
+		t.Fatalf("CheckLinks failed: %v", err)
+	}
+	if report.BrokenCount != 0 {
+		t.Errorf("Expected no broken link, got %+v", report.BrokenLinks)
+	}
+	if report.TotalChecked != 1 {
+		t.Errorf("Expected 1 checked link, got %d", report.TotalChecked)
+	}
+	if len(report.UncheckedLinks) != 1 || report.UncheckedLinks[0] != link {
+		t.Errorf("Expected %s unchecked, got %v", link, report.UncheckedLinks)
+	}
+
+	status, err := detector.ValidateLink(link)
+	if err != nil {
+		t.Fatalf("ValidateLink failed: %v", err)
+	}
+	if !status.Unchecked || status.IsValid {
+		t.Errorf("Expected an unchecked link, got %+v", status)
+	}
+}
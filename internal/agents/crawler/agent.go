@@ -27,7 +27,7 @@ func (c *Crawler) Process(ctx context.Context, data interface{}) (*agents.AgentR
 	}
 
 	// Perform the crawling operation
-	crawlResult, err := c.Crawl(ctx, request.SeedURL, request.OutputDir)
+	crawlResult, err := c.Execute(ctx, *request)
 	
 	// Create agent result even if crawling had issues
 	agentResult := &agents.AgentResult{
@@ -38,6 +38,9 @@ func (c *Crawler) Process(ctx context.Context, data interface{}) (*agents.AgentR
 		},
 		Duration: time.Since(startTime).Milliseconds(),
 	}
+	if crawlResult != nil {
+		agentResult.Data["redirect_report"] = c.AuditRedirects(crawlResult)
+	}
 
 	if err != nil {
 		// If there was an error but we got some results, mark as partial success
@@ -93,8 +96,8 @@ func (c *Crawler) parseInput(data interface{}) (*CrawlRequest, error) {
 		return nil, fmt.Errorf("expected CrawlRequest, got %T", data)
 	}
 
-	if request.SeedURL == "" {
-		return nil, fmt.Errorf("seed URL is required")
+	if request.SeedURL == "" && !request.IsList() {
+		return nil, fmt.Errorf("seed URL or URL list is required")
 	}
 
 	return &request, nil
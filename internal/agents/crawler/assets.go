@@ -0,0 +1,311 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/html"
+)
+
+// Asset types
+const (
+	AssetImage      = "image"
+	AssetStylesheet = "stylesheet"
+	AssetScript     = "script"
+	AssetPDF        = "pdf"
+)
+
+// Default asset pass limits, used when the configuration leaves them at zero
+const (
+	defaultMaxAssets     = 5000
+	defaultMaxAssetBytes = 10 << 20
+)
+
+// AssetRef is a resource referenced by a page
+type AssetRef struct {
+	Type string `json:"type"`
+	Href string `json:"href"`
+	// URL is the absolute URL of the asset, set by the asset pass
+	URL string `json:"url,omitempty"`
+}
+
+// Asset is a resource referenced by crawled pages, checked once the crawl is
+// over with HEAD, or GET when HEAD is refused or gives no size
+type Asset struct {
+	URL         string `json:"url"`
+	Type        string `json:"type"`
+	FinalURL    string `json:"final_url,omitempty"`
+	StatusCode  int    `json:"status_code"`
+	ContentType string `json:"content_type,omitempty"`
+	// Size is the uncompressed size in bytes, -1 when unknown. Truncated
+	// means the download hit the byte cap, so the asset is at least that big.
+	Size         int64  `json:"size"`
+	Truncated    bool   `json:"truncated,omitempty"`
+	CacheControl string `json:"cache_control,omitempty"`
+	Expires      string `json:"expires,omitempty"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	Error        string `json:"error,omitempty"`
+	// Pages lists the crawled pages using the asset
+	Pages []string `json:"pages"`
+}
+
+// Broken reports whether the asset could not be loaded
+func (a Asset) Broken() bool {
+	return a.Error != "" || a.StatusCode >= 400
+}
+
+// assetRefs returns the assets an element references: images and their
+// srcset candidates, stylesheets, external scripts and links to PDFs
+func assetRefs(n *html.Node) []AssetRef {
+	var refs []AssetRef
+	add := func(assetType, href string) {
+		if href = strings.TrimSpace(href); href != "" && !strings.HasPrefix(href, "data:") {
+			refs = append(refs, AssetRef{Type: assetType, Href: href})
+		}
+	}
+
+	switch n.Data {
+	case "img":
+		add(AssetImage, attribute(n, "src"))
+		add(AssetImage, attribute(n, "data-src"))
+		for _, candidate := range srcsetURLs(attribute(n, "srcset")) {
+			add(AssetImage, candidate)
+		}
+	case "source":
+		// Only <picture> sources are images, <video> and <audio> ones are media
+		if n.Parent != nil && n.Parent.Data == "picture" {
+			for _, candidate := range srcsetURLs(attribute(n, "srcset")) {
+				add(AssetImage, candidate)
+			}
+		}
+	case "link":
+		if hasRel(attribute(n, "rel"), "stylesheet") {
+			add(AssetStylesheet, attribute(n, "href"))
+		}
+	case "script":
+		add(AssetScript, attribute(n, "src"))
+	case "a":
+		href := attribute(n, "href")
+		if u, err := url.Parse(strings.TrimSpace(href)); err == nil && strings.EqualFold(path.Ext(u.Path), ".pdf") {
+			add(AssetPDF, href)
+		}
+	}
+	return refs
+}
+
+// srcsetURLs returns the URLs of the candidates of a srcset attribute, such
+// as "hero-480.jpg 480w, hero-960.jpg 960w"
+func srcsetURLs(srcset string) []string {
+	var urls []string
+	for _, candidate := range strings.Split(srcset, ",") {
+		if fields := strings.Fields(candidate); len(fields) > 0 {
+			urls = append(urls, fields[0])
+		}
+	}
+	return urls
+}
+
+// addAsset records an asset reference once per page
+func (p *PageData) addAsset(ref AssetRef) {
+	for _, existing := range p.Assets {
+		if existing.Href == ref.Href {
+			return
+		}
+	}
+	p.Assets = append(p.Assets, ref)
+}
+
+// checkAssets resolves the assets referenced by the crawled pages, links
+// each one to the pages using it and fetches them with the crawl workers.
+// A budget running out stops the pass, including the fetches under way.
+func (c *Crawler) checkAssets(ctx context.Context) []Asset {
+	maxAssets := positiveOr(c.Config.Assets.MaxAssets, defaultMaxAssets)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	c.mutex.Lock()
+	if c.stoppedBy != "" {
+		cancel()
+	}
+	c.stopAssets = cancel
+	defer func() {
+		c.mutex.Lock()
+		c.stopAssets = nil
+		c.mutex.Unlock()
+	}()
+	index := make(map[string]int)
+	assets := make([]Asset, 0)
+	collect := func(page *PageData) {
+		c.resolveAssetRefs(page)
+		for _, ref := range page.Assets {
+			if ref.URL == "" {
+				continue
+			}
+			k, ok := index[ref.URL]
+			if !ok {
+				if len(assets) >= maxAssets {
+					continue
+				}
+				k = len(assets)
+				index[ref.URL] = k
+				assets = append(assets, Asset{URL: ref.URL, Type: ref.Type, Size: -1, Pages: make([]string, 0, 1)})
+			}
+			// Two references of a page may resolve to the same asset
+			if pages := assets[k].Pages; len(pages) == 0 || pages[len(pages)-1] != page.URL {
+				assets[k].Pages = append(assets[k].Pages, page.URL)
+			}
+		}
+	}
+	// Lean pages are read back from pages.jsonl
+	if c.leanPages() && c.pages != nil {
+		if err := c.pages.each(func(page PageData) { collect(&page) }); err != nil {
+			fmt.Printf("Warning: failed to read the streamed pages for assets: %v\n", err)
+		}
+	} else {
+		for i := range c.Results {
+			collect(&c.Results[i])
+		}
+	}
+	c.mutex.Unlock()
+
+	workers := c.Config.Performance.ConcurrentRequests
+	if workers < 1 {
+		workers = 1
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := range jobs {
+				c.fetchAsset(ctx, &assets[k])
+			}
+		}()
+	}
+	for k := range assets {
+		if ctx.Err() != nil {
+			break
+		}
+		jobs <- k
+	}
+	close(jobs)
+	wg.Wait()
+
+	return assets
+}
+
+// resolveAssetRefs sets the URL of the asset references of page
+func (c *Crawler) resolveAssetRefs(page *PageData) {
+	base := page.FinalURL
+	if base == "" {
+		base = page.URL
+	}
+	for j := range page.Assets {
+		page.Assets[j].URL = assetURL(base, page.Assets[j].Href)
+	}
+}
+
+// fetchAsset checks an asset with HEAD, falling back to a GET capped to
+// MaxBytes when the server refuses HEAD or does not give the size
+func (c *Crawler) fetchAsset(ctx context.Context, asset *Asset) {
+	if c.Config.Respect.RobotsTxt {
+		rules, _ := c.robotsFor(ctx, asset.URL)
+		if allowed, rule := rules.Allowed(c.Config.UserAgent, asset.URL); !allowed {
+			asset.Error = "blocked by robots.txt rule " + rule
+			return
+		}
+	}
+
+	head, err := c.requestAsset(ctx, http.MethodHead, asset.URL)
+	if err == nil {
+		_ = head.Body.Close()
+		refused := head.StatusCode == http.StatusMethodNotAllowed || head.StatusCode == http.StatusNotImplemented
+		if !refused && (head.StatusCode != http.StatusOK || head.ContentLength >= 0) {
+			recordAsset(asset, head, head.ContentLength, false)
+			return
+		}
+	}
+
+	resp, err := c.requestAsset(ctx, http.MethodGet, asset.URL)
+	if err != nil {
+		asset.Error = err.Error()
+		return
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	maxBytes := int64(positiveOr(int(c.Config.Assets.MaxBytes), defaultMaxAssetBytes))
+	read, err := io.Copy(io.Discard, io.LimitReader(resp.Body, maxBytes+1))
+	c.mutex.Lock()
+	c.countBytes(read)
+	c.mutex.Unlock()
+	switch {
+	case resp.ContentLength >= 0:
+		recordAsset(asset, resp, resp.ContentLength, false)
+	case read > maxBytes:
+		recordAsset(asset, resp, maxBytes, true)
+	case err != nil:
+		recordAsset(asset, resp, -1, false)
+		asset.Error = "failed to read asset: " + err.Error()
+	default:
+		recordAsset(asset, resp, read, false)
+	}
+}
+
+// requestAsset sends one request for an asset, waiting for the host's turn
+func (c *Crawler) requestAsset(ctx context.Context, method, assetURL string) (*http.Response, error) {
+	req, err := c.newRequest(ctx, method, assetURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	host := hostOf(assetURL)
+	if err := c.politeness.Wait(ctx, host); err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Do(req)
+	if err == nil && isThrottled(resp.StatusCode) {
+		c.politeness.Backoff(host, parseRetryAfter(resp.Header.Get("Retry-After")))
+	}
+	return resp, err
+}
+
+func recordAsset(asset *Asset, resp *http.Response, size int64, truncated bool) {
+	asset.StatusCode = resp.StatusCode
+	asset.ContentType = resp.Header.Get("Content-Type")
+	asset.Size = size
+	asset.Truncated = truncated
+	asset.CacheControl = resp.Header.Get("Cache-Control")
+	asset.Expires = resp.Header.Get("Expires")
+	asset.ETag = resp.Header.Get("ETag")
+	asset.LastModified = resp.Header.Get("Last-Modified")
+	if final := resp.Request.URL.String(); final != asset.URL {
+		asset.FinalURL = final
+	}
+}
+
+// assetURL resolves an asset reference against its page. Assets may live on
+// any host, such as a CDN, but only HTTP(S) ones are checked.
+func assetURL(base, href string) string {
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return ""
+	}
+	ref, err := url.Parse(href)
+	if err != nil {
+		return ""
+	}
+	resolved := baseURL.ResolveReference(ref)
+	if resolved.Scheme != "http" && resolved.Scheme != "https" {
+		return ""
+	}
+	resolved.Fragment = ""
+	return resolved.String()
+}
@@ -0,0 +1,147 @@
+package crawler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	appconfig "firesalamander/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractContentAssets(t *testing.T) {
+	page, err := ExtractContent("https://example.com/", `<html><head>
+		<link rel="stylesheet" href="/style.css">
+		<link rel="icon" href="/favicon.ico">
+		<script src="/app.js"></script>
+		<script>inline()</script>
+	</head><body>
+		<img src="/hero.jpg" srcset="/hero-480.jpg 480w, /hero.jpg 960w">
+		<img src="data:image/png;base64,AAAA">
+		<picture><source srcset="/hero.webp 1x, /hero@2x.webp 2x"><img src="/hero.jpg"></picture>
+		<video><source src="/clip.mp4"></video>
+		<a href="/docs/guide.PDF?v=2">Guide</a>
+		<a href="/about">About</a>
+	</body></html>`, 0)
+	require.NoError(t, err)
+
+	assert.Equal(t, []AssetRef{
+		{Type: AssetStylesheet, Href: "/style.css"},
+		{Type: AssetScript, Href: "/app.js"},
+		{Type: AssetImage, Href: "/hero.jpg"},
+		{Type: AssetImage, Href: "/hero-480.jpg"},
+		{Type: AssetImage, Href: "/hero.webp"},
+		{Type: AssetImage, Href: "/hero@2x.webp"},
+		{Type: AssetPDF, Href: "/docs/guide.PDF?v=2"},
+	}, page.Assets)
+}
+
+func TestCrawlChecksAssets(t *testing.T) {
+	pdf := strings.Repeat("%", 2000)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(`<html><head><link rel="stylesheet" href="/missing.css"><script src="/app.js"></script></head>
+			<body><img src="/hero.jpg"><a href="/about">About</a><a href="/guide.pdf">Guide</a></body></html>`))
+	})
+	mux.HandleFunc("/about", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(`<html><body><img src="hero.jpg#top"></body></html>`))
+	})
+	mux.HandleFunc("/hero.jpg", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Header().Set("Content-Length", "3145728")
+		w.Header().Set("Cache-Control", "max-age=86400")
+		w.Header().Set("ETag", `"hero"`)
+		if r.Method != http.MethodHead {
+			t.Errorf("hero.jpg fetched with %s, HEAD gives its size", r.Method)
+		}
+	})
+	mux.HandleFunc("/app.js", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/javascript")
+		_, _ = w.Write([]byte("console.log('salamandre')"))
+	})
+	mux.HandleFunc("/guide.pdf", func(w http.ResponseWriter, r *http.Request) {
+		// Flushing first makes the response chunked, without a size
+		w.Header().Set("Content-Type", "application/pdf")
+		w.(http.Flusher).Flush()
+		if r.Method != http.MethodHead {
+			_, _ = w.Write([]byte(pdf))
+		}
+	})
+	mux.HandleFunc("/missing.css", http.NotFound)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	crawler := newTestCrawler(func(cfg *appconfig.CrawlerConfig) {
+		cfg.Limits = appconfig.Limits{MaxURLs: 10, MaxDepth: 3}
+		cfg.Performance.ConcurrentRequests = 2
+		cfg.Assets.MaxBytes = 1000
+	})
+	result, err := crawler.Crawl(context.Background(), server.URL+"/", "")
+	require.NoError(t, err)
+
+	assets := make(map[string]Asset)
+	for _, asset := range result.Assets {
+		assets[strings.TrimPrefix(asset.URL, server.URL)] = asset
+	}
+	require.Len(t, assets, 4)
+
+	hero := assets["/hero.jpg"]
+	assert.Equal(t, AssetImage, hero.Type)
+	assert.Equal(t, http.StatusOK, hero.StatusCode)
+	assert.Equal(t, int64(3145728), hero.Size)
+	assert.Equal(t, "max-age=86400", hero.CacheControl)
+	assert.Equal(t, `"hero"`, hero.ETag)
+	assert.ElementsMatch(t, []string{server.URL + "/", server.URL + "/about"}, hero.Pages)
+
+	script := assets["/app.js"]
+	assert.Equal(t, http.StatusOK, script.StatusCode)
+	assert.Equal(t, int64(len("console.log('salamandre')")), script.Size)
+	assert.False(t, script.Broken())
+
+	guide := assets["/guide.pdf"]
+	assert.Equal(t, AssetPDF, guide.Type)
+	assert.Equal(t, int64(1000), guide.Size)
+	assert.True(t, guide.Truncated)
+
+	missing := assets["/missing.css"]
+	assert.Equal(t, AssetStylesheet, missing.Type)
+	assert.Equal(t, http.StatusNotFound, missing.StatusCode)
+	assert.True(t, missing.Broken())
+
+	for _, page := range result.Pages {
+		for _, ref := range page.Assets {
+			assert.True(t, strings.HasPrefix(ref.URL, server.URL), "asset %s of %s not resolved", ref.Href, page.URL)
+		}
+	}
+}
+
+func TestCrawlWithoutAssetPass(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			t.Errorf("unexpected request for %s", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(`<html><body><img src="/hero.jpg"></body></html>`))
+	}))
+	defer server.Close()
+
+	crawler := newTestCrawler(func(cfg *appconfig.CrawlerConfig) {
+		cfg.Limits = appconfig.Limits{MaxURLs: 10, MaxDepth: 3}
+		cfg.Assets.Disabled = true
+	})
+	result, err := crawler.Crawl(context.Background(), server.URL+"/", "")
+	require.NoError(t, err)
+
+	assert.Empty(t, result.Assets)
+	require.Len(t, result.Pages, 1)
+	assert.Len(t, result.Pages[0].Assets, 1)
+}
@@ -0,0 +1,276 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// maxLoginPageSize bounds the login page read to collect hidden form fields
+const maxLoginPageSize = 1 << 20
+
+// newTransport returns the transport of the crawler's client. Host overrides
+// only change the address dialed: the Host header and TLS server name stay
+// those of the URL, as with curl --resolve.
+func newTransport(overrides map[string]string) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if len(overrides) == 0 {
+		return transport
+	}
+
+	addresses := make(map[string]string, len(overrides))
+	for host, address := range overrides {
+		addresses[strings.ToLower(host)] = address
+	}
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if host, port, err := net.SplitHostPort(addr); err == nil {
+			if address, ok := addresses[strings.ToLower(host)]; ok {
+				addr = address
+				if _, _, err := net.SplitHostPort(address); err != nil {
+					addr = net.JoinHostPort(address, port)
+				}
+			}
+		}
+		return dialer.DialContext(ctx, network, addr)
+	}
+	return transport
+}
+
+// newRequest builds a request carrying the crawler's user agent and, for
+// hosts in the crawl scope, its credentials and custom headers
+func (c *Crawler) newRequest(ctx context.Context, method, target string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", c.Config.UserAgent)
+
+	if !c.sendsCredentials(req.URL) {
+		return req, nil
+	}
+	auth := c.Config.Auth
+	for key, value := range auth.Headers {
+		req.Header.Set(key, value)
+	}
+	if auth.BasicUser != "" || auth.BasicPassword != "" {
+		req.SetBasicAuth(auth.BasicUser, auth.BasicPassword)
+	}
+	return req, nil
+}
+
+// sendsCredentials keeps credentials away from third-party hosts, such as a
+// sitemap served from a CDN
+func (c *Crawler) sendsCredentials(u *url.URL) bool {
+	if c.seedURL == "" {
+		return true
+	}
+	normalized, err := url.Parse(c.normalizer.Normalize(u.String()))
+	if err != nil {
+		return false
+	}
+	return c.inScope(normalized.Host)
+}
+
+// checkRedirect is the client's CheckRedirect. The client copies the headers
+// of the first request onto every hop, so a hop leaving the configured hosts
+// has the credentials and custom headers removed.
+func (c *Crawler) checkRedirect(req *http.Request, via []*http.Request) error {
+	if err := checkRedirect(req, via); err != nil {
+		return err
+	}
+	if !c.sendsCredentials(req.URL) {
+		for key := range c.Config.Auth.Headers {
+			req.Header.Del(key)
+		}
+		req.Header.Del("Authorization")
+	}
+	return nil
+}
+
+// startSession gives the crawl a fresh cookie jar holding the configured
+// cookies, shared with the subdomains in scope, then runs the form login if
+// one is configured
+func (c *Crawler) startSession(ctx context.Context) error {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return err
+	}
+	c.client.Jar = jar
+
+	seed, err := url.Parse(c.seedURL)
+	if err != nil {
+		return fmt.Errorf("invalid seed URL %q: %w", c.seedURL, err)
+	}
+	if c.Config.Scope.IncludeSubdomains {
+		c.client.Jar = c.newSessionJar(jar, seed)
+	}
+	if len(c.Config.Auth.Cookies) > 0 {
+		cookies := make([]*http.Cookie, 0, len(c.Config.Auth.Cookies))
+		for name, value := range c.Config.Auth.Cookies {
+			cookies = append(cookies, &http.Cookie{Name: name, Value: value, Path: "/"})
+		}
+		jar.SetCookies(seed, cookies)
+	}
+
+	if c.Config.Auth.Login.URL == "" {
+		return nil
+	}
+	if err := c.login(ctx); err != nil {
+		return fmt.Errorf("login failed: %w", err)
+	}
+	return nil
+}
+
+// sessionJar hands the cookies of the seed's host, and of the login form's
+// when it is in scope, to every other host in the crawl scope. Session
+// cookies are mostly host-only, so a crawl including subdomains would
+// otherwise browse them logged out.
+type sessionJar struct {
+	http.CookieJar
+	crawler  *Crawler
+	sessions []*url.URL
+}
+
+func (c *Crawler) newSessionJar(jar http.CookieJar, seed *url.URL) *sessionJar {
+	sessions := []*url.URL{seed}
+	if login, err := url.Parse(c.Config.Auth.Login.URL); err == nil && login.Host != "" && !strings.EqualFold(login.Host, seed.Host) && c.sendsCredentials(login) {
+		sessions = append(sessions, login)
+	}
+	return &sessionJar{CookieJar: jar, crawler: c, sessions: sessions}
+}
+
+// Cookies returns the cookies of u, then those of the session hosts it does
+// not already have a cookie of that name for
+func (j *sessionJar) Cookies(u *url.URL) []*http.Cookie {
+	cookies := j.CookieJar.Cookies(u)
+	if !j.crawler.sendsCredentials(u) {
+		return cookies
+	}
+
+	names := make(map[string]bool, len(cookies))
+	for _, cookie := range cookies {
+		names[cookie.Name] = true
+	}
+	for _, session := range j.sessions {
+		if strings.EqualFold(session.Host, u.Host) {
+			continue
+		}
+		// Path and Secure still apply, as on the session host itself
+		for _, cookie := range j.CookieJar.Cookies(&url.URL{Scheme: u.Scheme, Host: session.Host, Path: u.Path}) {
+			if !names[cookie.Name] {
+				names[cookie.Name] = true
+				cookies = append(cookies, cookie)
+			}
+		}
+	}
+	return cookies
+}
+
+// login loads the login form, for its session cookie and hidden fields, then
+// posts the credentials. The session cookies land in the client's jar.
+func (c *Crawler) login(ctx context.Context) error {
+	login := c.Config.Auth.Login
+
+	req, err := c.newRequest(ctx, http.MethodGet, login.URL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	page, err := io.ReadAll(io.LimitReader(resp.Body, maxLoginPageSize))
+	_ = resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("HTTP %d for login page %s", resp.StatusCode, login.URL)
+	}
+
+	form := hiddenInputs(string(page))
+	for name, value := range login.Fields {
+		form.Set(name, value)
+	}
+
+	action := resp.Request.URL
+	if login.Action != "" {
+		if action, err = action.Parse(login.Action); err != nil {
+			return fmt.Errorf("invalid login action %q: %w", login.Action, err)
+		}
+	}
+
+	req, err = c.newRequest(ctx, http.MethodPost, action.String(), strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err = c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("HTTP %d for login form %s", resp.StatusCode, action)
+	}
+
+	if login.SuccessCookie != "" && !hasCookie(c.client.Jar, action, login.SuccessCookie) {
+		return fmt.Errorf("no %s cookie after login", login.SuccessCookie)
+	}
+	return nil
+}
+
+// hiddenInputs returns the hidden inputs of a page, which login forms use
+// for CSRF tokens
+func hiddenInputs(page string) url.Values {
+	values := make(url.Values)
+	doc, err := html.Parse(strings.NewReader(page))
+	if err != nil {
+		return values
+	}
+
+	var traverse func(*html.Node)
+	traverse = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "input" {
+			var name, value, inputType string
+			for _, attr := range n.Attr {
+				switch attr.Key {
+				case "name":
+					name = attr.Val
+				case "value":
+					value = attr.Val
+				case "type":
+					inputType = strings.ToLower(attr.Val)
+				}
+			}
+			if inputType == "hidden" && name != "" {
+				values.Set(name, value)
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			traverse(child)
+		}
+	}
+	traverse(doc)
+	return values
+}
+
+func hasCookie(jar http.CookieJar, u *url.URL, name string) bool {
+	for _, cookie := range jar.Cookies(u) {
+		if cookie.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,231 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	appconfig "firesalamander/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCrawlSendsBasicAuthHeadersAndCookies(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		cookie, err := r.Cookie("preview")
+		if !ok || user != "staging" || password != "s3cret" || r.Header.Get("X-Preview-Token") != "abc" || err != nil || cookie.Value != "1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `<html><head><title>Staging</title></head><body><a href="/next">Next</a></body></html>`)
+	}))
+	defer server.Close()
+
+	crawler := newTestCrawler(func(cfg *appconfig.CrawlerConfig) {
+		cfg.Limits = appconfig.Limits{MaxURLs: 10, MaxDepth: 2}
+		cfg.Auth = appconfig.Auth{
+			BasicUser:     "staging",
+			BasicPassword: "s3cret",
+			Headers:       map[string]string{"X-Preview-Token": "abc"},
+			Cookies:       map[string]string{"preview": "1"},
+		}
+	})
+
+	result, err := crawler.Crawl(context.Background(), server.URL, "")
+	require.NoError(t, err)
+	assert.Len(t, result.Pages, 2)
+}
+
+func TestCredentialsStayOnCrawledHosts(t *testing.T) {
+	crawler := newTestCrawler(func(cfg *appconfig.CrawlerConfig) {
+		cfg.Auth = appconfig.Auth{BasicUser: "u", BasicPassword: "p", Headers: map[string]string{"X-Token": "t"}}
+	})
+	crawler.seedURL = "https://staging.example.com/"
+
+	req, err := crawler.newRequest(context.Background(), "GET", "https://staging.example.com/sitemap.xml", nil)
+	require.NoError(t, err)
+	_, _, ok := req.BasicAuth()
+	assert.True(t, ok)
+	assert.Equal(t, "t", req.Header.Get("X-Token"))
+
+	req, err = crawler.newRequest(context.Background(), "GET", "https://cdn.example.net/sitemap.xml", nil)
+	require.NoError(t, err)
+	_, _, ok = req.BasicAuth()
+	assert.False(t, ok)
+	assert.Empty(t, req.Header.Get("X-Token"))
+	assert.Equal(t, "Test-Bot/1.0", req.Header.Get("User-Agent"))
+}
+
+func TestCredentialsDroppedOnRedirectOffHost(t *testing.T) {
+	var leaked []string
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Token") != "" || r.Header.Get("Authorization") != "" {
+			leaked = append(leaked, r.URL.Path)
+		}
+		fmt.Fprint(w, `<html><head><title>Elsewhere</title></head><body></body></html>`)
+	}))
+	defer other.Close()
+	otherURL, err := url.Parse(other.URL)
+	require.NoError(t, err)
+
+	// Both hosts share an address: only the hostname leaves the crawl scope
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://other.example.net:"+otherURL.Port()+"/landing", http.StatusFound)
+	}))
+	defer site.Close()
+
+	crawler := newTestCrawler(func(cfg *appconfig.CrawlerConfig) {
+		cfg.Auth = appconfig.Auth{BasicUser: "u", BasicPassword: "p", Headers: map[string]string{"X-Token": "t"}}
+		cfg.HostOverrides = map[string]string{"other.example.net": "127.0.0.1"}
+	})
+	_, err = crawler.Crawl(context.Background(), site.URL, "")
+	require.NoError(t, err)
+	assert.Empty(t, leaked)
+}
+
+// newLoginTestServer serves a login form protected by a CSRF token; pages
+// require the session cookie it sets
+func newLoginTestServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/login" && r.Method == http.MethodGet:
+			http.SetCookie(w, &http.Cookie{Name: "csrf", Value: "tok", Path: "/"})
+			fmt.Fprint(w, `<form method="post" action="/session">
+				<input type="hidden" name="csrf_token" value="tok">
+				<input name="user"><input type="password" name="password"></form>`)
+		case r.URL.Path == "/session" && r.Method == http.MethodPost:
+			csrf, err := r.Cookie("csrf")
+			if err != nil || csrf.Value != r.FormValue("csrf_token") || r.FormValue("user") != "admin" || r.FormValue("password") != "pw" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "ok", Path: "/"})
+			http.Redirect(w, r, "/", http.StatusFound)
+		default:
+			if session, err := r.Cookie("session"); err != nil || session.Value != "ok" {
+				http.Redirect(w, r, "/login", http.StatusFound)
+				return
+			}
+			fmt.Fprintf(w, `<html><head><title>%s</title></head><body><a href="/private">Private</a></body></html>`, r.URL.Path)
+		}
+	}))
+}
+
+func TestCrawlLogsInWithForm(t *testing.T) {
+	server := newLoginTestServer()
+	defer server.Close()
+
+	crawler := newTestCrawler(func(cfg *appconfig.CrawlerConfig) {
+		cfg.Limits = appconfig.Limits{MaxURLs: 10, MaxDepth: 2}
+		cfg.Auth.Login = appconfig.FormLogin{
+			URL:           server.URL + "/login",
+			Action:        "/session",
+			Fields:        map[string]string{"user": "admin", "password": "pw"},
+			SuccessCookie: "session",
+		}
+	})
+
+	result, err := crawler.Crawl(context.Background(), server.URL+"/", "")
+	require.NoError(t, err)
+
+	titles := make([]string, 0, len(result.Pages))
+	for _, page := range result.Pages {
+		titles = append(titles, page.Title)
+	}
+	assert.ElementsMatch(t, []string{"/", "/private"}, titles)
+}
+
+func TestLoginSessionSharedWithSubdomains(t *testing.T) {
+	var mu sync.Mutex
+	var loggedOut []string
+	var port string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/login":
+			fmt.Fprint(w, `<form method="post" action="/session"><input name="user"></form>`)
+		case r.URL.Path == "/session":
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "ok", Path: "/"})
+		default:
+			if session, err := r.Cookie("session"); err != nil || session.Value != "ok" {
+				mu.Lock()
+				loggedOut = append(loggedOut, r.Host+r.URL.Path)
+				mu.Unlock()
+			}
+			fmt.Fprintf(w, `<html><body><a href="http://blog.example.com:%s/post">Blog</a></body></html>`, port)
+		}
+	}))
+	defer server.Close()
+
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	port = serverURL.Port()
+
+	// The session cookie is set by example.com only
+	crawler := newTestCrawler(func(cfg *appconfig.CrawlerConfig) {
+		cfg.Limits = appconfig.Limits{MaxURLs: 10, MaxDepth: 2}
+		cfg.HostOverrides = map[string]string{"example.com": "127.0.0.1", "blog.example.com": "127.0.0.1"}
+		cfg.Scope.IncludeSubdomains = true
+		cfg.Auth.Login = appconfig.FormLogin{
+			URL:           "http://example.com:" + port + "/login",
+			Action:        "/session",
+			Fields:        map[string]string{"user": "admin"},
+			SuccessCookie: "session",
+		}
+	})
+
+	result, err := crawler.Crawl(context.Background(), "http://example.com:"+port+"/", "")
+	require.NoError(t, err)
+	assert.Len(t, result.Pages, 2)
+	assert.Empty(t, loggedOut)
+}
+
+func TestCrawlFailsOnRejectedLogin(t *testing.T) {
+	server := newLoginTestServer()
+	defer server.Close()
+
+	crawler := newTestCrawler(func(cfg *appconfig.CrawlerConfig) {
+		cfg.Auth.Login = appconfig.FormLogin{
+			URL:    server.URL + "/login",
+			Action: "/session",
+			Fields: map[string]string{"user": "admin", "password": "wrong"},
+		}
+	})
+
+	_, err := crawler.Crawl(context.Background(), server.URL+"/", "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "login failed")
+}
+
+func TestCrawlWithHostOverride(t *testing.T) {
+	var hosts []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hosts = append(hosts, r.Host)
+		fmt.Fprint(w, `<html><head><title>Staging</title></head><body></body></html>`)
+	}))
+	defer server.Close()
+
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	port := serverURL.Port()
+
+	// www.example.com resolves to the test server, which still sees the production hostname
+	crawler := newTestCrawler(func(cfg *appconfig.CrawlerConfig) {
+		cfg.HostOverrides = map[string]string{"WWW.example.com": "127.0.0.1"}
+	})
+	result, err := crawler.Crawl(context.Background(), "http://www.example.com:"+port+"/", "")
+	require.NoError(t, err)
+	require.Len(t, result.Pages, 1)
+	assert.Equal(t, "Staging", result.Pages[0].Title)
+	assert.True(t, strings.HasPrefix(hosts[0], "www.example.com:"))
+}
+
+func TestHiddenInputs(t *testing.T) {
+	values := hiddenInputs(`<form><input type="HIDDEN" name="token" value="x"><input name="user" value="u"></form>`)
+	assert.Equal(t, url.Values{"token": {"x"}}, values)
+}
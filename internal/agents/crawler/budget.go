@@ -0,0 +1,172 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"unicode/utf8"
+)
+
+// Budget names, as reported in Metadata.BudgetsExhausted
+const (
+	BudgetTotalBytes        = "max_total_bytes"
+	BudgetDuration          = "max_duration"
+	BudgetPagesPerDirectory = "max_pages_per_directory"
+)
+
+// defaultMaxBodyBytes caps a response when Budgets.MaxBodyBytes is zero, so
+// a single huge page cannot exhaust the memory of the crawler
+const defaultMaxBodyBytes = 10 << 20
+
+// maxBodyBytes is the size past which a response is truncated
+func (c *Crawler) maxBodyBytes() int64 {
+	if c.Config.Budgets.MaxBodyBytes > 0 {
+		return c.Config.Budgets.MaxBodyBytes
+	}
+	return defaultMaxBodyBytes
+}
+
+// readBody reads at most max bytes of a response body and reports whether
+// there was more. A truncated body is cut back to where it is still well
+// formed, see cutBody.
+func readBody(body io.Reader, max int64) ([]byte, bool, error) {
+	data, err := io.ReadAll(io.LimitReader(body, max+1))
+	if int64(len(data)) > max {
+		return cutBody(data[:max]), true, err
+	}
+	return data, false, err
+}
+
+// cutBody drops the tag and the UTF-8 sequence a truncation left unfinished,
+// so a cut <meta charset> is not read as a declaration and a cut character
+// does not make a UTF-8 page look like windows-1252. Other multi-byte
+// charsets drop their cut character once decoded.
+func cutBody(data []byte) []byte {
+	if i := bytes.LastIndexByte(data, '<'); i >= 0 && bytes.IndexByte(data[i:], '>') < 0 {
+		data = data[:i]
+	}
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				data = data[:i]
+			}
+			break
+		}
+	}
+	return data
+}
+
+// resetBudgets starts the budget accounting of a run. Pages restored from
+// a checkpoint count against their directory. Caller holds c.mutex.
+func (c *Crawler) resetBudgets() {
+	c.budgetsExhausted = nil
+	c.stoppedBy = ""
+	c.directoryPages = make(map[string]int)
+	for _, page := range c.Results {
+		c.directoryPages[pageDirectory(page.URL)]++
+	}
+}
+
+// exhaust records a budget the crawl hit. Budgets other than the one per
+// directory stop the crawl: no task is dispatched anymore, and those in
+// flight complete unless the duration budget ended them. Caller holds
+// c.mutex.
+func (c *Crawler) exhaust(budget string) {
+	for _, hit := range c.budgetsExhausted {
+		if hit == budget {
+			return
+		}
+	}
+	c.budgetsExhausted = append(c.budgetsExhausted, budget)
+	if budget != BudgetPagesPerDirectory && c.stoppedBy == "" {
+		c.stoppedBy = budget
+		c.cond.Broadcast()
+		if c.stopAssets != nil {
+			c.stopAssets()
+		}
+	}
+}
+
+// stopped reports whether a budget stopped the crawl
+func (c *Crawler) stopped() bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.stoppedBy != ""
+}
+
+// countBytes adds bytes downloaded from the network, by pages or assets.
+// Caller holds c.mutex.
+func (c *Crawler) countBytes(n int64) {
+	c.bytesDownloaded += n
+	if max := c.Config.Budgets.MaxTotalBytes; max > 0 && c.bytesDownloaded >= max {
+		c.exhaust(BudgetTotalBytes)
+	}
+}
+
+// errDurationBudget ends the context of a crawl whose MaxDuration is spent
+var errDurationBudget = errors.New("duration budget exhausted")
+
+// startDurationBudget derives from ctx the context of a crawl, which ends
+// once MaxDuration is spent, counting the time before a resume. Fetches in
+// flight and their retry waits end with it, and the crawl stops. The
+// returned function releases the context.
+func (c *Crawler) startDurationBudget(ctx context.Context) (context.Context, func()) {
+	max := c.Config.Budgets.MaxDuration
+	if max <= 0 {
+		return context.WithCancel(ctx)
+	}
+	ctx, cancel := context.WithTimeoutCause(ctx, max-c.elapsed, errDurationBudget)
+	stop := context.AfterFunc(ctx, func() { c.checkDurationBudget(ctx) })
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// checkDurationBudget stops the crawl if ctx ended with its duration budget
+func (c *Crawler) checkDurationBudget(ctx context.Context) {
+	if !errors.Is(context.Cause(ctx), errDurationBudget) {
+		return
+	}
+	c.mutex.Lock()
+	c.exhaust(BudgetDuration)
+	c.mutex.Unlock()
+}
+
+// withinDirectoryBudget reports whether a task fits the per-directory
+// budget, counting the pages of its directory stored and in flight. Pages
+// over budget are recorded as excluded.
+func (c *Crawler) withinDirectoryBudget(task CrawlTask) bool {
+	max := c.Config.Budgets.MaxPagesPerDirectory
+	if max <= 0 || task.URL == c.seedURL {
+		return true
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	dir := pageDirectory(task.URL)
+	pages := c.directoryPages[dir]
+	for u := range c.inflight {
+		if u != task.URL && pageDirectory(u) == dir {
+			pages++
+		}
+	}
+	if pages < max {
+		return true
+	}
+	c.addExcluded(ExcludedURL{URL: task.URL, Rule: "budget: " + BudgetPagesPerDirectory})
+	c.exhaust(BudgetPagesPerDirectory)
+	return false
+}
+
+// pageDirectory is the directory a page counts against, as for the
+// sampling quota
+func pageDirectory(pageURL string) string {
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return "/"
+	}
+	return urlDirectory(u)
+}
@@ -0,0 +1,259 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	appconfig "firesalamander/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCrawlTruncatesLargeBodies(t *testing.T) {
+	big := `<html><head><title>Grosse page</title></head><body>` + strings.Repeat("<p>Salamandre</p>", 500) + `</body></html>`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/" {
+			_, _ = w.Write([]byte(`<html><head><title>Accueil</title></head><body><a href="/big">Big</a></body></html>`))
+			return
+		}
+		_, _ = w.Write([]byte(big))
+	}))
+	defer server.Close()
+
+	crawler := newTestCrawler(func(cfg *appconfig.CrawlerConfig) {
+		cfg.Limits = appconfig.Limits{MaxURLs: 10, MaxDepth: 3}
+		cfg.Budgets.MaxBodyBytes = 1000
+	})
+	result, err := crawler.Crawl(context.Background(), server.URL+"/", "")
+	require.NoError(t, err)
+
+	pages := pagesByURL(result)
+	require.Len(t, pages, 2)
+	truncated := pages[server.URL+"/big"]
+	assert.True(t, truncated.BodyTruncated)
+	// The body is cut before the tag the limit fell in
+	assert.Equal(t, int64(strings.LastIndex(big[:1000], "<")), truncated.BodySize)
+	assert.Equal(t, "Grosse page", truncated.Title)
+	assert.False(t, pages[server.URL+"/"].BodyTruncated)
+	assert.False(t, result.Metadata.Partial)
+}
+
+func TestCrawlStopsAtTotalBytes(t *testing.T) {
+	server := newSyntheticSite(3, 3, time.Millisecond, nil) // 1+3+9+27 pages
+	defer server.Close()
+
+	dir := t.TempDir()
+	crawler := newTestCrawler(func(cfg *appconfig.CrawlerConfig) {
+		cfg.Limits = appconfig.Limits{MaxURLs: 1000, MaxDepth: 5}
+		cfg.Checkpoint.Enabled = true
+		cfg.Budgets.MaxTotalBytes = 500
+	})
+	result, err := crawler.Crawl(context.Background(), server.URL+"/", dir)
+	require.NoError(t, err)
+
+	assert.Less(t, len(result.Pages), 40)
+	assert.GreaterOrEqual(t, result.Metadata.BytesDownloaded, int64(500))
+	assert.True(t, result.Metadata.Partial)
+	assert.Equal(t, []string{BudgetTotalBytes}, result.Metadata.BudgetsExhausted)
+
+	// The partial result is saved like a finished crawl
+	streamed, err := ReadCrawlResult(dir)
+	require.NoError(t, err)
+	assert.Len(t, streamed.Pages, len(result.Pages))
+	assert.True(t, streamed.Metadata.Partial)
+	assert.False(t, HasCheckpoint(dir))
+}
+
+func TestCrawlStopsAtDuration(t *testing.T) {
+	server := newSyntheticSite(3, 3, 20*time.Millisecond, nil)
+	defer server.Close()
+
+	crawler := newTestCrawler(func(cfg *appconfig.CrawlerConfig) {
+		cfg.Limits = appconfig.Limits{MaxURLs: 1000, MaxDepth: 5}
+		cfg.Budgets.MaxDuration = 100 * time.Millisecond
+	})
+	start := time.Now()
+	result, err := crawler.Crawl(context.Background(), server.URL+"/", "")
+	require.NoError(t, err)
+
+	assert.Less(t, time.Since(start), 2*time.Second)
+	assert.NotEmpty(t, result.Pages)
+	assert.Less(t, len(result.Pages), 40)
+	assert.True(t, result.Metadata.Partial)
+	assert.Equal(t, []string{BudgetDuration}, result.Metadata.BudgetsExhausted)
+}
+
+func TestDurationBudgetEndsFetchesInFlight(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			fmt.Fprint(w, `<html><body><a href="/slow">Slow</a></body></html>`)
+			return
+		}
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	crawler := newTestCrawler(func(cfg *appconfig.CrawlerConfig) {
+		cfg.Limits = appconfig.Limits{MaxURLs: 10, MaxDepth: 3}
+		cfg.Performance.RequestTimeout = 30 * time.Second
+		cfg.Budgets.MaxDuration = 200 * time.Millisecond
+	})
+	start := time.Now()
+	result, err := crawler.Crawl(context.Background(), server.URL+"/", "")
+	require.NoError(t, err)
+
+	assert.Less(t, time.Since(start), 2*time.Second)
+	assert.Len(t, result.Pages, 1)
+	assert.Equal(t, []string{BudgetDuration}, result.Metadata.BudgetsExhausted)
+}
+
+func TestDurationBudgetEndsRetryWaits(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	crawler := newTestCrawler(func(cfg *appconfig.CrawlerConfig) {
+		cfg.Limits = appconfig.Limits{MaxURLs: 10, MaxDepth: 3}
+		cfg.Performance.RetryAttempts = 3
+		cfg.Budgets.MaxDuration = 200 * time.Millisecond
+	})
+	start := time.Now()
+	result, err := crawler.Crawl(context.Background(), server.URL+"/", "")
+	require.NoError(t, err)
+
+	// The waits between attempts would last 6s
+	assert.Less(t, time.Since(start), 2*time.Second)
+	assert.True(t, result.Metadata.Partial)
+}
+
+func TestCrawlCapsPagesPerDirectory(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path != "/" {
+			fmt.Fprintf(w, `<html><head><title>%s</title></head><body></body></html>`, r.URL.Path)
+			return
+		}
+		var links strings.Builder
+		for i := 0; i < 10; i++ {
+			fmt.Fprintf(&links, `<a href="/blog/%d">Article</a><a href="/shop/%d">Produit</a>`, i, i)
+		}
+		fmt.Fprintf(w, `<html><body>%s<a href="/contact">Contact</a></body></html>`, links.String())
+	}))
+	defer server.Close()
+
+	crawler := newTestCrawler(func(cfg *appconfig.CrawlerConfig) {
+		cfg.Limits = appconfig.Limits{MaxURLs: 100, MaxDepth: 3}
+		cfg.Performance.ConcurrentRequests = 3
+		cfg.Budgets.MaxPagesPerDirectory = 3
+	})
+	result, err := crawler.Crawl(context.Background(), server.URL+"/", "")
+	require.NoError(t, err)
+
+	directories := make(map[string]int)
+	for _, page := range result.Pages {
+		directories[pageDirectory(page.URL)]++
+	}
+	assert.Equal(t, map[string]int{"/": 2, "/blog": 3, "/shop": 3}, directories)
+
+	skipped := 0
+	for _, excluded := range result.Excluded {
+		if excluded.Rule == "budget: "+BudgetPagesPerDirectory {
+			skipped++
+		}
+	}
+	assert.Equal(t, 14, skipped)
+	assert.False(t, result.Metadata.Partial)
+	assert.Equal(t, []string{BudgetPagesPerDirectory}, result.Metadata.BudgetsExhausted)
+}
+
+func TestCutBodyKeepsAWellFormedPrefix(t *testing.T) {
+	tests := []struct {
+		name, body, expected string
+	}{
+		{"complete", "<p>Salamandre</p>", "<p>Salamandre</p>"},
+		{"cut tag", "<p>Salamandre</p><p", "<p>Salamandre</p>"},
+		{"cut meta charset", `<html><head><meta charset="utf`, "<html><head>"},
+		{"cut character", "<p>Salamandre rapide" + "\xc3", "<p>Salamandre rapide"},
+		{"cut euro sign", "<p>10 " + "\xe2\x82", "<p>10 "},
+		{"whole character", "<p>Déménagée", "<p>Déménagée"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, string(cutBody([]byte(tt.body))))
+		})
+	}
+
+	// A UTF-8 page cut inside a character is still detected as UTF-8
+	body, truncated, err := readBody(strings.NewReader("<p>Déménagée</p>"), 5)
+	require.NoError(t, err)
+	assert.True(t, truncated)
+	assert.Equal(t, CharsetUTF8, DetectCharset("text/html; charset=utf-8", body).Detected)
+}
+
+func TestCrawlCountsNetworkBytesOnly(t *testing.T) {
+	server := newArchivedSite()
+	defer server.Close()
+
+	crawler := newTestCrawler(func(cfg *appconfig.CrawlerConfig) {
+		cfg.Limits = appconfig.Limits{MaxURLs: 10, MaxDepth: 3}
+		cfg.Performance.CacheDir = t.TempDir()
+		cfg.Performance.CacheTTL = time.Hour
+	})
+	crawler.cache = newHTTPCache(crawler.Config.Performance.CacheDir)
+	first, err := crawler.Crawl(context.Background(), server.URL+"/", "")
+	require.NoError(t, err)
+	assert.Positive(t, first.Metadata.BytesDownloaded)
+
+	// A warm re-crawl served from the cache downloads nothing
+	second, err := crawler.Crawl(context.Background(), server.URL+"/", "")
+	require.NoError(t, err)
+	assert.Equal(t, len(first.Pages), second.Metadata.CacheHits)
+	assert.Zero(t, second.Metadata.BytesDownloaded)
+}
+
+func TestAssetBytesCountTowardTotalBytes(t *testing.T) {
+	image := strings.Repeat("x", 4096)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte(`<html><body><img src="/a.png"><img src="/b.png"><img src="/c.png"></body></html>`))
+		default:
+			// No HEAD support and no length, so each asset is downloaded
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			w.Header().Set("Content-Type", "image/png")
+			w.(http.Flusher).Flush()
+			_, _ = w.Write([]byte(image))
+		}
+	}))
+	defer server.Close()
+
+	crawler := newTestCrawler(func(cfg *appconfig.CrawlerConfig) {
+		cfg.Limits = appconfig.Limits{MaxURLs: 10, MaxDepth: 3}
+		cfg.Budgets.MaxTotalBytes = 5000
+	})
+	result, err := crawler.Crawl(context.Background(), server.URL+"/", "")
+	require.NoError(t, err)
+
+	// The second asset exhausts the budget and the third is not fetched
+	assert.True(t, result.Metadata.Partial)
+	assert.Equal(t, []string{BudgetTotalBytes}, result.Metadata.BudgetsExhausted)
+	assert.Less(t, result.Metadata.BytesDownloaded, int64(3*len(image)))
+	require.Len(t, result.Assets, 3)
+	assert.Equal(t, int64(-1), result.Assets[2].Size)
+}
@@ -0,0 +1,222 @@
+package crawler
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"firesalamander/internal/config"
+)
+
+// cacheEntry is a stored 200 response, reused on 304 or while still fresh
+type cacheEntry struct {
+	URL           string        `json:"url"`
+	FinalURL      string        `json:"final_url"`
+	StatusCode    int           `json:"status_code"`
+	Header        http.Header   `json:"header"`
+	Body          []byte        `json:"body"`
+	RedirectChain []RedirectHop `json:"redirect_chain,omitempty"`
+	FetchedAt     time.Time     `json:"fetched_at"`
+}
+
+// httpCache persists responses across audits under the keys built by
+// cacheKey. A nil cache is valid and never hits.
+type httpCache struct {
+	dir string
+	mu  sync.Mutex
+}
+
+func newHTTPCache(dir string) *httpCache {
+	if dir == "" {
+		return nil
+	}
+	return &httpCache{dir: dir}
+}
+
+func (h *httpCache) path(key string) string {
+	sum := sha1.Sum([]byte(key))
+	return filepath.Join(h.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// cacheKey keys the response of pageURL by its normalized URL and by what
+// makes the same URL answer differently: the credentials sent with it and the
+// address a host override dials. Anonymous and authenticated crawls, or two
+// overridden targets, never share entries.
+func (c *Crawler) cacheKey(pageURL string) string {
+	key := c.normalizer.Normalize(pageURL)
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return key
+	}
+	for host, address := range c.Config.HostOverrides {
+		if strings.EqualFold(host, u.Hostname()) {
+			key += "\noverride=" + address
+		}
+	}
+	if c.sendsCredentials(u) {
+		if identity := authIdentity(c.Config.Auth); identity != "" {
+			key += "\nauth=" + identity
+		}
+	}
+	return key
+}
+
+// authIdentity digests the configured credentials, or returns "" for an
+// anonymous crawl
+func authIdentity(auth config.Auth) string {
+	var parts []string
+	add := func(kind string, values map[string]string) {
+		for name, value := range values {
+			parts = append(parts, kind+":"+name+"="+value)
+		}
+	}
+	if auth.BasicUser != "" || auth.BasicPassword != "" {
+		parts = append(parts, "basic:"+auth.BasicUser+":"+auth.BasicPassword)
+	}
+	add("header", auth.Headers)
+	add("cookie", auth.Cookies)
+	if auth.Login.URL != "" {
+		parts = append(parts, "login:"+auth.Login.URL)
+		add("field", auth.Login.Fields)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+
+	sort.Strings(parts)
+	sum := sha1.Sum([]byte(strings.Join(parts, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// lookup returns the cached response stored under key, or nil
+func (h *httpCache) lookup(key string) *cacheEntry {
+	if h == nil {
+		return nil
+	}
+
+	h.mu.Lock()
+	data, err := os.ReadFile(h.path(key))
+	h.mu.Unlock()
+	if err != nil {
+		return nil
+	}
+
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil
+	}
+	return &entry
+}
+
+// store writes the entry atomically so concurrent audits never read half a file
+func (h *httpCache) store(key string, entry *cacheEntry) error {
+	if h == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err := os.MkdirAll(h.dir, 0755); err != nil {
+		return err
+	}
+	path := h.path(key)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// fresh reports whether the entry can be used without contacting the server
+func (e *cacheEntry) fresh(ttl time.Duration) bool {
+	return ttl > 0 && time.Since(e.FetchedAt) < ttl
+}
+
+// addValidators turns the request into a conditional one
+func (e *cacheEntry) addValidators(req *http.Request) {
+	if etag := e.Header.Get("ETag"); etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified := e.Header.Get("Last-Modified"); lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+}
+
+// response rebuilds the stored response. Headers of a 304 answer replace the
+// stored ones, as RFC 9111 requires.
+func (e *cacheEntry) response(req *http.Request, notModified *http.Response) *http.Response {
+	header := e.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+
+	finalReq := req
+	if notModified != nil {
+		for key, values := range notModified.Header {
+			header[key] = values
+		}
+		finalReq = notModified.Request
+	} else if finalURL, err := url.Parse(e.FinalURL); err == nil && e.FinalURL != "" {
+		finalReq = req.Clone(req.Context())
+		finalReq.URL = finalURL
+	}
+
+	return &http.Response{
+		StatusCode:    e.StatusCode,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       finalReq,
+	}
+}
+
+// redirectRecord replays the redirects seen when the entry was stored
+func (e *cacheEntry) redirectRecord(sourceURL string) *RedirectRecord {
+	if len(e.RedirectChain) == 0 {
+		return nil
+	}
+	return &RedirectRecord{
+		SourceURL:   sourceURL,
+		Hops:        append([]RedirectHop(nil), e.RedirectChain...),
+		FinalURL:    e.FinalURL,
+		FinalStatus: e.StatusCode,
+	}
+}
+
+// countCache tallies a cache hit or miss for the crawl metadata
+func (c *Crawler) countCache(hit bool) {
+	if c.cache == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if hit {
+		c.cacheHits++
+	} else {
+		c.cacheMisses++
+	}
+}
+
+// cacheHitRatio is the share of fetches served from the cache
+func cacheHitRatio(hits, misses int) float64 {
+	if hits+misses == 0 {
+		return 0
+	}
+	return float64(hits) / float64(hits+misses)
+}
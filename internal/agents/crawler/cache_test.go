@@ -0,0 +1,165 @@
+package crawler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	appconfig "firesalamander/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const cacheTestHTML = `<html><head><title>Cached</title></head><body><h1>Cached page</h1></body></html>`
+
+// newCacheTestServer serves one page with validators and counts full and
+// not-modified responses
+func newCacheTestServer(full, notModified *int32) *httptest.Server {
+	lastModified := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC).Format(http.TimeFormat)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/etag":
+			w.Header().Set("ETag", `"v1"`)
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				atomic.AddInt32(notModified, 1)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		case "/modified":
+			w.Header().Set("Last-Modified", lastModified)
+			if r.Header.Get("If-Modified-Since") == lastModified {
+				atomic.AddInt32(notModified, 1)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+		atomic.AddInt32(full, 1)
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(cacheTestHTML))
+	}))
+}
+
+func TestCrawlRevalidatesWithETag(t *testing.T) {
+	var full, notModified int32
+	server := newCacheTestServer(&full, &notModified)
+	defer server.Close()
+
+	cacheDir := t.TempDir()
+	cached := func(cfg *appconfig.CrawlerConfig) { cfg.Performance.CacheDir = cacheDir }
+
+	first, err := newTestCrawler(cached).Crawl(context.Background(), server.URL+"/etag", "")
+	require.NoError(t, err)
+	require.Len(t, first.Pages, 1)
+	assert.False(t, first.Pages[0].FromCache)
+	assert.Equal(t, 0, first.Metadata.CacheHits)
+	assert.Equal(t, 1, first.Metadata.CacheMisses)
+
+	second, err := newTestCrawler(cached).Crawl(context.Background(), server.URL+"/etag", "")
+	require.NoError(t, err)
+	require.Len(t, second.Pages, 1)
+
+	page := second.Pages[0]
+	assert.True(t, page.FromCache)
+	assert.Equal(t, "Cached", page.Title)
+	assert.Equal(t, http.StatusOK, page.StatusCode)
+	assert.Equal(t, `"v1"`, page.Headers["Etag"])
+	assert.Equal(t, 1, second.Metadata.CacheHits)
+	assert.Equal(t, 1.0, second.Metadata.CacheHitRatio)
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&full))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&notModified))
+}
+
+func TestCrawlRevalidatesWithLastModified(t *testing.T) {
+	var full, notModified int32
+	server := newCacheTestServer(&full, &notModified)
+	defer server.Close()
+
+	cacheDir := t.TempDir()
+	cached := func(cfg *appconfig.CrawlerConfig) { cfg.Performance.CacheDir = cacheDir }
+	for i := 0; i < 2; i++ {
+		_, err := newTestCrawler(cached).Crawl(context.Background(), server.URL+"/modified", "")
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&full))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&notModified))
+}
+
+func TestCrawlServesFreshPagesFromCache(t *testing.T) {
+	var full, notModified int32
+	server := newCacheTestServer(&full, &notModified)
+	defer server.Close()
+
+	cacheDir := t.TempDir()
+	fresh := func(cfg *appconfig.CrawlerConfig) {
+		cfg.Performance.CacheDir = cacheDir
+		cfg.Performance.CacheTTL = time.Hour
+	}
+	for i := 0; i < 3; i++ {
+		result, err := newTestCrawler(fresh).Crawl(context.Background(), server.URL+"/plain", "")
+		require.NoError(t, err)
+		require.Len(t, result.Pages, 1)
+		assert.Equal(t, "Cached", result.Pages[0].Title)
+	}
+
+	// Within the TTL the server is not contacted at all
+	assert.Equal(t, int32(1), atomic.LoadInt32(&full))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&notModified))
+}
+
+func TestCrawlWithoutCache(t *testing.T) {
+	var full, notModified int32
+	server := newCacheTestServer(&full, &notModified)
+	defer server.Close()
+
+	uncached := func(cfg *appconfig.CrawlerConfig) { cfg.Performance.CacheTTL = time.Hour }
+	for i := 0; i < 2; i++ {
+		result, err := newTestCrawler(uncached).Crawl(context.Background(), server.URL+"/etag", "")
+		require.NoError(t, err)
+		assert.Equal(t, 0, result.Metadata.CacheHits+result.Metadata.CacheMisses)
+	}
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&full))
+}
+
+func TestCacheHitRatio(t *testing.T) {
+	assert.Equal(t, 0.0, cacheHitRatio(0, 0))
+	assert.Equal(t, 0.75, cacheHitRatio(3, 1))
+}
+
+func TestCacheKeySeparatesCredentialsAndOverrides(t *testing.T) {
+	newKeyCrawler := func(auth appconfig.Auth, overrides map[string]string) *Crawler {
+		c := NewCrawler(appconfig.CrawlerConfig{Auth: auth, HostOverrides: overrides})
+		c.seedURL = "https://example.com/"
+		return c
+	}
+	page := "https://example.com/account"
+
+	anonymous := newKeyCrawler(appconfig.Auth{}, nil).cacheKey(page)
+	authenticated := newKeyCrawler(appconfig.Auth{Cookies: map[string]string{"session": "1"}}, nil).cacheKey(page)
+	otherUser := newKeyCrawler(appconfig.Auth{Cookies: map[string]string{"session": "2"}}, nil).cacheKey(page)
+	staging := newKeyCrawler(appconfig.Auth{}, map[string]string{"example.com": "10.0.0.1"}).cacheKey(page)
+	preprod := newKeyCrawler(appconfig.Auth{}, map[string]string{"example.com": "10.0.0.2"}).cacheKey(page)
+
+	keys := []string{anonymous, authenticated, otherUser, staging, preprod}
+	for i := range keys {
+		for j := i + 1; j < len(keys); j++ {
+			assert.NotEqual(t, keys[i], keys[j])
+		}
+	}
+	assert.Equal(t, anonymous, newKeyCrawler(appconfig.Auth{}, nil).cacheKey("https://EXAMPLE.com/account"))
+
+	// Credentials are never sent off-site, so they do not split its entries
+	assert.Equal(t, newKeyCrawler(appconfig.Auth{}, nil).cacheKey("https://cdn.example.net/a.css"),
+		newKeyCrawler(appconfig.Auth{BasicUser: "u"}, nil).cacheKey("https://cdn.example.net/a.css"))
+}
+
+func TestCacheKeyUsesTheNormalizationPolicy(t *testing.T) {
+	c := NewCrawler(appconfig.CrawlerConfig{Normalization: appconfig.Normalization{WWW: "strip", Scheme: "https"}})
+
+	assert.Equal(t, c.cacheKey("https://example.com/a"), c.cacheKey("http://www.example.com/a"))
+}
@@ -0,0 +1,205 @@
+package crawler
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+)
+
+// Canonical charset names, as the WHATWG Encoding Standard spells them.
+// Labels such as iso-8859-1 or us-ascii resolve to windows-1252, which is
+// how browsers decode them.
+const (
+	CharsetUTF8        = "utf-8"
+	CharsetUTF16LE     = "utf-16le"
+	CharsetUTF16BE     = "utf-16be"
+	CharsetLatin9      = "iso-8859-15"
+	CharsetWindows1252 = "windows-1252"
+)
+
+// metaPrescanSize is how far into the document a <meta charset> is looked
+// for, as browsers do
+const metaPrescanSize = 1024
+
+// CharsetInfo describes the encoding of a fetched document
+type CharsetInfo struct {
+	// Header is the charset parameter of the Content-Type header
+	Header string
+	// Meta is the charset of the <meta charset> or http-equiv tag
+	Meta string
+	// BOM is the charset given by a byte order mark
+	BOM string
+	// Detected is the charset the document is decoded from
+	Detected string
+}
+
+// Declared returns the charset the server declares, the header taking
+// precedence over the meta tag
+func (i CharsetInfo) Declared() string {
+	if i.Header != "" {
+		return i.Header
+	}
+	return i.Meta
+}
+
+// Conflicts describes every disagreement between the declarations and the
+// bytes of the document
+func (i CharsetInfo) Conflicts() []string {
+	var conflicts []string
+	if i.Header != "" && i.Meta != "" && i.Header != i.Meta {
+		conflicts = append(conflicts, fmt.Sprintf("Content-Type header declares %s but the meta tag declares %s", i.Header, i.Meta))
+	}
+	if declared := i.Declared(); declared != "" && declared != i.Detected {
+		conflicts = append(conflicts, fmt.Sprintf("Page declares %s but is encoded as %s", declared, i.Detected))
+	}
+	return conflicts
+}
+
+// DetectCharset works out the encoding of an HTML document from its
+// Content-Type header, its byte order mark, its meta tag and its bytes. A
+// BOM always wins. Otherwise the declaration is trusted unless the bytes
+// contradict it: a page declared as UTF-8 that is not valid UTF-8 is read as
+// windows-1252, and a page declared in another charset that is valid UTF-8
+// beyond ASCII is read as UTF-8.
+func DetectCharset(contentType string, body []byte) CharsetInfo {
+	info := CharsetInfo{
+		Header: charsetFromContentType(contentType),
+		BOM:    charsetFromBOM(body),
+	}
+	prescan := body
+	if len(prescan) > metaPrescanSize {
+		prescan = prescan[:metaPrescanSize]
+	}
+	info.Meta = charsetFromMeta(prescan)
+
+	declared := info.Declared()
+	switch {
+	case info.BOM != "":
+		info.Detected = info.BOM
+	case utf8.Valid(body):
+		if declared == "" || !isASCII(body) {
+			info.Detected = CharsetUTF8
+		} else {
+			info.Detected = declared
+		}
+	case declared != "" && declared != CharsetUTF8:
+		info.Detected = declared
+	default:
+		info.Detected = CharsetWindows1252
+	}
+	return info
+}
+
+// DecodeHTML transcodes body to UTF-8 from the charset it was detected in.
+// Charsets without a decoder are returned as is.
+func DecodeHTML(body []byte, charsetName string) string {
+	if charsetFromBOM(body) == charsetName {
+		body = trimBOM(body)
+	}
+	if charsetName == CharsetUTF8 {
+		return string(body)
+	}
+
+	reader, err := charset.NewReaderLabel(charsetName, bytes.NewReader(body))
+	if err != nil {
+		return string(body)
+	}
+	decoded, err := io.ReadAll(reader)
+	if err != nil {
+		return string(body)
+	}
+	return string(decoded)
+}
+
+// canonicalCharset resolves a charset label to its canonical name. Unknown
+// labels are kept, lowercased.
+func canonicalCharset(label string) string {
+	label = strings.Trim(strings.TrimSpace(label), `"'`)
+	if _, name := charset.Lookup(label); name != "" {
+		return name
+	}
+	return strings.ToLower(label)
+}
+
+func charsetFromContentType(contentType string) string {
+	if contentType == "" {
+		return ""
+	}
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return canonicalCharset(params["charset"])
+}
+
+func charsetFromBOM(body []byte) string {
+	switch {
+	case bytes.HasPrefix(body, []byte("\xEF\xBB\xBF")):
+		return CharsetUTF8
+	case bytes.HasPrefix(body, []byte("\xFF\xFE")):
+		return CharsetUTF16LE
+	case bytes.HasPrefix(body, []byte("\xFE\xFF")):
+		return CharsetUTF16BE
+	}
+	return ""
+}
+
+// charsetFromMeta looks for <meta charset="..."> or
+// <meta http-equiv="Content-Type" content="...; charset=..."> in the start
+// of the document
+func charsetFromMeta(prescan []byte) string {
+	tokenizer := html.NewTokenizer(bytes.NewReader(prescan))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return ""
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			if token.Data != "meta" {
+				continue
+			}
+			var httpEquiv, content string
+			for _, attr := range token.Attr {
+				switch strings.ToLower(attr.Key) {
+				case "charset":
+					return canonicalCharset(attr.Val)
+				case "http-equiv":
+					httpEquiv = attr.Val
+				case "content":
+					content = attr.Val
+				}
+			}
+			if strings.EqualFold(httpEquiv, "content-type") {
+				if charset := charsetFromContentType(content); charset != "" {
+					return charset
+				}
+			}
+		}
+	}
+}
+
+func isASCII(body []byte) bool {
+	for _, b := range body {
+		if b >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// trimBOM drops the byte order mark charsetFromBOM found
+func trimBOM(body []byte) []byte {
+	switch charsetFromBOM(body) {
+	case CharsetUTF8:
+		return body[3:]
+	case CharsetUTF16LE, CharsetUTF16BE:
+		return body[2:]
+	}
+	return body
+}
@@ -0,0 +1,99 @@
+package crawler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectCharset(t *testing.T) {
+	latin1 := []byte("<html><head><title>R\xe9servation</title></head></html>")
+	utf8Page := []byte("<html><head><title>Réservation</title></head></html>")
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        []byte
+		detected    string
+		declared    string
+		conflicts   int
+	}{
+		{"header latin1", "text/html; charset=ISO-8859-1", latin1, CharsetWindows1252, CharsetWindows1252, 0},
+		{"meta charset", "text/html", append([]byte(`<meta charset="windows-1252">`), latin1...), CharsetWindows1252, CharsetWindows1252, 0},
+		{"http-equiv", "", append([]byte(`<meta http-equiv="Content-Type" content="text/html; charset=latin1">`), latin1...), CharsetWindows1252, CharsetWindows1252, 0},
+		{"undeclared latin1", "text/html", latin1, CharsetWindows1252, "", 0},
+		{"undeclared utf-8", "text/html", utf8Page, CharsetUTF8, "", 0},
+		{"utf-8 declared, latin1 bytes", "text/html; charset=utf-8", latin1, CharsetWindows1252, CharsetUTF8, 1},
+		{"latin1 declared, utf-8 bytes", "text/html; charset=iso-8859-1", utf8Page, CharsetUTF8, CharsetWindows1252, 1},
+		{"header and meta disagree", "text/html; charset=utf-8", append([]byte(`<meta charset="iso-8859-1">`), utf8Page...), CharsetUTF8, CharsetUTF8, 1},
+		{"bom wins", "text/html; charset=iso-8859-1", append([]byte("\xEF\xBB\xBF"), utf8Page...), CharsetUTF8, CharsetWindows1252, 1},
+		{"ascii and latin1 agree", "text/html; charset=us-ascii", append([]byte(`<meta charset="iso-8859-1">`), "<p>plain</p>"...), CharsetWindows1252, CharsetWindows1252, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := DetectCharset(tt.contentType, tt.body)
+			assert.Equal(t, tt.detected, info.Detected)
+			assert.Equal(t, tt.declared, info.Declared())
+			assert.Len(t, info.Conflicts(), tt.conflicts)
+		})
+	}
+}
+
+func TestDecodeHTML(t *testing.T) {
+	assert.Equal(t, "réservation € “œuvre”", DecodeHTML([]byte("r\xe9servation \x80 \x93\x9cuvre\x94"), CharsetWindows1252))
+	assert.Equal(t, "€ œ", DecodeHTML([]byte("\xa4 \xbd"), CharsetLatin9))
+	assert.Equal(t, "été", DecodeHTML([]byte("\xFF\xFE\xe9\x00t\x00\xe9\x00"), CharsetUTF16LE))
+	assert.Equal(t, "été", DecodeHTML([]byte("\xFE\xFF\x00\xe9\x00t\x00\xe9"), CharsetUTF16BE))
+	assert.Equal(t, "été", DecodeHTML([]byte("\xEF\xBB\xBFété"), CharsetUTF8))
+	assert.Equal(t, "plain", DecodeHTML([]byte("plain"), "x-unknown"))
+}
+
+func TestDecodeHTMLMultiByteAndCyrillic(t *testing.T) {
+	tests := []struct {
+		label    string
+		body     string
+		expected string
+	}{
+		{"Shift_JIS", "\x93\xfa\x96\x7b", "日本"},
+		{"EUC-KR", "\xc7\xd1\xb1\xb9", "한국"},
+		{"GB2312", "\xd6\xd0\xce\xc4", "中文"},
+		{"GBK", "\xd6\xd0\xce\xc4", "中文"},
+		{"windows-1251", "\xcf\xf0\xe8\xe2\xe5\xf2", "Привет"},
+		{"KOI8-R", "\xf0\xd2\xc9\xd7\xc5\xd4", "Привет"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.label, func(t *testing.T) {
+			info := DetectCharset("text/html; charset="+tt.label, []byte(tt.body))
+			assert.Equal(t, info.Declared(), info.Detected)
+			assert.Empty(t, info.Conflicts())
+			assert.Equal(t, tt.expected, DecodeHTML([]byte(tt.body), info.Detected))
+		})
+	}
+}
+
+func TestCrawlTranscodesLatin1Pages(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(`<html><head><meta charset="iso-8859-1"><title>R` + "\xe9" + `servation</title></head><body><h1>Caf` + "\xe9" + `</h1></body></html>`))
+	}))
+	defer server.Close()
+
+	result, err := newTestCrawler(nil).Crawl(context.Background(), server.URL+"/", "")
+	require.NoError(t, err)
+	require.Len(t, result.Pages, 1)
+
+	page := result.Pages[0]
+	assert.Equal(t, "Réservation", page.Title)
+	assert.Equal(t, "Café", page.H1)
+	assert.Equal(t, CharsetUTF8, page.DeclaredCharset)
+	assert.Equal(t, CharsetWindows1252, page.DetectedCharset)
+	assert.Len(t, page.CharsetConflicts, 2)
+	// The stored document keeps the bytes as served
+	assert.Contains(t, page.RawHTML, "R\xe9servation")
+}
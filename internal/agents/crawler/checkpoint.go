@@ -0,0 +1,491 @@
+package crawler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// checkpointFileName is written in the audit output directory
+	checkpointFileName = "crawl_checkpoint.json"
+	// journalFileName holds what the checkpoints appended, next to the
+	// checkpoint
+	journalFileName = "crawl_checkpoint.jsonl"
+	// defaultCheckpointInterval is used when checkpoints are enabled without an interval
+	defaultCheckpointInterval = 50
+)
+
+// A checkpoint is written in two parts. The pages, visited URLs and other
+// records that only grow are appended to a journal, each checkpoint adding
+// what changed since the previous one, while crawl_checkpoint.json holds
+// the frontier, the counters and the journal size it is consistent with. A
+// checkpoint thus costs the pages it adds, not the whole crawl so far.
+
+// Checkpoint is a snapshot of an unfinished crawl, enough to resume it. The
+// fields read from the journal, and from the records.jsonl of a lean crawl,
+// are filled by LoadCheckpoint.
+type Checkpoint struct {
+	SeedURL         string           `json:"seed_url"`
+	SavedAt         time.Time        `json:"saved_at"`
+	ElapsedMs       int64            `json:"elapsed_ms"`
+	MaxDepthReached int              `json:"max_depth_reached"`
+	Queue           []CrawlTask      `json:"queue"`
+	ListMode        bool             `json:"list_mode,omitempty"`
+	Traps           []CrawlTrap      `json:"traps,omitempty"`
+	BytesDownloaded int64            `json:"bytes_downloaded,omitempty"`
+	JournalSize     int64            `json:"journal_size"`
+	RecordsSize     int64            `json:"records_size,omitempty"`
+	Visited         []string         `json:"-"`
+	Pages           []PageData       `json:"-"`
+	BlockedURLs     []BlockedURL     `json:"-"`
+	Redirects       []RedirectRecord `json:"-"`
+	Excluded        []ExcludedURL    `json:"-"`
+	Sitemap         []SitemapEntry   `json:"-"`
+	Discovered      []string         `json:"-"`
+}
+
+// journalRecord is one line of the checkpoint journal
+type journalRecord struct {
+	Visited    string          `json:"visited,omitempty"`
+	Page       *PageData       `json:"page,omitempty"`
+	Blocked    *BlockedURL     `json:"blocked,omitempty"`
+	Redirect   *RedirectRecord `json:"redirect,omitempty"`
+	Excluded   *ExcludedURL    `json:"excluded,omitempty"`
+	Sitemap    *SitemapEntry   `json:"sitemap,omitempty"`
+	Discovered string          `json:"discovered,omitempty"`
+}
+
+// journalState counts what the journal already holds, and newly visited
+// URLs waiting for the next checkpoint
+type journalState struct {
+	pages, blocked, redirects, excluded, sitemap, discovered int
+	visited                                                  []string
+	size                                                     int64
+	open                                                     bool
+}
+
+// checkpointing reports whether the crawl writes checkpoints
+func (c *Crawler) checkpointing() bool {
+	return c.Config.Checkpoint.Enabled && c.outputDir != ""
+}
+
+// checkpointDue reports whether a checkpoint should be written now. Caller holds c.mutex.
+func (c *Crawler) checkpointDue() bool {
+	if !c.checkpointing() {
+		return false
+	}
+	interval := c.Config.Checkpoint.IntervalPages
+	if interval <= 0 {
+		interval = defaultCheckpointInterval
+	}
+	return len(c.Results)%interval == 0
+}
+
+// journalVisited keeps a newly visited URL for the next checkpoint. Caller
+// holds c.mutex.
+func (c *Crawler) journalVisited(u string) {
+	if c.checkpointing() {
+		c.journal.visited = append(c.journal.visited, u)
+	}
+}
+
+// checkpointDelta is what a checkpoint appends to the journal
+type checkpointDelta struct {
+	visited    []string
+	pages      []PageData
+	blocked    []BlockedURL
+	redirects  []RedirectRecord
+	excluded   []ExcludedURL
+	sitemap    []SitemapEntry
+	discovered []string
+}
+
+// snapshot captures the crawl state and what changed since the previous
+// checkpoint. Records only grow, so the delta shares their arrays. Pages
+// still being fetched go back to the front of the queue so a resumed crawl
+// fetches them again.
+func (c *Crawler) snapshot() (*Checkpoint, checkpointDelta) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	queue := make([]CrawlTask, 0, len(c.inflight)+c.Queue.Len()+1)
+	for _, task := range c.inflight {
+		queue = append(queue, task)
+	}
+	if c.held != nil {
+		queue = append(queue, *c.held)
+	}
+	queue = append(queue, c.Queue.Tasks()...)
+
+	// The checkpoint counts on the records written so far
+	if c.records != nil {
+		if err := c.records.file.Sync(); err != nil {
+			fmt.Printf("Warning: failed to sync crawl records: %v\n", err)
+		}
+	}
+
+	j := &c.journal
+	delta := checkpointDelta{
+		visited:    j.visited[:len(j.visited):len(j.visited)],
+		pages:      c.Results[j.pages:len(c.Results):len(c.Results)],
+		blocked:    c.Blocked[j.blocked:len(c.Blocked):len(c.Blocked)],
+		redirects:  c.Redirects[j.redirects:len(c.Redirects):len(c.Redirects)],
+		excluded:   c.Excluded[j.excluded:len(c.Excluded):len(c.Excluded)],
+		sitemap:    c.sitemapEntries[j.sitemap:len(c.sitemapEntries):len(c.sitemapEntries)],
+		discovered: c.discovered[j.discovered:len(c.discovered):len(c.discovered)],
+	}
+
+	return &Checkpoint{
+		SeedURL:         c.seedURL,
+		SavedAt:         time.Now(),
+		ElapsedMs:       (c.elapsed + time.Since(c.runStart)).Milliseconds(),
+		MaxDepthReached: c.maxDepthReached,
+		Queue:           queue,
+		ListMode:        c.listMode,
+		Traps:           c.traps.Traps(),
+		BytesDownloaded: c.bytesDownloaded,
+		RecordsSize:     c.recordsSize,
+	}, delta
+}
+
+// saveCheckpoint appends what changed to the journal, then writes the
+// checkpoint atomically, so a crash while writing leaves the previous
+// checkpoint in place. The lock is taken before the snapshot so checkpoints
+// are written in the order they are taken.
+func (c *Crawler) saveCheckpoint() error {
+	c.checkpointMutex.Lock()
+	defer c.checkpointMutex.Unlock()
+
+	checkpoint, delta := c.snapshot()
+
+	if err := os.MkdirAll(c.outputDir, 0755); err != nil {
+		return err
+	}
+
+	size, err := c.appendJournal(delta)
+	if err != nil {
+		return fmt.Errorf("failed to write checkpoint journal: %w", err)
+	}
+	checkpoint.JournalSize = size
+
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint: %w", err)
+	}
+
+	path := filepath.Join(c.outputDir, checkpointFileName)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	j := &c.journal
+	j.visited = append([]string(nil), j.visited[len(delta.visited):]...)
+	j.pages += len(delta.pages)
+	j.blocked += len(delta.blocked)
+	j.redirects += len(delta.redirects)
+	j.excluded += len(delta.excluded)
+	j.sitemap += len(delta.sitemap)
+	j.discovered += len(delta.discovered)
+	j.size = size
+	c.mutex.Unlock()
+	return nil
+}
+
+// appendJournal writes a delta at the end of the journal and returns its
+// new size. The first checkpoint of a crawl starts a new journal, after
+// removing the checkpoint of any previous crawl it replaces; a resumed crawl
+// drops what was appended after its checkpoint. Caller holds checkpointMutex.
+func (c *Crawler) appendJournal(delta checkpointDelta) (int64, error) {
+	path := filepath.Join(c.outputDir, journalFileName)
+	flags := os.O_WRONLY | os.O_CREATE
+	if !c.journal.open {
+		_ = os.Remove(filepath.Join(c.outputDir, checkpointFileName))
+		flags |= os.O_TRUNC
+	}
+	file, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = file.Close() }()
+	if err := file.Truncate(c.journal.size); err != nil {
+		return 0, err
+	}
+	if _, err := file.Seek(c.journal.size, io.SeekStart); err != nil {
+		return 0, err
+	}
+	c.journal.open = true
+
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	write := func(record journalRecord) error {
+		return encoder.Encode(record)
+	}
+	for _, u := range delta.visited {
+		if err := write(journalRecord{Visited: u}); err != nil {
+			return 0, err
+		}
+	}
+	for i := range delta.pages {
+		if err := write(journalRecord{Page: &delta.pages[i]}); err != nil {
+			return 0, err
+		}
+	}
+	for i := range delta.blocked {
+		if err := write(journalRecord{Blocked: &delta.blocked[i]}); err != nil {
+			return 0, err
+		}
+	}
+	for i := range delta.redirects {
+		if err := write(journalRecord{Redirect: &delta.redirects[i]}); err != nil {
+			return 0, err
+		}
+	}
+	for i := range delta.excluded {
+		if err := write(journalRecord{Excluded: &delta.excluded[i]}); err != nil {
+			return 0, err
+		}
+	}
+	for i := range delta.sitemap {
+		if err := write(journalRecord{Sitemap: &delta.sitemap[i]}); err != nil {
+			return 0, err
+		}
+	}
+	for _, u := range delta.discovered {
+		if err := write(journalRecord{Discovered: u}); err != nil {
+			return 0, err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return 0, err
+	}
+	if err := file.Sync(); err != nil {
+		return 0, err
+	}
+	return file.Seek(0, io.SeekCurrent)
+}
+
+// readJournal calls apply for each record of the first size bytes of the
+// journal in auditDir
+func readJournal(auditDir string, size int64, apply func(journalRecord)) error {
+	if size == 0 {
+		return nil
+	}
+	file, err := os.Open(filepath.Join(auditDir, journalFileName))
+	if err != nil {
+		return fmt.Errorf("failed to read checkpoint journal: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	decoder := json.NewDecoder(bufio.NewReader(io.LimitReader(file, size)))
+	for {
+		var record journalRecord
+		err := decoder.Decode(&record)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to parse checkpoint journal: %w", err)
+		}
+		apply(record)
+	}
+}
+
+// removeCheckpoint deletes the checkpoint of a finished crawl
+func (c *Crawler) removeCheckpoint() {
+	c.checkpointMutex.Lock()
+	defer c.checkpointMutex.Unlock()
+
+	_ = os.Remove(filepath.Join(c.outputDir, checkpointFileName))
+	_ = os.Remove(filepath.Join(c.outputDir, journalFileName))
+}
+
+// HasCheckpoint reports whether auditDir holds an unfinished crawl
+func HasCheckpoint(auditDir string) bool {
+	_, err := os.Stat(filepath.Join(auditDir, checkpointFileName))
+	return err == nil
+}
+
+// CanResume reports whether auditDir holds an unfinished crawl started from
+// seedURL, the first URL of the list in list mode, so that Resume goes on
+// with that crawl and not with another one
+func (c *Crawler) CanResume(auditDir, seedURL string, listMode bool) bool {
+	checkpoint, err := loadCheckpointState(auditDir)
+	if err != nil || checkpoint.ListMode != listMode {
+		return false
+	}
+	if listMode {
+		seedURL = c.normalizer.Clean(seedURL)
+	}
+	return checkpoint.SeedURL == seedURL
+}
+
+// loadCheckpointState reads crawl_checkpoint.json, without the journal
+func loadCheckpointState(auditDir string) (*Checkpoint, error) {
+	data, err := os.ReadFile(filepath.Join(auditDir, checkpointFileName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+
+	var checkpoint Checkpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint: %w", err)
+	}
+	return &checkpoint, nil
+}
+
+// LoadCheckpoint reads the checkpoint saved in auditDir along with its
+// journal. Resume replays the journal without loading it whole.
+func LoadCheckpoint(auditDir string) (*Checkpoint, error) {
+	checkpoint, err := loadCheckpointState(auditDir)
+	if err != nil {
+		return nil, err
+	}
+	err = readJournal(auditDir, checkpoint.JournalSize, func(record journalRecord) {
+		checkpoint.apply(record)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if checkpoint.RecordsSize > 0 {
+		err = readRecords(auditDir, checkpoint.RecordsSize, func(record crawlRecord) {
+			checkpoint.apply(journalRecord{Blocked: record.Blocked, Redirect: record.Redirect, Excluded: record.Excluded})
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return checkpoint, nil
+}
+
+// apply adds a journal record to the checkpoint
+func (cp *Checkpoint) apply(record journalRecord) {
+	switch {
+	case record.Visited != "":
+		cp.Visited = append(cp.Visited, record.Visited)
+	case record.Page != nil:
+		cp.Pages = append(cp.Pages, *record.Page)
+	case record.Blocked != nil:
+		cp.BlockedURLs = append(cp.BlockedURLs, *record.Blocked)
+	case record.Redirect != nil:
+		cp.Redirects = append(cp.Redirects, *record.Redirect)
+	case record.Excluded != nil:
+		cp.Excluded = append(cp.Excluded, *record.Excluded)
+	case record.Sitemap != nil:
+		cp.Sitemap = append(cp.Sitemap, *record.Sitemap)
+	case record.Discovered != "":
+		cp.Discovered = append(cp.Discovered, record.Discovered)
+	}
+}
+
+// Resume continues the crawl checkpointed in auditDir and writes its result
+// there, as Crawl would have
+func (c *Crawler) Resume(ctx context.Context, auditDir string) (*CrawlResult, error) {
+	startTime := time.Now()
+
+	checkpoint, err := loadCheckpointState(auditDir)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	c.reset(checkpoint.SeedURL, auditDir, checkpoint.ListMode)
+	// The journal is replayed without holding the records twice
+	err = readJournal(auditDir, checkpoint.JournalSize, func(record journalRecord) {
+		switch {
+		case record.Visited != "":
+			c.markVisited(record.Visited)
+		case record.Page != nil:
+			c.Results = append(c.Results, *record.Page)
+		case record.Blocked != nil:
+			c.Blocked = append(c.Blocked, *record.Blocked)
+		case record.Redirect != nil:
+			c.Redirects = append(c.Redirects, *record.Redirect)
+		case record.Excluded != nil:
+			c.Excluded = append(c.Excluded, *record.Excluded)
+		case record.Sitemap != nil:
+			c.sitemapEntries = append(c.sitemapEntries, *record.Sitemap)
+			c.sitemap[c.normalizer.Normalize(record.Sitemap.URL)] = *record.Sitemap
+		case record.Discovered != "":
+			c.discovered = append(c.discovered, record.Discovered)
+		}
+	})
+	if err != nil {
+		c.mutex.Unlock()
+		return nil, err
+	}
+	// The journal already holds what was replayed
+	c.journal = journalState{
+		pages:      len(c.Results),
+		blocked:    len(c.Blocked),
+		redirects:  len(c.Redirects),
+		excluded:   len(c.Excluded),
+		sitemap:    len(c.sitemapEntries),
+		discovered: len(c.discovered),
+		size:       checkpoint.JournalSize,
+		open:       true,
+	}
+	// A lean crawl goes on writing records.jsonl after the records its
+	// checkpoint counts on. Other crawls take them back in memory, and
+	// their next checkpoint moves them to the journal.
+	if checkpoint.RecordsSize > 0 {
+		if c.leanPages() {
+			c.recordsSize = checkpoint.RecordsSize
+		} else {
+			err = readRecords(auditDir, checkpoint.RecordsSize, func(record crawlRecord) {
+				switch {
+				case record.Blocked != nil:
+					c.Blocked = append(c.Blocked, *record.Blocked)
+				case record.Redirect != nil:
+					c.Redirects = append(c.Redirects, *record.Redirect)
+				case record.Excluded != nil:
+					c.Excluded = append(c.Excluded, *record.Excluded)
+				}
+			})
+			if err != nil {
+				c.mutex.Unlock()
+				return nil, err
+			}
+		}
+	}
+	for _, page := range c.Results {
+		c.Queue.Seen(page.URL)
+	}
+	for _, task := range checkpoint.Queue {
+		c.Queue.Push(task)
+	}
+	// Sitemap entries queued before the interruption are visited already
+	if c.listMode {
+		c.sitemapQueued = len(c.sitemapEntries)
+	}
+	c.traps.restore(checkpoint.Traps)
+	if len(c.Results) > 0 {
+		c.queueSitemap()
+	}
+	c.maxDepthReached = checkpoint.MaxDepthReached
+	c.elapsed = time.Duration(checkpoint.ElapsedMs) * time.Millisecond
+	c.resumed = true
+	c.bytesDownloaded = checkpoint.BytesDownloaded
+	c.mutex.Unlock()
+
+	if err := c.openArchive(); err != nil {
+		return nil, err
+	}
+	if err := c.startSession(ctx); err != nil {
+		c.closeArchive()
+		c.releaseSpill()
+		return nil, err
+	}
+
+	return c.run(ctx, startTime)
+}
@@ -0,0 +1,193 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	appconfig "firesalamander/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// checkpointTestPages serves the same page at every path
+var checkpointTestPages = map[string]testPage{"*": {Body: `<html><body>Page</body></html>`}}
+
+// checkpointEveryPage saves a checkpoint after each crawled page
+func checkpointEveryPage(cfg *appconfig.CrawlerConfig) {
+	cfg.Limits = appconfig.Limits{MaxURLs: 10, MaxDepth: 3}
+	cfg.Checkpoint = appconfig.Checkpoint{Enabled: true, IntervalPages: 1}
+}
+
+func TestSaveAndLoadCheckpoint(t *testing.T) {
+	c := newTestCrawler(checkpointEveryPage)
+	c.outputDir = t.TempDir()
+	c.seedURL = "https://example.com/"
+	c.runStart = time.Now()
+	c.markVisited("https://example.com/")
+	c.markVisited("https://example.com/a")
+	c.inflight = map[string]CrawlTask{"https://example.com/a": {URL: "https://example.com/a", Depth: 1}}
+	c.Queue.Push(CrawlTask{URL: "https://example.com/b", Depth: 1})
+	c.Results = []PageData{{URL: "https://example.com/", Title: "Home"}}
+	c.maxDepthReached = 1
+
+	require.NoError(t, c.saveCheckpoint())
+	assert.True(t, HasCheckpoint(c.outputDir))
+	assert.NoFileExists(t, filepath.Join(c.outputDir, checkpointFileName+".tmp"))
+
+	checkpoint, err := LoadCheckpoint(c.outputDir)
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/", checkpoint.SeedURL)
+	assert.Equal(t, 1, checkpoint.MaxDepthReached)
+	require.Len(t, checkpoint.Pages, 1)
+	assert.Equal(t, "Home", checkpoint.Pages[0].Title)
+
+	// The page being fetched when the checkpoint was taken is crawled again on resume
+	assert.ElementsMatch(t, []string{"https://example.com/", "https://example.com/a"}, checkpoint.Visited)
+	require.Len(t, checkpoint.Queue, 2)
+	assert.Equal(t, "https://example.com/a", checkpoint.Queue[0].URL)
+	assert.Equal(t, "https://example.com/b", checkpoint.Queue[1].URL)
+}
+
+func TestResumeContinuesFromCheckpoint(t *testing.T) {
+	server := newTestSite(checkpointTestPages)
+	defer server.Close()
+
+	seed := server.URL + "/"
+	auditDir := t.TempDir()
+
+	writer := newTestCrawler(checkpointEveryPage)
+	writer.outputDir = auditDir
+	writer.seedURL = seed
+	writer.runStart = time.Now()
+	writer.elapsed = 2 * time.Second
+	writer.markVisited(seed)
+	writer.inflight = map[string]CrawlTask{}
+	writer.Queue.Push(CrawlTask{URL: server.URL + "/a", Depth: 1, Parent: seed})
+	writer.Queue.Push(CrawlTask{URL: server.URL + "/b", Depth: 1, Parent: seed})
+	writer.Results = []PageData{{URL: seed, Title: "/", Depth: 0}}
+	require.NoError(t, writer.saveCheckpoint())
+
+	result, err := newTestCrawler(checkpointEveryPage).Resume(context.Background(), auditDir)
+	require.NoError(t, err)
+
+	assert.True(t, result.Metadata.Resumed)
+	assert.GreaterOrEqual(t, result.Metadata.DurationMs, 2000)
+	require.Len(t, result.Pages, 3)
+
+	urls := make([]string, 0, len(result.Pages))
+	for _, page := range result.Pages {
+		urls = append(urls, page.URL)
+	}
+	assert.ElementsMatch(t, []string{seed, server.URL + "/a", server.URL + "/b"}, urls)
+
+	// A finished crawl leaves its result and no checkpoint behind
+	assert.False(t, HasCheckpoint(auditDir))
+	assert.FileExists(t, filepath.Join(auditDir, "crawl_index.json"))
+}
+
+func TestCrawlKeepsCheckpointWhenInterrupted(t *testing.T) {
+	server := newTestSite(checkpointTestPages)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// A cancelled crawl must not delete the checkpoint it would resume from
+	auditDir := t.TempDir()
+	writer := newTestCrawler(checkpointEveryPage)
+	writer.outputDir = auditDir
+	writer.runStart = time.Now()
+	require.NoError(t, writer.saveCheckpoint())
+
+	_, _ = newTestCrawler(checkpointEveryPage).Crawl(ctx, server.URL, auditDir)
+	assert.True(t, HasCheckpoint(auditDir))
+}
+
+func TestCanResume(t *testing.T) {
+	auditDir := t.TempDir()
+	crawler := newTestCrawler(checkpointEveryPage)
+	assert.False(t, crawler.CanResume(auditDir, "https://example.com/", false))
+
+	writer := newTestCrawler(checkpointEveryPage)
+	writer.reset("https://example.com/", auditDir, false)
+	writer.runStart = time.Now()
+	require.NoError(t, writer.saveCheckpoint())
+
+	// Only the crawl of the same seed, in the same mode, is resumed
+	assert.True(t, crawler.CanResume(auditDir, "https://example.com/", false))
+	assert.False(t, crawler.CanResume(auditDir, "https://other.example.com/", false))
+	assert.False(t, crawler.CanResume(auditDir, "https://example.com/", true))
+}
+
+func TestResumeWithoutCheckpoint(t *testing.T) {
+	_, err := newTestCrawler(checkpointEveryPage).Resume(context.Background(), t.TempDir())
+	assert.Error(t, err)
+}
+
+func TestCheckpointAppendsOnlyWhatChanged(t *testing.T) {
+	c := newTestCrawler(checkpointEveryPage)
+	c.outputDir = t.TempDir()
+	c.seedURL = "https://example.com/"
+	c.runStart = time.Now()
+	c.markVisited("https://example.com/")
+	c.Results = []PageData{{URL: "https://example.com/"}}
+	require.NoError(t, c.saveCheckpoint())
+
+	journal := filepath.Join(c.outputDir, journalFileName)
+	first, err := os.Stat(journal)
+	require.NoError(t, err)
+
+	c.markVisited("https://example.com/a")
+	c.Results = append(c.Results, PageData{URL: "https://example.com/a"})
+	c.Excluded = append(c.Excluded, ExcludedURL{URL: "https://example.com/admin/", Rule: "pattern"})
+	require.NoError(t, c.saveCheckpoint())
+
+	// The second checkpoint appended its pages rather than rewriting the first
+	second, err := os.Stat(journal)
+	require.NoError(t, err)
+	data, err := os.ReadFile(journal)
+	require.NoError(t, err)
+	assert.Greater(t, second.Size(), first.Size())
+	assert.Equal(t, 5, bytes.Count(data, []byte("\n")))
+
+	checkpoint, err := LoadCheckpoint(c.outputDir)
+	require.NoError(t, err)
+	assert.Equal(t, second.Size(), checkpoint.JournalSize)
+	assert.Len(t, checkpoint.Pages, 2)
+	assert.Equal(t, []string{"https://example.com/", "https://example.com/a"}, checkpoint.Visited)
+	assert.Len(t, checkpoint.Excluded, 1)
+}
+
+func TestResumeIgnoresJournalPastCheckpoint(t *testing.T) {
+	server := newTestSite(checkpointTestPages)
+	defer server.Close()
+
+	seed := server.URL + "/"
+	auditDir := t.TempDir()
+
+	writer := newTestCrawler(checkpointEveryPage)
+	writer.outputDir = auditDir
+	writer.seedURL = seed
+	writer.runStart = time.Now()
+	writer.markVisited(seed)
+	writer.Results = []PageData{{URL: seed, Title: "/"}}
+	require.NoError(t, writer.saveCheckpoint())
+
+	// A crash between the journal and the checkpoint leaves records the
+	// checkpoint does not know about
+	journal, err := os.OpenFile(filepath.Join(auditDir, journalFileName), os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = journal.WriteString(`{"page":{"url":"` + server.URL + `/lost"}}` + "\n" + `{"visited":`)
+	require.NoError(t, err)
+	require.NoError(t, journal.Close())
+
+	result, err := newTestCrawler(checkpointEveryPage).Resume(context.Background(), auditDir)
+	require.NoError(t, err)
+	require.Len(t, result.Pages, 1)
+	assert.Equal(t, seed, result.Pages[0].URL)
+	assert.NoFileExists(t, filepath.Join(auditDir, journalFileName))
+}
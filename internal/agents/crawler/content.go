@@ -0,0 +1,318 @@
+package crawler
+
+import (
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// minParagraphLength is the shortest text scored as a paragraph
+const minParagraphLength = 25
+
+// ignoredTags never hold visible text
+var ignoredTags = map[string]bool{
+	"head": true, "script": true, "style": true, "noscript": true,
+	"template": true, "svg": true, "iframe": true, "object": true,
+}
+
+// boilerplateTags are site chrome, unless inside the main content where a
+// header or footer belongs to the article
+var boilerplateTags = map[string]bool{
+	"nav": true, "header": true, "footer": true, "aside": true,
+}
+
+// boilerplateRoles are the ARIA landmarks of site chrome
+var boilerplateRoles = map[string]bool{
+	"navigation": true, "banner": true, "contentinfo": true,
+	"complementary": true, "search": true, "dialog": true, "alertdialog": true,
+}
+
+// blockTags separate words when their text is joined
+var blockTags = map[string]bool{
+	"address": true, "article": true, "blockquote": true, "dd": true, "div": true,
+	"dl": true, "dt": true, "figcaption": true, "figure": true, "h1": true,
+	"h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "li": true,
+	"main": true, "ol": true, "p": true, "pre": true, "section": true,
+	"table": true, "td": true, "th": true, "tr": true, "ul": true, "br": true,
+}
+
+// paragraphTags are scored for their text density
+var paragraphTags = map[string]bool{
+	"p": true, "pre": true, "blockquote": true, "td": true, "li": true,
+}
+
+// boilerplateHint matches the id and class names of menus, banners and
+// widgets: "main-nav", "cookie-banner", "share"...
+var boilerplateHint = regexp.MustCompile(`(?i)(^|[-_\s])(nav|navbar|navigation|menu|sidebar|breadcrumbs?|cookies?|consent|gdpr|banner|social|share|sharing|newsletter|popup|modal|advert|ads|promo|related|comments?)([-_\s]|$)`)
+
+// chromeHint matches the id and class names of the site header and footer,
+// which inside the main content are the article's own ("entry-header")
+var chromeHint = regexp.MustCompile(`(?i)(^|[-_\s])(header|footer|masthead)([-_\s]|$)`)
+
+// extractMainContent splits the visible text of a document into its main
+// content and its boilerplate, in a readability-like way: a <main> element
+// wins, then the largest <article>, then the block with the best text
+// density. Navigation, headers, footers, asides and elements named like
+// menus or banners are boilerplate wherever they are.
+func extractMainContent(doc *html.Node) (string, string) {
+	body := findElement(doc, "body")
+	if body == nil {
+		body = doc
+	}
+
+	main := findMainElement(body)
+	if main == nil {
+		main = bestArticle(body)
+	}
+	if main == nil {
+		main = bestScoredBlock(body)
+	}
+	if main == nil {
+		main = body
+	}
+
+	var mainText, boilerplate strings.Builder
+	var walk func(n *html.Node, inMain, inBoilerplate bool)
+	walk = func(n *html.Node, inMain, inBoilerplate bool) {
+		switch n.Type {
+		case html.TextNode:
+			target := &boilerplate
+			if inMain && !inBoilerplate {
+				target = &mainText
+			}
+			target.WriteString(n.Data)
+			return
+		case html.ElementNode:
+			if ignoredTags[n.Data] {
+				return
+			}
+			if n != main {
+				inBoilerplate = inBoilerplate || isBoilerplate(n, inMain)
+			}
+			inMain = inMain || n == main
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c, inMain, inBoilerplate)
+		}
+		if n.Type == html.ElementNode && blockTags[n.Data] {
+			// Keep the words of adjacent blocks apart
+			if inMain && !inBoilerplate {
+				mainText.WriteByte(' ')
+			} else {
+				boilerplate.WriteByte(' ')
+			}
+		}
+	}
+	walk(body, body == main, false)
+
+	return collapseSpaces(mainText.String()), collapseSpaces(boilerplate.String())
+}
+
+// isBoilerplate reports whether an element is site chrome. Inside the main
+// content, header and footer tags are the article's own.
+func isBoilerplate(n *html.Node, inMain bool) bool {
+	if n.Data == "main" || n.Data == "article" || n.Data == "body" {
+		return false
+	}
+	if boilerplateTags[n.Data] && !(inMain && (n.Data == "header" || n.Data == "footer")) {
+		return true
+	}
+	for _, attr := range n.Attr {
+		switch attr.Key {
+		case "role":
+			if boilerplateRoles[strings.ToLower(attr.Val)] {
+				return true
+			}
+		case "id", "class":
+			if boilerplateHint.MatchString(attr.Val) || (!inMain && chromeHint.MatchString(attr.Val)) {
+				return true
+			}
+		case "aria-hidden":
+			if attr.Val == "true" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// findMainElement returns the <main> element or the element with role=main
+func findMainElement(n *html.Node) *html.Node {
+	if n.Type == html.ElementNode {
+		if ignoredTags[n.Data] {
+			return nil
+		}
+		if n.Data == "main" || strings.EqualFold(attribute(n, "role"), "main") {
+			return n
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findMainElement(c); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// bestArticle returns the <article> holding the most text outside
+// boilerplate, ignoring articles nested in another one
+func bestArticle(body *html.Node) *html.Node {
+	var best *html.Node
+	bestLength := 0
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			if ignoredTags[n.Data] || isBoilerplate(n, false) {
+				return
+			}
+			if n.Data == "article" {
+				if length := len(visibleText(n)); length > bestLength {
+					best, bestLength = n, length
+				}
+				return
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(body)
+	return best
+}
+
+// bestScoredBlock scores every paragraph on its length and commas, credits
+// its parent with the score and its grandparent with half of it, then
+// returns the block with the best score once weighed down by its link
+// density
+func bestScoredBlock(body *html.Node) *html.Node {
+	scores := make(map[*html.Node]float64)
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			if ignoredTags[n.Data] || isBoilerplate(n, false) {
+				return
+			}
+			if paragraphTags[n.Data] || (n.Data == "div" && !hasBlockChild(n)) {
+				text := visibleText(n)
+				if len(text) >= minParagraphLength {
+					score := 1 + float64(strings.Count(text, ",")) + float64(min(len(text)/100, 3))
+					if parent := n.Parent; parent != nil {
+						scores[parent] += score
+						if grandparent := parent.Parent; grandparent != nil {
+							scores[grandparent] += score / 2
+						}
+					}
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(body)
+
+	var best *html.Node
+	bestScore := 0.0
+	for candidate, score := range scores {
+		if candidate.Type != html.ElementNode {
+			continue
+		}
+		score *= 1 - linkDensity(candidate)
+		if score > bestScore || (score == bestScore && best != nil && contains(candidate, best)) {
+			best, bestScore = candidate, score
+		}
+	}
+	return best
+}
+
+// linkDensity is the share of an element's text that sits in links
+func linkDensity(n *html.Node) float64 {
+	total := len(visibleText(n))
+	if total == 0 {
+		return 0
+	}
+	linked := 0
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "a" {
+			linked += len(visibleText(n))
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return float64(linked) / float64(total)
+}
+
+// visibleText returns the text of n outside scripts and boilerplate
+func visibleText(n *html.Node) string {
+	var builder strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			builder.WriteString(n.Data)
+			return
+		case html.ElementNode:
+			if ignoredTags[n.Data] || isBoilerplate(n, false) {
+				return
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+		if n.Type == html.ElementNode && blockTags[n.Data] {
+			builder.WriteByte(' ')
+		}
+	}
+	walk(n)
+	return collapseSpaces(builder.String())
+}
+
+func hasBlockChild(n *html.Node) bool {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && blockTags[c.Data] && c.Data != "br" {
+			return true
+		}
+	}
+	return false
+}
+
+// contains reports whether ancestor is, or contains, n
+func contains(ancestor, n *html.Node) bool {
+	for ; n != nil; n = n.Parent {
+		if n == ancestor {
+			return true
+		}
+	}
+	return false
+}
+
+func findElement(n *html.Node, tag string) *html.Node {
+	if n.Type == html.ElementNode && n.Data == tag {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findElement(c, tag); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func attribute(n *html.Node, key string) string {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+func collapseSpaces(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
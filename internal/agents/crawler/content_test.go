@@ -0,0 +1,86 @@
+package crawler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const articleText = "Le salamandre de feu vit dans les forêts humides, sous les feuilles mortes, et sort surtout les nuits de pluie."
+
+func TestExtractContentPrefersMain(t *testing.T) {
+	page, err := ExtractContent("https://example.com/", `<html><body>
+		<header><a href="/">Accueil</a></header>
+		<nav><ul><li><a href="/a">Produits</a></li><li><a href="/b">Contact</a></li></ul></nav>
+		<main>
+			<header class="entry-header"><h1>La salamandre</h1></header>
+			<div><div><p>`+articleText+`</p></div></div>
+		</main>
+		<aside>Articles populaires de la semaine</aside>
+		<footer>Mentions légales</footer>
+		<div class="cookie-banner">Nous utilisons des cookies pour mesurer l'audience.</div>
+	</body></html>`, 0)
+	require.NoError(t, err)
+
+	assert.Equal(t, "La salamandre "+articleText, page.Content)
+	for _, boilerplate := range []string{"Accueil", "Produits", "Articles populaires", "Mentions légales", "cookies"} {
+		assert.Contains(t, page.BoilerplateContent, boilerplate)
+		assert.NotContains(t, page.Content, boilerplate)
+	}
+}
+
+func TestExtractContentDoesNotDuplicateNestedText(t *testing.T) {
+	page, err := ExtractContent("https://example.com/", `<html><body>
+		<div><div><div><section><p>`+articleText+`</p></section></div></div></div>
+	</body></html>`, 0)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, strings.Count(page.Content, "salamandre"))
+}
+
+func TestExtractContentPrefersLargestArticle(t *testing.T) {
+	page, err := ExtractContent("https://example.com/", `<html><body>
+		<article><p>Brève</p></article>
+		<article><h2>Habitat</h2><p>`+articleText+`</p></article>
+	</body></html>`, 0)
+	require.NoError(t, err)
+
+	assert.Equal(t, "Habitat "+articleText, page.Content)
+	assert.Equal(t, "Brève", page.BoilerplateContent)
+}
+
+func TestExtractContentScoresTextDensity(t *testing.T) {
+	page, err := ExtractContent("https://example.com/", `<html><body>
+		<div id="top"><a href="/a">Un lien de menu assez long</a> <a href="/b">Un autre lien de menu assez long</a></div>
+		<div id="story">
+			<p>`+articleText+`</p>
+			<p>Elle se nourrit d'insectes, de vers et de limaces, qu'elle chasse à l'affût.</p>
+		</div>
+		<div class="share-links">Partager sur les réseaux sociaux</div>
+	</body></html>`, 0)
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(page.Content, articleText))
+	assert.Contains(t, page.Content, "limaces")
+	assert.NotContains(t, page.Content, "lien de menu")
+	assert.NotContains(t, page.Content, "Partager")
+	assert.Contains(t, page.BoilerplateContent, "lien de menu")
+	assert.Contains(t, page.BoilerplateContent, "Partager")
+}
+
+func TestExtractContentRecordsAnchorRel(t *testing.T) {
+	page, err := ExtractContent("https://example.com/", `<html><body>
+		<a href="/a">Followed</a>
+		<a href="/b" rel="NoFollow noopener">Sponsored</a>
+		<a href="/c" rel="ugc">Comment</a>
+	</body></html>`, 0)
+	require.NoError(t, err)
+
+	require.Len(t, page.Anchors, 3)
+	assert.False(t, page.Anchors[0].NoFollow())
+	assert.Equal(t, "NoFollow noopener", page.Anchors[1].Rel)
+	assert.True(t, page.Anchors[1].NoFollow())
+	assert.False(t, page.Anchors[2].NoFollow())
+}
@@ -1,11 +1,13 @@
 package crawler
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/url"
 	"strings"
 	"sync"
+	"time"
 
 	"firesalamander/internal/config"
 	"golang.org/x/net/html"
@@ -14,69 +16,151 @@ import (
 type Crawler struct {
 	Config     config.CrawlerConfig
 	Visited    map[string]bool
-	Queue      []CrawlTask
+	Queue      Frontier
 	Results    []PageData
+	Blocked    []BlockedURL
+	Redirects  []RedirectRecord
+	Excluded   []ExcludedURL
 	mutex      sync.RWMutex
 	client     *http.Client
+	robots     *robotsCache
+	politeness *politeness
+	sitemap    map[string]SitemapEntry
+	outputDir  string
+	cache      *httpCache
+	normalizer *URLNormalizer
+	scope      *scopeRules
+	traps      *trapDetector
+
+	// Crawl session state, kept so it can be checkpointed and resumed
+	seedURL         string
+	sitemapEntries  []SitemapEntry
+	// sitemapQueued counts the sitemap entries already in the frontier.
+	// The others wait for the seed's links so they cannot crowd them out.
+	sitemapQueued   int
+	inflight        map[string]CrawlTask
+	held            *CrawlTask
+	cond            *sync.Cond
+	maxDepthReached int
+	elapsed         time.Duration
+	runStart        time.Time
+	resumed         bool
+	listMode        bool
+	discovered      []string
+	checkpointMutex sync.Mutex
+	journal         journalState
+	pages           *pageWriter
+	cacheHits       int
+	cacheMisses     int
+
+	// records holds the blocked, redirected and excluded URLs of a lean
+	// crawl on disk, recordsSize the part of it the crawl counts on
+	records     *recordWriter
+	recordsSize int64
+
+	// remote is set when worker processes fetch the pages
+	remote *Coordinator
+
+	// replay answers the requests when the crawl replays a WARC archive,
+	// in place of the transport kept in replayed
+	replay   *WARCReplay
+	replayed http.RoundTripper
+
+	// Budget accounting
+	bytesDownloaded  int64
+	directoryPages   map[string]int
+	budgetsExhausted []string
+	stoppedBy        string
+	// stopAssets cancels the asset pass once a budget stops the crawl
+	stopAssets context.CancelFunc
+
+	// What the crawl moved to disk to bound its memory
+	spillDir     string
+	visitedSpill *visitedStore
 }
 
-func NewCrawler(config config.CrawlerConfig) *Crawler {
-	return &Crawler{
-		Config:  config,
-		Visited: make(map[string]bool),
-		Queue:   make([]CrawlTask, 0),
-		Results: make([]PageData, 0),
+func NewCrawler(cfg config.CrawlerConfig) *Crawler {
+	// LoadCrawlerConfig already rejects malformed rates
+	rate, _ := config.ParseRateLimit(cfg.Performance.RateLimit)
+
+	c := &Crawler{
+		Config:    cfg,
+		Visited:   make(map[string]bool),
+		Queue:     NewFrontier(cfg),
+		Results:   make([]PageData, 0),
+		Blocked:   make([]BlockedURL, 0),
+		Redirects: make([]RedirectRecord, 0),
+		Excluded:  make([]ExcludedURL, 0),
 		client: &http.Client{
-			Timeout: config.Performance.RequestTimeout,
+			Timeout:   cfg.Performance.RequestTimeout,
+			Transport: newTransport(cfg.HostOverrides),
 		},
+		robots:     newRobotsCache(),
+		politeness: newPoliteness(rate, cfg.Performance.ConcurrentRequests),
+		sitemap:    make(map[string]SitemapEntry),
+		inflight:   make(map[string]CrawlTask),
+		cache:      newHTTPCache(cfg.Performance.CacheDir),
+		normalizer: NewURLNormalizer(cfg.Normalization),
+		scope:      newScopeRules(cfg),
+		traps:      newTrapDetector(cfg.Traps),
 	}
+	c.cond = sync.NewCond(&c.mutex)
+	c.client.CheckRedirect = c.checkRedirect
+	return c
 }
 
+// ShouldCrawlURL reports whether urlStr passes the exclusions, the scope
+// rules, the traps detected so far and the robots.txt rules already loaded
+// for its host. It fetches and records nothing: a host whose robots.txt was
+// not loaded yet is not held against the URL.
 func (c *Crawler) ShouldCrawlURL(urlStr string) bool {
-	// Check extensions
-	for _, ext := range c.Config.Exclusions.Extensions {
-		if strings.HasSuffix(urlStr, ext) {
-			return false
-		}
+	if c.scope.excludedBy(urlStr, c.Config.Exclusions.Extensions, urlStr == c.seedURL) != "" {
+		return false
 	}
-
-	// Check patterns
-	for _, pattern := range c.Config.Exclusions.Patterns {
-		if strings.Contains(urlStr, pattern) {
-			return false
-		}
+	if c.trapped(urlStr) {
+		return false
 	}
-
-	return true
-}
-
-func (c *Crawler) RespectDepthLimit(depth int) bool {
-	return depth <= c.Config.Limits.MaxDepth
+	if !c.Config.Respect.RobotsTxt {
+		return true
+	}
+	rules := c.loadedRobots(urlStr)
+	if rules == nil {
+		return true
+	}
+	allowed, _ := rules.Allowed(c.Config.UserAgent, urlStr)
+	return allowed
 }
 
-func NormalizeURL(urlStr string) string {
-	u, err := url.Parse(urlStr)
-	if err != nil {
-		return urlStr
+// shouldCrawl is ShouldCrawlURL for the scheduler: it fetches robots.txt
+// within ctx and records the excluded and blocked URLs
+func (c *Crawler) shouldCrawl(ctx context.Context, urlStr string) bool {
+	// Check extensions, exclusion patterns and scope rules
+	if rule := c.scope.excludedBy(urlStr, c.Config.Exclusions.Extensions, urlStr == c.seedURL); rule != "" {
+		c.mutex.Lock()
+		c.addExcluded(ExcludedURL{URL: urlStr, Rule: rule})
+		c.mutex.Unlock()
+		return false
 	}
 
-	// Remove fragment
-	u.Fragment = ""
-
-	// Remove UTM parameters
-	q := u.Query()
-	utmParams := []string{"utm_source", "utm_medium", "utm_campaign", "utm_term", "utm_content"}
-	for _, param := range utmParams {
-		q.Del(param)
+	// Drop queued URLs caught by a trap detected since they were queued
+	if c.trapped(urlStr) {
+		return false
 	}
-	u.RawQuery = q.Encode()
 
-	// Remove trailing slash for non-root paths
-	if u.Path != "/" && strings.HasSuffix(u.Path, "/") {
-		u.Path = strings.TrimSuffix(u.Path, "/")
-	}
+	// Check robots.txt
+	return c.allowedByRobots(ctx, urlStr)
+}
 
-	return u.String()
+// trapped reports whether urlStr falls in a trap detected so far. The seed
+// and the URLs of a list crawl are never trapped.
+func (c *Crawler) trapped(urlStr string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return !c.listMode && urlStr != c.seedURL && c.traps.match(urlStr)
+}
+
+func (c *Crawler) RespectDepthLimit(depth int) bool {
+	return depth <= c.Config.Limits.MaxDepth
 }
 
 func ExtractContent(pageURL, htmlContent string, depth int) (*PageData, error) {
@@ -99,6 +183,10 @@ func ExtractContent(pageURL, htmlContent string, depth int) (*PageData, error) {
 	var traverse func(*html.Node)
 	traverse = func(n *html.Node) {
 		if n.Type == html.ElementNode {
+			for _, ref := range assetRefs(n) {
+				page.addAsset(ref)
+			}
+
 			switch n.Data {
 			case "html":
 				// Extract language
@@ -110,8 +198,8 @@ func ExtractContent(pageURL, htmlContent string, depth int) (*PageData, error) {
 			case "title":
 				page.Title = getTextContent(n)
 			case "link":
-				// Extract canonical
-				var rel, href string
+				// Extract canonical and hreflang alternates
+				var rel, href, hreflang string
 				for _, attr := range n.Attr {
 					if attr.Key == "rel" {
 						rel = attr.Val
@@ -119,12 +207,22 @@ func ExtractContent(pageURL, htmlContent string, depth int) (*PageData, error) {
 					if attr.Key == "href" {
 						href = attr.Val
 					}
+					if attr.Key == "hreflang" {
+						hreflang = strings.TrimSpace(attr.Val)
+					}
 				}
 				if rel == "canonical" {
 					page.Canonical = href
 				}
+				if hasRel(rel, "alternate") && hreflang != "" && href != "" {
+					page.Hreflang = append(page.Hreflang, HreflangLink{
+						Lang:   hreflang,
+						URL:    absoluteURL(pageURL, href),
+						Source: HreflangSourceHTML,
+					})
+				}
 			case "meta":
-				// Check robots meta
+				// Check robots metas
 				var name, content string
 				for _, attr := range n.Attr {
 					if attr.Key == "name" {
@@ -134,8 +232,9 @@ func ExtractContent(pageURL, htmlContent string, depth int) (*PageData, error) {
 						content = attr.Val
 					}
 				}
-				if name == "robots" && strings.Contains(content, "noindex") {
-					page.MetaIndex = false
+				if agent := robotsMetaAgent(name); agent != "" {
+					page.Robots.add(RobotsDeclaration{Source: RobotsSourceMeta, Agent: agent, Value: content})
+					page.MetaIndex = !page.Robots.NoIndex
 				}
 			case "h1":
 				if page.H1 == "" { // Only first H1
@@ -146,10 +245,13 @@ func ExtractContent(pageURL, htmlContent string, depth int) (*PageData, error) {
 			case "h3":
 				page.H3 = append(page.H3, getTextContent(n))
 			case "a":
-				var href, text string
+				var href, rel, text string
 				for _, attr := range n.Attr {
-					if attr.Key == "href" {
+					switch attr.Key {
+					case "href":
 						href = attr.Val
+					case "rel":
+						rel = attr.Val
 					}
 				}
 				text = getTextContent(n)
@@ -157,18 +259,13 @@ func ExtractContent(pageURL, htmlContent string, depth int) (*PageData, error) {
 					page.Anchors = append(page.Anchors, Anchor{
 						Text: strings.TrimSpace(text),
 						Href: href,
+						Rel:  strings.TrimSpace(rel),
 					})
 					// Add to outgoing links if internal
 					if isInternalLink(href, pageURL) {
 						page.OutgoingLinks = append(page.OutgoingLinks, href)
 					}
 				}
-			case "p", "div", "article", "section":
-				// Extract main content
-				content := getTextContent(n)
-				if len(content) > 50 { // Meaningful content
-					page.Content += content + " "
-				}
 			}
 		}
 
@@ -179,14 +276,14 @@ func ExtractContent(pageURL, htmlContent string, depth int) (*PageData, error) {
 
 	traverse(doc)
 
+	// Split the text between main content and boilerplate
+	page.Content, page.BoilerplateContent = extractMainContent(doc)
+
 	// Detect language if not set
 	if page.Lang == "" {
 		page.Lang = DetectLanguage(page.Content)
 	}
 
-	// Clean content
-	page.Content = strings.TrimSpace(page.Content)
-
 	return page, nil
 }
 
@@ -3,6 +3,7 @@ package crawler
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
@@ -16,6 +17,56 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
+// newTestConfig returns the config of a crawler fetching a single page from
+// a test server, with override, when set, applied to it
+func newTestConfig(override func(cfg *appconfig.CrawlerConfig)) appconfig.CrawlerConfig {
+	cfg := appconfig.CrawlerConfig{
+		UserAgent:   "Test-Bot/1.0",
+		Limits:      appconfig.Limits{MaxURLs: 1, MaxDepth: 0},
+		Performance: appconfig.Performance{ConcurrentRequests: 1, RequestTimeout: 5 * time.Second},
+	}
+	if override != nil {
+		override(&cfg)
+	}
+	return cfg
+}
+
+// newTestCrawler returns a crawler built from newTestConfig(override)
+func newTestCrawler(override func(cfg *appconfig.CrawlerConfig)) *Crawler {
+	return NewCrawler(newTestConfig(override))
+}
+
+// testPage is what newTestSite serves at a path: Body with a 200, or a
+// redirect to Location with Status, 301 by default
+type testPage struct {
+	Body     string
+	Location string
+	Status   int
+}
+
+// newTestSite serves pages by path. Paths missing from pages get the "*"
+// page, or a 404 when there is none.
+func newTestSite(pages map[string]testPage) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, ok := pages[r.URL.Path]
+		if !ok {
+			page, ok = pages["*"]
+		}
+		switch {
+		case !ok:
+			http.NotFound(w, r)
+		case page.Location != "":
+			status := page.Status
+			if status == 0 {
+				status = http.StatusMovedPermanently
+			}
+			http.Redirect(w, r, page.Location, status)
+		default:
+			fmt.Fprint(w, page.Body)
+		}
+	}))
+}
+
 func TestNewCrawler(t *testing.T) {
 	cfg := appconfig.CrawlerConfig{
 		Limits: appconfig.Limits{
@@ -0,0 +1,272 @@
+package crawler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Robots declaration sources
+const (
+	RobotsSourceMeta   = "meta"
+	RobotsSourceHeader = "header"
+)
+
+// Robots agents. Directives declared for all robots or for Googlebot make
+// the effective directives of a page; other bots are only recorded.
+const (
+	RobotsAgentAll       = "robots"
+	RobotsAgentGooglebot = "googlebot"
+)
+
+// IndexableReason is the indexability reason of an indexable page
+const IndexableReason = "indexable"
+
+// RobotsDeclaration is one robots directive list found on a page, in a
+// <meta name="robots|googlebot|..."> tag or an X-Robots-Tag header
+type RobotsDeclaration struct {
+	Source string `json:"source"`
+	Agent  string `json:"agent"`
+	Value  string `json:"value"`
+}
+
+// RobotsDirectives are the effective robots directives of a page. The most
+// restrictive declaration wins.
+type RobotsDirectives struct {
+	NoIndex          bool   `json:"noindex,omitempty"`
+	NoFollow         bool   `json:"nofollow,omitempty"`
+	NoArchive        bool   `json:"noarchive,omitempty"`
+	NoSnippet        bool   `json:"nosnippet,omitempty"`
+	NoImageIndex     bool   `json:"noimageindex,omitempty"`
+	NoTranslate      bool   `json:"notranslate,omitempty"`
+	MaxSnippet       *int   `json:"max_snippet,omitempty"`
+	MaxImagePreview  string `json:"max_image_preview,omitempty"`
+	MaxVideoPreview  *int   `json:"max_video_preview,omitempty"`
+	UnavailableAfter string `json:"unavailable_after,omitempty"`
+
+	Declarations []RobotsDeclaration `json:"declarations,omitempty"`
+}
+
+// valueDirectives take a value after a colon, so "max-snippet:50" is not
+// mistaken for an agent prefix
+var valueDirectives = map[string]bool{
+	"max-snippet":       true,
+	"max-image-preview": true,
+	"max-video-preview": true,
+	"unavailable_after": true,
+}
+
+// unavailableAfterLayouts are the date formats accepted for unavailable_after
+var unavailableAfterLayouts = []string{
+	time.RFC3339,
+	time.RFC1123,
+	time.RFC1123Z,
+	time.RFC850,
+	time.RFC822,
+	time.RFC822Z,
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+	"2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006",
+}
+
+// appliesTo reports whether a declaration counts for the effective directives
+func (d RobotsDeclaration) appliesTo() bool {
+	return d.Agent == RobotsAgentAll || d.Agent == RobotsAgentGooglebot
+}
+
+// label names the declaration in indexability reasons
+func (d RobotsDeclaration) label() string {
+	if d.Source == RobotsSourceHeader {
+		if d.Agent == RobotsAgentAll {
+			return "X-Robots-Tag header"
+		}
+		return fmt.Sprintf("X-Robots-Tag header for %s", d.Agent)
+	}
+	return fmt.Sprintf("meta %s", d.Agent)
+}
+
+// add records a declaration and merges it into the effective directives when
+// it applies to all robots or to Googlebot
+func (r *RobotsDirectives) add(declaration RobotsDeclaration) {
+	r.Declarations = append(r.Declarations, declaration)
+	if declaration.appliesTo() {
+		r.merge(parseRobotsValue(declaration.Value))
+	}
+}
+
+// merge keeps the most restrictive of r and other
+func (r *RobotsDirectives) merge(other RobotsDirectives) {
+	r.NoIndex = r.NoIndex || other.NoIndex
+	r.NoFollow = r.NoFollow || other.NoFollow
+	r.NoArchive = r.NoArchive || other.NoArchive
+	r.NoSnippet = r.NoSnippet || other.NoSnippet
+	r.NoImageIndex = r.NoImageIndex || other.NoImageIndex
+	r.NoTranslate = r.NoTranslate || other.NoTranslate
+	r.MaxSnippet = minLimit(r.MaxSnippet, other.MaxSnippet)
+	r.MaxVideoPreview = minLimit(r.MaxVideoPreview, other.MaxVideoPreview)
+	if other.MaxImagePreview != "" && imagePreviewRank(other.MaxImagePreview) < imagePreviewRank(r.MaxImagePreview) {
+		r.MaxImagePreview = other.MaxImagePreview
+	}
+	if other.UnavailableAfter != "" && r.UnavailableAfter == "" {
+		r.UnavailableAfter = other.UnavailableAfter
+	}
+}
+
+// minLimit returns the smaller of two limits where -1 means no limit
+func minLimit(a, b *int) *int {
+	switch {
+	case a == nil:
+		return b
+	case b == nil || *b < 0:
+		return a
+	case *a < 0 || *b < *a:
+		return b
+	}
+	return a
+}
+
+func imagePreviewRank(value string) int {
+	switch value {
+	case "none":
+		return 0
+	case "standard":
+		return 1
+	case "large":
+		return 2
+	}
+	return 3
+}
+
+// parseRobotsValue parses a comma separated directive list such as
+// "noindex, max-snippet:50, unavailable_after: 2025-01-01". Dates may hold
+// commas, so tokens following unavailable_after that are not directives
+// belong to its date.
+func parseRobotsValue(value string) RobotsDirectives {
+	var directives RobotsDirectives
+	inDate := false
+	for _, token := range strings.Split(value, ",") {
+		token = strings.TrimSpace(token)
+		if token == "" {
+			continue
+		}
+		key, arg, _ := strings.Cut(token, ":")
+		key = strings.ToLower(strings.TrimSpace(key))
+		arg = strings.TrimSpace(arg)
+
+		switch key {
+		case "noindex":
+			directives.NoIndex = true
+		case "nofollow":
+			directives.NoFollow = true
+		case "none":
+			directives.NoIndex, directives.NoFollow = true, true
+		case "noarchive", "nocache":
+			directives.NoArchive = true
+		case "nosnippet":
+			directives.NoSnippet = true
+		case "noimageindex":
+			directives.NoImageIndex = true
+		case "notranslate":
+			directives.NoTranslate = true
+		case "all", "index", "follow":
+		case "max-snippet":
+			directives.MaxSnippet = parseLimit(arg)
+		case "max-video-preview":
+			directives.MaxVideoPreview = parseLimit(arg)
+		case "max-image-preview":
+			directives.MaxImagePreview = strings.ToLower(arg)
+		case "unavailable_after":
+			directives.UnavailableAfter = arg
+			inDate = true
+			continue
+		default:
+			if inDate {
+				directives.UnavailableAfter += ", " + token
+				continue
+			}
+		}
+		inDate = false
+	}
+	return directives
+}
+
+func parseLimit(value string) *int {
+	limit, err := strconv.Atoi(value)
+	if err != nil {
+		return nil
+	}
+	return &limit
+}
+
+// parseRobotsHeader splits an X-Robots-Tag value into its agent and
+// directives: "googlebot: noindex, nofollow" targets Googlebot, "noindex"
+// targets every robot
+func parseRobotsHeader(value string) RobotsDeclaration {
+	declaration := RobotsDeclaration{Source: RobotsSourceHeader, Agent: RobotsAgentAll, Value: strings.TrimSpace(value)}
+	prefix, rest, found := strings.Cut(value, ":")
+	prefix = strings.ToLower(strings.TrimSpace(prefix))
+	if found && prefix != "" && !strings.ContainsAny(prefix, ", ") && !valueDirectives[prefix] {
+		declaration.Agent = prefix
+		declaration.Value = strings.TrimSpace(rest)
+	}
+	return declaration
+}
+
+// robotsMetaAgent returns the agent a meta tag name targets, or "" when the
+// meta is not a robots meta. Bot specific names are recognised by the
+// "bot" they contain (googlebot, googlebot-news, bingbot...).
+func robotsMetaAgent(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == RobotsAgentAll || strings.Contains(name, "bot") {
+		return name
+	}
+	return ""
+}
+
+// applyRobotsHeaders merges the X-Robots-Tag headers into the page directives
+func applyRobotsHeaders(page *PageData, values []string) {
+	for _, value := range values {
+		if strings.TrimSpace(value) == "" {
+			continue
+		}
+		page.Robots.add(parseRobotsHeader(value))
+	}
+	page.MetaIndex = !page.Robots.NoIndex
+}
+
+// indexability tells whether a page can be indexed at now, and why. Robots
+// directives come first, then an expired unavailable_after, then a
+// canonical pointing elsewhere.
+func (p *PageData) indexability(now time.Time) (bool, string) {
+	for _, declaration := range p.Robots.Declarations {
+		if declaration.appliesTo() && parseRobotsValue(declaration.Value).NoIndex {
+			return false, "noindex in " + declaration.label()
+		}
+	}
+
+	if p.Robots.UnavailableAfter != "" {
+		for _, layout := range unavailableAfterLayouts {
+			date, err := time.Parse(layout, p.Robots.UnavailableAfter)
+			if err == nil && now.After(date) {
+				return false, "unavailable_after " + p.Robots.UnavailableAfter + " has passed"
+			}
+			if err == nil {
+				break
+			}
+		}
+	}
+
+	if p.Canonical != "" {
+		// Trailing slash, case or default port differences are not a canonical
+		// pointing elsewhere
+		canonical := absoluteURL(p.URL, p.Canonical)
+		target := NormalizeURL(canonical)
+		if target != NormalizeURL(p.URL) && (p.FinalURL == "" || target != NormalizeURL(p.FinalURL)) {
+			return false, "canonicalised to " + canonical
+		}
+	}
+
+	return true, IndexableReason
+}
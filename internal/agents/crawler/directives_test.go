@@ -0,0 +1,123 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	appconfig "firesalamander/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRobotsValue(t *testing.T) {
+	directives := parseRobotsValue("NoArchive, max-snippet:50, max-image-preview:large, unavailable_after: Wednesday, 15-Nov-23 15:00:00 UTC, nosnippet")
+	assert.False(t, directives.NoIndex)
+	assert.True(t, directives.NoArchive)
+	assert.True(t, directives.NoSnippet)
+	require.NotNil(t, directives.MaxSnippet)
+	assert.Equal(t, 50, *directives.MaxSnippet)
+	assert.Equal(t, "large", directives.MaxImagePreview)
+	assert.Equal(t, "Wednesday, 15-Nov-23 15:00:00 UTC", directives.UnavailableAfter)
+
+	none := parseRobotsValue("none")
+	assert.True(t, none.NoIndex)
+	assert.True(t, none.NoFollow)
+}
+
+func TestParseRobotsHeader(t *testing.T) {
+	assert.Equal(t, RobotsDeclaration{Source: RobotsSourceHeader, Agent: RobotsAgentAll, Value: "noindex, nofollow"}, parseRobotsHeader("noindex, nofollow"))
+	assert.Equal(t, RobotsDeclaration{Source: RobotsSourceHeader, Agent: "googlebot", Value: "noindex"}, parseRobotsHeader("GoogleBot: noindex"))
+	assert.Equal(t, RobotsAgentAll, parseRobotsHeader("max-snippet:20").Agent)
+	assert.Equal(t, RobotsAgentAll, parseRobotsHeader("unavailable_after: 2020-01-01").Agent)
+}
+
+func TestExtractContentRobotsMetas(t *testing.T) {
+	page, err := ExtractContent("https://example.com/", `<html><head>
+		<meta name="robots" content="max-snippet:100, noarchive">
+		<meta name="googlebot" content="max-snippet:20">
+		<meta name="bingbot" content="noindex">
+	</head><body></body></html>`, 0)
+	require.NoError(t, err)
+
+	// bingbot is recorded but does not change the effective directives
+	assert.True(t, page.MetaIndex)
+	assert.True(t, page.Robots.NoArchive)
+	require.NotNil(t, page.Robots.MaxSnippet)
+	assert.Equal(t, 20, *page.Robots.MaxSnippet)
+	assert.Len(t, page.Robots.Declarations, 3)
+
+	indexable, reason := page.indexability(time.Now())
+	assert.True(t, indexable)
+	assert.Equal(t, IndexableReason, reason)
+}
+
+func TestIndexability(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		html   string
+		header string
+		reason string
+	}{
+		{"meta noindex", `<meta name="robots" content="noindex">`, "", "noindex in meta robots"},
+		{"googlebot noindex", `<meta name="googlebot" content="none">`, "", "noindex in meta googlebot"},
+		{"header noindex", ``, "noindex", "noindex in X-Robots-Tag header"},
+		{"header googlebot", ``, "googlebot: noindex", "noindex in X-Robots-Tag header for googlebot"},
+		{"other bot header", ``, "otherbot: noindex", IndexableReason},
+		{"expired", `<meta name="robots" content="unavailable_after: 2025-01-01">`, "", "unavailable_after 2025-01-01 has passed"},
+		{"not yet expired", `<meta name="robots" content="unavailable_after: 2026-01-01">`, "", IndexableReason},
+		{"canonicalised", `<link rel="canonical" href="/other">`, "", "canonicalised to https://example.com/other"},
+		{"self canonical", `<link rel="canonical" href="/page">`, "", IndexableReason},
+		{"self canonical with trailing slash", `<link rel="canonical" href="/page/">`, "", IndexableReason},
+		{"self canonical with case and port", `<link rel="canonical" href="HTTPS://Example.COM:443/page">`, "", IndexableReason},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := ExtractContent("https://example.com/page", "<html><head>"+tt.html+"</head></html>", 0)
+			require.NoError(t, err)
+			page.FinalURL = page.URL
+			applyRobotsHeaders(page, []string{tt.header})
+
+			indexable, reason := page.indexability(now)
+			assert.Equal(t, tt.reason == IndexableReason, indexable)
+			assert.Equal(t, tt.reason, reason)
+		})
+	}
+}
+
+func TestCrawlHonoursNofollow(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<html><body><a href="/meta">Meta</a><a href="/header">Header</a></body></html>`)
+		case "/meta":
+			fmt.Fprint(w, `<html><head><meta name="robots" content="nofollow"></head><body><a href="/hidden-a">A</a></body></html>`)
+		case "/header":
+			w.Header().Set("X-Robots-Tag", "noindex, nofollow")
+			fmt.Fprint(w, `<html><body><a href="/hidden-b">B</a></body></html>`)
+		default:
+			fmt.Fprint(w, `<html><body>leaf</body></html>`)
+		}
+	}))
+	defer server.Close()
+
+	result, err := newTestCrawler(func(cfg *appconfig.CrawlerConfig) {
+		cfg.Limits = appconfig.Limits{MaxURLs: 10, MaxDepth: 3}
+		cfg.Performance.ConcurrentRequests = 2
+	}).Crawl(context.Background(), server.URL+"/", "")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{server.URL + "/", server.URL + "/meta", server.URL + "/header"}, pageURLs(result))
+
+	for _, page := range result.Pages {
+		if page.URL == server.URL+"/header" {
+			assert.False(t, page.Indexable)
+			assert.False(t, page.MetaIndex)
+			assert.Equal(t, "noindex in X-Robots-Tag header", page.IndexabilityReason)
+		}
+	}
+}
@@ -0,0 +1,627 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"firesalamander/internal/config"
+)
+
+// A distributed crawl splits the crawler in two. The coordinator runs the
+// usual scheduler, so it owns the frontier, the dedup set, robots.txt,
+// traps and the final result, but its workers hand each task over to worker
+// processes instead of fetching it. Worker processes lease batches of URLs
+// over HTTP, fetch and extract them, then return the pages, whose anchors
+// are the discovered links. A lease that is not returned in time expires
+// and its URLs go back to the other workers.
+//
+// Politeness is enforced by the coordinator: robots.txt is checked before a
+// URL is handed out, and each leased URL comes with the delay its host's
+// turn is due in, so the workers together stay within the configured rate
+// and Crawl-delay. A worker told to back off by a host passes the pause on
+// with its results. Workers archive their exchanges for the coordinator's
+// WARC file. When a token is configured, every request to the coordinator
+// must carry it.
+
+// Default distributed crawl settings, used when the configuration leaves
+// them at zero
+const (
+	defaultLeaseTTL    = 2 * time.Minute
+	defaultBatchSize   = 10
+	defaultMaxInFlight = 100
+	// maxLeaseAttempts is how many leases of a URL may expire before it is
+	// given up, so a page crashing its workers cannot stall the crawl
+	maxLeaseAttempts = 3
+	// maxLeaseFailures is how many lease requests in a row a worker lets
+	// fail, so it can be started before the coordinator listens
+	maxLeaseFailures   = 10
+	workerPollInterval = 200 * time.Millisecond
+	// leaseHorizon is how far ahead a host's turn may be granted, so a
+	// lease does not hold URLs its worker could not fetch for long
+	leaseHorizon = 5 * time.Second
+	// maxLeaseRequestBytes caps a lease request, a worker ID and a number
+	maxLeaseRequestBytes = 64 << 10
+	// bodyCopiesPerTask and taskOverheadBytes bound the completion of one
+	// task: its body comes back as the page text, the HTML and the archived
+	// exchanges, base64 or JSON escaped, along with headers and anchors
+	bodyCopiesPerTask = 8
+	taskOverheadBytes = 1 << 20
+)
+
+// ErrLeaseExpired is returned when a worker completes a lease that already
+// expired. Its URLs were handed to another worker.
+var ErrLeaseExpired = errors.New("lease expired")
+
+// Lease is a batch of URLs handed to a worker
+type Lease struct {
+	ID    string      `json:"id,omitempty"`
+	Tasks []CrawlTask `json:"tasks"`
+	// Delays tells, for each task, how long after the lease its host's turn
+	// comes. The fetch must not start earlier.
+	Delays    []time.Duration `json:"delays,omitempty"`
+	ExpiresAt time.Time       `json:"expires_at"`
+	// Seed scopes the worker's credentials and login to the crawled site
+	Seed string `json:"seed,omitempty"`
+	// Done tells the worker the crawl is over
+	Done bool `json:"done"`
+}
+
+// TaskResult is the outcome of a leased task. Page is nil when the fetch
+// failed, while the redirect chain and archived exchanges are kept either
+// way.
+type TaskResult struct {
+	Task     CrawlTask       `json:"task"`
+	Page     *PageData       `json:"page,omitempty"`
+	HTML     []byte          `json:"html,omitempty"`
+	Redirect *RedirectRecord `json:"redirect,omitempty"`
+	// WARC holds the records of the task's exchanges when archiving is on
+	WARC []byte `json:"warc,omitempty"`
+	// Backoff is how long the worker still leaves the task's host alone
+	// after a 429/503 or a Retry-After, for the coordinator to do the same
+	Backoff time.Duration `json:"backoff,omitempty"`
+	// Blocked is set when the worker's robots.txt disallows the task, for
+	// the coordinator to record it
+	Blocked *BlockedURL `json:"blocked,omitempty"`
+	Error   string      `json:"error,omitempty"`
+}
+
+type leaseRequest struct {
+	Worker string `json:"worker"`
+	Max    int    `json:"max"`
+}
+
+type completeRequest struct {
+	LeaseID string       `json:"lease_id"`
+	Results []TaskResult `json:"results"`
+}
+
+// remoteTask is a task waiting for a worker. Its result is sent exactly
+// once, by the worker completing it or by the last lease expiry.
+type remoteTask struct {
+	task     CrawlTask
+	attempts int
+	result   chan TaskResult
+}
+
+type lease struct {
+	worker  string
+	tasks   map[string]*remoteTask
+	expires time.Time
+}
+
+// Coordinator runs a crawl whose pages are fetched by worker processes. It
+// serves the lease protocol with Handler.
+type Coordinator struct {
+	crawler     *Crawler
+	leaseTTL    time.Duration
+	batchSize   int
+	maxInFlight int
+	token       string
+
+	mutex   sync.Mutex
+	pending []*remoteTask
+	leases  map[string]*lease
+	// workers maps each worker to whether it was told the crawl is over
+	workers map[string]bool
+	leaseID int
+	seedURL string
+	done    bool
+}
+
+// NewCoordinator creates the coordinator of a distributed crawl
+func NewCoordinator(cfg config.CrawlerConfig) *Coordinator {
+	co := &Coordinator{
+		crawler:     NewCrawler(cfg),
+		leaseTTL:    cfg.Distributed.LeaseTTL,
+		batchSize:   positiveOr(cfg.Distributed.BatchSize, defaultBatchSize),
+		maxInFlight: positiveOr(cfg.Distributed.MaxInFlight, defaultMaxInFlight),
+		token:       cfg.Distributed.Token,
+		leases:      make(map[string]*lease),
+		workers:     make(map[string]bool),
+	}
+	if co.leaseTTL <= 0 {
+		co.leaseTTL = defaultLeaseTTL
+	}
+	co.crawler.remote = co
+	return co
+}
+
+// Crawl runs the crawl from seedURL until the frontier is exhausted, with
+// the same result as Crawler.Crawl. Workers are told the crawl is over on
+// their next lease.
+func (co *Coordinator) Crawl(ctx context.Context, seedURL string, outputDir string) (*CrawlResult, error) {
+	co.start(co.crawler.normalizer.Clean(seedURL))
+	result, err := co.crawler.Crawl(ctx, seedURL, outputDir)
+	co.finish()
+	return result, err
+}
+
+// Resume continues the crawl checkpointed in auditDir, as Crawler.Resume
+func (co *Coordinator) Resume(ctx context.Context, auditDir string) (*CrawlResult, error) {
+	checkpoint, err := loadCheckpointState(auditDir)
+	if err != nil {
+		return nil, err
+	}
+	co.start(checkpoint.SeedURL)
+	result, err := co.crawler.Resume(ctx, auditDir)
+	co.finish()
+	return result, err
+}
+
+func (co *Coordinator) start(seedURL string) {
+	co.mutex.Lock()
+	co.seedURL = seedURL
+	co.done = false
+	co.mutex.Unlock()
+}
+
+func (co *Coordinator) finish() {
+	co.mutex.Lock()
+	co.done = true
+	co.pending = nil
+	co.leases = make(map[string]*lease)
+	co.mutex.Unlock()
+}
+
+// Drain waits until every worker that leased URLs was told the crawl is
+// over, so a coordinator process does not exit under their feet
+func (co *Coordinator) Drain(ctx context.Context) {
+	ticker := time.NewTicker(workerPollInterval / 5)
+	defer ticker.Stop()
+	for {
+		co.mutex.Lock()
+		drained := true
+		for _, told := range co.workers {
+			drained = drained && told
+		}
+		co.mutex.Unlock()
+		if drained {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Handler serves the lease protocol: POST /lease hands out a batch of URLs
+// and POST /complete takes the pages back. With a token configured, requests
+// without it are refused.
+func (co *Coordinator) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /lease", co.handleLease)
+	mux.HandleFunc("POST /complete", co.handleComplete)
+	if co.token == "" {
+		return mux
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !validToken(r.Header.Get("Authorization"), co.token) {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// validToken checks a bearer Authorization header in constant time
+func validToken(authorization, token string) bool {
+	presented, ok := strings.CutPrefix(authorization, "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(presented), []byte(token)) == 1
+}
+
+func (co *Coordinator) handleLease(w http.ResponseWriter, r *http.Request) {
+	var req leaseRequest
+	r.Body = http.MaxBytesReader(w, r.Body, maxLeaseRequestBytes)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Worker == "" {
+		http.Error(w, "invalid lease request", http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, co.lease(req.Worker, req.Max, time.Now()))
+}
+
+func (co *Coordinator) handleComplete(w http.ResponseWriter, r *http.Request) {
+	var req completeRequest
+	r.Body = http.MaxBytesReader(w, r.Body, co.maxCompletionBytes())
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "completion too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "invalid completion", http.StatusBadRequest)
+		return
+	}
+	if err := co.complete(req.LeaseID, req.Results, time.Now()); err != nil {
+		http.Error(w, err.Error(), http.StatusGone)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// maxCompletionBytes caps the completion of a full batch, whose bodies were
+// truncated at the crawler's maxBodyBytes
+func (co *Coordinator) maxCompletionBytes() int64 {
+	return int64(co.batchSize) * (bodyCopiesPerTask*co.crawler.maxBodyBytes() + taskOverheadBytes)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		fmt.Printf("Warning: failed to write response: %v\n", err)
+	}
+}
+
+// lease hands up to max pending tasks to a worker, each with the delay its
+// host's turn is due in. Tasks whose host is not due within leaseHorizon stay
+// pending. The lease is empty when no task is due, which also happens while
+// in-flight pages are awaited.
+func (co *Coordinator) lease(worker string, max int, now time.Time) Lease {
+	co.mutex.Lock()
+	defer co.mutex.Unlock()
+	co.expireLeases(now)
+
+	if co.done {
+		co.workers[worker] = true
+		return Lease{Done: true}
+	}
+	co.workers[worker] = false
+
+	n := co.batchSize
+	if max > 0 && max < n {
+		n = max
+	}
+
+	granted := Lease{Tasks: []CrawlTask{}, Seed: co.seedURL}
+	var taken []*remoteTask
+	kept := co.pending[:0]
+	for _, rt := range co.pending {
+		if len(taken) < n {
+			if delay, ok := co.crawler.politeness.Grant(hostOf(rt.task.URL), leaseHorizon, now); ok {
+				taken = append(taken, rt)
+				granted.Tasks = append(granted.Tasks, rt.task)
+				granted.Delays = append(granted.Delays, delay)
+				continue
+			}
+		}
+		kept = append(kept, rt)
+	}
+	co.pending = kept
+	if len(taken) == 0 {
+		return granted
+	}
+
+	co.leaseID++
+	l := &lease{
+		worker:  worker,
+		tasks:   make(map[string]*remoteTask, len(taken)),
+		expires: now.Add(co.leaseTTL),
+	}
+	for _, rt := range taken {
+		l.tasks[rt.task.URL] = rt
+	}
+	granted.ID = "lease-" + strconv.Itoa(co.leaseID)
+	granted.ExpiresAt = l.expires
+	co.leases[granted.ID] = l
+	return granted
+}
+
+// complete hands the results of a lease to the waiting scheduler workers.
+// A partial completion renews the lease of the remaining URLs.
+func (co *Coordinator) complete(leaseID string, results []TaskResult, now time.Time) error {
+	co.mutex.Lock()
+	defer co.mutex.Unlock()
+	co.expireLeases(now)
+
+	l, ok := co.leases[leaseID]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrLeaseExpired, leaseID)
+	}
+	for _, result := range results {
+		rt, ok := l.tasks[result.Task.URL]
+		if !ok {
+			continue
+		}
+		delete(l.tasks, result.Task.URL)
+		result.Task = rt.task
+		co.crawler.politeness.Throttle(hostOf(rt.task.URL), result.Backoff, now)
+		rt.result <- result
+	}
+
+	if len(l.tasks) == 0 {
+		delete(co.leases, leaseID)
+	} else {
+		l.expires = now.Add(co.leaseTTL)
+	}
+	return nil
+}
+
+// expireLeases puts the URLs of expired leases back at the head of the
+// pending tasks, or fails them once they expired too often. Caller holds
+// co.mutex.
+func (co *Coordinator) expireLeases(now time.Time) {
+	var requeued []*remoteTask
+	for id, l := range co.leases {
+		if now.Before(l.expires) {
+			continue
+		}
+		delete(co.leases, id)
+		fmt.Printf("Warning: lease %s of worker %s expired with %d URLs\n", id, l.worker, len(l.tasks))
+		for _, rt := range l.tasks {
+			rt.attempts++
+			if rt.attempts >= maxLeaseAttempts {
+				rt.result <- TaskResult{Task: rt.task, Error: fmt.Sprintf("lease expired %d times", rt.attempts)}
+				continue
+			}
+			requeued = append(requeued, rt)
+		}
+	}
+	if len(requeued) > 0 {
+		co.pending = append(requeued, co.pending...)
+	}
+}
+
+// dispatch queues a task for the workers and waits for its result
+func (co *Coordinator) dispatch(ctx context.Context, task CrawlTask) (*PageData, []byte, *RedirectRecord, error) {
+	rt := &remoteTask{task: task, result: make(chan TaskResult, 1)}
+	co.mutex.Lock()
+	co.pending = append(co.pending, rt)
+	co.mutex.Unlock()
+
+	select {
+	case result := <-rt.result:
+		co.crawler.archiveRecords(result.WARC)
+		if result.Blocked != nil {
+			co.crawler.mutex.Lock()
+			co.crawler.addBlocked(*result.Blocked)
+			co.crawler.mutex.Unlock()
+		}
+		if result.Page != nil {
+			co.crawler.countCache(result.Page.FromCache)
+		}
+		if result.Error != "" {
+			return nil, nil, result.Redirect, errors.New(result.Error)
+		}
+		if result.Page == nil {
+			return nil, nil, result.Redirect, fmt.Errorf("worker returned no page for %s", task.URL)
+		}
+		return result.Page, result.HTML, result.Redirect, nil
+	case <-ctx.Done():
+		return nil, nil, nil, ctx.Err()
+	}
+}
+
+// slots is how many scheduler workers wait on worker processes
+func (co *Coordinator) slots() int {
+	return co.maxInFlight
+}
+
+// Worker fetches the URLs leased from a coordinator, ConcurrentRequests at
+// a time
+type Worker struct {
+	ID          string
+	coordinator string
+	crawler     *Crawler
+	client      *http.Client
+	token       string
+	batchSize   int
+	seedURL     string
+}
+
+// NewWorker creates a worker leasing URLs from the coordinator listening at
+// coordinatorURL
+func NewWorker(id, coordinatorURL string, cfg config.CrawlerConfig) *Worker {
+	return &Worker{
+		ID:          id,
+		coordinator: strings.TrimSuffix(coordinatorURL, "/"),
+		crawler:     NewCrawler(cfg),
+		client:      &http.Client{Timeout: 30 * time.Second},
+		token:       cfg.Distributed.Token,
+		batchSize:   positiveOr(cfg.Distributed.BatchSize, defaultBatchSize),
+	}
+}
+
+// Run leases and fetches batches until the coordinator reports the crawl
+// is over or ctx is cancelled. The pages of an interrupted batch are
+// dropped; their lease expires and another worker fetches them.
+func (w *Worker) Run(ctx context.Context) error {
+	// Workers fetch the pages, so they are the ones replaying an archive
+	if err := w.crawler.openArchive(); err != nil {
+		return err
+	}
+	defer w.crawler.closeArchive()
+	if w.crawler.Config.Archive.WARC {
+		w.crawler.recordForCoordinator()
+	}
+
+	failures := 0
+	for {
+		granted, err := w.lease(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			failures++
+			if failures >= maxLeaseFailures {
+				return err
+			}
+			w.idle(ctx)
+			continue
+		}
+		failures = 0
+
+		if granted.Done {
+			return nil
+		}
+		if len(granted.Tasks) == 0 {
+			w.idle(ctx)
+			continue
+		}
+
+		if granted.Seed != w.seedURL {
+			w.seedURL = granted.Seed
+			w.crawler.seedURL = granted.Seed
+			if err := w.crawler.startSession(ctx); err != nil {
+				return err
+			}
+		}
+
+		results := w.fetchBatch(ctx, granted, time.Now())
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err := w.complete(ctx, granted.ID, results); errors.Is(err, ErrLeaseExpired) {
+			fmt.Printf("Warning: %v, its pages were dropped\n", err)
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// fetchBatch fetches the tasks of a lease received at leased with the
+// crawler's concurrency
+func (w *Worker) fetchBatch(ctx context.Context, granted Lease, leased time.Time) []TaskResult {
+	tasks := granted.Tasks
+	workers := positiveOr(w.crawler.Config.Performance.ConcurrentRequests, 1)
+	results := make([]TaskResult, len(tasks))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := range jobs {
+				var delay time.Duration
+				if k < len(granted.Delays) {
+					delay = granted.Delays[k]
+				}
+				results[k] = w.fetchTask(ctx, tasks[k], leased.Add(delay))
+			}
+		}()
+	}
+	for k := range tasks {
+		jobs <- k
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+// fetchTask fetches a task once its host's turn has come and robots.txt
+// allows it, archiving the exchanges for the coordinator
+func (w *Worker) fetchTask(ctx context.Context, task CrawlTask, due time.Time) TaskResult {
+	result := TaskResult{Task: task}
+	if err := sleep(ctx, time.Until(due)); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	var archive *bytes.Buffer
+	if w.crawler.Config.Archive.WARC {
+		archive = &bytes.Buffer{}
+		ctx = withWARCWriter(ctx, &warcWriter{out: archive})
+	}
+
+	// The worker's crawler only fetches: what it finds goes to the coordinator
+	if result.Blocked = w.crawler.robotsBlock(ctx, task.URL); result.Blocked != nil {
+		result.Error = fmt.Sprintf("%s: %v", task.URL, ErrBlockedByRobots)
+	} else {
+		page, body, redirect, err := w.crawler.fetchPage(ctx, task)
+		result.Page, result.HTML, result.Redirect = page, body, redirect
+		if err != nil {
+			result.Error = err.Error()
+		}
+	}
+	if archive != nil {
+		result.WARC = archive.Bytes()
+	}
+	result.Backoff = w.crawler.politeness.Paused(hostOf(task.URL), time.Now())
+	return result
+}
+
+func (w *Worker) lease(ctx context.Context) (Lease, error) {
+	var granted Lease
+	resp, err := w.post(ctx, "/lease", leaseRequest{Worker: w.ID, Max: w.batchSize})
+	if err != nil {
+		return granted, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return granted, fmt.Errorf("lease refused: HTTP %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&granted); err != nil {
+		return granted, fmt.Errorf("invalid lease: %w", err)
+	}
+	return granted, nil
+}
+
+func (w *Worker) complete(ctx context.Context, leaseID string, results []TaskResult) error {
+	resp, err := w.post(ctx, "/complete", completeRequest{LeaseID: leaseID, Results: results})
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNoContent, http.StatusOK:
+		return nil
+	case http.StatusGone:
+		return fmt.Errorf("%w: %s", ErrLeaseExpired, leaseID)
+	default:
+		return fmt.Errorf("completion refused: HTTP %d", resp.StatusCode)
+	}
+}
+
+func (w *Worker) post(ctx context.Context, path string, body interface{}) (*http.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.coordinator+path, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.token != "" {
+		req.Header.Set("Authorization", "Bearer "+w.token)
+	}
+	return w.client.Do(req)
+}
+
+// idle waits before asking for URLs again
+func (w *Worker) idle(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(workerPollInterval):
+	}
+}
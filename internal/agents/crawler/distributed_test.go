@@ -0,0 +1,335 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	appconfig "firesalamander/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// smallCluster shares a 10-URL crawl between workers in small batches
+func smallCluster(cfg *appconfig.CrawlerConfig) {
+	cfg.Limits = appconfig.Limits{MaxURLs: 10, MaxDepth: 5}
+	cfg.Performance.ConcurrentRequests = 2
+	cfg.Distributed = appconfig.Distributed{BatchSize: 4, MaxInFlight: 12, LeaseTTL: time.Minute}
+}
+
+func TestDistributedCrawlMatchesLocalCrawl(t *testing.T) {
+	server := newSyntheticSite(3, 3, time.Millisecond, map[int]bool{5: true}) // 1+3+9+27 pages
+	defer server.Close()
+
+	local, err := newTestCrawler(func(cfg *appconfig.CrawlerConfig) {
+		cfg.Limits = appconfig.Limits{MaxURLs: 1000, MaxDepth: 5}
+		cfg.Performance.ConcurrentRequests = 4
+	}).Crawl(context.Background(), server.URL+"/", "")
+	require.NoError(t, err)
+
+	cfg := newTestConfig(func(cfg *appconfig.CrawlerConfig) {
+		smallCluster(cfg)
+		cfg.Limits.MaxURLs = 1000
+	})
+	coordinator := NewCoordinator(cfg)
+	api := httptest.NewServer(coordinator.Handler())
+	defer api.Close()
+
+	var wg sync.WaitGroup
+	workerErrs := make([]error, 3)
+	for i := range workerErrs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			worker := NewWorker("worker-"+strconv.Itoa(i), api.URL, cfg)
+			workerErrs[i] = worker.Run(context.Background())
+		}(i)
+	}
+
+	dir := t.TempDir()
+	distributed, err := coordinator.Crawl(context.Background(), server.URL+"/", dir)
+	require.NoError(t, err)
+	coordinator.Drain(context.Background())
+	wg.Wait()
+	for _, err := range workerErrs {
+		assert.NoError(t, err)
+	}
+
+	localURLs, distributedURLs := pageURLs(local), pageURLs(distributed)
+	sort.Strings(localURLs)
+	sort.Strings(distributedURLs)
+	assert.Equal(t, localURLs, distributedURLs)
+	assert.Len(t, distributedURLs, 36) // page 5 and its three children are missing
+	assert.Equal(t, 3, distributed.Metadata.MaxDepthReached)
+
+	// Raw documents travel with the pages and are stored by the coordinator
+	for _, page := range distributed.Pages {
+		html, err := LoadRawHTML(dir, page)
+		require.NoError(t, err)
+		assert.Contains(t, html, "<html")
+	}
+}
+
+func TestCoordinatorRequeuesExpiredLeases(t *testing.T) {
+	coordinator := NewCoordinator(newTestConfig(smallCluster))
+	task := CrawlTask{URL: "https://example.com/", Depth: 0}
+
+	type outcome struct {
+		page *PageData
+		err  error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		page, _, _, err := coordinator.dispatch(context.Background(), task)
+		done <- outcome{page, err}
+	}()
+
+	now := time.Now()
+	var first Lease
+	require.Eventually(t, func() bool {
+		first = coordinator.lease("dead", 0, now)
+		return len(first.Tasks) == 1
+	}, time.Second, time.Millisecond)
+
+	// The dead worker's lease expires and the URL goes to another worker
+	later := first.ExpiresAt.Add(time.Second)
+	second := coordinator.lease("alive", 0, later)
+	require.Equal(t, []CrawlTask{task}, second.Tasks)
+	assert.Empty(t, coordinator.lease("other", 0, later).Tasks)
+
+	err := coordinator.complete(first.ID, []TaskResult{{Task: task, Page: &PageData{URL: task.URL, Title: "Zombie"}}}, later)
+	assert.True(t, errors.Is(err, ErrLeaseExpired))
+
+	require.NoError(t, coordinator.complete(second.ID, []TaskResult{{Task: task, Page: &PageData{URL: task.URL, Title: "Accueil"}}}, later))
+	result := <-done
+	require.NoError(t, result.err)
+	assert.Equal(t, "Accueil", result.page.Title)
+}
+
+func TestCoordinatorGivesUpAfterRepeatedExpiries(t *testing.T) {
+	coordinator := NewCoordinator(newTestConfig(smallCluster))
+	task := CrawlTask{URL: "https://example.com/crash", Depth: 1}
+
+	done := make(chan error, 1)
+	go func() {
+		_, _, _, err := coordinator.dispatch(context.Background(), task)
+		done <- err
+	}()
+
+	now := time.Now()
+	require.Eventually(t, func() bool {
+		return len(coordinator.lease("worker", 0, now).Tasks) == 1
+	}, time.Second, time.Millisecond)
+	for attempt := 1; attempt < maxLeaseAttempts; attempt++ {
+		now = now.Add(2 * time.Minute)
+		require.Len(t, coordinator.lease("worker", 0, now).Tasks, 1)
+	}
+
+	// The last expiry fails the URL instead of handing it out again
+	assert.Empty(t, coordinator.lease("worker", 0, now.Add(2*time.Minute)).Tasks)
+	err := <-done
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "lease expired")
+}
+
+func TestCoordinatorGrantsHostSlots(t *testing.T) {
+	cfg := newTestConfig(smallCluster)
+	cfg.Performance.RateLimit = "6/m" // one request every 10s, no burst
+	cfg.Performance.ConcurrentRequests = 1
+	coordinator := NewCoordinator(cfg)
+
+	tasks := []CrawlTask{
+		{URL: "https://example.com/a", Depth: 1},
+		{URL: "https://example.com/b", Depth: 1},
+		{URL: "https://other.example/", Depth: 1},
+	}
+	for _, task := range tasks {
+		go func(task CrawlTask) {
+			_, _, _, _ = coordinator.dispatch(context.Background(), task)
+		}(task)
+	}
+	require.Eventually(t, func() bool {
+		coordinator.mutex.Lock()
+		defer coordinator.mutex.Unlock()
+		return len(coordinator.pending) == len(tasks)
+	}, time.Second, time.Millisecond)
+
+	// Each host gets one slot now; the second example.com URL is not due
+	// for another 10s, whichever worker asks
+	now := time.Now()
+	first := coordinator.lease("worker-1", 0, now)
+	require.Len(t, first.Tasks, 2)
+	assert.NotEqual(t, first.Tasks[0].URL, first.Tasks[1].URL)
+	assert.Equal(t, []time.Duration{0, 0}, first.Delays)
+	assert.Empty(t, coordinator.lease("worker-2", 0, now.Add(time.Second)).Tasks)
+
+	// A turn due within the horizon is granted with the delay to wait
+	second := coordinator.lease("worker-2", 0, now.Add(7*time.Second))
+	require.Len(t, second.Tasks, 1)
+	assert.Equal(t, "example.com", hostOf(second.Tasks[0].URL))
+	require.Len(t, second.Delays, 1)
+	assert.InDelta(t, 3*time.Second, second.Delays[0], float64(time.Millisecond))
+}
+
+func TestCoordinatorAppliesWorkerBackoff(t *testing.T) {
+	coordinator := NewCoordinator(newTestConfig(smallCluster))
+	tasks := []CrawlTask{{URL: "https://example.com/a", Depth: 1}, {URL: "https://example.com/b", Depth: 1}}
+	for _, task := range tasks {
+		go func(task CrawlTask) {
+			_, _, _, _ = coordinator.dispatch(context.Background(), task)
+		}(task)
+	}
+	require.Eventually(t, func() bool {
+		coordinator.mutex.Lock()
+		defer coordinator.mutex.Unlock()
+		return len(coordinator.pending) == len(tasks)
+	}, time.Second, time.Millisecond)
+
+	now := time.Now()
+	first := coordinator.lease("worker-1", 1, now)
+	require.Len(t, first.Tasks, 1)
+	throttled := TaskResult{Task: first.Tasks[0], Error: "HTTP 429", Backoff: 30 * time.Second}
+	require.NoError(t, coordinator.complete(first.ID, []TaskResult{throttled}, now))
+
+	// The host is left alone for the 30s the worker was told to wait
+	assert.Empty(t, coordinator.lease("worker-2", 0, now.Add(time.Second)).Tasks)
+	second := coordinator.lease("worker-2", 0, now.Add(27*time.Second))
+	require.Len(t, second.Tasks, 1)
+	assert.InDelta(t, 3*time.Second, second.Delays[0], float64(time.Millisecond))
+}
+
+func TestWorkerReportsBackoff(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	worker := NewWorker("worker", "http://127.0.0.1:0", newTestConfig(smallCluster))
+	result := worker.fetchTask(context.Background(), CrawlTask{URL: server.URL + "/"}, time.Now())
+	assert.InDelta(t, 30*time.Second, result.Backoff, float64(time.Second))
+
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("<html><body>OK</body></html>"))
+	}))
+	defer healthy.Close()
+	assert.Zero(t, worker.fetchTask(context.Background(), CrawlTask{URL: healthy.URL + "/"}, time.Now()).Backoff)
+}
+
+func TestWorkerReturnsBlockedURLs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("User-agent: *\nDisallow: /private/\n"))
+	}))
+	defer server.Close()
+
+	worker := NewWorker("worker", "http://127.0.0.1:0", newTestConfig(func(cfg *appconfig.CrawlerConfig) {
+		smallCluster(cfg)
+		cfg.Respect.RobotsTxt = true
+	}))
+	result := worker.fetchTask(context.Background(), CrawlTask{URL: server.URL + "/private/page"}, time.Now())
+	require.NotNil(t, result.Blocked)
+	assert.Equal(t, "Disallow: /private/", result.Blocked.Rule)
+	assert.Empty(t, worker.crawler.Blocked)
+
+	// The coordinator records what the worker found
+	coordinator := NewCoordinator(newTestConfig(smallCluster))
+	go func() {
+		_, _, _, _ = coordinator.dispatch(context.Background(), result.Task)
+	}()
+	require.Eventually(t, func() bool {
+		coordinator.mutex.Lock()
+		defer coordinator.mutex.Unlock()
+		return len(coordinator.pending) == 1
+	}, time.Second, time.Millisecond)
+	lease := coordinator.lease("worker", 1, time.Now())
+	require.Len(t, lease.Tasks, 1)
+	require.NoError(t, coordinator.complete(lease.ID, []TaskResult{result}, time.Now()))
+	require.Eventually(t, func() bool {
+		coordinator.crawler.mutex.Lock()
+		defer coordinator.crawler.mutex.Unlock()
+		return len(coordinator.crawler.Blocked) == 1
+	}, time.Second, time.Millisecond)
+}
+
+func TestCoordinatorRejectsOversizedCompletion(t *testing.T) {
+	cfg := newTestConfig(smallCluster)
+	cfg.Distributed.BatchSize = 1
+	cfg.Budgets.MaxBodyBytes = 1
+	api := httptest.NewServer(NewCoordinator(cfg).Handler())
+	defer api.Close()
+
+	body := `{"lease_id":"lease-1","results":[{"html":"` + strings.Repeat("A", 2<<20) + `"}]}`
+	resp, err := http.Post(api.URL+"/complete", "application/json", strings.NewReader(body))
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+}
+
+func TestCoordinatorRequiresToken(t *testing.T) {
+	cfg := newTestConfig(smallCluster)
+	cfg.Distributed.Token = "s3cret"
+	coordinator := NewCoordinator(cfg)
+	api := httptest.NewServer(coordinator.Handler())
+	defer api.Close()
+
+	for _, token := range []string{"", "wrong"} {
+		impostor := newTestConfig(smallCluster)
+		impostor.Distributed.Token = token
+		_, err := NewWorker("impostor", api.URL, impostor).lease(context.Background())
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "HTTP 401")
+	}
+
+	granted, err := NewWorker("worker", api.URL, cfg).lease(context.Background())
+	require.NoError(t, err)
+	assert.False(t, granted.Done)
+}
+
+func TestDistributedCrawlArchivesWorkerExchanges(t *testing.T) {
+	server := newArchivedSite()
+	defer server.Close()
+
+	cfg := newTestConfig(smallCluster)
+	cfg.Archive.WARC = true
+	coordinator := NewCoordinator(cfg)
+	api := httptest.NewServer(coordinator.Handler())
+	defer api.Close()
+
+	workerErr := make(chan error, 1)
+	go func() {
+		workerErr <- NewWorker("worker", api.URL, cfg).Run(context.Background())
+	}()
+
+	dir := t.TempDir()
+	_, err := coordinator.Crawl(context.Background(), server.URL+"/", dir)
+	require.NoError(t, err)
+	coordinator.Drain(context.Background())
+	require.NoError(t, <-workerErr)
+
+	// The pages fetched by the worker land in the coordinator's archive
+	data, err := os.ReadFile(filepath.Join(dir, WARCFileName))
+	require.NoError(t, err)
+	archive := string(data)
+	assert.Contains(t, archive, "HTTP/1.1 301 Moved Permanently\r\n")
+	assert.Contains(t, archive, "<title>Nouvelle page</title>")
+	assert.Equal(t, 1, strings.Count(archive, "WARC-Type: warcinfo\r\n"))
+	assert.Equal(t, strings.Count(archive, "WARC-Type: response\r\n"), strings.Count(archive, "WARC-Type: request\r\n"))
+
+	replay, err := NewWARCReplay(filepath.Join(dir, WARCFileName))
+	require.NoError(t, err)
+	defer replay.Close()
+	assert.NotEmpty(t, replay.captures["GET "+server.URL+"/new"])
+}
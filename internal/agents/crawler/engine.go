@@ -2,176 +2,489 @@ package crawler
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 )
 
 func (c *Crawler) Crawl(ctx context.Context, seedURL string, outputDir string) (*CrawlResult, error) {
 	startTime := time.Now()
+	seedURL = c.normalizer.Clean(seedURL)
 
 	// Initialize
 	c.mutex.Lock()
-	c.Visited = make(map[string]bool)
-	c.Queue = []CrawlTask{{URL: seedURL, Depth: 0}}
-	c.Results = make([]PageData, 0)
+	c.reset(seedURL, outputDir, false)
+	c.enqueue(CrawlTask{URL: seedURL, Depth: 0})
 	c.mutex.Unlock()
 
-	// Create semaphore for concurrent requests
-	semaphore := make(chan struct{}, c.Config.Performance.ConcurrentRequests)
+	if err := c.openArchive(); err != nil {
+		return nil, err
+	}
+	if err := c.startSession(ctx); err != nil {
+		c.closeArchive()
+		c.releaseSpill()
+		return nil, err
+	}
 
-	var wg sync.WaitGroup
-	maxDepthReached := 0
+	// Collect the URLs listed in XML sitemaps, which is the only way to
+	// reach orphan pages. They are queued once the seed's links are.
+	if c.Config.Respect.Sitemap {
+		entries, err := c.DiscoverSitemaps(ctx, seedURL)
+		if err != nil {
+			fmt.Printf("Warning: sitemap discovery failed for %s: %v\n", seedURL, err)
+		}
 
-	for len(c.Queue) > 0 && len(c.Results) < c.Config.Limits.MaxURLs {
 		c.mutex.Lock()
-		if len(c.Queue) == 0 {
-			c.mutex.Unlock()
-			break
+		for _, entry := range entries {
+			c.sitemap[c.normalizer.Normalize(entry.URL)] = entry
+			c.sitemapEntries = append(c.sitemapEntries, entry)
 		}
-
-		task := c.Queue[0]
-		c.Queue = c.Queue[1:]
 		c.mutex.Unlock()
+	}
 
-		// Check if already visited
-		c.mutex.RLock()
-		if c.Visited[task.URL] {
-			c.mutex.RUnlock()
-			continue
-		}
-		c.mutex.RUnlock()
+	return c.run(ctx, startTime)
+}
 
-		// Check depth limit
-		if !c.RespectDepthLimit(task.Depth) {
-			continue
+// reset clears the state of any previous crawl before a new crawl from
+// seedURL. Caller holds c.mutex.
+func (c *Crawler) reset(seedURL, outputDir string, listMode bool) {
+	c.removeSpill()
+	c.Visited = make(map[string]bool)
+	c.journal = journalState{}
+	c.listMode = listMode
+	c.outputDir = outputDir
+	c.Queue = c.newFrontier()
+	c.held = nil
+	c.Results = make([]PageData, 0)
+	c.Blocked = make([]BlockedURL, 0)
+	c.Redirects = make([]RedirectRecord, 0)
+	c.Excluded = make([]ExcludedURL, 0)
+	c.traps = newTrapDetector(c.Config.Traps)
+	c.discovered = nil
+	c.sitemap = make(map[string]SitemapEntry)
+	c.sitemapEntries = make([]SitemapEntry, 0)
+	c.sitemapQueued = 0
+	c.inflight = make(map[string]CrawlTask)
+	c.seedURL = seedURL
+	c.maxDepthReached = 0
+	c.resumed = false
+	c.elapsed = 0
+	c.cacheHits, c.cacheMisses = 0, 0
+	c.bytesDownloaded = 0
+	c.recordsSize = 0
+}
+
+// run processes the frontier until it is exhausted or MaxURLs is reached,
+// then builds and saves the result
+func (c *Crawler) run(ctx context.Context, startTime time.Time) (*CrawlResult, error) {
+	outputDir := c.outputDir
+	c.runStart = startTime
+	defer c.closeArchive()
+	defer c.releaseSpill()
+
+	c.mutex.Lock()
+	c.resetBudgets()
+	c.mutex.Unlock()
+	crawlCtx, stopDuration := c.startDurationBudget(ctx)
+	defer stopDuration()
+
+	// Stream pages to disk as they complete, starting with those restored
+	// from a checkpoint
+	c.pages = nil
+	if outputDir != "" {
+		// Lean pages restored from a checkpoint get their text back from
+		// the pages the interrupted crawl streamed
+		previous := ""
+		if c.leanPages() && len(c.Results) > 0 {
+			previous = filepath.Join(outputDir, pagesFileName+".prev")
+			if err := os.Rename(filepath.Join(outputDir, pagesFileName), previous); err != nil {
+				previous = ""
+			}
 		}
 
-		// Check URL should be crawled
-		if !c.ShouldCrawlURL(task.URL) {
-			continue
+		pages, err := newPageWriter(outputDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create page output: %w", err)
+		}
+		if err := c.writeRestoredPages(pages, previous); err != nil {
+			_ = pages.Close(CrawlTrailer{})
+			return nil, fmt.Errorf("failed to write page output: %w", err)
 		}
+		c.pages = pages
 
-		// Mark as visited
+		// Blocked, redirected and excluded URLs of a lean crawl go to
+		// records.jsonl next to the pages
 		c.mutex.Lock()
-		c.Visited[task.URL] = true
+		c.openRecords()
 		c.mutex.Unlock()
+		defer func() {
+			c.mutex.Lock()
+			c.closeRecords()
+			c.mutex.Unlock()
+		}()
+	}
 
-		if task.Depth > maxDepthReached {
-			maxDepthReached = task.Depth
-		}
+	workers := c.Config.Performance.ConcurrentRequests
+	if c.remote != nil {
+		workers = c.remote.slots()
+	}
+	if workers < 1 {
+		workers = 1
+	}
 
-		// Crawl page concurrently
+	// Wake up idle workers when the crawl is cancelled
+	stop := context.AfterFunc(crawlCtx, func() {
+		c.mutex.Lock()
+		c.cond.Broadcast()
+		c.mutex.Unlock()
+	})
+	defer stop()
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
 		wg.Add(1)
-		go func(task CrawlTask) {
+		go func() {
 			defer wg.Done()
-			semaphore <- struct{}{} // Acquire
-			defer func() { <-semaphore }() // Release
-
-			if err := c.crawlPage(ctx, task); err != nil {
-				fmt.Printf("Error crawling %s: %v\n", task.URL, err)
-			}
-		}(task)
+			c.work(crawlCtx)
+		}()
 	}
-
 	wg.Wait()
+	// Workers may notice the deadline before the budget is recorded
+	c.checkDurationBudget(crawlCtx)
+
+	c.mutex.Lock()
+	c.buildLinkGraph()
+	c.mutex.Unlock()
+
+	// A crawl stopped by its budget has no time or bytes left for assets
+	var assets []Asset
+	if !c.Config.Assets.Disabled && ctx.Err() == nil && !c.stopped() {
+		assets = c.checkAssets(crawlCtx)
+	}
 
-	// Create result
+	// Create result. The duration budget may still fire.
+	c.mutex.Lock()
 	result := &CrawlResult{
-		Pages: c.Results,
+		Pages:       c.Results,
+		BlockedURLs: c.Blocked,
+		Redirects:   c.Redirects,
+		Excluded:    c.Excluded,
+		Sitemap:     c.sitemapEntries,
+		Discovered:  c.discovered,
+		Traps:       c.traps.Traps(),
+		Assets:      assets,
 		Metadata: Metadata{
-			TotalPages:      len(c.Results),
-			MaxDepthReached: maxDepthReached,
-			DurationMs:      int(time.Since(startTime).Milliseconds()),
-			RobotsRespected: c.Config.Respect.RobotsTxt,
-			SitemapFound:    false, // TODO: implement sitemap detection
+			Mode:             c.mode(),
+			TotalPages:       len(c.Results),
+			MaxDepthReached:  c.maxDepthReached,
+			DurationMs:       int((c.elapsed + time.Since(startTime)).Milliseconds()),
+			RobotsRespected:  c.Config.Respect.RobotsTxt,
+			SitemapFound:     len(c.sitemapEntries) > 0,
+			Resumed:          c.resumed,
+			Strategy:         c.Config.CrawlStrategy(),
+			CacheHits:        c.cacheHits,
+			CacheMisses:      c.cacheMisses,
+			CacheHitRatio:    cacheHitRatio(c.cacheHits, c.cacheMisses),
+			LeanPages:        c.leanPages(),
+			BytesDownloaded:  c.bytesDownloaded,
+			Partial:          c.stoppedBy != "",
+			BudgetsExhausted: c.budgetsExhausted,
 		},
 	}
+	c.mutex.Unlock()
 
 	// Save to file
 	if outputDir != "" {
-		if err := c.saveToFile(result, outputDir); err != nil {
+		// Pages were streamed before their incoming links were known
+		rewrite := c.pages.Rewrite
+		if c.leanPages() {
+			rewrite = func(pages []PageData, trailer CrawlTrailer) error {
+				return c.pages.RewriteLean(pages, trailer, func(page *PageData) {
+					c.resolveAnchors(page)
+					page.OutgoingLinks = uniqueLinks(page.Anchors)
+					if assets != nil {
+						c.resolveAssetRefs(page)
+					}
+				})
+			}
+		}
+		if err := rewrite(result.Pages, CrawlTrailer{
+			BlockedURLs: result.BlockedURLs,
+			Redirects:   result.Redirects,
+			Excluded:    result.Excluded,
+			Traps:       result.Traps,
+			Assets:      result.Assets,
+			Sitemap:     result.Sitemap,
+			Metadata:    result.Metadata,
+		}); err != nil {
+			return result, fmt.Errorf("failed to save pages: %w", err)
+		}
+		if err := saveIndex(result, outputDir); err != nil {
 			return result, fmt.Errorf("failed to save results: %w", err)
 		}
+		// A finished crawl no longer needs its checkpoint
+		if ctx.Err() == nil {
+			c.removeCheckpoint()
+			if !c.leanPages() {
+				c.removeRecords()
+			}
+		}
 	}
 
 	return result, nil
 }
 
 func (c *Crawler) crawlPage(ctx context.Context, task CrawlTask) error {
-	// Create request
-	req, err := http.NewRequestWithContext(ctx, "GET", task.URL, nil)
+	// A coordinator hands the fetch over to a worker process
+	fetch := c.fetchPage
+	if c.remote != nil {
+		fetch = c.remote.dispatch
+	}
+
+	page, body, redirect, err := fetch(ctx, task)
+	c.recordRedirect(redirect)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return err
 	}
+	return c.addPage(task, page, body)
+}
 
-	req.Header.Set("User-Agent", c.Config.UserAgent)
+// fetchPage fetches and extracts a task's page without touching the crawl
+// state, apart from the cache. The redirect chain is returned even when the
+// fetch fails.
+func (c *Crawler) fetchPage(ctx context.Context, task CrawlTask) (page *PageData, body []byte, redirect *RedirectRecord, err error) {
+	// Create request
+	req, err := c.newRequest(ctx, "GET", task.URL, nil)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to create request: %w", err)
+	}
 
-	// Make request with retry
+	// Trace the time to first byte of the final attempt and record redirects
+	var fetchStart, firstByte time.Time
+	chain := &redirectChain{}
+	traced := httptrace.WithClientTrace(withRedirectChain(req.Context(), chain), &httptrace.ClientTrace{
+		GotFirstResponseByte: func() { firstByte = time.Now() },
+	})
+	req = req.WithContext(traced)
+
+	// Reuse a cached response while it is fresh, otherwise revalidate it
+	cacheKey := c.cacheKey(task.URL)
+	cached := c.cache.lookup(cacheKey)
 	var resp *http.Response
-	for attempt := 0; attempt <= c.Config.Performance.RetryAttempts; attempt++ {
-		resp, err = c.client.Do(req)
-		if err == nil && resp.StatusCode < 500 {
-			break
-		}
-		if attempt < c.Config.Performance.RetryAttempts {
-			time.Sleep(time.Duration(attempt+1) * time.Second)
+	fresh := cached != nil && cached.fresh(c.Config.Performance.CacheTTL)
+	if fresh {
+		fetchStart = time.Now()
+		resp = cached.response(req, nil)
+		redirect = cached.redirectRecord(task.URL)
+		c.countCache(true)
+	} else {
+		if cached != nil {
+			cached.addValidators(req)
 		}
-	}
 
-	if err != nil {
-		return fmt.Errorf("failed to fetch %s: %w", task.URL, err)
+		resp, err = c.fetch(ctx, req, hostOf(task.URL), chain, &fetchStart)
+
+		// Redirects are kept even when they end on an error
+		if err != nil {
+			return nil, nil, chain.record(task.URL, nil), fmt.Errorf("failed to fetch %s: %w", task.URL, err)
+		}
+		redirect = chain.record(task.URL, resp)
+
+		if resp.StatusCode == http.StatusNotModified && cached != nil {
+			_ = resp.Body.Close()
+			resp = cached.response(req, resp)
+			c.countCache(true)
+		} else {
+			cached = nil
+			c.countCache(false)
+		}
 	}
 	defer func() { _ = resp.Body.Close() }()
 
 	if resp.StatusCode >= 400 {
-		return fmt.Errorf("HTTP %d for %s", resp.StatusCode, task.URL)
+		return nil, nil, redirect, fmt.Errorf("HTTP %d for %s", resp.StatusCode, task.URL)
 	}
 
-	// Read body
-	body, err := io.ReadAll(resp.Body)
+	// Read body, truncated past the budget
+	body, truncated, err := readBody(resp.Body, c.maxBodyBytes())
 	if err != nil {
-		return fmt.Errorf("failed to read body: %w", err)
+		return nil, nil, redirect, fmt.Errorf("failed to read body: %w", err)
+	}
+	downloaded := time.Now()
+
+	// Fresh hits keep their original fetch time so the TTL still expires
+	if resp.StatusCode == http.StatusOK && !fresh && !truncated {
+		entry := &cacheEntry{
+			URL:           task.URL,
+			FinalURL:      resp.Request.URL.String(),
+			StatusCode:    resp.StatusCode,
+			Header:        resp.Header,
+			Body:          body,
+			RedirectChain: redirect.hopsOrNil(),
+			FetchedAt:     downloaded,
+		}
+		if err := c.cache.store(cacheKey, entry); err != nil {
+			fmt.Printf("Warning: failed to cache %s: %v\n", task.URL, err)
+		}
 	}
 
-	// Extract content
-	page, err := ExtractContent(task.URL, string(body), task.Depth)
+	// Extract content from the document transcoded to UTF-8. The character
+	// a truncation cut in a multi-byte charset decodes as a replacement.
+	charset := DetectCharset(resp.Header.Get("Content-Type"), body)
+	document := DecodeHTML(body, charset.Detected)
+	if truncated {
+		document = strings.TrimSuffix(document, "\uFFFD")
+	}
+	page, err = ExtractContent(task.URL, document, task.Depth)
 	if err != nil {
-		return fmt.Errorf("failed to extract content: %w", err)
+		return nil, nil, redirect, fmt.Errorf("failed to extract content: %w", err)
+	}
+
+	// Keep the real document and response for downstream audits
+	recordResponse(page, resp, len(body), fetchStart, firstByte, downloaded)
+	page.Hreflang = append(page.Hreflang, parseHreflangHeaders(resp.Header.Values("Link"), task.URL)...)
+	page.FinalURL = resp.Request.URL.String()
+	page.RedirectChain = redirect.hopsOrNil()
+	page.FromCache = cached != nil
+	page.BodyTruncated = truncated
+	page.DeclaredCharset = charset.Declared()
+	page.DetectedCharset = charset.Detected
+	page.CharsetConflicts = charset.Conflicts()
+	applyRobotsHeaders(page, resp.Header.Values("X-Robots-Tag"))
+	page.Indexable, page.IndexabilityReason = page.indexability(downloaded)
+	return page, body, redirect, nil
+}
+
+// addPage stores a fetched page, queues its links and streams it to disk
+func (c *Crawler) addPage(task CrawlTask, page *PageData, body []byte) error {
+	if err := c.storeRawHTML(page, body); err != nil {
+		return fmt.Errorf("failed to store raw HTML: %w", err)
 	}
 
 	// Add to results
 	c.mutex.Lock()
-	c.Results = append(c.Results, *page)
+	if entry, ok := c.sitemap[c.normalizer.Normalize(task.URL)]; ok {
+		applySitemapEntry(page, entry)
+	}
+	if c.leanPages() {
+		c.Results = append(c.Results, leanPage(*page))
+	} else {
+		c.Results = append(c.Results, *page)
+	}
+	if !c.listMode {
+		c.traps.observePage(page)
+	}
+	c.directoryPages[pageDirectory(page.URL)]++
+	// Cached pages were not downloaded again
+	if !page.FromCache {
+		c.countBytes(page.BodySize)
+	}
+	delete(c.inflight, task.URL)
+	checkpointDue := c.checkpointDue()
+	if final := c.normalizer.Normalize(page.FinalURL); final != c.normalizer.Normalize(task.URL) {
+		c.markVisited(final)
+	}
 
-	// Add new URLs to queue
-	for _, anchor := range page.Anchors {
-		newURL := c.resolveURL(task.URL, anchor.Href)
-		if newURL != "" && !c.Visited[newURL] && c.RespectDepthLimit(task.Depth+1) {
-			c.Queue = append(c.Queue, CrawlTask{
+	// Add new URLs to queue, resolved against the post-redirect URL. List
+	// mode only records them, and a nofollow page or a page redirected out
+	// of scope adds none.
+	anchors := page.Anchors
+	if page.Robots.NoFollow || !c.inScope(hostOf(c.normalizer.Normalize(page.FinalURL))) {
+		anchors = nil
+	}
+	for _, anchor := range anchors {
+		newURL := c.resolveURL(page.FinalURL, anchor.Href)
+		if newURL != "" && c.listMode {
+			if key := c.normalizer.Normalize(newURL); c.Config.List.RecordLinks && !c.isVisited(key) {
+				c.markVisited(key)
+				c.discovered = append(c.discovered, newURL)
+			}
+			continue
+		}
+		if newURL != "" && c.RespectDepthLimit(task.Depth+1) {
+			c.enqueue(CrawlTask{
 				URL:    newURL,
 				Depth:  task.Depth + 1,
 				Parent: task.URL,
 			})
 		}
 	}
+	if task.URL == c.seedURL {
+		c.queueSitemap()
+	}
 	c.mutex.Unlock()
 
+	if c.pages != nil {
+		if err := c.pages.WritePage(*page); err != nil {
+			fmt.Printf("Warning: failed to stream page %s: %v\n", task.URL, err)
+		}
+	}
+
+	if checkpointDue {
+		if err := c.saveCheckpoint(); err != nil {
+			fmt.Printf("Warning: failed to save crawl checkpoint: %v\n", err)
+		}
+	}
+
 	return nil
 }
 
+// fetch sends the request with retries, waiting for the host's turn before
+// each attempt. fetchStart is set to the start of the last attempt.
+func (c *Crawler) fetch(ctx context.Context, req *http.Request, host string, chain *redirectChain, fetchStart *time.Time) (*http.Response, error) {
+	var resp *http.Response
+	var err error
+	for attempt := 0; attempt <= c.Config.Performance.RetryAttempts; attempt++ {
+		if err := c.politeness.Wait(ctx, host); err != nil {
+			return nil, err
+		}
+
+		chain.reset()
+		*fetchStart = time.Now()
+		resp, err = c.client.Do(req)
+		if err == nil && isThrottled(resp.StatusCode) {
+			c.politeness.Backoff(host, parseRetryAfter(resp.Header.Get("Retry-After")))
+		} else if err == nil {
+			c.politeness.Success(host)
+		}
+
+		if err == nil && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			break
+		}
+		if errors.Is(err, errRedirectLoop) || errors.Is(err, errTooManyRedirects) {
+			break
+		}
+		if attempt < c.Config.Performance.RetryAttempts {
+			if resp != nil {
+				_ = resp.Body.Close()
+			}
+			// Throttled hosts are already paused by the politeness scheduler
+			if err != nil || !isThrottled(resp.StatusCode) {
+				if err := sleep(ctx, time.Duration(attempt+1)*time.Second); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return resp, err
+}
+
+// resolveURL resolves href against baseURL into the URL to fetch, cleaned
+// but on the host and scheme the link names. Its Normalize form is the key
+// the crawl knows it by.
 func (c *Crawler) resolveURL(baseURL, href string) string {
 	if href == "" {
 		return ""
 	}
 
-	base, err := url.Parse(baseURL)
+	base, err := url.Parse(c.normalizer.Clean(baseURL))
 	if err != nil {
 		return ""
 	}
@@ -181,32 +494,42 @@ func (c *Crawler) resolveURL(baseURL, href string) string {
 		return ""
 	}
 
-	resolved := base.ResolveReference(link)
-	
-	// Only return if same host
-	if resolved.Host != base.Host {
+	resolved := c.normalizer.Clean(base.ResolveReference(link).String())
+	key, err := url.Parse(c.normalizer.Normalize(resolved))
+	if err != nil {
 		return ""
 	}
 
-	return NormalizeURL(resolved.String())
-}
-
-func (c *Crawler) saveToFile(result *CrawlResult, outputDir string) error {
-	// Ensure directory exists
-	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		return err
+	// Only return links in the seed's scope, whatever host the linking page
+	// was redirected to. Outside a crawl, links stay on the page's host.
+	if c.seedURL == "" && key.Host != c.normalizer.normalizedHost(base) {
+		return ""
+	}
+	if c.seedURL != "" && !c.inScope(key.Host) {
+		return ""
 	}
 
-	// Write crawl_index.json
-	filePath := filepath.Join(outputDir, "crawl_index.json")
-	file, err := os.Create(filePath)
-	if err != nil {
-		return err
+	return resolved
+}
+
+// inScope reports whether the normalized host is the seed host or, when
+// subdomains are included, one of its subdomains
+func (c *Crawler) inScope(host string) bool {
+	if c.seedURL == "" {
+		return false
 	}
-	defer func() { _ = file.Close() }()
+	return c.scope.hostInScope(host, hostOf(c.normalizer.Normalize(c.seedURL)))
+}
 
-	encoder := json.NewEncoder(file)
-	encoder.SetIndent("", "  ")
-	return encoder.Encode(result)
+// saveToFile writes crawl_index.json from the pages held in result
+func (c *Crawler) saveToFile(result *CrawlResult, outputDir string) error {
+	return writeCrawlIndex(outputDir, result, func(yield func(PageData) error) error {
+		for _, page := range result.Pages {
+			if err := yield(page); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
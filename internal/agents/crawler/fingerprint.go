@@ -0,0 +1,115 @@
+package crawler
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"hash/fnv"
+	"strings"
+	"unicode"
+)
+
+const (
+	// shingleSize is the number of words in a shingle
+	shingleSize = 3
+	// minHashSize is the number of hash functions of a MinHash signature:
+	// the estimated similarity is off by about 1/√128
+	minHashSize = 128
+	// bandRows is the number of signature values in an LSH band: two pages
+	// sharing a band are worth comparing
+	bandRows = 4
+)
+
+// Fingerprint identifies the text of a page, exactly and by similarity
+type Fingerprint struct {
+	// Hash is the SHA-256 of the normalized text, equal for exact duplicates
+	Hash string `json:"hash"`
+	// MinHash estimates the Jaccard similarity of the shingles of two texts
+	MinHash []uint32 `json:"minhash"`
+	Words   int      `json:"words"`
+}
+
+// NewFingerprint fingerprints a text. Case, punctuation and spacing are
+// ignored.
+func NewFingerprint(content string) Fingerprint {
+	words := tokenize(content)
+	sum := sha256.Sum256([]byte(strings.Join(words, " ")))
+	return Fingerprint{
+		Hash:    hex.EncodeToString(sum[:]),
+		MinHash: minHash(words),
+		Words:   len(words),
+	}
+}
+
+// Similarity estimates how alike two texts are, from 0 to 1, as the share of
+// values their MinHash signatures have in common
+func (f Fingerprint) Similarity(other Fingerprint) float64 {
+	if f.Hash == other.Hash {
+		return 1
+	}
+	if len(f.MinHash) != len(other.MinHash) || len(f.MinHash) == 0 {
+		return 0
+	}
+	same := 0
+	for i := range f.MinHash {
+		if f.MinHash[i] == other.MinHash[i] {
+			same++
+		}
+	}
+	return float64(same) / float64(len(f.MinHash))
+}
+
+// Bands splits the signature into LSH bands, each prefixed with its rank
+func (f Fingerprint) Bands() []string {
+	bands := make([]string, 0, len(f.MinHash)/bandRows)
+	for i := 0; i+bandRows <= len(f.MinHash); i += bandRows {
+		band := []byte{byte(i / bandRows)}
+		for _, value := range f.MinHash[i : i+bandRows] {
+			band = binary.BigEndian.AppendUint32(band, value)
+		}
+		bands = append(bands, string(band))
+	}
+	return bands
+}
+
+// tokenize splits a text into lowercase words
+func tokenize(content string) []string {
+	return strings.FieldsFunc(strings.ToLower(content), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// minHash computes the MinHash signature of the word shingles: for each hash
+// function, the smallest value it takes over the shingles
+func minHash(words []string) []uint32 {
+	if len(words) == 0 {
+		return nil
+	}
+	size := min(shingleSize, len(words))
+
+	signature := make([]uint32, minHashSize)
+	for i := range signature {
+		signature[i] = ^uint32(0)
+	}
+	for i := 0; i+size <= len(words); i++ {
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(words[i:i+size], " ")))
+		shingle := h.Sum64()
+		for j := range signature {
+			if value := uint32(mix(shingle+uint64(j)*0x9E3779B97F4A7C15) >> 32); value < signature[j] {
+				signature[j] = value
+			}
+		}
+	}
+	return signature
+}
+
+// mix is the splitmix64 finalizer, from which the hash functions derive
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xBF58476D1CE4E5B9
+	x ^= x >> 27
+	x *= 0x94D049BB133111EB
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,414 @@
+package crawler
+
+import (
+	"container/heap"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"unicode"
+
+	"firesalamander/internal/config"
+	"firesalamander/internal/constants"
+)
+
+// Frontier holds the URLs waiting to be crawled and decides which comes next
+type Frontier interface {
+	Push(task CrawlTask)
+	Pop() (CrawlTask, bool)
+	Len() int
+	// Tasks returns the pending tasks in the order they would be popped
+	Tasks() []CrawlTask
+	// Seen accounts for a URL crawled outside this frontier, e.g. restored
+	// from a checkpoint, so quotas stay correct
+	Seen(urlStr string)
+}
+
+// NewFrontier returns the frontier for the configured crawl strategy
+func NewFrontier(cfg config.CrawlerConfig) Frontier {
+	switch cfg.CrawlStrategy() {
+	case constants.CrawlStrategySmart:
+		return newSmartFrontier(cfg, false)
+	case constants.CrawlStrategyAggressive:
+		return newSmartFrontier(cfg, true)
+	default:
+		return &bfsFrontier{}
+	}
+}
+
+// bfsFrontier is a plain FIFO queue: pages are crawled in discovery order
+type bfsFrontier struct {
+	tasks []CrawlTask
+}
+
+func (f *bfsFrontier) Push(task CrawlTask) {
+	f.tasks = append(f.tasks, task)
+}
+
+func (f *bfsFrontier) Pop() (CrawlTask, bool) {
+	if len(f.tasks) == 0 {
+		return CrawlTask{}, false
+	}
+	task := f.tasks[0]
+	f.tasks = f.tasks[1:]
+	return task, true
+}
+
+func (f *bfsFrontier) Len() int {
+	return len(f.tasks)
+}
+
+func (f *bfsFrontier) Tasks() []CrawlTask {
+	return append([]CrawlTask(nil), f.tasks...)
+}
+
+func (f *bfsFrontier) Seen(string) {}
+
+// Sampling tiers, lowest popped first
+const (
+	tierPriority = iota
+	tierNormal
+	tierOverQuota
+	tierPagination
+)
+
+// smartFrontier samples a capped crawl so it covers the site instead of its
+// first listing: priority pages come first, then URLs whose template and
+// directory have been crawled the least. Pagination and URLs over quota
+// only come once nothing else is left. In aggressive mode they are dropped.
+//
+// Tasks are parsed and scored once when pushed and kept in a heap. Scores
+// only get worse as pages are crawled, so a stored score is a lower bound:
+// Pop rescores the top task and pops it once its score is current.
+type smartFrontier struct {
+	queue          frontierQueue
+	pushed         int
+	priorityPages  []string
+	directoryQuota int
+	templateQuota  int
+	aggressive     bool
+	directories    map[string]int
+	templates      map[string]int
+}
+
+func newSmartFrontier(cfg config.CrawlerConfig, aggressive bool) *smartFrontier {
+	f := &smartFrontier{
+		priorityPages:  cfg.Sampling.PriorityPages,
+		directoryQuota: cfg.Sampling.DirectoryQuota,
+		templateQuota:  cfg.Sampling.TemplateQuota,
+		aggressive:     aggressive,
+		directories:    make(map[string]int),
+		templates:      make(map[string]int),
+	}
+
+	maxURLs := cfg.Limits.MaxURLs
+	if maxURLs <= 0 {
+		maxURLs = constants.DefaultMaxURLs
+	}
+	if f.directoryQuota <= 0 {
+		f.directoryQuota = max(maxURLs/5, 1)
+	}
+	if f.templateQuota <= 0 {
+		f.templateQuota = max(maxURLs/10, 1)
+		if aggressive {
+			f.templateQuota = max(maxURLs/50, 1)
+		}
+	}
+	return f
+}
+
+func (f *smartFrontier) Push(task CrawlTask) {
+	entry := &frontierEntry{task: task, order: f.pushed, invalid: true}
+	f.pushed++
+	if u, err := url.Parse(task.URL); err == nil {
+		entry.invalid = false
+		entry.template = urlTemplate(u)
+		entry.directory = urlDirectory(u)
+		entry.pagination = isPaginationURL(u)
+		entry.priority = isPriorityPage(u, task.Depth, f.priorityPages)
+	}
+	entry.score = f.score(entry)
+	heap.Push(&f.queue, entry)
+}
+
+// Pop returns the best pending task, the first pushed among equals
+func (f *smartFrontier) Pop() (CrawlTask, bool) {
+	for f.queue.Len() > 0 {
+		top := f.queue[0]
+		if score := f.score(top); score != top.score {
+			top.score = score
+			heap.Fix(&f.queue, 0)
+			continue
+		}
+		heap.Pop(&f.queue)
+
+		if f.aggressive && top.score.tier >= tierOverQuota {
+			continue
+		}
+		if !top.invalid {
+			f.directories[top.directory]++
+			f.templates[top.template]++
+		}
+		return top.task, true
+	}
+	return CrawlTask{}, false
+}
+
+func (f *smartFrontier) Len() int {
+	return f.queue.Len()
+}
+
+func (f *smartFrontier) Tasks() []CrawlTask {
+	entries := append(frontierQueue(nil), f.queue...)
+	scores := make(map[*frontierEntry]frontierScore, len(entries))
+	for _, entry := range entries {
+		scores[entry] = f.score(entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if scores[a] != scores[b] {
+			return scores[a].less(scores[b])
+		}
+		return a.order < b.order
+	})
+
+	tasks := make([]CrawlTask, len(entries))
+	for i, entry := range entries {
+		tasks[i] = entry.task
+	}
+	return tasks
+}
+
+func (f *smartFrontier) Seen(urlStr string) {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return
+	}
+	f.directories[urlDirectory(u)]++
+	f.templates[urlTemplate(u)]++
+}
+
+// frontierEntry is a queued task with what its score depends on, parsed once
+type frontierEntry struct {
+	task       CrawlTask
+	order      int
+	template   string
+	directory  string
+	pagination bool
+	priority   bool
+	invalid    bool
+	// score is the score when last computed, a lower bound of the current one
+	score frontierScore
+}
+
+// frontierQueue is a min-heap of entries by score, then push order
+type frontierQueue []*frontierEntry
+
+func (q frontierQueue) Len() int { return len(q) }
+
+func (q frontierQueue) Less(i, j int) bool {
+	if q[i].score != q[j].score {
+		return q[i].score.less(q[j].score)
+	}
+	return q[i].order < q[j].order
+}
+
+func (q frontierQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *frontierQueue) Push(x any) { *q = append(*q, x.(*frontierEntry)) }
+
+func (q *frontierQueue) Pop() any {
+	old := *q
+	entry := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	return entry
+}
+
+type frontierScore struct {
+	tier      int
+	templates int
+	depth     int
+}
+
+func (s frontierScore) less(other frontierScore) bool {
+	if s.tier != other.tier {
+		return s.tier < other.tier
+	}
+	if s.templates != other.templates {
+		return s.templates < other.templates
+	}
+	return s.depth < other.depth
+}
+
+// score ranks an entry against the pages crawled so far
+func (f *smartFrontier) score(entry *frontierEntry) frontierScore {
+	if entry.invalid {
+		return frontierScore{tier: tierPagination, depth: entry.task.Depth}
+	}
+
+	score := frontierScore{tier: tierNormal, templates: f.templates[entry.template], depth: entry.task.Depth}
+
+	switch {
+	case entry.pagination:
+		score.tier = tierPagination
+	case f.templates[entry.template] >= f.templateQuota || f.directories[entry.directory] >= f.directoryQuota:
+		score.tier = tierOverQuota
+	case entry.priority:
+		score.tier = tierPriority
+	}
+	return score
+}
+
+// Keywords recognising the priority page kinds of crawler.yaml
+var (
+	categorySegments = []string{"category", "categories", "categorie", "c", "collection", "collections", "rayon", "rayons", "catalog", "catalogue", "shop", "boutique"}
+	productSegments  = []string{"product", "products", "produit", "produits", "p", "item", "items", "article", "dp"}
+)
+
+// isPriorityPage matches a URL against the priority_pages entries: "home",
+// "categories", "top_products" (products linked close to the home page) or a
+// path prefix such as "/blog"
+func isPriorityPage(u *url.URL, depth int, priorityPages []string) bool {
+	segments := pathSegments(u.Path)
+
+	for _, kind := range priorityPages {
+		switch kind {
+		case "home":
+			if len(segments) == 0 || (len(segments) == 1 && strings.HasPrefix(segments[0], "index.")) {
+				return true
+			}
+		case "categories":
+			if len(segments) > 0 && len(segments) <= 2 && containsFold(categorySegments, segments[0]) {
+				return true
+			}
+		case "top_products":
+			if depth <= 2 && len(segments) > 1 && containsFold(productSegments, segments[0]) {
+				return true
+			}
+		default:
+			if strings.HasPrefix(kind, "/") && strings.HasPrefix(u.Path, kind) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// paginationParams are query parameters carrying a page number
+var paginationParams = []string{"page", "p", "pg", "paged", "pagenum", "start", "offset"}
+
+// isPaginationURL recognises ?page=2, /page/2 and /page-2 style listings
+func isPaginationURL(u *url.URL) bool {
+	query := u.Query()
+	for _, param := range paginationParams {
+		if value := query.Get(param); value != "" && isNumber(value) && value != "1" {
+			return true
+		}
+	}
+
+	segments := pathSegments(u.Path)
+	for i, segment := range segments {
+		lower := strings.ToLower(segment)
+		if (lower == "page" || lower == "p") && i+1 < len(segments) && isNumber(segments[i+1]) {
+			return true
+		}
+		if rest, ok := strings.CutPrefix(lower, "page-"); ok && isNumber(rest) {
+			return true
+		}
+	}
+	return false
+}
+
+// urlDirectory is the first path segment, the unit of the per-directory quota
+func urlDirectory(u *url.URL) string {
+	segments := pathSegments(u.Path)
+	if len(segments) < 2 {
+		return "/"
+	}
+	return "/" + strings.ToLower(segments[0])
+}
+
+// urlTemplate guesses the page template from the URL shape: identifiers
+// are replaced by placeholders, the leaf segment only keeps its extension
+// and the query only keeps its parameter names
+func urlTemplate(u *url.URL) string {
+	segments := pathSegments(u.Path)
+
+	var b strings.Builder
+	for i, segment := range segments {
+		b.WriteString("/")
+		switch {
+		case i == len(segments)-1:
+			b.WriteString("{leaf}" + path.Ext(segment))
+		case isNumber(segment):
+			b.WriteString("{n}")
+		case looksLikeID(segment):
+			b.WriteString("{id}")
+		default:
+			b.WriteString(strings.ToLower(segment))
+		}
+	}
+	if b.Len() == 0 {
+		b.WriteString("/")
+	}
+
+	if u.RawQuery != "" {
+		keys := make([]string, 0)
+		for key := range u.Query() {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		b.WriteString("?" + strings.Join(keys, "&"))
+	}
+	return b.String()
+}
+
+func pathSegments(p string) []string {
+	segments := make([]string, 0)
+	for _, segment := range strings.Split(p, "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	return segments
+}
+
+func isNumber(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// looksLikeID spots hashes and UUIDs: long segments mixing digits and letters
+func looksLikeID(s string) bool {
+	if len(s) < 8 {
+		return false
+	}
+	digits := 0
+	for _, r := range s {
+		switch {
+		case unicode.IsDigit(r):
+			digits++
+		case r == '-' || unicode.Is(unicode.ASCII_Hex_Digit, r):
+		default:
+			return false
+		}
+	}
+	return digits > 0
+}
+
+func containsFold(values []string, s string) bool {
+	for _, value := range values {
+		if strings.EqualFold(value, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,227 @@
+package crawler
+
+import (
+	"container/heap"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+
+	appconfig "firesalamander/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// shopSampling samples a 20-URL crawl of a shop with the smart strategy
+func shopSampling(cfg *appconfig.CrawlerConfig) {
+	cfg.Limits = appconfig.Limits{MaxURLs: 20, MaxDepth: 5}
+	cfg.Sampling = appconfig.Sampling{
+		Strategy:      "smart",
+		PriorityPages: []string{"home", "categories", "top_products"},
+	}
+}
+
+// pushShopListing fills a frontier the way a listing-heavy shop would
+func pushShopListing(f Frontier) {
+	for i := 2; i <= 50; i++ {
+		f.Push(CrawlTask{URL: fmt.Sprintf("https://shop.example/catalog/shoes?page=%d", i), Depth: 1})
+	}
+	for i := 1; i <= 30; i++ {
+		f.Push(CrawlTask{URL: fmt.Sprintf("https://shop.example/product/shoe-%d", i), Depth: 2})
+	}
+	f.Push(CrawlTask{URL: "https://shop.example/blog/summer-sale", Depth: 2})
+	f.Push(CrawlTask{URL: "https://shop.example/about", Depth: 1})
+	f.Push(CrawlTask{URL: "https://shop.example/catalog/hats", Depth: 1})
+	f.Push(CrawlTask{URL: "https://shop.example/", Depth: 0})
+}
+
+func popURLs(f Frontier, n int) []string {
+	urls := make([]string, 0, n)
+	for len(urls) < n {
+		task, ok := f.Pop()
+		if !ok {
+			break
+		}
+		urls = append(urls, task.URL)
+	}
+	return urls
+}
+
+func TestNewFrontierStrategy(t *testing.T) {
+	assert.IsType(t, &bfsFrontier{}, NewFrontier(appconfig.CrawlerConfig{}))
+	assert.IsType(t, &smartFrontier{}, NewFrontier(newTestConfig(shopSampling)))
+
+	cfg := newTestConfig(shopSampling)
+	cfg.Sampling.Strategy = "none"
+	assert.IsType(t, &bfsFrontier{}, NewFrontier(cfg))
+
+	cfg.Sampling.Strategy = "aggressive"
+	aggressive, ok := NewFrontier(cfg).(*smartFrontier)
+	assert.True(t, ok)
+	assert.True(t, aggressive.aggressive)
+}
+
+func TestBFSFrontierIsFIFO(t *testing.T) {
+	f := NewFrontier(appconfig.CrawlerConfig{})
+	pushShopListing(f)
+
+	urls := popURLs(f, 3)
+	assert.Equal(t, []string{
+		"https://shop.example/catalog/shoes?page=2",
+		"https://shop.example/catalog/shoes?page=3",
+		"https://shop.example/catalog/shoes?page=4",
+	}, urls)
+}
+
+func TestSmartFrontierSamplesTheSite(t *testing.T) {
+	f := NewFrontier(newTestConfig(shopSampling))
+	pushShopListing(f)
+
+	urls := popURLs(f, 10)
+
+	// Priority pages first
+	assert.Equal(t, "https://shop.example/", urls[0])
+	assert.Contains(t, urls[:3], "https://shop.example/catalog/hats")
+
+	// Every template shows up before pagination or a second round of products
+	assert.Contains(t, urls, "https://shop.example/about")
+	assert.Contains(t, urls, "https://shop.example/blog/summer-sale")
+	for _, u := range urls {
+		assert.NotContains(t, u, "?page=")
+	}
+
+	// Pagination is only crawled once nothing else is left
+	remaining := popURLs(f, f.Len())
+	assert.Contains(t, remaining[len(remaining)-1], "?page=")
+}
+
+func TestSmartFrontierTemplateQuota(t *testing.T) {
+	f := NewFrontier(newTestConfig(shopSampling)) // template quota 20/10 = 2
+	for i := 1; i <= 5; i++ {
+		f.Push(CrawlTask{URL: fmt.Sprintf("https://shop.example/product/shoe-%d", i), Depth: 2})
+	}
+	f.Push(CrawlTask{URL: "https://shop.example/brand/acme/shoes", Depth: 3})
+
+	urls := popURLs(f, 3)
+	assert.Equal(t, "https://shop.example/brand/acme/shoes", urls[2])
+}
+
+func TestAggressiveFrontierDropsOverQuota(t *testing.T) {
+	cfg := newTestConfig(shopSampling)
+	cfg.Sampling.Strategy = "aggressive"
+	f := NewFrontier(cfg) // template quota 1
+	pushShopListing(f)
+
+	urls := popURLs(f, 100)
+	products := 0
+	for _, u := range urls {
+		assert.NotContains(t, u, "?page=")
+		if strings.HasPrefix(u, "https://shop.example/product/") {
+			products++
+		}
+	}
+	assert.Equal(t, 1, products)
+	assert.Equal(t, 0, f.Len())
+}
+
+func TestSmartFrontierSeen(t *testing.T) {
+	f := NewFrontier(newTestConfig(shopSampling))
+	f.Seen("https://shop.example/product/shoe-1")
+	f.Seen("https://shop.example/product/shoe-2")
+
+	f.Push(CrawlTask{URL: "https://shop.example/product/shoe-3", Depth: 2})
+	f.Push(CrawlTask{URL: "https://shop.example/contact", Depth: 2})
+
+	task, _ := f.Pop()
+	assert.Equal(t, "https://shop.example/contact", task.URL)
+}
+
+func TestSmartFrontierPopsLikeAFullRescan(t *testing.T) {
+	tasks := make([]CrawlTask, 0, 2000)
+	for i := 0; i < 2000; i++ {
+		var u string
+		switch i % 5 {
+		case 0:
+			u = fmt.Sprintf("https://shop.example/product/item-%d", i)
+		case 1:
+			u = fmt.Sprintf("https://shop.example/catalog/c%d?page=%d", i%7, i)
+		case 2:
+			u = fmt.Sprintf("https://shop.example/blog/%d/post-%d", i%12, i)
+		case 3:
+			u = fmt.Sprintf("https://shop.example/category/c%d", i)
+		default:
+			u = fmt.Sprintf("https://shop.example/d%d/page-%d.html", i%40, i)
+		}
+		tasks = append(tasks, CrawlTask{URL: u, Depth: i % 4})
+	}
+
+	cfg := newTestConfig(shopSampling)
+	cfg.Limits.MaxURLs = 500
+	f := NewFrontier(cfg)
+	for _, task := range tasks {
+		f.Push(task)
+	}
+
+	// The reference rescans every pending task on each pop, as the frontier
+	// used to: the earliest pushed task with the best current score wins
+	reference := newSmartFrontier(cfg, false)
+	pending := make([]*frontierEntry, 0, len(tasks))
+	for _, task := range tasks {
+		reference.Push(task)
+	}
+	for reference.queue.Len() > 0 {
+		pending = append(pending, heap.Pop(&reference.queue).(*frontierEntry))
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].order < pending[j].order })
+	for len(pending) > 0 {
+		best := 0
+		for i := 1; i < len(pending); i++ {
+			if reference.score(pending[i]).less(reference.score(pending[best])) {
+				best = i
+			}
+		}
+		want := pending[best]
+		pending = append(pending[:best], pending[best+1:]...)
+		reference.Seen(want.task.URL)
+
+		got, ok := f.Pop()
+		require.True(t, ok)
+		require.Equal(t, want.task, got)
+	}
+	_, ok := f.Pop()
+	assert.False(t, ok)
+}
+
+func TestURLTemplate(t *testing.T) {
+	tests := map[string]string{
+		"https://shop.example/":                          "/",
+		"https://shop.example/product/red-shoe":          "/product/{leaf}",
+		"https://shop.example/product/blue-hat":          "/product/{leaf}",
+		"https://shop.example/blog/2024/05/post.html":    "/blog/{n}/{n}/{leaf}.html",
+		"https://shop.example/u/3f2a9c1e-77aa/profile":   "/u/{id}/{leaf}",
+		"https://shop.example/search?q=shoes&sort=price": "/{leaf}?q&sort",
+		"https://shop.example/Category/Shoes?color=red":  "/category/{leaf}?color",
+	}
+
+	for raw, expected := range tests {
+		u, _ := url.Parse(raw)
+		assert.Equal(t, expected, urlTemplate(u), raw)
+	}
+}
+
+func TestIsPaginationURL(t *testing.T) {
+	tests := map[string]bool{
+		"https://shop.example/shoes?page=3":  true,
+		"https://shop.example/shoes?page=1":  false,
+		"https://shop.example/shoes/page/2":  true,
+		"https://shop.example/shoes/page-4":  true,
+		"https://shop.example/page/contact":  false,
+		"https://shop.example/shoes?sort=up": false,
+	}
+
+	for raw, expected := range tests {
+		u, _ := url.Parse(raw)
+		assert.Equal(t, expected, isPaginationURL(u), raw)
+	}
+}
@@ -0,0 +1,108 @@
+package crawler
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Hreflang annotation sources
+const (
+	HreflangSourceHTML   = "html"
+	HreflangSourceHeader = "header"
+)
+
+// HreflangLink is an alternate language version declared by a page, either
+// with <link rel="alternate" hreflang> or with an HTTP Link header
+type HreflangLink struct {
+	Lang   string `json:"lang"`
+	URL    string `json:"url"`
+	Source string `json:"source"`
+}
+
+// hasRel reports whether a space separated rel attribute contains value
+func hasRel(rel, value string) bool {
+	for _, token := range strings.Fields(rel) {
+		if strings.EqualFold(token, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// absoluteURL resolves href against the page URL, keeping href when either
+// cannot be parsed
+func absoluteURL(pageURL, href string) string {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return href
+	}
+	ref, err := url.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return href
+	}
+	return base.ResolveReference(ref).String()
+}
+
+// parseHreflangHeaders extracts the hreflang alternates of HTTP Link headers,
+// such as: Link: <https://example.com/en/>; rel="alternate"; hreflang="en"
+func parseHreflangHeaders(values []string, pageURL string) []HreflangLink {
+	var links []HreflangLink
+	for _, value := range values {
+		for _, link := range splitLinkHeader(value) {
+			target, params, ok := parseLinkValue(link)
+			if !ok || !hasRel(params["rel"], "alternate") || params["hreflang"] == "" {
+				continue
+			}
+			links = append(links, HreflangLink{
+				Lang:   params["hreflang"],
+				URL:    absoluteURL(pageURL, target),
+				Source: HreflangSourceHeader,
+			})
+		}
+	}
+	return links
+}
+
+// splitLinkHeader splits a Link header on the commas separating links,
+// ignoring commas inside <...> and quoted strings
+func splitLinkHeader(value string) []string {
+	var parts []string
+	inURL, inQuote, start := false, false, 0
+	for i, r := range value {
+		switch {
+		case r == '<' && !inQuote:
+			inURL = true
+		case r == '>' && !inQuote:
+			inURL = false
+		case r == '"' && !inURL:
+			inQuote = !inQuote
+		case r == ',' && !inURL && !inQuote:
+			parts = append(parts, value[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, value[start:])
+}
+
+// parseLinkValue splits one link of a Link header into its target and
+// lowercased parameters
+func parseLinkValue(link string) (string, map[string]string, bool) {
+	link = strings.TrimSpace(link)
+	if !strings.HasPrefix(link, "<") {
+		return "", nil, false
+	}
+	end := strings.Index(link, ">")
+	if end < 0 {
+		return "", nil, false
+	}
+
+	params := make(map[string]string)
+	for _, param := range strings.Split(link[end+1:], ";") {
+		key, value, found := strings.Cut(strings.TrimSpace(param), "=")
+		if !found {
+			continue
+		}
+		params[strings.ToLower(strings.TrimSpace(key))] = strings.Trim(strings.TrimSpace(value), `"`)
+	}
+	return link[1:end], params, true
+}
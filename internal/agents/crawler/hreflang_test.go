@@ -0,0 +1,68 @@
+package crawler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	appconfig "firesalamander/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractContentHreflang(t *testing.T) {
+	html := `<html lang="fr"><head>
+		<link rel="canonical" href="https://example.com/fr/">
+		<link rel="alternate" hreflang="fr" href="https://example.com/fr/">
+		<link rel="alternate" hreflang="en-GB" href="/en/">
+		<link rel="alternate" hreflang="x-default" href="https://example.com/">
+		<link rel="alternate" type="application/rss+xml" href="/feed">
+	</head><body></body></html>`
+
+	page, err := ExtractContent("https://example.com/fr/", html, 0)
+	require.NoError(t, err)
+
+	assert.Equal(t, []HreflangLink{
+		{Lang: "fr", URL: "https://example.com/fr/", Source: HreflangSourceHTML},
+		{Lang: "en-GB", URL: "https://example.com/en/", Source: HreflangSourceHTML},
+		{Lang: "x-default", URL: "https://example.com/", Source: HreflangSourceHTML},
+	}, page.Hreflang)
+	assert.Equal(t, "https://example.com/fr/", page.Canonical)
+}
+
+func TestParseHreflangHeaders(t *testing.T) {
+	values := []string{
+		`<https://example.com/fr>; rel="alternate"; hreflang="fr", </en>; rel="alternate"; hreflang="en"`,
+		`<https://example.com/style.css>; rel=preload; as=style`,
+		`<https://example.com/a,b>; rel="alternate canonical"; hreflang=de`,
+	}
+
+	assert.Equal(t, []HreflangLink{
+		{Lang: "fr", URL: "https://example.com/fr", Source: HreflangSourceHeader},
+		{Lang: "en", URL: "https://example.com/en", Source: HreflangSourceHeader},
+		{Lang: "de", URL: "https://example.com/a,b", Source: HreflangSourceHeader},
+	}, parseHreflangHeaders(values, "https://example.com/page"))
+}
+
+func TestCrawlRecordsHreflangHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Link", `</doc-en.pdf>; rel="alternate"; hreflang="en"`)
+		w.Write([]byte(`<html><head><link rel="alternate" hreflang="fr" href="/"></head><body></body></html>`))
+	}))
+	defer server.Close()
+
+	crawler := NewCrawler(appconfig.CrawlerConfig{
+		Limits:      appconfig.Limits{MaxURLs: 1, MaxDepth: 0},
+		Performance: appconfig.Performance{ConcurrentRequests: 1, RequestTimeout: 5 * time.Second},
+	})
+	result, err := crawler.Crawl(context.Background(), server.URL, "")
+	require.NoError(t, err)
+	require.Len(t, result.Pages, 1)
+
+	assert.ElementsMatch(t, []HreflangLink{
+		{Lang: "fr", URL: server.URL + "/", Source: HreflangSourceHTML},
+		{Lang: "en", URL: server.URL + "/doc-en.pdf", Source: HreflangSourceHeader},
+	}, result.Pages[0].Hreflang)
+}
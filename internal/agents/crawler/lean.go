@@ -0,0 +1,106 @@
+package crawler
+
+import (
+	"fmt"
+	"os"
+)
+
+// With Memory.LeanPages, crawled pages are streamed to pages.jsonl in full
+// but kept in memory as their scalar summary: checkpoints only need that,
+// and the link graph and the asset pass read the anchors and assets back
+// from pages.jsonl. The link graph goes to links.jsonl rather than to the
+// pages, and blocked, redirected and excluded URLs to records.jsonl. The
+// other fields are merged back from the streamed records when pages.jsonl is
+// rewritten at the end of the crawl. The summaries still grow with the
+// crawl, at around 1 KB per page.
+
+// leanPages reports whether crawled pages are kept lean in memory
+func (c *Crawler) leanPages() bool {
+	return c.Config.Memory.LeanPages && c.outputDir != ""
+}
+
+// leanPage drops the text and lists of a page
+func leanPage(page PageData) PageData {
+	page.Content = ""
+	page.BoilerplateContent = ""
+	page.RawHTML = ""
+	page.H2 = nil
+	page.H3 = nil
+	page.Headers = nil
+	page.Anchors = nil
+	page.OutgoingLinks = nil
+	page.IncomingLinks = nil
+	page.RedirectChain = nil
+	page.Hreflang = nil
+	page.CharsetConflicts = nil
+	page.Robots.Declarations = nil
+	page.Assets = nil
+	return page
+}
+
+// restoreLean puts back what leanPage dropped from the streamed page, but
+// for the link lists the link graph gives
+func restoreLean(page *PageData, streamed PageData) {
+	page.Content = streamed.Content
+	page.BoilerplateContent = streamed.BoilerplateContent
+	page.H2 = streamed.H2
+	page.H3 = streamed.H3
+	page.Headers = streamed.Headers
+	page.Anchors = streamed.Anchors
+	page.RedirectChain = streamed.RedirectChain
+	page.Hreflang = streamed.Hreflang
+	page.CharsetConflicts = streamed.CharsetConflicts
+	page.Robots.Declarations = streamed.Robots.Declarations
+	page.Assets = streamed.Assets
+}
+
+// writeRestoredPages streams the pages restored from a checkpoint. Lean
+// pages are copied from previous, the pages.jsonl of the interrupted crawl,
+// when it has them.
+func (c *Crawler) writeRestoredPages(pages *pageWriter, previous string) error {
+	if previous == "" {
+		for _, page := range c.Results {
+			if err := pages.WritePage(page); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	defer func() { _ = os.Remove(previous) }()
+
+	restored := make(map[string]bool, len(c.Results))
+	for _, page := range c.Results {
+		restored[page.URL] = true
+	}
+
+	file, err := os.Open(previous)
+	if err != nil {
+		return err
+	}
+	reader := NewPageReader(file)
+	defer func() { _ = reader.Close() }()
+	for reader.Next() {
+		// Pages fetched after the checkpoint are fetched again
+		page := reader.Page()
+		if !restored[page.URL] {
+			continue
+		}
+		delete(restored, page.URL)
+		if err := pages.WritePage(page); err != nil {
+			return err
+		}
+	}
+	if err := reader.Err(); err != nil {
+		fmt.Printf("Warning: failed to read the pages of the interrupted crawl: %v\n", err)
+	}
+
+	// Pages the interrupted crawl did not manage to stream stay lean
+	for _, page := range c.Results {
+		if restored[page.URL] {
+			if err := pages.WritePage(page); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,305 @@
+package crawler
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// UnreachableLinkDepth is the link depth of a page no crawled link leads to
+// from the seed, such as a page only listed in the sitemap
+const UnreachableLinkDepth = -1
+
+// buildLinkGraph resolves and normalizes the anchors of every crawled page
+// once the crawl is over, and fills the link fields of the pages from the
+// resulting internal link graph. The anchors of lean pages are read back
+// from pages.jsonl, and their graph written to links.jsonl rather than kept
+// in memory. Either way it holds a URL index and a few counters per page,
+// around 150 bytes per page on top of its summary. Caller holds c.mutex.
+func (c *Crawler) buildLinkGraph() {
+	// A link reaches a page through its requested or its final URL
+	index := make(map[string]int, len(c.Results))
+	for i, page := range c.Results {
+		index[c.normalizer.Normalize(page.URL)] = i
+	}
+	for i, page := range c.Results {
+		if page.FinalURL == "" {
+			continue
+		}
+		if _, ok := index[c.normalizer.Normalize(page.FinalURL)]; !ok {
+			index[c.normalizer.Normalize(page.FinalURL)] = i
+		}
+	}
+	// A link to a redirecting URL counts for the page it lands on
+	resolve := func(urlStr string) (int, bool) {
+		i, ok := index[urlStr]
+		if ok && c.Results[i].FinalURL != "" {
+			i = index[c.normalizer.Normalize(c.Results[i].FinalURL)]
+		}
+		return i, ok
+	}
+	// position finds a crawled page by its requested URL
+	position := func(urlStr string) (int, bool) {
+		i, ok := index[c.normalizer.Normalize(urlStr)]
+		return i, ok && c.Results[i].URL == urlStr
+	}
+
+	// link counts the links of page i, and returns the URLs it links to and
+	// the other crawled pages among them, once each
+	inlinks := make([]int, len(c.Results))
+	uniqueInlinks := make([]int, len(c.Results))
+	link := func(i int, anchors []Anchor) ([]string, []int) {
+		page := &c.Results[i]
+		page.Outlinks = 0
+		var targets []int
+		linked := make(map[int]bool)
+		for _, anchor := range anchors {
+			if anchor.URL == "" {
+				continue
+			}
+			page.Outlinks++
+			// Links of a page to itself are not inlinks
+			target, crawled := resolve(anchor.URL)
+			if !crawled || target == i {
+				continue
+			}
+			inlinks[target]++
+			if !linked[target] {
+				linked[target] = true
+				uniqueInlinks[target]++
+				targets = append(targets, target)
+			}
+		}
+		outgoing := uniqueLinks(anchors)
+		page.UniqueOutlinks = len(outgoing)
+		return outgoing, targets
+	}
+
+	seed, seedCrawled := index[c.normalizer.Normalize(c.seedURL)]
+	var depths []int
+	if c.leanPages() && c.pages != nil {
+		depths = c.writeLinkGraph(link, position, resolve, seed, seedCrawled)
+	} else {
+		if c.outputDir != "" {
+			_ = os.Remove(filepath.Join(c.outputDir, linksFileName))
+		}
+		incoming := make([][]string, len(c.Results))
+		graph := make([][]int, len(c.Results))
+		for i := range c.Results {
+			page := &c.Results[i]
+			c.resolveAnchors(page)
+			page.OutgoingLinks, graph[i] = link(i, page.Anchors)
+			for _, target := range graph[i] {
+				incoming[target] = append(incoming[target], page.URL)
+			}
+		}
+		for i := range c.Results {
+			page := &c.Results[i]
+			page.IncomingLinks = incoming[i]
+			if page.IncomingLinks == nil {
+				page.IncomingLinks = make([]string, 0)
+			}
+			sort.Strings(page.IncomingLinks)
+		}
+		depths = linkDepths(seed, seedCrawled, graph)
+	}
+
+	for i := range c.Results {
+		page := &c.Results[i]
+		page.Inlinks = inlinks[i]
+		page.UniqueInlinks = uniqueInlinks[i]
+		page.LinkDepth = depths[i]
+	}
+}
+
+// uniqueLinks lists the internal URLs anchors link to, once each, in the
+// order they appear
+func uniqueLinks(anchors []Anchor) []string {
+	links := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, anchor := range anchors {
+		if anchor.URL == "" || seen[anchor.URL] {
+			continue
+		}
+		seen[anchor.URL] = true
+		links = append(links, anchor.URL)
+	}
+	return links
+}
+
+// linksFileName holds the internal link graph of a lean crawl next to
+// pages.jsonl, one linkRecord per crawled page
+const linksFileName = "links.jsonl"
+
+// linkRecord is one line of links.jsonl: the internal URLs a page links to
+type linkRecord struct {
+	URL   string   `json:"url"`
+	Links []string `json:"links"`
+}
+
+// writeLinkGraph links the streamed pages with link, writes their links to
+// links.jsonl and returns the link depths computed from it. Caller holds
+// c.mutex.
+func (c *Crawler) writeLinkGraph(link func(i int, anchors []Anchor) ([]string, []int), position, resolve func(string) (int, bool), seed int, seedCrawled bool) []int {
+	depths := make([]int, len(c.Results))
+	for i := range depths {
+		depths[i] = UnreachableLinkDepth
+	}
+
+	path := filepath.Join(c.outputDir, linksFileName)
+	if err := c.writeLinks(path, link, position); err != nil {
+		fmt.Printf("Warning: failed to write the link graph: %v\n", err)
+		_ = os.Remove(path)
+		return depths
+	}
+	if seedCrawled {
+		if err := streamedLinkDepths(path, depths, seed, position, resolve); err != nil {
+			fmt.Printf("Warning: failed to read the link graph: %v\n", err)
+		}
+	}
+	return depths
+}
+
+// writeLinks writes to path the links of the streamed pages. Every page is
+// linked, even once writing failed. Caller holds c.mutex.
+func (c *Crawler) writeLinks(path string, link func(i int, anchors []Anchor) ([]string, []int), position func(string) (int, bool)) error {
+	file, err := os.Create(path)
+	if err != nil {
+		c.linkStreamedPages(position, func(i int, anchors []Anchor) { link(i, anchors) })
+		return err
+	}
+	w := bufio.NewWriter(file)
+	encoder := json.NewEncoder(w)
+	c.linkStreamedPages(position, func(i int, anchors []Anchor) {
+		links, _ := link(i, anchors)
+		if err == nil {
+			err = encoder.Encode(linkRecord{URL: c.Results[i].URL, Links: links})
+		}
+	})
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// streamedLinkDepths computes the link depths of linkDepths level by level,
+// reading links.jsonl at path once per level instead of holding the graph:
+// memory stays at the depths, but a site N clicks deep reads the file N+1
+// times.
+func streamedLinkDepths(path string, depths []int, seed int, position, resolve func(string) (int, bool)) error {
+	depths[seed] = 0
+	for level := 0; ; level++ {
+		reached := false
+		err := readLinks(path, func(record linkRecord) {
+			source, ok := position(record.URL)
+			if !ok || depths[source] != level {
+				return
+			}
+			for _, u := range record.Links {
+				target, crawled := resolve(u)
+				if crawled && depths[target] == UnreachableLinkDepth {
+					depths[target] = level + 1
+					reached = true
+				}
+			}
+		})
+		if err != nil || !reached {
+			return err
+		}
+	}
+}
+
+// readLinks calls fn with each record of links.jsonl at path
+func readLinks(path string, fn func(linkRecord)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+
+	decoder := json.NewDecoder(bufio.NewReader(file))
+	for {
+		var record linkRecord
+		err := decoder.Decode(&record)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to parse the link graph: %w", err)
+		}
+		fn(record)
+	}
+}
+
+// linkStreamedPages calls link with the resolved anchors of each page
+// streamed to pages.jsonl, found among the crawled pages with position.
+// Pages missing from it are linked with the anchors they have in memory.
+// Caller holds c.mutex.
+func (c *Crawler) linkStreamedPages(position func(string) (int, bool), link func(i int, anchors []Anchor)) {
+	linked := make([]bool, len(c.Results))
+	err := c.pages.each(func(page PageData) {
+		i, ok := position(page.URL)
+		if !ok || linked[i] {
+			return
+		}
+		linked[i] = true
+		c.resolveAnchors(&page)
+		link(i, page.Anchors)
+	})
+	if err != nil {
+		fmt.Printf("Warning: failed to read the streamed pages for the link graph: %v\n", err)
+	}
+	for i := range c.Results {
+		if !linked[i] {
+			c.resolveAnchors(&c.Results[i])
+			link(i, c.Results[i].Anchors)
+		}
+	}
+}
+
+// resolveAnchors sets the URL of the anchors of page, against the URL the
+// page was redirected to
+func (c *Crawler) resolveAnchors(page *PageData) {
+	base := page.FinalURL
+	if base == "" {
+		base = page.URL
+	}
+	for j := range page.Anchors {
+		if target := c.resolveURL(base, page.Anchors[j].Href); target != "" {
+			page.Anchors[j].URL = c.normalizer.Normalize(target)
+		}
+	}
+}
+
+// linkDepths computes the number of clicks from the seed to every page,
+// breadth first over the link graph
+func linkDepths(seed int, seedCrawled bool, targets [][]int) []int {
+	depths := make([]int, len(targets))
+	for i := range depths {
+		depths[i] = UnreachableLinkDepth
+	}
+	if !seedCrawled {
+		return depths
+	}
+
+	depths[seed] = 0
+	queue := []int{seed}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, target := range targets[current] {
+			if depths[target] == UnreachableLinkDepth {
+				depths[target] = depths[current] + 1
+				queue = append(queue, target)
+			}
+		}
+	}
+	return depths
+}
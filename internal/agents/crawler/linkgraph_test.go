@@ -0,0 +1,124 @@
+package crawler
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	appconfig "firesalamander/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func pagesByURL(result *CrawlResult) map[string]PageData {
+	pages := make(map[string]PageData, len(result.Pages))
+	for _, page := range result.Pages {
+		pages[page.URL] = page
+	}
+	return pages
+}
+
+// linkGraphTestPages link to each other, to themselves, through a redirect
+// and off site
+var linkGraphTestPages = map[string]testPage{
+	"/":      {Body: `<html><body><a href="/a">A</a><a href="/a?utm_source=nav">A again</a><a href="b">B</a><a href="https://other.example/">Out</a></body></html>`},
+	"/a":     {Body: `<html><body><a href="/">Home</a><a href="/a">Self</a><a href="/c/">C</a></body></html>`},
+	"/b":     {Body: `<html><body><a href="/old-c">C</a></body></html>`},
+	"/old-c": {Location: "/c"},
+	"*":      {Body: `<html><body>leaf</body></html>`},
+}
+
+func TestCrawlBuildsLinkGraph(t *testing.T) {
+	server := newTestSite(linkGraphTestPages)
+	defer server.Close()
+
+	dir := t.TempDir()
+	result, err := newTestCrawler(func(cfg *appconfig.CrawlerConfig) {
+		cfg.Limits = appconfig.Limits{MaxURLs: 10, MaxDepth: 5}
+	}).Crawl(context.Background(), server.URL+"/", dir)
+	require.NoError(t, err)
+
+	pages := pagesByURL(result)
+	home, a, c := pages[server.URL+"/"], pages[server.URL+"/a"], pages[server.URL+"/c"]
+
+	// Anchors are resolved and normalized, tracking parameters and trailing
+	// slashes included
+	assert.Equal(t, []string{server.URL + "/a", server.URL + "/b"}, home.OutgoingLinks)
+	assert.Equal(t, 3, home.Outlinks)
+	assert.Equal(t, 2, home.UniqueOutlinks)
+	assert.Equal(t, server.URL+"/a", home.Anchors[1].URL)
+	assert.Empty(t, home.Anchors[3].URL)
+
+	assert.Equal(t, []string{server.URL + "/a"}, home.IncomingLinks)
+	assert.Equal(t, 0, home.LinkDepth)
+
+	// Self links are not inlinks
+	assert.Equal(t, []string{server.URL + "/"}, a.IncomingLinks)
+	assert.Equal(t, 2, a.Inlinks)
+	assert.Equal(t, 1, a.UniqueInlinks)
+	assert.Equal(t, 1, a.LinkDepth)
+
+	// /c is reached directly from /a and through the redirect from /b, the
+	// redirecting URL /old-c being fetched after /c
+	assert.Equal(t, []string{server.URL + "/a", server.URL + "/b"}, c.IncomingLinks)
+	assert.Equal(t, 2, c.LinkDepth)
+
+	// The streamed pages carry the graph too
+	streamed, err := ReadCrawlResult(dir)
+	require.NoError(t, err)
+	assert.Equal(t, c.IncomingLinks, pagesByURL(streamed)[server.URL+"/c"].IncomingLinks)
+	assert.Equal(t, result.Metadata.TotalPages, streamed.Metadata.TotalPages)
+	assert.NoFileExists(t, filepath.Join(dir, linksFileName))
+}
+
+func TestLeanCrawlWritesLinkGraph(t *testing.T) {
+	server := newTestSite(linkGraphTestPages)
+	defer server.Close()
+
+	reference, err := newTestCrawler(func(cfg *appconfig.CrawlerConfig) {
+		cfg.Limits = appconfig.Limits{MaxURLs: 10, MaxDepth: 5}
+	}).Crawl(context.Background(), server.URL+"/", t.TempDir())
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	crawler := newTestCrawler(func(cfg *appconfig.CrawlerConfig) {
+		cfg.Limits = appconfig.Limits{MaxURLs: 10, MaxDepth: 5}
+		cfg.Memory.LeanPages = true
+	})
+	result, err := crawler.Crawl(context.Background(), server.URL+"/", dir)
+	require.NoError(t, err)
+
+	// Lean pages get the same counts without holding the graph
+	references := pagesByURL(reference)
+	for _, page := range result.Pages {
+		expected := references[page.URL]
+		assert.Equal(t, expected.Inlinks, page.Inlinks, page.URL)
+		assert.Equal(t, expected.UniqueInlinks, page.UniqueInlinks, page.URL)
+		assert.Equal(t, expected.Outlinks, page.Outlinks, page.URL)
+		assert.Equal(t, expected.UniqueOutlinks, page.UniqueOutlinks, page.URL)
+		assert.Equal(t, expected.LinkDepth, page.LinkDepth, page.URL)
+		assert.Nil(t, page.OutgoingLinks, page.URL)
+		assert.Nil(t, page.IncomingLinks, page.URL)
+	}
+
+	// The graph is in links.jsonl, the outgoing links in pages.jsonl
+	links := make(map[string][]string)
+	require.NoError(t, readLinks(filepath.Join(dir, linksFileName), func(record linkRecord) {
+		links[record.URL] = record.Links
+	}))
+	assert.Len(t, links, len(result.Pages))
+	for u, expected := range references {
+		assert.Equal(t, expected.OutgoingLinks, links[u], u)
+	}
+	streamed, err := ReadCrawlResult(dir)
+	require.NoError(t, err)
+	for _, page := range streamed.Pages {
+		assert.Equal(t, references[page.URL].OutgoingLinks, page.OutgoingLinks, page.URL)
+	}
+}
+
+func TestLinkDepthOfUnlinkedPages(t *testing.T) {
+	depths := linkDepths(0, true, [][]int{{1}, {}, {1}})
+	assert.Equal(t, []int{0, 1, UnreachableLinkDepth}, depths)
+	assert.Equal(t, []int{UnreachableLinkDepth, UnreachableLinkDepth}, linkDepths(0, false, [][]int{{1}, {}}))
+}
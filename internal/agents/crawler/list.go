@@ -0,0 +1,137 @@
+package crawler
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Crawl modes reported in the metadata
+const (
+	ModeCrawl = "crawl"
+	ModeList  = "list"
+)
+
+// CrawlList fetches exactly the given URLs, in order, without following the
+// links they contain. The result has the same shape as a regular crawl. The
+// first URL stands for the seed: it scopes credentials and recorded links.
+func (c *Crawler) CrawlList(ctx context.Context, urls []string, outputDir string) (*CrawlResult, error) {
+	return c.crawlList(ctx, urls, nil, outputDir)
+}
+
+// crawlList runs a list mode crawl. Sitemap entries, when the list comes from
+// a sitemap, are applied to the matching pages.
+func (c *Crawler) crawlList(ctx context.Context, urls []string, entries []SitemapEntry, outputDir string) (*CrawlResult, error) {
+	startTime := time.Now()
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("URL list is empty")
+	}
+
+	c.mutex.Lock()
+	c.reset(c.normalizer.Clean(urls[0]), outputDir, true)
+	for _, entry := range entries {
+		c.sitemap[c.normalizer.Normalize(entry.URL)] = entry
+		c.sitemapEntries = append(c.sitemapEntries, entry)
+	}
+	// The sitemap is the list itself
+	c.sitemapQueued = len(c.sitemapEntries)
+	for _, u := range urls {
+		c.enqueue(CrawlTask{URL: c.normalizer.Clean(u), Depth: 0})
+	}
+	c.mutex.Unlock()
+
+	if err := c.openArchive(); err != nil {
+		return nil, err
+	}
+	if err := c.startSession(ctx); err != nil {
+		c.closeArchive()
+		c.releaseSpill()
+		return nil, err
+	}
+
+	return c.run(ctx, startTime)
+}
+
+// Execute runs the crawl described by a request: a list mode crawl
+// when it carries URLs, a URL file or a sitemap, a regular crawl otherwise.
+// List sources add up, duplicates are fetched once.
+func (c *Crawler) Execute(ctx context.Context, request CrawlRequest) (*CrawlResult, error) {
+	if !request.IsList() {
+		return c.Crawl(ctx, request.SeedURL, request.OutputDir)
+	}
+
+	urls := append([]string(nil), request.URLs...)
+	if request.URLFile != "" {
+		fromFile, err := LoadURLList(request.URLFile)
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, fromFile...)
+	}
+
+	var entries []SitemapEntry
+	if request.SitemapURL != "" {
+		found, err := c.ListFromSitemap(ctx, request.SitemapURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read sitemap list: %w", err)
+		}
+		for _, entry := range found {
+			urls = append(urls, entry.URL)
+		}
+		entries = found
+	}
+
+	return c.crawlList(ctx, urls, entries, request.OutputDir)
+}
+
+// IsList reports whether the request asks for a list mode crawl
+func (r CrawlRequest) IsList() bool {
+	return len(r.URLs) > 0 || r.URLFile != "" || r.SitemapURL != ""
+}
+
+// LoadURLList reads one URL per line. Blank lines and lines starting with
+// "#" are skipped.
+func LoadURLList(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open URL list: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	urls := make([]string, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		urls = append(urls, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read URL list: %w", err)
+	}
+	return urls, nil
+}
+
+// newFrontier returns the frontier for the current mode. A list is fetched
+// in its own order, so sampling strategies do not apply.
+func (c *Crawler) newFrontier() Frontier {
+	var frontier Frontier = &bfsFrontier{}
+	if !c.listMode {
+		frontier = NewFrontier(c.Config)
+	}
+	if limit := c.Config.Memory.FrontierURLs; limit > 0 {
+		frontier = newSpillFrontier(frontier, limit, c.spillPath)
+	}
+	return frontier
+}
+
+func (c *Crawler) mode() string {
+	if c.listMode {
+		return ModeList
+	}
+	return ModeCrawl
+}
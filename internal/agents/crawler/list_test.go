@@ -0,0 +1,141 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	appconfig "firesalamander/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// listLimits would cut a link-following crawl short: a list crawl must
+// ignore them
+func listLimits(cfg *appconfig.CrawlerConfig) {
+	cfg.Limits = appconfig.Limits{MaxURLs: 2, MaxDepth: 3}
+	cfg.Performance.ConcurrentRequests = 2
+	cfg.Sampling = appconfig.Sampling{Strategy: "aggressive"}
+}
+
+func pageURLs(result *CrawlResult) []string {
+	urls := make([]string, 0, len(result.Pages))
+	for _, page := range result.Pages {
+		urls = append(urls, page.URL)
+	}
+	return urls
+}
+
+// newSitemapServer serves a sitemap listing locs, where paths are on the
+// sitemap server itself, and a small page everywhere else
+func newSitemapServer(t *testing.T, locs ...string) *httptest.Server {
+	t.Helper()
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/sitemap.xml" {
+			fmt.Fprintf(w, `<html><head><title>%s</title></head><body><a href="/other">Other</a></body></html>`, r.URL.Path)
+			return
+		}
+		var urls strings.Builder
+		for _, loc := range locs {
+			if strings.HasPrefix(loc, "/") {
+				loc = server.URL + loc
+			}
+			fmt.Fprintf(&urls, "<url><loc>%s</loc></url>", loc)
+		}
+		fmt.Fprintf(w, `<?xml version="1.0"?><urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">%s</urlset>`, urls.String())
+	}))
+	return server
+}
+
+func TestCrawlListFetchesExactlyTheList(t *testing.T) {
+	server := newSyntheticSite(3, 2, 0, nil)
+	defer server.Close()
+
+	// The list ignores MaxURLs and sampling, and follows no link
+	list := []string{server.URL + "/page/4", server.URL + "/page/1", server.URL + "/page/7", server.URL + "/page/1#dup"}
+	result, err := newTestCrawler(listLimits).CrawlList(context.Background(), list, "")
+	require.NoError(t, err)
+
+	assert.ElementsMatch(t, []string{server.URL + "/page/4", server.URL + "/page/1", server.URL + "/page/7"}, pageURLs(result))
+	assert.Equal(t, ModeList, result.Metadata.Mode)
+	assert.Equal(t, 0, result.Metadata.MaxDepthReached)
+	assert.Empty(t, result.Discovered)
+}
+
+func TestCrawlListRecordsDiscoveredLinks(t *testing.T) {
+	server := newSyntheticSite(2, 2, 0, nil)
+	defer server.Close()
+
+	crawler := newTestCrawler(func(cfg *appconfig.CrawlerConfig) {
+		listLimits(cfg)
+		cfg.List.RecordLinks = true
+	})
+	result, err := crawler.CrawlList(context.Background(), []string{server.URL + "/page/1", server.URL + "/page/3"}, "")
+	require.NoError(t, err)
+
+	// page 1 links to 3 and 4: 3 is in the list, 4 is only recorded
+	assert.Len(t, result.Pages, 2)
+	assert.Equal(t, []string{server.URL + "/page/4"}, result.Discovered)
+}
+
+func TestExecuteListFromFileAndSitemap(t *testing.T) {
+	server := newSyntheticSite(2, 2, 0, nil)
+	defer server.Close()
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "urls.txt")
+	content := fmt.Sprintf("# top landing pages\n%s/page/2\n\n  %s/page/5  \n", server.URL, server.URL)
+	require.NoError(t, os.WriteFile(file, []byte(content), 0644))
+
+	sitemap := newSitemapServer(t, server.URL+"/page/6")
+	defer sitemap.Close()
+
+	crawler := newTestCrawler(listLimits)
+	result, err := crawler.Execute(context.Background(), CrawlRequest{
+		URLs:       []string{server.URL + "/"},
+		URLFile:    file,
+		OutputDir:  dir,
+		SitemapURL: sitemap.URL + "/sitemap.xml",
+	})
+	require.NoError(t, err)
+
+	// Sitemap URLs on another host than the sitemap are out of scope
+	assert.ElementsMatch(t, []string{server.URL + "/", server.URL + "/page/2", server.URL + "/page/5"}, pageURLs(result))
+	assert.FileExists(t, filepath.Join(dir, pagesFileName))
+}
+
+func TestCrawlListFromSitemap(t *testing.T) {
+	sitemap := newSitemapServer(t, "/page/3", "/page/6")
+	defer sitemap.Close()
+
+	result, err := newTestCrawler(listLimits).Execute(context.Background(), CrawlRequest{SitemapURL: sitemap.URL + "/sitemap.xml"})
+	require.NoError(t, err)
+	require.Len(t, result.Pages, 2)
+	for _, page := range result.Pages {
+		assert.True(t, page.InSitemap, page.URL)
+	}
+}
+
+func TestExecuteWithoutListCrawls(t *testing.T) {
+	server := newSyntheticSite(2, 1, 0, nil)
+	defer server.Close()
+
+	result, err := newTestCrawler(func(cfg *appconfig.CrawlerConfig) {
+		cfg.Limits = appconfig.Limits{MaxURLs: 10, MaxDepth: 5}
+		cfg.Performance.ConcurrentRequests = 2
+	}).Execute(context.Background(), CrawlRequest{SeedURL: server.URL + "/"})
+	require.NoError(t, err)
+	assert.Equal(t, ModeCrawl, result.Metadata.Mode)
+	assert.Len(t, result.Pages, 3)
+}
+
+func TestLoadURLListMissingFile(t *testing.T) {
+	_, err := LoadURLList(filepath.Join(t.TempDir(), "missing.txt"))
+	assert.Error(t, err)
+}
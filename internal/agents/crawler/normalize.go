@@ -0,0 +1,235 @@
+package crawler
+
+import (
+	"net"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"firesalamander/internal/config"
+)
+
+// defaultDenyParams are tracking parameters that never change the content of
+// a page. A trailing "*" matches any parameter with that prefix.
+var defaultDenyParams = []string{"utm_*", "gclid", "fbclid", "msclkid"}
+
+// sessionParams are the session IDs stripped when the policy asks for it.
+// Short names like sid are only dropped then, as some sites use them for
+// content.
+var sessionParams = []string{"phpsessid", "jsessionid", "aspsessionid*", "sid", "sessionid"}
+
+// pathSessionID matches session IDs carried in the path, as in /cart;jsessionid=ABC
+var pathSessionID = regexp.MustCompile(`(?i);jsessionid=[^/?#]*`)
+
+// defaultNormalizer applies the default policy for NormalizeURL
+var defaultNormalizer = NewURLNormalizer(config.Normalization{})
+
+// URLNormalizer rewrites URLs to a canonical form so that equivalent URLs
+// are crawled once
+type URLNormalizer struct {
+	cfg   config.Normalization
+	allow map[string]bool
+	deny  []string
+}
+
+// NewURLNormalizer builds a normalizer for the given policy. Parameter names
+// are matched case-insensitively.
+func NewURLNormalizer(cfg config.Normalization) *URLNormalizer {
+	n := &URLNormalizer{cfg: cfg, allow: make(map[string]bool, len(cfg.AllowParams))}
+	for _, param := range cfg.AllowParams {
+		n.allow[strings.ToLower(param)] = true
+	}
+	deny := append([]string(nil), defaultDenyParams...)
+	if cfg.StripSessionParams {
+		deny = append(deny, sessionParams...)
+	}
+	for _, param := range append(deny, cfg.DenyParams...) {
+		n.deny = append(n.deny, strings.ToLower(param))
+	}
+	return n
+}
+
+// NormalizeURL canonicalizes urlStr with the default policy. Besides the
+// fragment, tracking parameters and trailing slash it always dropped, it
+// lowercases the host, drops the default port and gives an empty path the
+// root "/", so that https://example.com and https://example.com/ share one
+// key. Session IDs are kept unless the policy strips them.
+func NormalizeURL(urlStr string) string {
+	return defaultNormalizer.Normalize(urlStr)
+}
+
+// ServedURL returns the URL the page was served from, after redirects
+func (p *PageData) ServedURL() string {
+	if p.FinalURL != "" {
+		return p.FinalURL
+	}
+	return p.URL
+}
+
+// CanonicalURL returns the canonical URL the page declares, resolved against
+// ServedURL and normalized with NormalizeURL, or "" when it has none
+func (p *PageData) CanonicalURL() string {
+	if p.Canonical == "" {
+		return ""
+	}
+	base, err := url.Parse(p.ServedURL())
+	if err != nil {
+		return ""
+	}
+	canonical, err := base.Parse(strings.TrimSpace(p.Canonical))
+	if err != nil {
+		return ""
+	}
+	return NormalizeURL(canonical.String())
+}
+
+// Normalize returns the canonical form of urlStr, or urlStr itself when it
+// cannot be parsed
+func (n *URLNormalizer) Normalize(urlStr string) string {
+	return n.normalize(urlStr, true)
+}
+
+// Clean applies the policy but for the scheme and www rewrites. These only
+// tell which URLs are the same page: the crawler fetches the host and scheme
+// the site links to, so it follows no redirect the site does not have.
+func (n *URLNormalizer) Clean(urlStr string) string {
+	return n.normalize(urlStr, false)
+}
+
+func (n *URLNormalizer) normalize(urlStr string, rewriteSite bool) string {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return urlStr
+	}
+
+	u.Fragment = ""
+	u.RawFragment = ""
+
+	if u.Host != "" {
+		n.normalizeHost(u, rewriteSite)
+		if u.Path == "" {
+			u.Path = "/"
+		}
+	}
+	if rewriteSite && n.cfg.Scheme != "" && (u.Scheme == "http" || u.Scheme == "https") {
+		u.Scheme = n.cfg.Scheme
+	}
+
+	if n.cfg.StripSessionParams && strings.Contains(strings.ToLower(u.Path), ";jsessionid=") {
+		u.Path = pathSessionID.ReplaceAllString(u.Path, "")
+		u.RawPath = ""
+	}
+	if !n.cfg.KeepTrailingSlash && u.Path != "/" && strings.HasSuffix(u.Path, "/") {
+		u.Path = strings.TrimSuffix(u.Path, "/")
+		u.RawPath = ""
+	}
+
+	u.RawQuery = n.normalizeQuery(u.RawQuery)
+	u.ForceQuery = false
+
+	return u.String()
+}
+
+// normalizeHost lowercases the host, drops the scheme's default port and,
+// with rewriteSite, applies the www policy
+func (n *URLNormalizer) normalizeHost(u *url.URL, rewriteSite bool) {
+	host, port := u.Hostname(), u.Port()
+	if !n.cfg.KeepHostCase {
+		host = strings.ToLower(host)
+	}
+	if !n.cfg.KeepDefaultPort && ((u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443")) {
+		port = ""
+	}
+
+	switch www := n.cfg.WWW; {
+	case !rewriteSite:
+	case www == "add":
+		if !strings.HasPrefix(strings.ToLower(host), "www.") && strings.Contains(host, ".") && net.ParseIP(host) == nil {
+			host = "www." + host
+		}
+	case www == "strip":
+		if len(host) > 4 && strings.EqualFold(host[:4], "www.") {
+			host = host[4:]
+		}
+	}
+
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port != "" {
+		host += ":" + port
+	}
+	u.Host = host
+}
+
+// normalizedHost returns the host of u as Normalize writes it
+func (n *URLNormalizer) normalizedHost(u *url.URL) string {
+	normalized := *u
+	n.normalizeHost(&normalized, true)
+	return normalized.Host
+}
+
+// normalizeQuery drops unwanted parameters and sorts the rest by name, unless
+// the policy keeps the original order. Pairs that cannot be decoded, such as
+// those holding a ";", are kept as they are rather than lost.
+func (n *URLNormalizer) normalizeQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+
+	type param struct{ key, value, raw string }
+	params := make([]param, 0)
+	for _, pair := range strings.Split(rawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		rawKey, rawValue, _ := strings.Cut(pair, "=")
+		key, keyErr := url.QueryUnescape(rawKey)
+		value, valueErr := url.QueryUnescape(rawValue)
+		if keyErr != nil || valueErr != nil || strings.Contains(pair, ";") {
+			params = append(params, param{key: rawKey, raw: pair})
+			continue
+		}
+		if n.keepParam(key) {
+			params = append(params, param{key: key, value: value})
+		}
+	}
+
+	if !n.cfg.KeepQueryOrder {
+		sort.SliceStable(params, func(i, j int) bool { return params[i].key < params[j].key })
+	}
+
+	var b strings.Builder
+	for i, p := range params {
+		if i > 0 {
+			b.WriteByte('&')
+		}
+		if p.raw != "" {
+			b.WriteString(p.raw)
+			continue
+		}
+		b.WriteString(url.QueryEscape(p.key))
+		b.WriteByte('=')
+		b.WriteString(url.QueryEscape(p.value))
+	}
+	return b.String()
+}
+
+// keepParam applies the allow list first, then the deny list
+func (n *URLNormalizer) keepParam(key string) bool {
+	key = strings.ToLower(key)
+	if len(n.allow) > 0 {
+		return n.allow[key]
+	}
+	for _, deny := range n.deny {
+		if prefix, ok := strings.CutSuffix(deny, "*"); ok {
+			if strings.HasPrefix(key, prefix) {
+				return false
+			}
+		} else if key == deny {
+			return false
+		}
+	}
+	return true
+}
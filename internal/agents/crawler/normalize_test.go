@@ -0,0 +1,130 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	appconfig "firesalamander/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestURLNormalizerDefaults(t *testing.T) {
+	n := NewURLNormalizer(appconfig.Normalization{})
+
+	tests := []struct {
+		input    string
+		expected string
+		name     string
+	}{
+		{"https://Example.COM/Page", "https://example.com/Page", "lowercase host only"},
+		{"https://example.com:443/page", "https://example.com/page", "drop https default port"},
+		{"http://example.com:80/page", "http://example.com/page", "drop http default port"},
+		{"http://example.com:8080/page", "http://example.com:8080/page", "keep other ports"},
+		{"https://example.com", "https://example.com/", "empty path is root"},
+		{"https://example.com/p?b=2&a=1&b=1", "https://example.com/p?a=1&b=2&b=1", "sort query by name"},
+		{"https://example.com/p?utm_id=1&gclid=2&fbclid=3", "https://example.com/p", "strip tracking params"},
+		{"https://example.com/p?sid=1&PHPSESSID=abc", "https://example.com/p?PHPSESSID=abc&sid=1", "keep session IDs"},
+		{"https://example.com/cart;jsessionid=ABC123?x=1", "https://example.com/cart;jsessionid=ABC123?x=1", "keep path session ID"},
+		{"https://example.com/p?b=1&a=x;y", "https://example.com/p?a=x;y&b=1", "keep pairs with a semicolon"},
+		{"https://example.com/p?", "https://example.com/p", "drop empty query"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, n.Normalize(tt.input))
+		})
+	}
+}
+
+// NormalizeURL keeps what it returned before the policy became configurable,
+// apart from the canonicalizations it gained: host case, default port, root
+// path and the wider tracking list
+func TestNormalizeURLKeepsItsKeys(t *testing.T) {
+	assert.Equal(t, "https://example.com/list?sessionid=42&sid=7", NormalizeURL("https://example.com/list?sid=7&sessionid=42#top"))
+	assert.Equal(t, "https://example.com/p?a=1&b=x;y", NormalizeURL("https://example.com/p/?b=x;y&a=1&utm_source=news"))
+	assert.Equal(t, "https://example.com/", NormalizeURL("https://example.com"))
+	assert.Equal(t, NormalizeURL("https://example.com"), NormalizeURL("https://example.com/"))
+}
+
+func TestPageDataCanonicalURL(t *testing.T) {
+	page := PageData{URL: "https://example.com/old", FinalURL: "https://example.com/shop/", Canonical: " ../list?utm_source=feed "}
+	assert.Equal(t, "https://example.com/shop/", page.ServedURL())
+	assert.Equal(t, "https://example.com/list", page.CanonicalURL())
+
+	page = PageData{URL: "https://example.com/shop"}
+	assert.Equal(t, "https://example.com/shop", page.ServedURL())
+	assert.Empty(t, page.CanonicalURL())
+}
+
+func TestURLNormalizerPolicy(t *testing.T) {
+	tests := []struct {
+		cfg      appconfig.Normalization
+		input    string
+		expected string
+		name     string
+	}{
+		{appconfig.Normalization{WWW: "strip"}, "https://www.example.com/a", "https://example.com/a", "strip www"},
+		{appconfig.Normalization{WWW: "add"}, "https://example.com/a", "https://www.example.com/a", "add www"},
+		{appconfig.Normalization{WWW: "add"}, "http://127.0.0.1/a", "http://127.0.0.1/a", "never add www to IPs"},
+		{appconfig.Normalization{Scheme: "https"}, "http://example.com/a", "https://example.com/a", "force https"},
+		{appconfig.Normalization{Scheme: "https"}, "http://example.com:80/a", "https://example.com/a", "default port of original scheme"},
+		{appconfig.Normalization{KeepQueryOrder: true}, "https://example.com/p?b=1&a=2", "https://example.com/p?b=1&a=2", "keep query order"},
+		{appconfig.Normalization{KeepTrailingSlash: true}, "https://example.com/dir/", "https://example.com/dir/", "keep trailing slash"},
+		{appconfig.Normalization{KeepHostCase: true}, "https://Example.com/a", "https://Example.com/a", "keep host case"},
+		{appconfig.Normalization{StripSessionParams: true}, "https://example.com/p?PHPSESSID=abc&id=1", "https://example.com/p?id=1", "strip PHP session"},
+		{appconfig.Normalization{StripSessionParams: true}, "https://example.com/p?sid=1&jsessionid=2&ASPSESSIONIDQA=3", "https://example.com/p", "strip session IDs"},
+		{appconfig.Normalization{StripSessionParams: true}, "https://example.com/cart;jsessionid=ABC123?x=1", "https://example.com/cart?x=1", "strip path session ID"},
+		{appconfig.Normalization{DenyParams: []string{"sort", "ref_*"}}, "https://example.com/p?sort=asc&ref_src=x&id=1", "https://example.com/p?id=1", "deny list"},
+		{appconfig.Normalization{AllowParams: []string{"page"}}, "https://example.com/p?page=2&color=red", "https://example.com/p?page=2", "allow list"},
+		{appconfig.Normalization{AllowParams: []string{"sid"}, StripSessionParams: true}, "https://example.com/p?sid=7", "https://example.com/p?sid=7", "allow list wins over deny list"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, NewURLNormalizer(tt.cfg).Normalize(tt.input))
+		})
+	}
+}
+
+func TestResolveURLUsesNormalizationPolicy(t *testing.T) {
+	crawler := NewCrawler(appconfig.CrawlerConfig{
+		Normalization: appconfig.Normalization{WWW: "strip", Scheme: "https", StripSessionParams: true},
+	})
+
+	// Links to the www host or over http are fetched as linked, and only
+	// their key collapses onto the canonical site
+	linked := crawler.resolveURL("https://example.com/", "http://www.example.com/a")
+	assert.Equal(t, "http://www.example.com/a", linked)
+	assert.Equal(t, "https://example.com/a", crawler.normalizer.Normalize(linked))
+	assert.Equal(t, "https://example.com/b", crawler.resolveURL("https://example.com/", "/b?PHPSESSID=1"))
+}
+
+func TestCrawlFetchesLinkedScheme(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `<html><body><a href="%s/a">A</a><a href="/a#top">A again</a></body></html>`, server.URL)
+		default:
+			w.Write([]byte("<html><head><title>A</title></head><body></body></html>"))
+		}
+	}))
+	defer server.Close()
+
+	// The test server only speaks HTTP, so fetching the rewritten URLs
+	// would fail
+	crawler := newTestCrawler(func(cfg *appconfig.CrawlerConfig) {
+		cfg.Limits = appconfig.Limits{MaxURLs: 10, MaxDepth: 2}
+		cfg.Normalization = appconfig.Normalization{Scheme: "https"}
+	})
+
+	result, err := crawler.Crawl(context.Background(), server.URL, "")
+	require.NoError(t, err)
+	require.Len(t, result.Pages, 2)
+	assert.Equal(t, server.URL+"/a", result.Pages[1].URL)
+	assert.Empty(t, result.Redirects)
+}
@@ -0,0 +1,292 @@
+package crawler
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// maxCrawlDelay caps absurd Crawl-delay values so an audit can still finish
+	maxCrawlDelay = 60 * time.Second
+	// minBackoff and maxBackoff bound the pause after a 429/503 without Retry-After
+	minBackoff = 1 * time.Second
+	maxBackoff = 60 * time.Second
+	// minThrottledRate is the slowest rate adaptive back-off can reduce a host to
+	minThrottledRate = 0.1
+)
+
+// hostLimiter is a token bucket for a single host
+type hostLimiter struct {
+	rate         float64 // tokens per second, 0 means unlimited
+	configured   float64 // rate before any adaptive back-off
+	burst        float64
+	tokens       float64
+	last         time.Time
+	blockedUntil time.Time
+	backoff      time.Duration
+}
+
+// refill adds the tokens earned since the last reservation
+func (l *hostLimiter) refill(now time.Time) {
+	if !l.last.IsZero() && l.rate > 0 {
+		l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	}
+	l.last = now
+}
+
+// reserve takes a token and returns how long the caller must wait before using it
+func (l *hostLimiter) reserve(now time.Time) time.Duration {
+	var wait time.Duration
+
+	if l.rate > 0 {
+		l.refill(now)
+		l.tokens--
+		if l.tokens < 0 {
+			wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+		}
+	}
+
+	if until := l.blockedUntil.Sub(now); until > wait {
+		wait = until
+	}
+	return wait
+}
+
+// due returns how long a reservation made now would wait, without taking it
+func (l *hostLimiter) due(now time.Time) time.Duration {
+	var wait time.Duration
+
+	if l.rate > 0 {
+		l.refill(now)
+		if l.tokens < 1 {
+			wait = time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+		}
+	}
+
+	if until := l.blockedUntil.Sub(now); until > wait {
+		wait = until
+	}
+	return wait
+}
+
+// politeness schedules requests per host according to the configured rate,
+// robots.txt Crawl-delay and server back-off signals
+type politeness struct {
+	mu    sync.Mutex
+	rate  float64
+	burst float64
+	hosts map[string]*hostLimiter
+}
+
+func newPoliteness(rate float64, burst int) *politeness {
+	if burst < 1 {
+		burst = 1
+	}
+	return &politeness{
+		rate:  rate,
+		burst: float64(burst),
+		hosts: make(map[string]*hostLimiter),
+	}
+}
+
+// limiter returns the bucket for host, creating it full. Caller holds p.mu.
+func (p *politeness) limiter(host string) *hostLimiter {
+	l, ok := p.hosts[host]
+	if !ok {
+		l = &hostLimiter{
+			rate:       p.rate,
+			configured: p.rate,
+			burst:      p.burst,
+			tokens:     p.burst,
+		}
+		p.hosts[host] = l
+	}
+	return l
+}
+
+// Wait blocks until a request to host is allowed or ctx is done
+func (p *politeness) Wait(ctx context.Context, host string) error {
+	p.mu.Lock()
+	wait := p.limiter(host).reserve(time.Now())
+	p.mu.Unlock()
+
+	return sleep(ctx, wait)
+}
+
+// sleep waits for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Grant reserves a request to host on behalf of another process, such as a
+// distributed crawl worker, when the host's turn comes within horizon. It
+// returns how long the request must wait from now, or false when the turn is
+// further away and nothing was reserved.
+func (p *politeness) Grant(host string, horizon time.Duration, now time.Time) (time.Duration, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	l := p.limiter(host)
+	if l.due(now) > horizon {
+		return 0, false
+	}
+	return l.reserve(now), true
+}
+
+// SetCrawlDelay slows host down to one request per delay, if that is
+// stricter than the configured rate
+func (p *politeness) SetCrawlDelay(host string, delay time.Duration) {
+	if delay <= 0 {
+		return
+	}
+	if delay > maxCrawlDelay {
+		delay = maxCrawlDelay
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	l := p.limiter(host)
+	rate := 1 / delay.Seconds()
+	if l.configured == 0 || rate < l.configured {
+		l.configured = rate
+		l.rate = rate
+		l.burst = 1
+		l.tokens = math.Min(l.tokens, 1)
+	}
+}
+
+// Backoff pauses host after a 429/503 response and halves its rate. A
+// positive retryAfter from the server is used as is; otherwise the pause
+// doubles on each consecutive signal.
+func (p *politeness) Backoff(host string, retryAfter time.Duration) time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	l := p.limiter(host)
+
+	if l.backoff == 0 {
+		l.backoff = minBackoff
+	} else {
+		l.backoff *= 2
+	}
+	if l.backoff > maxBackoff {
+		l.backoff = maxBackoff
+	}
+
+	delay := l.backoff
+	if retryAfter > 0 {
+		delay = retryAfter
+	}
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+	l.blockedUntil = time.Now().Add(delay)
+
+	if l.rate > 0 {
+		l.rate = math.Max(l.rate/2, math.Min(minThrottledRate, l.configured))
+	}
+
+	return delay
+}
+
+// Paused returns how long host stays paused by a back-off after now
+func (p *politeness) Paused(host string, now time.Time) time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if until := p.limiter(host).blockedUntil.Sub(now); until > 0 {
+		return until
+	}
+	return 0
+}
+
+// Throttle applies to host a back-off seen by another process, such as a
+// distributed crawl worker. A pause already in force is only extended, so
+// that several tasks reporting the same back-off slow the host down once.
+func (p *politeness) Throttle(host string, pause time.Duration, now time.Time) {
+	if pause <= 0 {
+		return
+	}
+	if pause > maxBackoff {
+		pause = maxBackoff
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	l := p.limiter(host)
+	until := now.Add(pause)
+	if now.Before(l.blockedUntil) {
+		if until.After(l.blockedUntil) {
+			l.blockedUntil = until
+		}
+		return
+	}
+	l.blockedUntil = until
+	if l.rate > 0 {
+		l.rate = math.Max(l.rate/2, math.Min(minThrottledRate, l.configured))
+	}
+}
+
+// Success records a normal response and lets the host recover its rate
+func (p *politeness) Success(host string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	l := p.limiter(host)
+	l.backoff = 0
+	if l.rate > 0 && l.rate < l.configured {
+		l.rate = math.Min(l.configured, l.rate*1.25)
+	}
+}
+
+// isThrottled reports whether a status code asks the client to slow down
+func isThrottled(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode == http.StatusServiceUnavailable
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if when, err := http.ParseTime(value); err == nil {
+		if d := time.Until(when); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// hostOf returns the host part of a URL, or the URL itself if it cannot be parsed
+func hostOf(urlStr string) string {
+	u, err := url.Parse(urlStr)
+	if err != nil || u.Host == "" {
+		return urlStr
+	}
+	return u.Host
+}
@@ -0,0 +1,101 @@
+package crawler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	appconfig "firesalamander/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolitenessTokenBucket(t *testing.T) {
+	p := newPoliteness(20, 1)
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		require.NoError(t, p.Wait(ctx, "example.com"))
+	}
+
+	// First token is free, the next four are spaced by 50ms
+	assert.GreaterOrEqual(t, time.Since(start), 190*time.Millisecond)
+
+	// Other hosts have their own bucket
+	start = time.Now()
+	require.NoError(t, p.Wait(ctx, "other.com"))
+	assert.Less(t, time.Since(start), 20*time.Millisecond)
+}
+
+func TestPolitenessCrawlDelay(t *testing.T) {
+	p := newPoliteness(0, 5)
+	p.SetCrawlDelay("example.com", 100*time.Millisecond)
+
+	ctx := context.Background()
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		require.NoError(t, p.Wait(ctx, "example.com"))
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 190*time.Millisecond)
+}
+
+func TestPolitenessBackoff(t *testing.T) {
+	p := newPoliteness(10, 1)
+
+	assert.Equal(t, 2*time.Second, p.Backoff("example.com", 2*time.Second))
+	assert.Equal(t, 5.0, p.hosts["example.com"].rate)
+
+	// Without Retry-After the pause doubles
+	assert.Equal(t, 2*time.Second, p.Backoff("example.com", 0))
+	assert.Equal(t, 4*time.Second, p.Backoff("example.com", 0))
+
+	p.Success("example.com")
+	assert.Equal(t, time.Duration(0), p.hosts["example.com"].backoff)
+	assert.Greater(t, p.hosts["example.com"].rate, 1.25)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.Error(t, p.Wait(ctx, "example.com"))
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	assert.Equal(t, 3*time.Second, parseRetryAfter("3"))
+	assert.Equal(t, time.Duration(0), parseRetryAfter(""))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon"))
+
+	date := time.Now().Add(10 * time.Second).UTC().Format(http.TimeFormat)
+	d := parseRetryAfter(date)
+	assert.Greater(t, d, 8*time.Second)
+	assert.LessOrEqual(t, d, 10*time.Second)
+}
+
+func TestCrawlHonoursRetryAfter(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte("<html><head><title>OK</title></head><body></body></html>"))
+	}))
+	defer server.Close()
+
+	crawler := NewCrawler(appconfig.CrawlerConfig{
+		UserAgent:   "Test-Bot/1.0",
+		Limits:      appconfig.Limits{MaxURLs: 1, MaxDepth: 0},
+		Performance: appconfig.Performance{ConcurrentRequests: 1, RetryAttempts: 1, RateLimit: "10/s"},
+	})
+
+	start := time.Now()
+	result, err := crawler.Crawl(context.Background(), server.URL, "")
+	require.NoError(t, err)
+
+	assert.Len(t, result.Pages, 1)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&attempts))
+	assert.GreaterOrEqual(t, time.Since(start), 900*time.Millisecond)
+}
@@ -0,0 +1,219 @@
+package crawler
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// recordsFileName holds the blocked, redirected and excluded URLs of a lean
+// crawl next to pages.jsonl, one JSON record per line, in place of the
+// crawler's slices. Those URLs can outnumber the pages many times over.
+const recordsFileName = "records.jsonl"
+
+// crawlRecord is one line of records.jsonl
+type crawlRecord struct {
+	Blocked  *BlockedURL     `json:"blocked,omitempty"`
+	Redirect *RedirectRecord `json:"redirect,omitempty"`
+	Excluded *ExcludedURL    `json:"excluded,omitempty"`
+}
+
+// recordWriter appends records to records.jsonl. Its size is read and
+// written under c.mutex, so that a checkpoint knows how much of the file it
+// is consistent with.
+type recordWriter struct {
+	file *os.File
+	size int64
+}
+
+// openRecordWriter opens records.jsonl in outputDir, keeping its first size
+// bytes: those of the checkpoint a crawl resumes, none for a new crawl
+func openRecordWriter(outputDir string, size int64) (*recordWriter, error) {
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(filepath.Join(outputDir, recordsFileName), os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Truncate(size); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	if _, err := file.Seek(size, io.SeekStart); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return &recordWriter{file: file, size: size}, nil
+}
+
+func (w *recordWriter) write(record crawlRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode crawl record: %w", err)
+	}
+	n, err := w.file.Write(append(data, '\n'))
+	w.size += int64(n)
+	return err
+}
+
+func (w *recordWriter) close() error {
+	return w.file.Close()
+}
+
+// readRecords calls fn with the records of the first size bytes of
+// records.jsonl in auditDir, or of the whole file when size is negative. A
+// missing file holds no records.
+func readRecords(auditDir string, size int64, fn func(crawlRecord)) error {
+	file, err := os.Open(filepath.Join(auditDir, recordsFileName))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read crawl records: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	var r io.Reader = file
+	if size >= 0 {
+		r = io.LimitReader(file, size)
+	}
+	decoder := json.NewDecoder(bufio.NewReader(r))
+	for {
+		var record crawlRecord
+		err := decoder.Decode(&record)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to parse crawl records: %w", err)
+		}
+		fn(record)
+	}
+}
+
+// addBlocked records a URL robots.txt blocks. Caller holds c.mutex.
+func (c *Crawler) addBlocked(blocked BlockedURL) {
+	if !c.writeRecord(crawlRecord{Blocked: &blocked}) {
+		c.Blocked = append(c.Blocked, blocked)
+	}
+}
+
+// addRedirect records a redirect chain. Caller holds c.mutex.
+func (c *Crawler) addRedirect(redirect RedirectRecord) {
+	if !c.writeRecord(crawlRecord{Redirect: &redirect}) {
+		c.Redirects = append(c.Redirects, redirect)
+	}
+}
+
+// addExcluded records a URL a scope rule or a budget excluded. Caller holds
+// c.mutex.
+func (c *Crawler) addExcluded(excluded ExcludedURL) {
+	if !c.writeRecord(crawlRecord{Excluded: &excluded}) {
+		c.Excluded = append(c.Excluded, excluded)
+	}
+}
+
+// writeRecord appends record to records.jsonl and reports whether it did.
+// Without a record file, or once writing to it failed, records stay in
+// memory. Caller holds c.mutex.
+func (c *Crawler) writeRecord(record crawlRecord) bool {
+	if c.records == nil {
+		return false
+	}
+	if err := c.records.write(record); err != nil {
+		fmt.Printf("Warning: failed to write crawl records, keeping them in memory: %v\n", err)
+		_ = c.records.file.Truncate(c.recordsSize)
+		c.closeRecords()
+		return false
+	}
+	c.recordsSize = c.records.size
+	return true
+}
+
+// openRecords starts writing the records of a lean crawl to records.jsonl,
+// after the part a resumed checkpoint counts on. Other crawls keep their
+// records in memory, and remove the file of an earlier crawl unless they
+// resume its checkpoint. Caller holds c.mutex.
+func (c *Crawler) openRecords() {
+	c.records = nil
+	if c.outputDir == "" {
+		return
+	}
+	if !c.leanPages() {
+		if !c.resumed {
+			c.removeRecords()
+		}
+		return
+	}
+
+	records, err := openRecordWriter(c.outputDir, c.recordsSize)
+	if err != nil {
+		fmt.Printf("Warning: failed to open crawl records, keeping them in memory: %v\n", err)
+		return
+	}
+	c.records = records
+}
+
+// closeRecords closes records.jsonl. Caller holds c.mutex.
+func (c *Crawler) closeRecords() {
+	if c.records == nil {
+		return
+	}
+	if err := c.records.close(); err != nil {
+		fmt.Printf("Warning: failed to close crawl records: %v\n", err)
+	}
+	c.records = nil
+}
+
+// removeRecords deletes records.jsonl once nothing counts on it
+func (c *Crawler) removeRecords() {
+	_ = os.Remove(filepath.Join(c.outputDir, recordsFileName))
+}
+
+// readCrawlRecords puts the records of records.jsonl in auditDir ahead of
+// those result kept in memory
+func readCrawlRecords(auditDir string, result *CrawlResult) error {
+	var blocked []BlockedURL
+	var redirects []RedirectRecord
+	var excluded []ExcludedURL
+	err := readRecords(auditDir, -1, func(record crawlRecord) {
+		switch {
+		case record.Blocked != nil:
+			blocked = append(blocked, *record.Blocked)
+		case record.Redirect != nil:
+			redirects = append(redirects, *record.Redirect)
+		case record.Excluded != nil:
+			excluded = append(excluded, *record.Excluded)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if len(blocked) > 0 {
+		result.BlockedURLs = append(blocked, result.BlockedURLs...)
+	}
+	if len(redirects) > 0 {
+		result.Redirects = append(redirects, result.Redirects...)
+	}
+	if len(excluded) > 0 {
+		result.Excluded = append(excluded, result.Excluded...)
+	}
+	return nil
+}
+
+// crawlRedirects returns the redirects of result, with those a lean crawl
+// wrote to records.jsonl
+func (c *Crawler) crawlRedirects(result *CrawlResult) []RedirectRecord {
+	if !result.Metadata.LeanPages {
+		return result.Redirects
+	}
+	all := &CrawlResult{Redirects: result.Redirects}
+	if err := readCrawlRecords(c.outputDir, all); err != nil {
+		fmt.Printf("Warning: failed to read crawl records: %v\n", err)
+	}
+	return all.Redirects
+}
@@ -0,0 +1,105 @@
+package crawler
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	appconfig "firesalamander/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordsTestPages link to a redirect, a page robots.txt blocks and an
+// excluded one
+var recordsTestPages = map[string]testPage{
+	"/robots.txt": {Body: "User-agent: *\nDisallow: /private/\n"},
+	"/old":        {Location: "/new"},
+	"*":           {Body: `<html><body><a href="/old">Old</a><a href="/private/a">Private</a><a href="/shop/item">Shop</a></body></html>`},
+}
+
+// recordsScope blocks, redirects and excludes some of recordsTestPages
+func recordsScope(cfg *appconfig.CrawlerConfig) {
+	cfg.Limits = appconfig.Limits{MaxURLs: 10, MaxDepth: 3}
+	cfg.Respect = appconfig.Respect{RobotsTxt: true}
+	cfg.Scope = appconfig.Scope{Exclude: []string{"/shop/*"}}
+}
+
+func TestLeanCrawlWritesRecordsToDisk(t *testing.T) {
+	server := newTestSite(recordsTestPages)
+	defer server.Close()
+
+	dir := t.TempDir()
+	lean := newTestCrawler(func(cfg *appconfig.CrawlerConfig) {
+		recordsScope(cfg)
+		cfg.Memory.LeanPages = true
+	})
+	result, err := lean.Crawl(context.Background(), server.URL+"/", dir)
+	require.NoError(t, err)
+	assert.Empty(t, result.BlockedURLs)
+	assert.Empty(t, result.Redirects)
+	assert.Empty(t, result.Excluded)
+	assert.FileExists(t, filepath.Join(dir, recordsFileName))
+
+	streamed, err := ReadCrawlResult(dir)
+	require.NoError(t, err)
+	require.Len(t, streamed.BlockedURLs, 1)
+	assert.Equal(t, server.URL+"/private/a", streamed.BlockedURLs[0].URL)
+	require.Len(t, streamed.Redirects, 1)
+	assert.Equal(t, server.URL+"/old", streamed.Redirects[0].SourceURL)
+	require.Len(t, streamed.Excluded, 1)
+	assert.Equal(t, server.URL+"/shop/item", streamed.Excluded[0].URL)
+
+	// A crawl keeping its records in memory leaves no stale file behind
+	result, err = newTestCrawler(recordsScope).Crawl(context.Background(), server.URL+"/", dir)
+	require.NoError(t, err)
+	assert.Len(t, result.Excluded, 1)
+	assert.NoFileExists(t, filepath.Join(dir, recordsFileName))
+}
+
+func TestResumeKeepsCrawlRecords(t *testing.T) {
+	server := newTestSite(checkpointTestPages)
+	defer server.Close()
+
+	seed := server.URL + "/"
+	checkpoint := func(auditDir string) {
+		writer := newTestCrawler(checkpointEveryPage)
+		writer.Config.Memory.LeanPages = true
+		writer.outputDir = auditDir
+		writer.seedURL = seed
+		writer.runStart = time.Now()
+		writer.markVisited(seed)
+		writer.Results = []PageData{{URL: seed, Title: "/"}}
+		writer.openRecords()
+		writer.addExcluded(ExcludedURL{URL: server.URL + "/kept", Rule: "exclude: /kept"})
+		require.NoError(t, writer.saveCheckpoint())
+		// Records written after the checkpoint are dropped on resume
+		writer.addExcluded(ExcludedURL{URL: server.URL + "/lost", Rule: "exclude: /lost"})
+		writer.closeRecords()
+	}
+	kept := []ExcludedURL{{URL: server.URL + "/kept", Rule: "exclude: /kept"}}
+
+	lean := t.TempDir()
+	checkpoint(lean)
+	loaded, err := LoadCheckpoint(lean)
+	require.NoError(t, err)
+	assert.Equal(t, kept, loaded.Excluded)
+
+	resumer := newTestCrawler(checkpointEveryPage)
+	resumer.Config.Memory.LeanPages = true
+	result, err := resumer.Resume(context.Background(), lean)
+	require.NoError(t, err)
+	assert.Empty(t, result.Excluded)
+	streamed, err := ReadCrawlResult(lean)
+	require.NoError(t, err)
+	assert.Equal(t, kept, streamed.Excluded)
+
+	// A crawl resumed without lean pages takes the records back in memory
+	full := t.TempDir()
+	checkpoint(full)
+	result, err = newTestCrawler(checkpointEveryPage).Resume(context.Background(), full)
+	require.NoError(t, err)
+	assert.Equal(t, kept, result.Excluded)
+	assert.NoFileExists(t, filepath.Join(full, recordsFileName))
+}
@@ -0,0 +1,278 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// maxRedirects matches the default limit of net/http
+const maxRedirects = 10
+
+var (
+	errRedirectLoop     = errors.New("redirect loop detected")
+	errTooManyRedirects = errors.New("too many redirects")
+)
+
+// RedirectHop is one redirect response in a chain
+type RedirectHop struct {
+	URL        string `json:"url"`
+	StatusCode int    `json:"status_code"`
+	Location   string `json:"location"`
+}
+
+// RedirectRecord is the full redirect chain observed for a requested URL
+type RedirectRecord struct {
+	SourceURL   string        `json:"source_url"`
+	Hops        []RedirectHop `json:"hops"`
+	FinalURL    string        `json:"final_url"`
+	FinalStatus int           `json:"final_status"`
+	Loop        bool          `json:"loop"`
+}
+
+// RedirectIssue is a problem found in a redirect chain
+type RedirectIssue struct {
+	Type        string `json:"type"`
+	Severity    string `json:"severity"`
+	SourceURL   string `json:"source_url"`
+	Description string `json:"description"`
+}
+
+// RedirectReport summarizes the redirects seen during a crawl
+type RedirectReport struct {
+	TotalRedirects int             `json:"total_redirects"`
+	Issues         []RedirectIssue `json:"issues"`
+	Counts         map[string]int  `json:"counts"`
+}
+
+// Redirect issue types
+const (
+	RedirectIssueChain     = "redirect_chain"
+	RedirectIssueTemporary = "temporary_redirect"
+	RedirectIssueProtocol  = "protocol_inconsistency"
+	RedirectIssueLoop      = "redirect_loop"
+	RedirectIssueToError   = "redirect_to_error"
+)
+
+type redirectChainKey struct{}
+
+// redirectChain collects the hops of one fetch through the client's CheckRedirect hook
+type redirectChain struct {
+	mu   sync.Mutex
+	hops []RedirectHop
+	loop bool
+}
+
+func withRedirectChain(ctx context.Context, chain *redirectChain) context.Context {
+	return context.WithValue(ctx, redirectChainKey{}, chain)
+}
+
+// checkRedirect is installed as http.Client.CheckRedirect. It records every
+// hop and stops on loops instead of letting the client spin until its limit.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	chain, _ := req.Context().Value(redirectChainKey{}).(*redirectChain)
+
+	if chain != nil && req.Response != nil {
+		chain.mu.Lock()
+		chain.hops = append(chain.hops, RedirectHop{
+			URL:        req.Response.Request.URL.String(),
+			StatusCode: req.Response.StatusCode,
+			Location:   req.URL.String(),
+		})
+		chain.mu.Unlock()
+	}
+
+	for _, previous := range via {
+		if previous.URL.String() == req.URL.String() {
+			if chain != nil {
+				chain.mu.Lock()
+				chain.loop = true
+				chain.mu.Unlock()
+			}
+			return errRedirectLoop
+		}
+	}
+
+	if len(via) >= maxRedirects {
+		return errTooManyRedirects
+	}
+	return nil
+}
+
+// reset clears the chain before a retry
+func (r *redirectChain) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hops = nil
+	r.loop = false
+}
+
+// record builds the redirect record for sourceURL, or nil if nothing redirected
+func (r *redirectChain) record(sourceURL string, resp *http.Response) *RedirectRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.hops) == 0 {
+		return nil
+	}
+
+	record := &RedirectRecord{
+		SourceURL: sourceURL,
+		Hops:      append([]RedirectHop(nil), r.hops...),
+		FinalURL:  r.hops[len(r.hops)-1].Location,
+		Loop:      r.loop,
+	}
+	if resp != nil && !r.loop {
+		record.FinalURL = resp.Request.URL.String()
+		record.FinalStatus = resp.StatusCode
+	}
+	return record
+}
+
+// hopsOrNil returns the hops of a record that may be nil
+func (r *RedirectRecord) hopsOrNil() []RedirectHop {
+	if r == nil {
+		return nil
+	}
+	return r.Hops
+}
+
+// AnalyzeRedirects flags chains longer than one hop, temporary redirects
+// used as permanent ones, HTTP/HTTPS inconsistencies, loops and redirects
+// ending on an error. A temporary redirect counts as permanent when the
+// same hop was captured more than once or lands on a page declaring itself
+// canonical, which pages tells; a single temporary hop is only a low
+// severity issue.
+func AnalyzeRedirects(records []RedirectRecord, pages []PageData) *RedirectReport {
+	report := &RedirectReport{
+		TotalRedirects: len(records),
+		Issues:         make([]RedirectIssue, 0),
+		Counts:         make(map[string]int),
+	}
+
+	add := func(issueType, severity, source, description string) {
+		report.Issues = append(report.Issues, RedirectIssue{
+			Type:        issueType,
+			Severity:    severity,
+			SourceURL:   source,
+			Description: description,
+		})
+		report.Counts[issueType]++
+	}
+
+	captures := make(map[RedirectHop]int)
+	for _, record := range records {
+		for _, hop := range record.Hops {
+			captures[hop]++
+		}
+	}
+	canonicals := selfCanonicalPages(pages)
+
+	for _, record := range records {
+		if record.Loop {
+			add(RedirectIssueLoop, "critical", record.SourceURL,
+				fmt.Sprintf("Redirect loop after %d hops", len(record.Hops)))
+			continue
+		}
+
+		if len(record.Hops) > 1 {
+			add(RedirectIssueChain, "medium", record.SourceURL,
+				fmt.Sprintf("Redirect chain of %d hops to %s", len(record.Hops), record.FinalURL))
+		}
+
+		for _, hop := range record.Hops {
+			if isTemporaryRedirect(hop.StatusCode) {
+				switch target := NormalizeURL(absoluteURL(hop.URL, hop.Location)); {
+				case canonicals[target]:
+					add(RedirectIssueTemporary, "medium", record.SourceURL,
+						fmt.Sprintf("Temporary redirect (%d) from %s to its canonical target %s; use 301 or 308 for permanent moves", hop.StatusCode, hop.URL, hop.Location))
+				case captures[hop] > 1:
+					add(RedirectIssueTemporary, "medium", record.SourceURL,
+						fmt.Sprintf("Temporary redirect (%d) from %s to %s seen %d times; use 301 or 308 for permanent moves", hop.StatusCode, hop.URL, hop.Location, captures[hop]))
+				default:
+					add(RedirectIssueTemporary, "low", record.SourceURL,
+						fmt.Sprintf("Temporary redirect (%d) from %s to %s; check the move is meant to be temporary", hop.StatusCode, hop.URL, hop.Location))
+				}
+			}
+
+			from, errFrom := url.Parse(hop.URL)
+			to, errTo := url.Parse(hop.Location)
+			if errFrom != nil || errTo != nil {
+				continue
+			}
+			if from.Scheme == "https" && to.Scheme == "http" {
+				add(RedirectIssueProtocol, "high", record.SourceURL,
+					fmt.Sprintf("HTTPS downgraded to HTTP: %s -> %s", hop.URL, hop.Location))
+			}
+		}
+
+		if len(record.Hops) > 1 && mixesSchemes(record.Hops) {
+			add(RedirectIssueProtocol, "medium", record.SourceURL,
+				"Redirect chain switches between HTTP and HTTPS more than once")
+		}
+
+		if record.FinalStatus >= 400 {
+			add(RedirectIssueToError, "high", record.SourceURL,
+				fmt.Sprintf("Redirect ends on HTTP %d at %s", record.FinalStatus, record.FinalURL))
+		}
+	}
+
+	return report
+}
+
+// AuditRedirects analyzes the redirects of a crawl result, read back from
+// records.jsonl when the crawl kept them on disk
+func (c *Crawler) AuditRedirects(result *CrawlResult) *RedirectReport {
+	return AnalyzeRedirects(c.crawlRedirects(result), result.Pages)
+}
+
+// selfCanonicalPages lists the normalized URLs of the pages whose canonical
+// is themselves
+func selfCanonicalPages(pages []PageData) map[string]bool {
+	canonicals := make(map[string]bool)
+	for _, page := range pages {
+		if page.Canonical == "" {
+			continue
+		}
+		base := page.FinalURL
+		if base == "" {
+			base = page.URL
+		}
+		if canonical := NormalizeURL(absoluteURL(base, page.Canonical)); canonical == NormalizeURL(base) {
+			canonicals[canonical] = true
+		}
+	}
+	return canonicals
+}
+
+func isTemporaryRedirect(statusCode int) bool {
+	return statusCode == http.StatusFound ||
+		statusCode == http.StatusSeeOther ||
+		statusCode == http.StatusTemporaryRedirect
+}
+
+// mixesSchemes reports whether a chain changes scheme more than once
+func mixesSchemes(hops []RedirectHop) bool {
+	changes := 0
+	for _, hop := range hops {
+		from, errFrom := url.Parse(hop.URL)
+		to, errTo := url.Parse(hop.Location)
+		if errFrom == nil && errTo == nil && from.Scheme != to.Scheme {
+			changes++
+		}
+	}
+	return changes > 1
+}
+
+// recordRedirect keeps a redirect chain for the crawl result
+func (c *Crawler) recordRedirect(record *RedirectRecord) {
+	if record == nil {
+		return
+	}
+	c.mutex.Lock()
+	c.addRedirect(*record)
+	c.mutex.Unlock()
+}
@@ -0,0 +1,192 @@
+package crawler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	appconfig "firesalamander/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var redirectTestPages = map[string]testPage{
+	"/old":    {Location: "/moved"},
+	"/moved":  {Location: "/new", Status: http.StatusFound},
+	"/new":    {Body: `<html><head><title>New</title></head><body><a href="child">Child</a></body></html>`},
+	"/loop-a": {Location: "/loop-b"},
+	"/loop-b": {Location: "/loop-a"},
+	"/gone":   {Location: "/missing"},
+}
+
+func TestCrawlRecordsRedirectChain(t *testing.T) {
+	server := newTestSite(redirectTestPages)
+	defer server.Close()
+
+	result, err := newTestCrawler(nil).Crawl(context.Background(), server.URL+"/old", "")
+	require.NoError(t, err)
+	require.Len(t, result.Pages, 1)
+
+	page := result.Pages[0]
+	assert.Equal(t, server.URL+"/old", page.URL)
+	assert.Equal(t, server.URL+"/new", page.FinalURL)
+	require.Len(t, page.RedirectChain, 2)
+	assert.Equal(t, RedirectHop{URL: server.URL + "/old", StatusCode: 301, Location: server.URL + "/moved"}, page.RedirectChain[0])
+	assert.Equal(t, RedirectHop{URL: server.URL + "/moved", StatusCode: 302, Location: server.URL + "/new"}, page.RedirectChain[1])
+
+	require.Len(t, result.Redirects, 1)
+	assert.Equal(t, server.URL+"/new", result.Redirects[0].FinalURL)
+	assert.Equal(t, http.StatusOK, result.Redirects[0].FinalStatus)
+}
+
+func TestCrawlRecordsRedirectLoop(t *testing.T) {
+	server := newTestSite(redirectTestPages)
+	defer server.Close()
+
+	result, err := newTestCrawler(nil).Crawl(context.Background(), server.URL+"/loop-a", "")
+	require.NoError(t, err)
+
+	assert.Empty(t, result.Pages)
+	require.Len(t, result.Redirects, 1)
+	assert.True(t, result.Redirects[0].Loop)
+	assert.Len(t, result.Redirects[0].Hops, 2)
+}
+
+func TestCrawlRecordsRedirectToError(t *testing.T) {
+	server := newTestSite(redirectTestPages)
+	defer server.Close()
+
+	result, err := newTestCrawler(nil).Crawl(context.Background(), server.URL+"/gone", "")
+	require.NoError(t, err)
+
+	assert.Empty(t, result.Pages)
+	require.Len(t, result.Redirects, 1)
+	assert.Equal(t, http.StatusNotFound, result.Redirects[0].FinalStatus)
+}
+
+func TestAnalyzeRedirects(t *testing.T) {
+	records := []RedirectRecord{
+		{
+			SourceURL: "http://example.com/a",
+			Hops: []RedirectHop{
+				{URL: "http://example.com/a", StatusCode: 301, Location: "https://example.com/a"},
+				{URL: "https://example.com/a", StatusCode: 302, Location: "http://example.com/b"},
+			},
+			FinalURL:    "http://example.com/b",
+			FinalStatus: 200,
+		},
+		{
+			SourceURL: "https://example.com/loop",
+			Hops: []RedirectHop{
+				{URL: "https://example.com/loop", StatusCode: 301, Location: "https://example.com/loop2"},
+				{URL: "https://example.com/loop2", StatusCode: 301, Location: "https://example.com/loop"},
+			},
+			Loop: true,
+		},
+		{
+			SourceURL:   "https://example.com/old",
+			Hops:        []RedirectHop{{URL: "https://example.com/old", StatusCode: 301, Location: "https://example.com/404"}},
+			FinalURL:    "https://example.com/404",
+			FinalStatus: 404,
+		},
+		{
+			SourceURL:   "https://example.com/fine",
+			Hops:        []RedirectHop{{URL: "https://example.com/fine", StatusCode: 301, Location: "https://example.com/fine/"}},
+			FinalURL:    "https://example.com/fine/",
+			FinalStatus: 200,
+		},
+	}
+
+	report := AnalyzeRedirects(records, nil)
+
+	assert.Equal(t, 4, report.TotalRedirects)
+	assert.Equal(t, 1, report.Counts[RedirectIssueChain])
+	assert.Equal(t, 1, report.Counts[RedirectIssueTemporary])
+	assert.Equal(t, 2, report.Counts[RedirectIssueProtocol])
+	assert.Equal(t, 1, report.Counts[RedirectIssueLoop])
+	assert.Equal(t, 1, report.Counts[RedirectIssueToError])
+
+	for _, issue := range report.Issues {
+		assert.NotEqual(t, "https://example.com/fine", issue.SourceURL)
+		if issue.Type == RedirectIssueTemporary {
+			// A single temporary hop may well be temporary
+			assert.Equal(t, "low", issue.Severity)
+		}
+	}
+}
+
+func TestAnalyzeRedirectsFlagsTemporaryRedirectsUsedAsPermanent(t *testing.T) {
+	temporary := func(source, location string) RedirectRecord {
+		return RedirectRecord{
+			SourceURL:   source,
+			Hops:        []RedirectHop{{URL: source, StatusCode: 302, Location: location}},
+			FinalURL:    location,
+			FinalStatus: 200,
+		}
+	}
+	records := []RedirectRecord{
+		temporary("https://example.com/promo", "https://example.com/soldes"),
+		temporary("https://example.com/old", "https://example.com/new"),
+		temporary("https://example.com/shop", "https://example.com/boutique"),
+		temporary("https://example.com/shop", "https://example.com/boutique"),
+	}
+	pages := []PageData{
+		{URL: "https://example.com/old", FinalURL: "https://example.com/new", Canonical: "/new"},
+		{URL: "https://example.com/promo", FinalURL: "https://example.com/soldes", Canonical: "https://example.com/"},
+	}
+
+	severities := make(map[string][]string)
+	for _, issue := range AnalyzeRedirects(records, pages).Issues {
+		require.Equal(t, RedirectIssueTemporary, issue.Type)
+		severities[issue.SourceURL] = append(severities[issue.SourceURL], issue.Severity)
+	}
+	assert.Equal(t, map[string][]string{
+		// The landing page is canonicalised elsewhere: nothing says the move is permanent
+		"https://example.com/promo": {"low"},
+		// The redirect points at the canonical target
+		"https://example.com/old": {"medium"},
+		// The same hop was captured twice
+		"https://example.com/shop": {"medium", "medium"},
+	}, severities)
+}
+
+func TestCrawlDoesNotFollowLinksAfterOffHostRedirect(t *testing.T) {
+	var external []string
+	var mutex sync.Mutex
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		external = append(external, r.URL.Path)
+		mutex.Unlock()
+		w.Write([]byte(`<html><body><a href="/ext-a">A</a><a href="ext-b">B</a></body></html>`))
+	}))
+	defer other.Close()
+
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<html><body><a href="/go">Partner</a></body></html>`))
+		case "/go":
+			http.Redirect(w, r, other.URL+"/landing", http.StatusFound)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer site.Close()
+
+	crawler := NewCrawler(appconfig.CrawlerConfig{
+		UserAgent:   "Test-Bot/1.0",
+		Limits:      appconfig.Limits{MaxURLs: 10, MaxDepth: 3},
+		Performance: appconfig.Performance{ConcurrentRequests: 1, RequestTimeout: 5 * time.Second},
+	})
+	result, err := crawler.Crawl(context.Background(), site.URL+"/", "")
+	require.NoError(t, err)
+
+	assert.Len(t, result.Pages, 2)
+	assert.Equal(t, []string{"/landing"}, external)
+	for _, page := range result.Pages {
+		assert.NotContains(t, page.URL, other.URL)
+	}
+}
@@ -0,0 +1,82 @@
+package crawler
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// htmlDirName is the sub-directory of the audit output holding raw documents
+const htmlDirName = "html"
+
+// recordResponse copies the HTTP response details onto a crawled page
+func recordResponse(page *PageData, resp *http.Response, bodySize int, start, firstByte, downloaded time.Time) {
+	page.StatusCode = resp.StatusCode
+	page.Headers = flattenHeaders(resp.Header)
+	page.ContentType = resp.Header.Get("Content-Type")
+	page.BodySize = int64(bodySize)
+	if !firstByte.IsZero() && firstByte.After(start) {
+		page.TTFBMs = firstByte.Sub(start).Milliseconds()
+	}
+	page.DownloadMs = downloaded.Sub(start).Milliseconds()
+}
+
+// flattenHeaders joins repeated header values the way they are sent on the wire
+func flattenHeaders(header http.Header) map[string]string {
+	flat := make(map[string]string, len(header))
+	for key, values := range header {
+		flat[key] = strings.Join(values, ", ")
+	}
+	return flat
+}
+
+// htmlFileName derives a stable file name from the page URL
+func htmlFileName(pageURL string) string {
+	sum := sha1.Sum([]byte(pageURL))
+	return hex.EncodeToString(sum[:]) + ".html"
+}
+
+// storeRawHTML writes the fetched document under <outputDir>/html and keeps
+// a relative reference on the page. Without an output directory the
+// document stays in memory.
+func (c *Crawler) storeRawHTML(page *PageData, body []byte) error {
+	if c.outputDir == "" {
+		page.RawHTML = string(body)
+		return nil
+	}
+
+	dir := filepath.Join(c.outputDir, htmlDirName)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	name := htmlFileName(page.URL)
+	if err := os.WriteFile(filepath.Join(dir, name), body, 0644); err != nil {
+		return err
+	}
+
+	page.HTMLRef = filepath.Join(htmlDirName, name)
+	return nil
+}
+
+// LoadRawHTML returns the raw document of a crawled page, either kept in
+// memory or stored in the audit output directory
+func LoadRawHTML(outputDir string, page PageData) (string, error) {
+	if page.RawHTML != "" {
+		return page.RawHTML, nil
+	}
+	if page.HTMLRef == "" {
+		return "", fmt.Errorf("no raw HTML stored for %s", page.URL)
+	}
+
+	data, err := os.ReadFile(filepath.Join(outputDir, page.HTMLRef))
+	if err != nil {
+		return "", fmt.Errorf("failed to read raw HTML for %s: %w", page.URL, err)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,77 @@
+package crawler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const responseTestHTML = `<!DOCTYPE html><html lang="en"><head><title>Raw</title><meta name="viewport" content="width=device-width"></head><body><h1>Raw</h1></body></html>`
+
+func newResponseTestServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Add("Vary", "Accept")
+		w.Header().Add("Vary", "Cookie")
+		time.Sleep(5 * time.Millisecond)
+		w.Write([]byte(responseTestHTML))
+	}))
+}
+
+func TestCrawlRecordsResponse(t *testing.T) {
+	server := newResponseTestServer()
+	defer server.Close()
+
+	result, err := newTestCrawler(nil).Crawl(context.Background(), server.URL, "")
+	require.NoError(t, err)
+	require.Len(t, result.Pages, 1)
+
+	page := result.Pages[0]
+	assert.Equal(t, http.StatusOK, page.StatusCode)
+	assert.Equal(t, "text/html; charset=utf-8", page.ContentType)
+	assert.Equal(t, "max-age=60", page.Headers["Cache-Control"])
+	assert.Equal(t, "Accept, Cookie", page.Headers["Vary"])
+	assert.Equal(t, int64(len(responseTestHTML)), page.BodySize)
+	assert.GreaterOrEqual(t, page.TTFBMs, int64(5))
+	assert.GreaterOrEqual(t, page.DownloadMs, page.TTFBMs)
+
+	// Without an output directory the document stays in memory
+	assert.Empty(t, page.HTMLRef)
+	html, err := LoadRawHTML("", page)
+	require.NoError(t, err)
+	assert.Equal(t, responseTestHTML, html)
+}
+
+func TestCrawlStoresRawHTML(t *testing.T) {
+	server := newResponseTestServer()
+	defer server.Close()
+
+	outputDir := t.TempDir()
+	result, err := newTestCrawler(nil).Crawl(context.Background(), server.URL, outputDir)
+	require.NoError(t, err)
+	require.Len(t, result.Pages, 1)
+
+	page := result.Pages[0]
+	assert.Empty(t, page.RawHTML)
+	assert.Equal(t, filepath.Join(htmlDirName, htmlFileName(server.URL+"/")), page.HTMLRef)
+	assert.FileExists(t, filepath.Join(outputDir, page.HTMLRef))
+
+	html, err := LoadRawHTML(outputDir, page)
+	require.NoError(t, err)
+	assert.Equal(t, responseTestHTML, html)
+}
+
+func TestLoadRawHTMLMissing(t *testing.T) {
+	_, err := LoadRawHTML(t.TempDir(), PageData{URL: "https://example.com"})
+	assert.Error(t, err)
+
+	_, err = LoadRawHTML(t.TempDir(), PageData{URL: "https://example.com", HTMLRef: "html/missing.html"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,434 @@
+package crawler
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxRobotsSize mirrors Google's limit: content past 500 KiB is ignored
+const maxRobotsSize = 500 * 1024
+
+// RobotsRule is a single allow/disallow line of a robots.txt group
+type RobotsRule struct {
+	Allow   bool   `json:"allow"`
+	Pattern string `json:"pattern"`
+}
+
+// RobotsGroup is a set of rules shared by one or more user-agent lines
+type RobotsGroup struct {
+	UserAgents []string      `json:"user_agents"`
+	Rules      []RobotsRule  `json:"rules"`
+	CrawlDelay time.Duration `json:"crawl_delay"`
+}
+
+// RobotsRules is the parsed content of a robots.txt file
+type RobotsRules struct {
+	Groups   []RobotsGroup `json:"groups"`
+	Sitemaps []string      `json:"sitemaps"`
+}
+
+// BlockedURL records a URL skipped because of robots.txt
+type BlockedURL struct {
+	URL  string `json:"url"`
+	Rule string `json:"rule"`
+}
+
+// allowAllRobots is used when robots.txt is missing (4xx)
+var allowAllRobots = &RobotsRules{}
+
+// disallowAllRobots is used when robots.txt is unreachable, on a 5xx or a
+// network error, as RFC 9309 and Google do
+var disallowAllRobots = &RobotsRules{
+	Groups: []RobotsGroup{{
+		UserAgents: []string{"*"},
+		Rules:      []RobotsRule{{Allow: false, Pattern: "/"}},
+	}},
+}
+
+// ParseRobots parses robots.txt content. Consecutive user-agent lines share
+// the rules that follow them; unknown directives are ignored.
+func ParseRobots(content string) *RobotsRules {
+	rules := &RobotsRules{
+		Groups:   make([]RobotsGroup, 0),
+		Sitemaps: make([]string, 0),
+	}
+
+	var current *RobotsGroup
+	lastWasAgent := false
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	scanner.Buffer(make([]byte, 0, 64*1024), maxRobotsSize)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if idx := strings.Index(line, "#"); idx >= 0 {
+			line = line[:idx]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			if current == nil || !lastWasAgent {
+				rules.Groups = append(rules.Groups, RobotsGroup{})
+				current = &rules.Groups[len(rules.Groups)-1]
+			}
+			current.UserAgents = append(current.UserAgents, strings.ToLower(value))
+			lastWasAgent = true
+			continue
+		case "allow", "disallow":
+			// An empty disallow means "allow everything" and matches nothing
+			if current != nil && value != "" {
+				current.Rules = append(current.Rules, RobotsRule{
+					Allow:   key == "allow",
+					Pattern: value,
+				})
+			}
+		case "crawl-delay":
+			if current != nil {
+				if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+					current.CrawlDelay = time.Duration(seconds * float64(time.Second))
+				}
+			}
+		case "sitemap":
+			if value != "" {
+				rules.Sitemaps = append(rules.Sitemaps, value)
+			}
+		}
+		lastWasAgent = false
+	}
+
+	return rules
+}
+
+// groupFor selects the rules that apply to userAgent. As RFC 9309 asks,
+// user-agent lines are matched case-insensitively against the crawler's
+// product token, the user agent up to its version: a line naming the whole
+// token or its leading words applies, the longest one wins, and groups
+// naming the same agent are merged. "*" is used only when nothing matches.
+func (r *RobotsRules) groupFor(userAgent string) *RobotsGroup {
+	token := productToken(userAgent)
+
+	best := ""
+	for _, group := range r.Groups {
+		for _, agent := range group.UserAgents {
+			if agent != "*" && agentMatches(agent, token) && len(agent) > len(best) {
+				best = agent
+			}
+		}
+	}
+	if best == "" {
+		best = "*"
+	}
+
+	var merged *RobotsGroup
+	for _, group := range r.Groups {
+		for _, agent := range group.UserAgents {
+			if agent != best {
+				continue
+			}
+			if merged == nil {
+				merged = &RobotsGroup{UserAgents: []string{best}}
+			}
+			merged.Rules = append(merged.Rules, group.Rules...)
+			if group.CrawlDelay > merged.CrawlDelay {
+				merged.CrawlDelay = group.CrawlDelay
+			}
+			break
+		}
+	}
+
+	return merged
+}
+
+// Allowed reports whether userAgent may fetch urlStr, along with the rule that
+// decided it. The longest matching pattern wins; on a tie, allow wins.
+func (r *RobotsRules) Allowed(userAgent, urlStr string) (bool, string) {
+	group := r.groupFor(userAgent)
+	if group == nil {
+		return true, ""
+	}
+
+	path := robotsPath(urlStr)
+	// robots.txt itself is always allowed
+	if path == "/robots.txt" {
+		return true, ""
+	}
+
+	var match *RobotsRule
+	for i := range group.Rules {
+		rule := &group.Rules[i]
+		if !robotsPatternMatch(rule.Pattern, path) {
+			continue
+		}
+		if match == nil ||
+			len(rule.Pattern) > len(match.Pattern) ||
+			(len(rule.Pattern) == len(match.Pattern) && rule.Allow && !match.Allow) {
+			match = rule
+		}
+	}
+
+	if match == nil {
+		return true, ""
+	}
+
+	directive := "Disallow"
+	if match.Allow {
+		directive = "Allow"
+	}
+	return match.Allow, fmt.Sprintf("%s: %s", directive, match.Pattern)
+}
+
+// CrawlDelay returns the Crawl-delay declared for userAgent, if any
+func (r *RobotsRules) CrawlDelay(userAgent string) time.Duration {
+	group := r.groupFor(userAgent)
+	if group == nil {
+		return 0
+	}
+	return group.CrawlDelay
+}
+
+// productToken is the name part of a user agent, lowercased: the text
+// before its version or comment, "fire salamander seo analyzer" for
+// "Fire Salamander SEO Analyzer/1.0 (SEPTEO)"
+func productToken(userAgent string) string {
+	token := userAgent
+	if i := strings.IndexAny(token, "/("); i >= 0 {
+		token = token[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(token))
+}
+
+// agentMatches reports whether a user-agent line names the product token,
+// in full or by its leading words
+func agentMatches(agent, token string) bool {
+	if agent == "" || !strings.HasPrefix(token, agent) {
+		return false
+	}
+	return len(agent) == len(token) || token[len(agent)] == ' '
+}
+
+// robotsPath returns the path and query of a URL as matched by robots.txt
+func robotsPath(urlStr string) string {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return urlStr
+	}
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	return path
+}
+
+// robotsPatternMatch matches a robots.txt path pattern supporting "*" (any
+// sequence) and a trailing "$" (end of URL).
+func robotsPatternMatch(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored {
+		pattern = strings.TrimSuffix(pattern, "$")
+	}
+
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	pos := len(parts[0])
+
+	for i := 1; i < len(parts); i++ {
+		part := parts[i]
+		if i == len(parts)-1 && anchored {
+			// The last fragment must sit at the very end of the path
+			return len(path)-pos >= len(part) && strings.HasSuffix(path, part)
+		}
+		idx := strings.Index(path[pos:], part)
+		if idx < 0 {
+			return false
+		}
+		pos += idx + len(part)
+	}
+
+	if anchored {
+		return pos == len(path)
+	}
+	return true
+}
+
+// robotsCache fetches and keeps robots.txt per scheme and host. Each host
+// is fetched once, by the first caller; the others wait for that fetch only,
+// so a slow host does not hold up the lookups of the other hosts.
+type robotsCache struct {
+	mu      sync.Mutex
+	entries map[string]*robotsEntry
+}
+
+// robotsEntry holds the rules of a host once done is closed
+type robotsEntry struct {
+	done  chan struct{}
+	rules *RobotsRules
+	err   error
+}
+
+func newRobotsCache() *robotsCache {
+	return &robotsCache{
+		entries: make(map[string]*robotsEntry),
+	}
+}
+
+// robotsFor returns the robots.txt rules governing urlStr, fetching them once per host
+func (c *Crawler) robotsFor(ctx context.Context, urlStr string) (*RobotsRules, error) {
+	u, err := url.Parse(urlStr)
+	if err != nil || u.Host == "" {
+		return allowAllRobots, err
+	}
+	key := u.Scheme + "://" + u.Host
+
+	for {
+		c.robots.mu.Lock()
+		entry, ok := c.robots.entries[key]
+		if !ok {
+			entry = &robotsEntry{done: make(chan struct{})}
+			c.robots.entries[key] = entry
+		}
+		c.robots.mu.Unlock()
+
+		if !ok {
+			c.loadRobots(ctx, key, u.Host, entry)
+			if entry.rules == nil {
+				return allowAllRobots, entry.err
+			}
+			return entry.rules, entry.err
+		}
+
+		select {
+		case <-entry.done:
+		case <-ctx.Done():
+			return allowAllRobots, ctx.Err()
+		}
+		// A fetch cancelled with its caller's context is tried again
+		if entry.rules != nil {
+			return entry.rules, entry.err
+		}
+	}
+}
+
+// loadedRobots returns the robots.txt rules governing urlStr if they were
+// fetched already, nil otherwise
+func (c *Crawler) loadedRobots(urlStr string) *RobotsRules {
+	u, err := url.Parse(urlStr)
+	if err != nil || u.Host == "" {
+		return allowAllRobots
+	}
+
+	c.robots.mu.Lock()
+	entry, ok := c.robots.entries[u.Scheme+"://"+u.Host]
+	c.robots.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	select {
+	case <-entry.done:
+		return entry.rules
+	default:
+		return nil
+	}
+}
+
+// loadRobots fetches the robots.txt of a host into its entry. A fetch cut
+// short by a cancelled context is not cached.
+func (c *Crawler) loadRobots(ctx context.Context, key, host string, entry *robotsEntry) {
+	defer close(entry.done)
+
+	rules, err := c.fetchRobots(ctx, key+"/robots.txt")
+	if err != nil && ctx.Err() != nil {
+		c.robots.mu.Lock()
+		delete(c.robots.entries, key)
+		c.robots.mu.Unlock()
+		entry.rules, entry.err = nil, err
+		return
+	}
+	if err != nil && c.Config.Respect.RobotsTxt {
+		// An unreachable robots.txt blocks the host like a server error
+		fmt.Printf("Warning: robots.txt unavailable for %s, not crawling the host: %v\n", key, err)
+		rules = disallowAllRobots
+	} else if err != nil {
+		// Only the Crawl-delay was wanted, and there is none to honour
+		rules = allowAllRobots
+	}
+	entry.rules, entry.err = rules, err
+
+	if c.Config.Respect.CrawlDelay {
+		c.politeness.SetCrawlDelay(host, rules.CrawlDelay(c.Config.UserAgent))
+	}
+}
+
+func (c *Crawler) fetchRobots(ctx context.Context, robotsURL string) (*RobotsRules, error) {
+	req, err := c.newRequest(ctx, "GET", robotsURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create robots.txt request: %w", err)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", robotsURL, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	switch {
+	case resp.StatusCode >= 500:
+		return disallowAllRobots, nil
+	case resp.StatusCode >= 400:
+		return allowAllRobots, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxRobotsSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read robots.txt: %w", err)
+	}
+
+	return ParseRobots(string(body)), nil
+}
+
+// allowedByRobots checks urlStr against robots.txt and records blocked URLs
+func (c *Crawler) allowedByRobots(ctx context.Context, urlStr string) bool {
+	blocked := c.robotsBlock(ctx, urlStr)
+	if blocked == nil {
+		return true
+	}
+	c.mutex.Lock()
+	c.addBlocked(*blocked)
+	c.mutex.Unlock()
+	return false
+}
+
+// robotsBlock checks urlStr against robots.txt, fetched within ctx, and
+// returns the record of urlStr when it is disallowed. It records nothing.
+func (c *Crawler) robotsBlock(ctx context.Context, urlStr string) *BlockedURL {
+	if !c.Config.Respect.RobotsTxt {
+		// robots.txt is still read for its Crawl-delay, but not enforced
+		if c.Config.Respect.CrawlDelay {
+			_, _ = c.robotsFor(ctx, urlStr)
+		}
+		return nil
+	}
+
+	// Fetch errors were logged once by loadRobots
+	rules, _ := c.robotsFor(ctx, urlStr)
+	if allowed, rule := rules.Allowed(c.Config.UserAgent, urlStr); !allowed {
+		return &BlockedURL{URL: urlStr, Rule: rule}
+	}
+	return nil
+}
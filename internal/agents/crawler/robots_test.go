@@ -0,0 +1,283 @@
+package crawler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	appconfig "firesalamander/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRobots(t *testing.T) {
+	content := `# Example robots.txt
+User-agent: *
+Disallow: /private/
+Allow: /private/public
+Crawl-delay: 2
+
+User-agent: BadBot
+User-agent: OtherBot
+Disallow: /
+
+Sitemap: https://example.com/sitemap.xml
+`
+
+	rules := ParseRobots(content)
+
+	require.Len(t, rules.Groups, 2)
+	assert.Equal(t, []string{"*"}, rules.Groups[0].UserAgents)
+	assert.Len(t, rules.Groups[0].Rules, 2)
+	assert.Equal(t, 2*time.Second, rules.Groups[0].CrawlDelay)
+	assert.Equal(t, []string{"badbot", "otherbot"}, rules.Groups[1].UserAgents)
+	assert.Equal(t, []string{"https://example.com/sitemap.xml"}, rules.Sitemaps)
+}
+
+func TestRobotsPatternMatch(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		path     string
+		expected bool
+		name     string
+	}{
+		{"/fish", "/fish.html", true, "prefix match"},
+		{"/fish", "/Fish.asp", false, "case sensitive"},
+		{"/fish*", "/fishheads/yummy.html", true, "trailing wildcard"},
+		{"/*.php", "/folder/filename.php?params", true, "wildcard extension"},
+		{"/*.php$", "/filename.php", true, "anchored extension"},
+		{"/*.php$", "/filename.php?params", false, "anchored rejects query"},
+		{"/fish*.php", "/fishheads/catfish.php?parameters", true, "inner wildcard"},
+		{"/fish*.php", "/Fish.PHP", false, "inner wildcard case sensitive"},
+		{"/$", "/", true, "root only"},
+		{"/$", "/page", false, "root only rejects page"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, robotsPatternMatch(tt.pattern, tt.path))
+		})
+	}
+}
+
+func TestRobotsAllowed(t *testing.T) {
+	rules := ParseRobots(`User-agent: *
+Disallow: /shop/
+Allow: /shop/sale
+Disallow: /*?sessionid=
+Disallow: /page
+Allow: /page
+
+User-agent: fire salamander
+Disallow: /admin
+Crawl-delay: 5
+`)
+
+	tests := []struct {
+		userAgent string
+		url       string
+		expected  bool
+		name      string
+	}{
+		{"OtherBot/1.0", "https://example.com/shop/cart", false, "disallowed directory"},
+		{"OtherBot/1.0", "https://example.com/shop/sale/shoes", true, "longer allow wins"},
+		{"OtherBot/1.0", "https://example.com/list?sessionid=42", false, "wildcard query"},
+		{"OtherBot/1.0", "https://example.com/page", true, "allow wins on tie"},
+		{"OtherBot/1.0", "https://example.com/robots.txt", true, "robots.txt always allowed"},
+		{"Fire Salamander SEO Analyzer/1.0", "https://example.com/shop/cart", true, "specific group replaces wildcard"},
+		{"Fire Salamander SEO Analyzer/1.0", "https://example.com/admin/users", false, "specific group rules apply"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed, _ := rules.Allowed(tt.userAgent, tt.url)
+			assert.Equal(t, tt.expected, allowed)
+		})
+	}
+
+	_, rule := rules.Allowed("OtherBot/1.0", "https://example.com/shop/cart")
+	assert.Equal(t, "Disallow: /shop/", rule)
+	assert.Equal(t, 5*time.Second, rules.CrawlDelay("Fire Salamander SEO Analyzer/1.0"))
+	assert.Equal(t, time.Duration(0), rules.CrawlDelay("OtherBot/1.0"))
+}
+
+func TestCrawlRespectsRobots(t *testing.T) {
+	fetched := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetched <- r.URL.Path
+		if r.URL.Path == "/robots.txt" {
+			w.Write([]byte("User-agent: *\nDisallow: /private\n"))
+			return
+		}
+		w.Write([]byte("<html><head><title>Page</title></head><body></body></html>"))
+	}))
+	defer server.Close()
+
+	crawler := NewCrawler(appconfig.CrawlerConfig{
+		UserAgent:   "Test-Bot/1.0",
+		Limits:      appconfig.Limits{MaxURLs: 10, MaxDepth: 2},
+		Performance: appconfig.Performance{ConcurrentRequests: 1, RequestTimeout: 5 * time.Second},
+		Respect:     appconfig.Respect{RobotsTxt: true},
+	})
+
+	result, err := crawler.Crawl(context.Background(), server.URL+"/private/area", "")
+	require.NoError(t, err)
+
+	assert.Empty(t, result.Pages)
+	require.Len(t, result.BlockedURLs, 1)
+	assert.Equal(t, server.URL+"/private/area", result.BlockedURLs[0].URL)
+	assert.Equal(t, "Disallow: /private", result.BlockedURLs[0].Rule)
+
+	close(fetched)
+	for path := range fetched {
+		assert.Equal(t, "/robots.txt", path)
+	}
+}
+
+func TestRobotsUnavailable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	crawler := NewCrawler(appconfig.CrawlerConfig{
+		UserAgent: "Test-Bot/1.0",
+		Respect:   appconfig.Respect{RobotsTxt: true},
+	})
+
+	// A 5xx robots.txt means the whole site is off limits
+	assert.False(t, crawler.shouldCrawl(context.Background(), server.URL+"/page"))
+}
+
+func TestRobotsUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	unreachable := server.URL
+	server.Close()
+
+	crawler := NewCrawler(appconfig.CrawlerConfig{
+		UserAgent:   "Test-Bot/1.0",
+		Performance: appconfig.Performance{RequestTimeout: time.Second},
+		Respect:     appconfig.Respect{RobotsTxt: true},
+	})
+
+	// A network error counts as a server error, not as a missing file
+	assert.False(t, crawler.shouldCrawl(context.Background(), unreachable+"/page"))
+	assert.False(t, crawler.shouldCrawl(context.Background(), unreachable+"/other"))
+}
+
+func TestShouldCrawlURLFetchesAndRecordsNothing(t *testing.T) {
+	var fetches int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		w.Write([]byte("User-agent: *\nDisallow: /private/\n"))
+	}))
+	defer server.Close()
+
+	crawler := NewCrawler(appconfig.CrawlerConfig{
+		UserAgent:   "Test-Bot/1.0",
+		Performance: appconfig.Performance{RequestTimeout: 5 * time.Second},
+		Respect:     appconfig.Respect{RobotsTxt: true},
+		Exclusions:  appconfig.Exclusions{Patterns: []string{"/admin/"}},
+	})
+
+	// robots.txt is not loaded yet and is not fetched
+	assert.True(t, crawler.ShouldCrawlURL(server.URL+"/private/page"))
+	assert.False(t, crawler.ShouldCrawlURL(server.URL+"/admin/panel"))
+	assert.Zero(t, atomic.LoadInt32(&fetches))
+	assert.Empty(t, crawler.Excluded)
+
+	// Once the scheduler loaded them, the rules apply without being recorded
+	assert.False(t, crawler.shouldCrawl(context.Background(), server.URL+"/private/page"))
+	assert.False(t, crawler.ShouldCrawlURL(server.URL+"/private/other"))
+	assert.True(t, crawler.ShouldCrawlURL(server.URL+"/page"))
+	assert.Len(t, crawler.Blocked, 1)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fetches))
+}
+
+func TestRobotsUserAgentProductToken(t *testing.T) {
+	rules := ParseRobots(`User-agent: *
+Disallow: /private/
+
+User-agent: bot
+Disallow: /
+
+User-agent: FIRE SALAMANDER SEO ANALYZER
+Disallow: /admin/
+`)
+
+	// "bot" is not the product token of these agents, so "*" applies
+	allowed, _ := rules.Allowed("SuperBot/1.0", "https://example.com/page")
+	assert.True(t, allowed)
+	allowed, _ = rules.Allowed("Fire Salamander SEO Analyzer/1.0 (bot)", "https://example.com/page")
+	assert.True(t, allowed)
+
+	// The product token is matched case-insensitively
+	allowed, rule := rules.Allowed("Fire Salamander SEO Analyzer/1.0 (SEPTEO)", "https://example.com/admin/users")
+	assert.False(t, allowed)
+	assert.Equal(t, "Disallow: /admin/", rule)
+	allowed, _ = rules.Allowed("Bot/2.0", "https://example.com/page")
+	assert.False(t, allowed)
+}
+
+func TestRobotsSlowHostDoesNotBlockOthers(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte("User-agent: *\nDisallow: /private\n"))
+	}))
+	defer slow.Close()
+	defer close(release)
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("User-agent: *\nDisallow: /private\n"))
+	}))
+	defer fast.Close()
+
+	crawler := NewCrawler(appconfig.CrawlerConfig{
+		UserAgent:   "Test-Bot/1.0",
+		Performance: appconfig.Performance{RequestTimeout: 5 * time.Second},
+		Respect:     appconfig.Respect{RobotsTxt: true},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	slowDone := make(chan bool, 1)
+	go func() { slowDone <- crawler.allowedByRobots(ctx, slow.URL+"/page") }()
+
+	fastDone := make(chan bool, 1)
+	go func() { fastDone <- crawler.allowedByRobots(context.Background(), fast.URL+"/private/page") }()
+	select {
+	case allowed := <-fastDone:
+		assert.False(t, allowed)
+	case <-time.After(2 * time.Second):
+		t.Fatal("robots.txt lookup of a host waited for another host")
+	}
+
+	// Cancelling the crawl cancels the pending fetch
+	cancel()
+	select {
+	case <-slowDone:
+	case <-time.After(2 * time.Second):
+		t.Fatal("robots.txt fetch ignored the crawl context")
+	}
+}
+
+func TestCrawlDelayWithoutRobotsRules(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("User-agent: *\nDisallow: /\nCrawl-delay: 3\n"))
+	}))
+	defer server.Close()
+
+	crawler := NewCrawler(appconfig.CrawlerConfig{
+		UserAgent:   "Test-Bot/1.0",
+		Performance: appconfig.Performance{RequestTimeout: 5 * time.Second},
+		Respect:     appconfig.Respect{CrawlDelay: true},
+	})
+
+	// The rules are ignored, the delay is not
+	assert.True(t, crawler.shouldCrawl(context.Background(), server.URL+"/page"))
+	limiter := crawler.politeness.hosts[hostOf(server.URL)]
+	require.NotNil(t, limiter)
+	assert.InDelta(t, 1.0/3, limiter.configured, 0.001)
+}
@@ -0,0 +1,144 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+
+	"firesalamander/internal/constants"
+)
+
+// The scheduler is a pool of workers sharing the frontier under c.mutex.
+// c.inflight doubles as the set of reserved MaxURLs slots: a task holds a
+// slot from dispatch until its page is stored or it fails, so the crawl
+// never returns more than MaxURLs pages and never fewer while URLs remain.
+// The crawl ends when the frontier is empty and no task is in flight,
+// since only in-flight tasks can discover new URLs.
+
+// enqueue adds a task unless its URL was already scheduled. URLs are marked
+// visited here rather than when fetched so the frontier never holds
+// duplicates. Caller holds c.mutex.
+func (c *Crawler) enqueue(task CrawlTask) {
+	key := c.normalizer.Normalize(task.URL)
+	if c.isVisited(key) {
+		return
+	}
+	c.markVisited(key)
+	// Listed URLs and the seed are fetched whatever their shape
+	if !c.listMode && task.URL != c.seedURL && c.traps.quarantine(task.URL) {
+		return
+	}
+	c.Queue.Push(task)
+	c.cond.Broadcast()
+}
+
+// queueSitemap queues the sitemap entries not queued yet, below the links of
+// the seed. Entries the links already reached are skipped. Caller holds
+// c.mutex.
+func (c *Crawler) queueSitemap() {
+	for _, entry := range c.sitemapEntries[c.sitemapQueued:] {
+		c.enqueue(CrawlTask{URL: entry.URL, Depth: 1, Parent: c.seedURL})
+	}
+	c.sitemapQueued = len(c.sitemapEntries)
+}
+
+// work runs one worker until the crawl is over
+func (c *Crawler) work(ctx context.Context) {
+	for {
+		task, ok := c.next(ctx)
+		if !ok {
+			return
+		}
+
+		if c.shouldCrawl(ctx, task.URL) && c.withinDirectoryBudget(task) {
+			if err := c.crawlPage(ctx, task); err != nil {
+				fmt.Printf("Error crawling %s: %v\n", task.URL, err)
+			}
+		}
+		c.finish(task)
+	}
+}
+
+// next blocks until a task can be dispatched, and reports false once the
+// crawl is over: frontier drained, MaxURLs reached, budget exhausted or
+// context cancelled
+func (c *Crawler) next(ctx context.Context) (CrawlTask, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for {
+		// An exhausted budget ends the crawl like a cancellation
+		if ctx.Err() != nil || c.stoppedBy != "" {
+			return CrawlTask{}, false
+		}
+
+		// A list mode crawl fetches its whole list
+		if !c.listMode && len(c.Results)+len(c.inflight) >= c.Config.Limits.MaxURLs {
+			// Failed fetches give their slot back, so wait for the outcome
+			if len(c.inflight) == 0 {
+				return CrawlTask{}, false
+			}
+			c.cond.Wait()
+			continue
+		}
+
+		if c.held == nil {
+			task, ok := c.Queue.Pop()
+			if !ok {
+				// A seed that produced no page still lets the sitemap in
+				if len(c.inflight) == 0 && c.sitemapQueued < len(c.sitemapEntries) {
+					c.queueSitemap()
+					continue
+				}
+				if len(c.inflight) == 0 {
+					return CrawlTask{}, false
+				}
+				c.cond.Wait()
+				continue
+			}
+			c.held = &task
+		}
+		task := *c.held
+
+		if !c.RespectDepthLimit(task.Depth) {
+			c.held = nil
+			continue
+		}
+
+		// Breadth-first crawls finish a level before starting the next, so
+		// a capped crawl keeps the shallowest pages
+		if c.strictBFS() && c.levelBusy(task.Depth) {
+			c.cond.Wait()
+			continue
+		}
+
+		c.held = nil
+		c.inflight[task.URL] = task
+		if task.Depth > c.maxDepthReached {
+			c.maxDepthReached = task.Depth
+		}
+		return task, true
+	}
+}
+
+// finish releases the slot of a task whose fetch produced no page, and wakes
+// up the workers waiting for the frontier to change
+func (c *Crawler) finish(task CrawlTask) {
+	c.mutex.Lock()
+	delete(c.inflight, task.URL)
+	c.cond.Broadcast()
+	c.mutex.Unlock()
+}
+
+func (c *Crawler) strictBFS() bool {
+	return c.Config.CrawlStrategy() == constants.CrawlStrategyBFS
+}
+
+// levelBusy reports whether a shallower task is still in flight. Caller holds c.mutex.
+func (c *Crawler) levelBusy(depth int) bool {
+	for _, task := range c.inflight {
+		if task.Depth < depth {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,169 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	appconfig "firesalamander/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newSyntheticSite serves a complete tree: page n links to its children
+// n*fanout+1 ... n*fanout+fanout, down to the given number of levels.
+// Pages listed in broken answer 404.
+func newSyntheticSite(fanout, levels int, delay time.Duration, broken map[int]bool) *httptest.Server {
+	total := 0
+	for level, width := 0, 1; level <= levels; level, width = level+1, width*fanout {
+		total += width
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := 0
+		if r.URL.Path != "/" {
+			n, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/page/"))
+			if err != nil || n >= total {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			id = n
+		}
+		if broken[id] {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		time.Sleep(delay)
+
+		var links strings.Builder
+		for child := id*fanout + 1; child <= id*fanout+fanout && child < total; child++ {
+			fmt.Fprintf(&links, `<a href="/page/%d">Page %d</a>`, child, child)
+		}
+		fmt.Fprintf(w, `<html><head><title>Page %d</title></head><body>%s</body></html>`, id, links.String())
+	}))
+}
+
+func TestCrawlVisitsWholeSite(t *testing.T) {
+	server := newSyntheticSite(3, 3, time.Millisecond, nil) // 1+3+9+27 pages
+	defer server.Close()
+
+	crawler := newTestCrawler(func(cfg *appconfig.CrawlerConfig) {
+		cfg.Limits = appconfig.Limits{MaxURLs: 1000, MaxDepth: 5}
+		cfg.Performance.ConcurrentRequests = 4
+	})
+	result, err := crawler.Crawl(context.Background(), server.URL+"/", "")
+	require.NoError(t, err)
+
+	assert.Len(t, result.Pages, 40)
+	assert.Equal(t, 3, result.Metadata.MaxDepthReached)
+
+	seen := make(map[string]bool)
+	for _, page := range result.Pages {
+		assert.False(t, seen[page.URL], "duplicate page %s", page.URL)
+		seen[page.URL] = true
+	}
+}
+
+func TestCrawlStopsExactlyAtMaxURLs(t *testing.T) {
+	server := newSyntheticSite(4, 3, time.Millisecond, nil)
+	defer server.Close()
+
+	for _, workers := range []int{1, 3, 8} {
+		crawler := newTestCrawler(func(cfg *appconfig.CrawlerConfig) {
+			cfg.Limits = appconfig.Limits{MaxURLs: 17, MaxDepth: 5}
+			cfg.Performance.ConcurrentRequests = workers
+		})
+		result, err := crawler.Crawl(context.Background(), server.URL+"/", "")
+		require.NoError(t, err)
+		assert.Len(t, result.Pages, 17, "workers=%d", workers)
+		assert.Equal(t, 17, result.Metadata.TotalPages)
+	}
+}
+
+func TestCrawlRefillsSlotsOfFailedPages(t *testing.T) {
+	// Half of the first level is broken; the crawl fills the cap from deeper pages
+	server := newSyntheticSite(4, 2, time.Millisecond, map[int]bool{1: true, 2: true})
+	defer server.Close()
+
+	crawler := newTestCrawler(func(cfg *appconfig.CrawlerConfig) {
+		cfg.Limits = appconfig.Limits{MaxURLs: 10, MaxDepth: 5}
+		cfg.Performance.ConcurrentRequests = 4
+	})
+	result, err := crawler.Crawl(context.Background(), server.URL+"/", "")
+	require.NoError(t, err)
+	assert.Len(t, result.Pages, 10)
+}
+
+func TestCrawlKeepsStrictBFSOrder(t *testing.T) {
+	server := newSyntheticSite(5, 2, 5*time.Millisecond, nil)
+	defer server.Close()
+
+	// Root plus the whole first level fits in the cap: no second level page
+	// may take the place of a first level one
+	crawler := newTestCrawler(func(cfg *appconfig.CrawlerConfig) {
+		cfg.Limits = appconfig.Limits{MaxURLs: 6, MaxDepth: 5}
+		cfg.Performance.ConcurrentRequests = 8
+	})
+	result, err := crawler.Crawl(context.Background(), server.URL+"/", "")
+	require.NoError(t, err)
+	require.Len(t, result.Pages, 6)
+
+	lastDepth := 0
+	for _, page := range result.Pages {
+		assert.LessOrEqual(t, page.Depth, 1, page.URL)
+		assert.GreaterOrEqual(t, page.Depth, lastDepth)
+		lastDepth = page.Depth
+	}
+}
+
+func TestCrawlStopsOnCancel(t *testing.T) {
+	server := newSyntheticSite(3, 4, 20*time.Millisecond, nil)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		crawler := newTestCrawler(func(cfg *appconfig.CrawlerConfig) {
+			cfg.Limits = appconfig.Limits{MaxURLs: 1000, MaxDepth: 5}
+			cfg.Performance.ConcurrentRequests = 2
+		})
+		_, _ = crawler.Crawl(ctx, server.URL+"/", "")
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("crawl did not stop after cancellation")
+	}
+}
+
+func BenchmarkCrawlSyntheticSite(b *testing.B) {
+	server := newSyntheticSite(5, 3, 0, nil) // 156 pages
+	defer server.Close()
+
+	for _, workers := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				crawler := newTestCrawler(func(cfg *appconfig.CrawlerConfig) {
+					cfg.Limits = appconfig.Limits{MaxURLs: 1000, MaxDepth: 5}
+					cfg.Performance.ConcurrentRequests = workers
+				})
+				result, err := crawler.Crawl(context.Background(), server.URL+"/", "")
+				if err != nil {
+					b.Fatal(err)
+				}
+				if len(result.Pages) != 156 {
+					b.Fatalf("crawled %d pages, want 156", len(result.Pages))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package crawler
+
+import (
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"firesalamander/internal/config"
+)
+
+// ExcludedURL records a URL skipped because of an exclusion or scope rule
+type ExcludedURL struct {
+	URL  string `json:"url"`
+	Rule string `json:"rule"`
+}
+
+// urlRule is a compiled include/exclude pattern. Rules starting with "re:"
+// are regexes matched against the full URL; rules containing "*" are globs
+// matched against the whole path and query, or the whole URL when they
+// contain a scheme; anything else is a plain substring of the URL.
+type urlRule struct {
+	raw     string
+	re      *regexp.Regexp
+	fullURL bool
+}
+
+// compileURLRules compiles rules, skipping invalid regexes (LoadCrawlerConfig
+// already rejects them)
+func compileURLRules(rules []string) []urlRule {
+	compiled := make([]urlRule, 0, len(rules))
+	for _, raw := range rules {
+		rule := urlRule{raw: raw}
+		if expr, ok := strings.CutPrefix(raw, "re:"); ok {
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				continue
+			}
+			rule.re, rule.fullURL = re, true
+		} else if strings.Contains(raw, "*") {
+			rule.re = globToRegexp(raw)
+			rule.fullURL = strings.Contains(raw, "://")
+		}
+		compiled = append(compiled, rule)
+	}
+	return compiled
+}
+
+// globToRegexp turns a glob into an anchored regex where "*" matches any
+// sequence of characters, slashes included
+func globToRegexp(glob string) *regexp.Regexp {
+	parts := strings.Split(glob, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	return regexp.MustCompile("^" + strings.Join(parts, ".*") + "$")
+}
+
+func (r urlRule) match(urlStr string) bool {
+	if r.re == nil {
+		return strings.Contains(urlStr, r.raw)
+	}
+	if r.fullURL {
+		return r.re.MatchString(urlStr)
+	}
+
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return false
+	}
+	target := u.EscapedPath()
+	if u.RawQuery != "" {
+		target += "?" + u.RawQuery
+	}
+	return r.re.MatchString(target)
+}
+
+// scopeRules holds the compiled exclusion and scope rules of a crawler
+type scopeRules struct {
+	patterns          []urlRule
+	include           []urlRule
+	exclude           []urlRule
+	includeSubdomains bool
+}
+
+func newScopeRules(cfg config.CrawlerConfig) *scopeRules {
+	return &scopeRules{
+		patterns:          compileURLRules(cfg.Exclusions.Patterns),
+		include:           compileURLRules(cfg.Scope.Include),
+		exclude:           compileURLRules(cfg.Scope.Exclude),
+		includeSubdomains: cfg.Scope.IncludeSubdomains,
+	}
+}
+
+// excludedBy returns the rule excluding urlStr, or "" when it may be crawled.
+// The seed is never rejected by include rules, otherwise a crawl restricted to
+// a section could not start from the home page.
+func (s *scopeRules) excludedBy(urlStr string, extensions []string, seed bool) string {
+	path := strings.ToLower(urlStr)
+	if u, err := url.Parse(urlStr); err == nil {
+		path = strings.ToLower(u.Path)
+	}
+	for _, ext := range extensions {
+		if strings.HasSuffix(urlStr, ext) || strings.HasSuffix(path, strings.ToLower(ext)) {
+			return "extension: " + ext
+		}
+	}
+
+	for _, rule := range s.patterns {
+		if rule.match(urlStr) {
+			return "pattern: " + rule.raw
+		}
+	}
+	for _, rule := range s.exclude {
+		if rule.match(urlStr) {
+			return "exclude: " + rule.raw
+		}
+	}
+
+	if len(s.include) == 0 || seed {
+		return ""
+	}
+	for _, rule := range s.include {
+		if rule.match(urlStr) {
+			return ""
+		}
+	}
+	return "include: no include rule matched"
+}
+
+// hostInScope reports whether host belongs to the crawl. Without subdomains
+// only the root host itself is in scope; with them, any host under the root
+// host minus its "www." prefix is.
+func (s *scopeRules) hostInScope(host, root string) bool {
+	if strings.EqualFold(host, root) {
+		return true
+	}
+	if !s.includeSubdomains || host == "" || root == "" {
+		return false
+	}
+
+	domain := strings.TrimPrefix(strings.ToLower(stripPort(root)), "www.")
+	hostname := strings.ToLower(stripPort(host))
+	return hostname == domain || strings.HasSuffix(hostname, "."+domain)
+}
+
+func stripPort(host string) string {
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		return hostname
+	}
+	return host
+}
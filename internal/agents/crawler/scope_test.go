@@ -0,0 +1,106 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	appconfig "firesalamander/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestURLRuleMatch(t *testing.T) {
+	tests := []struct {
+		rule     string
+		url      string
+		expected bool
+		name     string
+	}{
+		{"/admin/", "https://example.com/admin/users", true, "substring"},
+		{"/blog/*", "https://example.com/blog/2024/post", true, "glob crosses slashes"},
+		{"/blog/*", "https://example.com/news/blog/post", false, "glob anchored on path"},
+		{"*/print", "https://example.com/a/b/print", true, "glob suffix"},
+		{"/search*", "https://example.com/search?q=seo", true, "glob covers query"},
+		{"https://shop.example.com/*", "https://shop.example.com/cart", true, "glob on full URL"},
+		{`re:/p/\d+$`, "https://example.com/p/42", true, "regex"},
+		{`re:/p/\d+$`, "https://example.com/p/42/reviews", false, "regex no match"},
+		{"?sort=", "https://example.com/list?sort=asc", true, "question mark is literal"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := compileURLRules([]string{tt.rule})
+			assert.Equal(t, tt.expected, rules[0].match(tt.url))
+		})
+	}
+}
+
+func TestShouldCrawlReportsRule(t *testing.T) {
+	crawler := NewCrawler(appconfig.CrawlerConfig{
+		Exclusions: appconfig.Exclusions{
+			Extensions: []string{".pdf"},
+			Patterns:   []string{"/admin/"},
+		},
+		Scope: appconfig.Scope{
+			Include: []string{"/blog/*", "re:^https://example\\.com/$"},
+			Exclude: []string{"*/tag/*"},
+		},
+	})
+
+	assert.True(t, crawler.shouldCrawl(context.Background(), "https://example.com/"))
+	assert.True(t, crawler.shouldCrawl(context.Background(), "https://example.com/blog/post"))
+	assert.False(t, crawler.shouldCrawl(context.Background(), "https://example.com/files/doc.PDF"))
+	assert.False(t, crawler.shouldCrawl(context.Background(), "https://example.com/admin/panel"))
+	assert.False(t, crawler.shouldCrawl(context.Background(), "https://example.com/blog/tag/seo"))
+	assert.False(t, crawler.shouldCrawl(context.Background(), "https://example.com/shop"))
+
+	assert.Equal(t, []ExcludedURL{
+		{URL: "https://example.com/files/doc.PDF", Rule: "extension: .pdf"},
+		{URL: "https://example.com/admin/panel", Rule: "pattern: /admin/"},
+		{URL: "https://example.com/blog/tag/seo", Rule: "exclude: */tag/*"},
+		{URL: "https://example.com/shop", Rule: "include: no include rule matched"},
+	}, crawler.Excluded)
+}
+
+func TestHostInScope(t *testing.T) {
+	strict := newScopeRules(appconfig.CrawlerConfig{})
+	assert.True(t, strict.hostInScope("example.com", "example.com"))
+	assert.False(t, strict.hostInScope("blog.example.com", "example.com"))
+
+	subdomains := newScopeRules(appconfig.CrawlerConfig{Scope: appconfig.Scope{IncludeSubdomains: true}})
+	assert.True(t, subdomains.hostInScope("blog.example.com", "www.example.com"))
+	assert.True(t, subdomains.hostInScope("example.com:8080", "www.example.com"))
+	assert.False(t, subdomains.hostInScope("notexample.com", "example.com"))
+	assert.False(t, subdomains.hostInScope("example.org", "example.com"))
+}
+
+func TestCrawlKeepsIncludeScopeAndReportsExclusions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><head><title>Page</title></head><body>
+			<a href="/blog/one">One</a><a href="/blog/two?PHPSESSID=x">Two</a>
+			<a href="/shop/item">Item</a></body></html>`)
+	}))
+	defer server.Close()
+
+	crawler := NewCrawler(appconfig.CrawlerConfig{
+		UserAgent:     "Test-Bot/1.0",
+		Limits:        appconfig.Limits{MaxURLs: 10, MaxDepth: 2},
+		Performance:   appconfig.Performance{ConcurrentRequests: 2, RequestTimeout: 5 * time.Second},
+		Scope:         appconfig.Scope{Include: []string{"/blog/*"}},
+		Normalization: appconfig.Normalization{StripSessionParams: true},
+	})
+
+	result, err := crawler.Crawl(context.Background(), server.URL, "")
+	require.NoError(t, err)
+
+	urls := make([]string, 0, len(result.Pages))
+	for _, page := range result.Pages {
+		urls = append(urls, page.URL)
+	}
+	assert.ElementsMatch(t, []string{server.URL + "/", server.URL + "/blog/one", server.URL + "/blog/two"}, urls)
+	assert.Equal(t, []ExcludedURL{{URL: server.URL + "/shop/item", Rule: "include: no include rule matched"}}, result.Excluded)
+}
@@ -0,0 +1,251 @@
+package crawler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxSitemapSize is the uncompressed size limit from sitemaps.org
+	maxSitemapSize = 50 * 1024 * 1024
+	// maxSitemapFiles bounds how many sitemap files one crawl will read
+	maxSitemapFiles = 50
+	// maxSitemapIndexDepth bounds nested sitemap indexes
+	maxSitemapIndexDepth = 3
+)
+
+// SitemapEntry is a URL listed in an XML sitemap
+type SitemapEntry struct {
+	URL        string  `json:"url"`
+	LastMod    string  `json:"lastmod,omitempty"`
+	Priority   float64 `json:"priority,omitempty"`
+	ChangeFreq string  `json:"changefreq,omitempty"`
+	Source     string  `json:"source"`
+}
+
+type xmlURLSet struct {
+	XMLName xml.Name `xml:"urlset"`
+	URLs    []struct {
+		Loc        string `xml:"loc"`
+		LastMod    string `xml:"lastmod"`
+		Priority   string `xml:"priority"`
+		ChangeFreq string `xml:"changefreq"`
+	} `xml:"url"`
+}
+
+type xmlSitemapIndex struct {
+	XMLName  xml.Name `xml:"sitemapindex"`
+	Sitemaps []struct {
+		Loc string `xml:"loc"`
+	} `xml:"sitemap"`
+}
+
+// ParseSitemap parses a sitemap or a sitemap index. It returns the URL
+// entries of a urlset, or the child sitemap locations of an index.
+func ParseSitemap(data []byte, source string) ([]SitemapEntry, []string, error) {
+	data, err := gunzipIfNeeded(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var root struct {
+		XMLName xml.Name
+	}
+	if err := xml.Unmarshal(data, &root); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse sitemap %s: %w", source, err)
+	}
+
+	switch root.XMLName.Local {
+	case "urlset":
+		var set xmlURLSet
+		if err := xml.Unmarshal(data, &set); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse urlset %s: %w", source, err)
+		}
+		entries := make([]SitemapEntry, 0, len(set.URLs))
+		for _, u := range set.URLs {
+			loc := strings.TrimSpace(u.Loc)
+			if loc == "" {
+				continue
+			}
+			entry := SitemapEntry{
+				URL:        loc,
+				LastMod:    strings.TrimSpace(u.LastMod),
+				ChangeFreq: strings.TrimSpace(u.ChangeFreq),
+				Source:     source,
+			}
+			if p, err := strconv.ParseFloat(strings.TrimSpace(u.Priority), 64); err == nil {
+				entry.Priority = p
+			}
+			entries = append(entries, entry)
+		}
+		return entries, nil, nil
+
+	case "sitemapindex":
+		var index xmlSitemapIndex
+		if err := xml.Unmarshal(data, &index); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse sitemap index %s: %w", source, err)
+		}
+		children := make([]string, 0, len(index.Sitemaps))
+		for _, s := range index.Sitemaps {
+			if loc := strings.TrimSpace(s.Loc); loc != "" {
+				children = append(children, loc)
+			}
+		}
+		return nil, children, nil
+
+	default:
+		return nil, nil, fmt.Errorf("unexpected sitemap root <%s> in %s", root.XMLName.Local, source)
+	}
+}
+
+// gunzipIfNeeded decompresses gzipped sitemaps, detected by their magic bytes
+func gunzipIfNeeded(data []byte) ([]byte, error) {
+	if len(data) < 2 || data[0] != 0x1f || data[1] != 0x8b {
+		return data, nil
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open gzipped sitemap: %w", err)
+	}
+	defer func() { _ = reader.Close() }()
+
+	return io.ReadAll(io.LimitReader(reader, maxSitemapSize))
+}
+
+// DiscoverSitemaps finds the sitemaps of the site hosting seedURL, from the
+// robots.txt Sitemap lines or /sitemap.xml, and returns every URL they list
+// in the seed's scope. Sitemap indexes are followed.
+func (c *Crawler) DiscoverSitemaps(ctx context.Context, seedURL string) ([]SitemapEntry, error) {
+	seed, err := url.Parse(seedURL)
+	if err != nil || seed.Host == "" {
+		return nil, fmt.Errorf("invalid seed URL %q", seedURL)
+	}
+	root := seed.Scheme + "://" + seed.Host
+	seedHost := hostOf(c.normalizer.Normalize(seedURL))
+
+	var pending []string
+	if rules, err := c.robotsFor(ctx, seedURL); err == nil {
+		pending = append(pending, rules.Sitemaps...)
+	}
+	if len(pending) == 0 {
+		pending = []string{root + "/sitemap.xml"}
+	}
+
+	return c.readSitemaps(ctx, pending, seedHost)
+}
+
+// ListFromSitemap returns the URLs listed by one sitemap, or by the sitemaps
+// of an index, on the sitemap's own host. It feeds list mode crawls.
+func (c *Crawler) ListFromSitemap(ctx context.Context, sitemapURL string) ([]SitemapEntry, error) {
+	u, err := url.Parse(sitemapURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid sitemap URL %q", sitemapURL)
+	}
+	return c.readSitemaps(ctx, []string{sitemapURL}, hostOf(c.normalizer.Normalize(sitemapURL)))
+}
+
+// readSitemaps fetches the pending sitemaps, following indexes, and keeps the
+// entries in scope of host
+func (c *Crawler) readSitemaps(ctx context.Context, pending []string, host string) ([]SitemapEntry, error) {
+	type sitemapRef struct {
+		url   string
+		depth int
+	}
+	queue := make([]sitemapRef, 0, len(pending))
+	for _, p := range pending {
+		queue = append(queue, sitemapRef{url: p})
+	}
+
+	seenSitemaps := make(map[string]bool)
+	seenURLs := make(map[string]bool)
+	entries := make([]SitemapEntry, 0)
+	var firstErr error
+
+	for len(queue) > 0 && len(seenSitemaps) < maxSitemapFiles {
+		ref := queue[0]
+		queue = queue[1:]
+		if seenSitemaps[ref.url] {
+			continue
+		}
+		seenSitemaps[ref.url] = true
+
+		data, err := c.fetchSitemap(ctx, ref.url)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		found, children, err := ParseSitemap(data, ref.url)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		for _, entry := range found {
+			entry.URL = c.normalizer.Clean(entry.URL)
+			key := c.normalizer.Normalize(entry.URL)
+			u, err := url.Parse(key)
+			if err != nil || !c.scope.hostInScope(u.Host, host) {
+				continue
+			}
+			if seenURLs[key] {
+				continue
+			}
+			seenURLs[key] = true
+			entries = append(entries, entry)
+		}
+
+		if ref.depth < maxSitemapIndexDepth {
+			for _, child := range children {
+				queue = append(queue, sitemapRef{url: child, depth: ref.depth + 1})
+			}
+		}
+	}
+
+	if len(entries) == 0 && firstErr != nil {
+		return entries, firstErr
+	}
+	return entries, nil
+}
+
+func (c *Crawler) fetchSitemap(ctx context.Context, sitemapURL string) ([]byte, error) {
+	req, err := c.newRequest(ctx, "GET", sitemapURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sitemap request: %w", err)
+	}
+
+	if err := c.politeness.Wait(ctx, req.URL.Host); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", sitemapURL, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("HTTP %d for %s", resp.StatusCode, sitemapURL)
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, maxSitemapSize))
+}
+
+// applySitemapEntry copies sitemap hints onto a crawled page
+func applySitemapEntry(page *PageData, entry SitemapEntry) {
+	page.InSitemap = true
+	page.SitemapLastMod = entry.LastMod
+	page.SitemapPriority = entry.Priority
+}
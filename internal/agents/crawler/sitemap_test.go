@@ -0,0 +1,212 @@
+package crawler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	appconfig "firesalamander/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSitemap(t *testing.T) {
+	t.Run("urlset", func(t *testing.T) {
+		data := []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+	<url><loc>https://example.com/</loc><lastmod>2025-01-01</lastmod><priority>1.0</priority></url>
+	<url><loc> https://example.com/about </loc><changefreq>monthly</changefreq></url>
+	<url><loc></loc></url>
+</urlset>`)
+
+		entries, children, err := ParseSitemap(data, "test.xml")
+		require.NoError(t, err)
+		assert.Empty(t, children)
+		require.Len(t, entries, 2)
+		assert.Equal(t, "https://example.com/", entries[0].URL)
+		assert.Equal(t, "2025-01-01", entries[0].LastMod)
+		assert.Equal(t, 1.0, entries[0].Priority)
+		assert.Equal(t, "https://example.com/about", entries[1].URL)
+		assert.Equal(t, "monthly", entries[1].ChangeFreq)
+		assert.Equal(t, "test.xml", entries[1].Source)
+	})
+
+	t.Run("sitemap index", func(t *testing.T) {
+		data := []byte(`<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+	<sitemap><loc>https://example.com/sitemap-1.xml</loc></sitemap>
+	<sitemap><loc>https://example.com/sitemap-2.xml.gz</loc></sitemap>
+</sitemapindex>`)
+
+		entries, children, err := ParseSitemap(data, "index.xml")
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+		assert.Equal(t, []string{"https://example.com/sitemap-1.xml", "https://example.com/sitemap-2.xml.gz"}, children)
+	})
+
+	t.Run("gzipped", func(t *testing.T) {
+		data := gzipBytes(t, `<urlset><url><loc>https://example.com/gz</loc></url></urlset>`)
+
+		entries, _, err := ParseSitemap(data, "test.xml.gz")
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, "https://example.com/gz", entries[0].URL)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, _, err := ParseSitemap([]byte("<html></html>"), "bad.xml")
+		assert.Error(t, err)
+	})
+}
+
+func TestDiscoverSitemaps(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			w.Write([]byte("User-agent: *\nDisallow:\nSitemap: " + server.URL + "/sitemap_index.xml\n"))
+		case "/sitemap_index.xml":
+			w.Write([]byte(`<sitemapindex>
+				<sitemap><loc>` + server.URL + `/pages.xml</loc></sitemap>
+				<sitemap><loc>` + server.URL + `/products.xml.gz</loc></sitemap>
+			</sitemapindex>`))
+		case "/pages.xml":
+			w.Write([]byte(`<urlset>
+				<url><loc>` + server.URL + `/about/</loc><lastmod>2025-03-01</lastmod></url>
+				<url><loc>https://other.com/page</loc></url>
+			</urlset>`))
+		case "/products.xml.gz":
+			w.Write(gzipBytes(t, `<urlset>
+				<url><loc>`+server.URL+`/orphan</loc><priority>0.8</priority></url>
+				<url><loc>`+server.URL+`/about</loc></url>
+			</urlset>`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	crawler := NewCrawler(appconfig.CrawlerConfig{UserAgent: "Test-Bot/1.0"})
+
+	entries, err := crawler.DiscoverSitemaps(context.Background(), server.URL)
+	require.NoError(t, err)
+
+	// External URLs are dropped and duplicates collapse after normalization
+	require.Len(t, entries, 2)
+	assert.Equal(t, server.URL+"/about", entries[0].URL)
+	assert.Equal(t, "2025-03-01", entries[0].LastMod)
+	assert.Equal(t, server.URL+"/orphan", entries[1].URL)
+	assert.Equal(t, 0.8, entries[1].Priority)
+}
+
+func TestDiscoverSitemapsFallback(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/sitemap.xml" {
+			w.Write([]byte(`<urlset><url><loc>` + server.URL + `/from-default</loc></url></urlset>`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	crawler := NewCrawler(appconfig.CrawlerConfig{UserAgent: "Test-Bot/1.0"})
+
+	entries, err := crawler.DiscoverSitemaps(context.Background(), server.URL)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, server.URL+"/from-default", entries[0].URL)
+}
+
+func TestCrawlSeedsFromSitemap(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sitemap.xml":
+			w.Write([]byte(`<urlset><url><loc>` + server.URL + `/orphan</loc><lastmod>2025-05-05</lastmod><priority>0.3</priority></url></urlset>`))
+		case "/", "/orphan":
+			w.Write([]byte("<html><head><title>Page</title></head><body></body></html>"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	crawler := NewCrawler(appconfig.CrawlerConfig{
+		UserAgent:   "Test-Bot/1.0",
+		Limits:      appconfig.Limits{MaxURLs: 10, MaxDepth: 2},
+		Performance: appconfig.Performance{ConcurrentRequests: 1, RequestTimeout: 5 * time.Second},
+		Respect:     appconfig.Respect{Sitemap: true},
+	})
+
+	result, err := crawler.Crawl(context.Background(), server.URL, "")
+	require.NoError(t, err)
+
+	assert.True(t, result.Metadata.SitemapFound)
+	require.Len(t, result.Sitemap, 1)
+
+	var orphan *PageData
+	for i := range result.Pages {
+		if result.Pages[i].URL == server.URL+"/orphan" {
+			orphan = &result.Pages[i]
+		}
+	}
+	require.NotNil(t, orphan, "sitemap URL should be crawled")
+	assert.True(t, orphan.InSitemap)
+	assert.Equal(t, "2025-05-05", orphan.SitemapLastMod)
+	assert.Equal(t, 0.3, orphan.SitemapPriority)
+}
+
+func TestCrawlQueuesSitemapAfterSeedLinks(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sitemap.xml":
+			urls := ""
+			for i := 0; i < 20; i++ {
+				urls += fmt.Sprintf("<url><loc>%s/listed-%d</loc></url>", server.URL, i)
+			}
+			w.Write([]byte("<urlset>" + urls + "</urlset>"))
+		case "/":
+			w.Write([]byte(`<html><body><a href="/linked">Linked</a></body></html>`))
+		case "/robots.txt":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.Write([]byte("<html><head><title>Page</title></head><body></body></html>"))
+		}
+	}))
+	defer server.Close()
+
+	crawler := NewCrawler(appconfig.CrawlerConfig{
+		UserAgent:   "Test-Bot/1.0",
+		Limits:      appconfig.Limits{MaxURLs: 3, MaxDepth: 2},
+		Performance: appconfig.Performance{ConcurrentRequests: 1, RequestTimeout: 5 * time.Second},
+		Respect:     appconfig.Respect{Sitemap: true},
+	})
+
+	result, err := crawler.Crawl(context.Background(), server.URL, "")
+	require.NoError(t, err)
+
+	// A large sitemap does not take the budget from the seed's links
+	require.Len(t, result.Pages, 3)
+	urls := make([]string, 0, len(result.Pages))
+	for _, page := range result.Pages {
+		urls = append(urls, page.URL)
+	}
+	assert.Contains(t, urls, server.URL+"/linked")
+	assert.Len(t, result.Sitemap, 20)
+}
+
+func gzipBytes(t *testing.T, content string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	_, err := writer.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	return buf.Bytes()
+}
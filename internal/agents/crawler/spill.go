@@ -0,0 +1,251 @@
+package crawler
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// spillPath returns the directory holding the frontier segments and visited
+// URLs moved out of memory, creating it on first use. Caller holds c.mutex.
+func (c *Crawler) spillPath() (string, error) {
+	if c.spillDir != "" {
+		return c.spillDir, nil
+	}
+
+	base := c.Config.Memory.SpillDir
+	if base == "" {
+		base = c.outputDir
+	}
+	if base != "" {
+		if err := os.MkdirAll(base, 0755); err != nil {
+			return "", err
+		}
+	}
+	dir, err := os.MkdirTemp(base, "spill-")
+	if err != nil {
+		return "", err
+	}
+	c.spillDir = dir
+	return dir, nil
+}
+
+// removeSpill deletes what the crawl moved to disk. Caller holds c.mutex.
+func (c *Crawler) removeSpill() {
+	if f, ok := c.Queue.(*spillFrontier); ok {
+		f.close()
+	}
+	if c.visitedSpill != nil {
+		c.visitedSpill.close()
+		c.visitedSpill = nil
+	}
+	if c.spillDir != "" {
+		_ = os.RemoveAll(c.spillDir)
+		c.spillDir = ""
+	}
+}
+
+// releaseSpill deletes what the crawl moved to disk once it is over
+func (c *Crawler) releaseSpill() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.removeSpill()
+}
+
+// spillFrontier keeps at most limit tasks in the frontier it wraps and
+// queues the others, in order, in segment files. Segments are reloaded
+// oldest first as the frontier drains, so a breadth-first crawl keeps its
+// order while smart sampling applies to the tasks in memory.
+type spillFrontier struct {
+	inner Frontier
+	limit int
+	dir   func() (string, error)
+
+	// segments are the sealed segment files, oldest first. New tasks go to
+	// the tail segment while any task is spilled.
+	segments  []frontierSegment
+	tail      *os.File
+	tailBuf   *bufio.Writer
+	tailCount int
+	spilled   int
+	sequence  int
+	failed    bool
+	// tailMutex guards the tail flush of concurrent checkpoints, which
+	// only hold the crawler's read lock
+	tailMutex sync.Mutex
+}
+
+type frontierSegment struct {
+	path  string
+	count int
+}
+
+func newSpillFrontier(inner Frontier, limit int, dir func() (string, error)) *spillFrontier {
+	return &spillFrontier{inner: inner, limit: limit, dir: dir}
+}
+
+// segmentSize is the number of tasks per segment. Half the limit lets a
+// segment be reloaded as soon as the frontier is half empty.
+func (f *spillFrontier) segmentSize() int {
+	return positiveOr(f.limit/2, 1)
+}
+
+func (f *spillFrontier) Push(task CrawlTask) {
+	if !f.failed && (f.spilled > 0 || f.inner.Len() >= f.limit) {
+		err := f.spill(task)
+		if err == nil {
+			return
+		}
+		// The frontier still works, it just stops saving memory
+		fmt.Printf("Warning: failed to spill the frontier, keeping it in memory: %v\n", err)
+		f.failed = true
+		f.reloadAll()
+	}
+	f.inner.Push(task)
+}
+
+func (f *spillFrontier) Pop() (CrawlTask, bool) {
+	if f.spilled > 0 && f.inner.Len() <= f.limit/2 {
+		f.reload()
+	}
+	return f.inner.Pop()
+}
+
+func (f *spillFrontier) Len() int {
+	return f.inner.Len() + f.spilled
+}
+
+// Tasks reads the spilled tasks back after those in memory
+func (f *spillFrontier) Tasks() []CrawlTask {
+	tasks := f.inner.Tasks()
+	f.tailMutex.Lock()
+	defer f.tailMutex.Unlock()
+	if f.tail != nil {
+		if err := f.tailBuf.Flush(); err != nil {
+			fmt.Printf("Warning: failed to flush frontier segment: %v\n", err)
+		}
+	}
+	segments := f.segments
+	if f.tail != nil {
+		segments = append(segments[:len(segments):len(segments)], frontierSegment{path: f.tail.Name(), count: f.tailCount})
+	}
+	for _, s := range segments {
+		segment, err := readSegment(s.path)
+		if err != nil {
+			fmt.Printf("Warning: failed to read frontier segment: %v\n", err)
+		}
+		tasks = append(tasks, segment...)
+	}
+	return tasks
+}
+
+func (f *spillFrontier) Seen(urlStr string) {
+	f.inner.Seen(urlStr)
+}
+
+func (f *spillFrontier) spill(task CrawlTask) error {
+	if f.tail == nil {
+		dir, err := f.dir()
+		if err != nil {
+			return err
+		}
+		f.sequence++
+		file, err := os.Create(filepath.Join(dir, fmt.Sprintf("frontier-%06d.jsonl", f.sequence)))
+		if err != nil {
+			return err
+		}
+		f.tail, f.tailBuf, f.tailCount = file, bufio.NewWriter(file), 0
+	}
+
+	data, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+	if _, err := f.tailBuf.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	f.tailCount++
+	f.spilled++
+	if f.tailCount >= f.segmentSize() {
+		// The task is in the segment, a failure shows when it is reloaded
+		if err := f.seal(); err != nil {
+			fmt.Printf("Warning: failed to write frontier segment: %v\n", err)
+		}
+	}
+	return nil
+}
+
+// seal closes the tail segment so it can be reloaded
+func (f *spillFrontier) seal() error {
+	err := f.tailBuf.Flush()
+	if closeErr := f.tail.Close(); err == nil {
+		err = closeErr
+	}
+	f.segments = append(f.segments, frontierSegment{path: f.tail.Name(), count: f.tailCount})
+	f.tail, f.tailBuf = nil, nil
+	return err
+}
+
+// reload moves the oldest segment back into memory
+func (f *spillFrontier) reload() {
+	if len(f.segments) == 0 && f.tail != nil {
+		if err := f.seal(); err != nil {
+			fmt.Printf("Warning: failed to write frontier segment: %v\n", err)
+		}
+	}
+	if len(f.segments) == 0 {
+		return
+	}
+
+	segment := f.segments[0]
+	f.segments = f.segments[1:]
+	f.spilled -= segment.count
+	tasks, err := readSegment(segment.path)
+	if err != nil {
+		fmt.Printf("Warning: failed to read frontier segment, %d URLs lost: %v\n", segment.count-len(tasks), err)
+	}
+	_ = os.Remove(segment.path)
+	for _, task := range tasks {
+		f.inner.Push(task)
+	}
+}
+
+// reloadAll moves every spilled task back into memory
+func (f *spillFrontier) reloadAll() {
+	for len(f.segments) > 0 || f.tail != nil {
+		f.reload()
+	}
+}
+
+// close drops the spilled tasks, once the crawl is over
+func (f *spillFrontier) close() {
+	if f.tail != nil {
+		_ = f.tail.Close()
+		f.tail, f.tailBuf = nil, nil
+	}
+	f.segments = nil
+	f.spilled = 0
+}
+
+func readSegment(path string) ([]CrawlTask, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+
+	var tasks []CrawlTask
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var task CrawlTask
+		if err := json.Unmarshal(scanner.Bytes(), &task); err != nil {
+			return tasks, err
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, scanner.Err()
+}
@@ -0,0 +1,192 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	appconfig "firesalamander/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpillFrontierKeepsOrder(t *testing.T) {
+	dir := t.TempDir()
+	inner := &bfsFrontier{}
+	frontier := newSpillFrontier(inner, 10, func() (string, error) { return dir, nil })
+	defer frontier.close()
+
+	task := func(i int) CrawlTask {
+		return CrawlTask{URL: fmt.Sprintf("https://example.com/%d", i), Depth: 1}
+	}
+	for i := 0; i < 100; i++ {
+		frontier.Push(task(i))
+		assert.LessOrEqual(t, inner.Len(), 10)
+	}
+	assert.Equal(t, 100, frontier.Len())
+
+	tasks := frontier.Tasks()
+	require.Len(t, tasks, 100)
+	for i, queued := range tasks {
+		assert.Equal(t, task(i), queued)
+	}
+
+	// Pops and pushes interleave without breaking the FIFO order
+	next := 100
+	for i := 0; i < 150; i++ {
+		popped, ok := frontier.Pop()
+		require.True(t, ok)
+		assert.Equal(t, task(i), popped)
+		assert.LessOrEqual(t, inner.Len(), 10)
+		if i%2 == 0 {
+			frontier.Push(task(next))
+			next++
+		}
+	}
+	for i := 150; i < next; i++ {
+		popped, ok := frontier.Pop()
+		require.True(t, ok)
+		assert.Equal(t, task(i), popped)
+	}
+	_, ok := frontier.Pop()
+	assert.False(t, ok)
+	assert.Equal(t, 0, frontier.Len())
+}
+
+func TestVisitedURLsMoveToDisk(t *testing.T) {
+	c := newTestCrawler(func(cfg *appconfig.CrawlerConfig) {
+		cfg.Limits = appconfig.Limits{MaxURLs: 1000, MaxDepth: 3}
+		cfg.Memory.VisitedURLs = 100
+	})
+	c.outputDir = t.TempDir()
+	defer c.removeSpill()
+
+	for i := 0; i < 5000; i++ {
+		c.markVisited(fmt.Sprintf("https://example.com/page/%d", i))
+	}
+	assert.Less(t, len(c.Visited), 100)
+	require.NotNil(t, c.visitedSpill)
+
+	for i := 0; i < 5000; i++ {
+		require.True(t, c.isVisited(fmt.Sprintf("https://example.com/page/%d", i)), "page %d forgotten", i)
+	}
+	for i := 0; i < 5000; i++ {
+		require.False(t, c.isVisited(fmt.Sprintf("https://example.com/other/%d", i)), "other %d taken for visited", i)
+	}
+	// Spills are merged into a logarithmic number of runs
+	assert.LessOrEqual(t, len(c.visitedSpill.runs), 7)
+}
+
+func TestBloomFilterFalsePositiveRate(t *testing.T) {
+	filter := newBloomFilter(10000)
+	for i := 0; i < 10000; i++ {
+		filter.add(urlFingerprint(fmt.Sprintf("https://example.com/%d", i)))
+	}
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if filter.mayContain(urlFingerprint(fmt.Sprintf("https://example.org/%d", i))) {
+			falsePositives++
+		}
+	}
+	assert.Less(t, falsePositives, 200)
+}
+
+func TestCrawlWithBoundedMemory(t *testing.T) {
+	server := newSyntheticSite(3, 3, time.Millisecond, nil) // 1+3+9+27 pages
+	defer server.Close()
+
+	reference, err := newTestCrawler(func(cfg *appconfig.CrawlerConfig) {
+		cfg.Limits = appconfig.Limits{MaxURLs: 1000, MaxDepth: 5}
+		cfg.Performance.ConcurrentRequests = 4
+	}).Crawl(context.Background(), server.URL+"/", t.TempDir())
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	crawler := newTestCrawler(func(cfg *appconfig.CrawlerConfig) {
+		cfg.Limits = appconfig.Limits{MaxURLs: 1000, MaxDepth: 5}
+		cfg.Performance.ConcurrentRequests = 4
+		cfg.Memory = appconfig.Memory{FrontierURLs: 4, VisitedURLs: 8, LeanPages: true}
+	})
+	result, err := crawler.Crawl(context.Background(), server.URL+"/", dir)
+	require.NoError(t, err)
+
+	urls, referenceURLs := pageURLs(result), pageURLs(reference)
+	sort.Strings(urls)
+	sort.Strings(referenceURLs)
+	assert.Equal(t, referenceURLs, urls)
+	assert.True(t, result.Metadata.LeanPages)
+	for _, page := range result.Pages {
+		assert.Empty(t, page.Content)
+		assert.Empty(t, page.Anchors)
+		assert.Empty(t, page.OutgoingLinks)
+		assert.Empty(t, page.IncomingLinks)
+		assert.Empty(t, page.Assets)
+		assert.Empty(t, page.Robots.Declarations)
+		assert.NotZero(t, page.StatusCode)
+	}
+
+	// pages.jsonl holds the whole pages, with their link counts
+	streamed, err := ReadCrawlResult(dir)
+	require.NoError(t, err)
+	require.Len(t, streamed.Pages, 40)
+	for _, page := range streamed.Pages {
+		assert.NotEmpty(t, page.Title)
+		for _, anchor := range page.Anchors {
+			assert.NotEmpty(t, anchor.Text)
+			assert.NotEmpty(t, anchor.URL)
+		}
+		assert.Len(t, page.OutgoingLinks, page.UniqueOutlinks)
+		if page.URL != server.URL+"/" {
+			assert.Equal(t, 1, page.UniqueInlinks, page.URL)
+		}
+	}
+
+	spilled, err := filepath.Glob(filepath.Join(dir, "spill-*"))
+	require.NoError(t, err)
+	assert.Empty(t, spilled)
+}
+
+func TestResumeRestoresLeanPageText(t *testing.T) {
+	server := newTestSite(checkpointTestPages)
+	defer server.Close()
+
+	seed := server.URL + "/"
+	auditDir := t.TempDir()
+
+	// The interrupted run streamed its pages in full
+	stale, err := newPageWriter(auditDir)
+	require.NoError(t, err)
+	require.NoError(t, stale.WritePage(PageData{URL: seed, Title: "/", Content: "Texte complet"}))
+	require.NoError(t, stale.WritePage(PageData{URL: server.URL + "/a", Content: "Après le point de reprise"}))
+
+	writer := newTestCrawler(checkpointEveryPage)
+	writer.outputDir = auditDir
+	writer.seedURL = seed
+	writer.runStart = time.Now()
+	writer.markVisited(seed)
+	writer.markVisited(server.URL + "/a")
+	writer.inflight = map[string]CrawlTask{}
+	writer.Queue.Push(CrawlTask{URL: server.URL + "/a", Depth: 1, Parent: seed})
+	writer.Results = []PageData{leanPage(PageData{URL: seed, Title: "/", Content: "Texte complet"})}
+	require.NoError(t, writer.saveCheckpoint())
+
+	resumer := newTestCrawler(checkpointEveryPage)
+	resumer.Config.Memory.LeanPages = true
+	_, err = resumer.Resume(context.Background(), auditDir)
+	require.NoError(t, err)
+
+	streamed, err := ReadCrawlResult(auditDir)
+	require.NoError(t, err)
+	contents := make(map[string]string)
+	for _, page := range streamed.Pages {
+		contents[page.URL] = page.Content
+	}
+	assert.Equal(t, map[string]string{seed: "Texte complet", server.URL + "/a": "Page"}, contents)
+	assert.NoFileExists(t, filepath.Join(auditDir, pagesFileName+".prev"))
+	_, err = os.Stat(filepath.Join(auditDir, pagesFileName))
+	assert.NoError(t, err)
+}
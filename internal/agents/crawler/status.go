@@ -0,0 +1,34 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// ErrBlockedByRobots is returned for URLs robots.txt disallows to the crawler
+var ErrBlockedByRobots = errors.New("blocked by robots.txt")
+
+// TargetStatus checks a URL the crawl did not fetch, such as an hreflang
+// alternate, the way the crawler would: robots.txt is honoured and requests
+// carry its user agent and wait for the host's turn. A HEAD request is tried
+// first. finalURL is where redirects ended, the target itself when none.
+func (c *Crawler) TargetStatus(ctx context.Context, target string) (status int, finalURL string, err error) {
+	if c.Config.Respect.RobotsTxt {
+		rules, _ := c.robotsFor(ctx, target)
+		if allowed, _ := rules.Allowed(c.Config.UserAgent, target); !allowed {
+			return 0, "", ErrBlockedByRobots
+		}
+	}
+
+	resp, err := c.requestAsset(ctx, http.MethodHead, target)
+	if err == nil && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented) {
+		_ = resp.Body.Close()
+		resp, err = c.requestAsset(ctx, http.MethodGet, target)
+	}
+	if err != nil {
+		return 0, "", err
+	}
+	_ = resp.Body.Close()
+	return resp.StatusCode, resp.Request.URL.String(), nil
+}
@@ -0,0 +1,389 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// pagesFileName is the streamed page output in the audit directory. Each line
+// is a JSON record holding one page, and the last line of a finished crawl
+// is a trailer with the metadata.
+const pagesFileName = "pages.jsonl"
+
+// CrawlTrailer closes pages.jsonl with everything but the pages
+type CrawlTrailer struct {
+	BlockedURLs []BlockedURL     `json:"blocked_urls"`
+	Redirects   []RedirectRecord `json:"redirects"`
+	Excluded    []ExcludedURL    `json:"excluded_urls"`
+	Traps       []CrawlTrap      `json:"traps,omitempty"`
+	Assets      []Asset          `json:"assets,omitempty"`
+	Sitemap     []SitemapEntry   `json:"sitemap"`
+	Metadata    Metadata         `json:"metadata"`
+}
+
+// pageRecord is one line of pages.jsonl
+type pageRecord struct {
+	Page    *PageData     `json:"page,omitempty"`
+	Trailer *CrawlTrailer `json:"trailer,omitempty"`
+}
+
+// pageWriter appends pages to pages.jsonl as they complete. Every record is
+// flushed on its own so a crash loses at most the line being written.
+type pageWriter struct {
+	mutex sync.Mutex
+	file  *os.File
+}
+
+// newPageWriter creates pages.jsonl in outputDir, replacing any previous one
+func newPageWriter(outputDir string) (*pageWriter, error) {
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.Create(filepath.Join(outputDir, pagesFileName))
+	if err != nil {
+		return nil, err
+	}
+	return &pageWriter{file: file}, nil
+}
+
+func (w *pageWriter) WritePage(page PageData) error {
+	return w.write(pageRecord{Page: &page})
+}
+
+// Close writes the trailer and closes the file
+func (w *pageWriter) Close(trailer CrawlTrailer) error {
+	err := w.write(pageRecord{Trailer: &trailer})
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Rewrite replaces the streamed pages with pages, then closes the file with
+// the trailer. The link graph pass uses it once every page is complete.
+func (w *pageWriter) Rewrite(pages []PageData, trailer CrawlTrailer) error {
+	return w.replace(trailer, func(out *pageWriter) error {
+		for _, page := range pages {
+			if err := out.WritePage(page); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RewriteLean is Rewrite for lean pages, whose text and lists are read back
+// from the streamed records, their links being resolved by resolve.
+// Pages are written in the order they were streamed.
+func (w *pageWriter) RewriteLean(pages []PageData, trailer CrawlTrailer, resolve func(page *PageData)) error {
+	streamed, err := os.Open(w.file.Name())
+	if err != nil {
+		_ = w.file.Close()
+		return err
+	}
+	reader := NewPageReader(streamed)
+	defer func() { _ = reader.Close() }()
+
+	return w.replace(trailer, func(out *pageWriter) error {
+		pending := make(map[string]int, len(pages))
+		for i, page := range pages {
+			pending[page.URL] = i
+		}
+		for reader.Next() {
+			full := reader.Page()
+			i, ok := pending[full.URL]
+			if !ok {
+				continue
+			}
+			delete(pending, full.URL)
+			page := pages[i]
+			restoreLean(&page, full)
+			resolve(&page)
+			if err := out.WritePage(page); err != nil {
+				return err
+			}
+		}
+		if err := reader.Err(); err != nil {
+			return err
+		}
+		for _, page := range pages {
+			if _, ok := pending[page.URL]; ok {
+				if err := out.WritePage(page); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// each calls fn with every page streamed so far
+func (w *pageWriter) each(fn func(page PageData)) error {
+	streamed, err := os.Open(w.file.Name())
+	if err != nil {
+		return err
+	}
+	reader := NewPageReader(streamed)
+	defer func() { _ = reader.Close() }()
+	for reader.Next() {
+		fn(reader.Page())
+	}
+	return reader.Err()
+}
+
+// replace writes the pages produced by fill and the trailer to a temporary
+// file, then renames it over pages.jsonl. A crash while rewriting leaves the
+// streamed pages in place. The writer is closed either way.
+func (w *pageWriter) replace(trailer CrawlTrailer, fill func(out *pageWriter) error) error {
+	path := w.file.Name()
+	tmp, err := os.Create(path + ".tmp")
+	if err != nil {
+		_ = w.file.Close()
+		return err
+	}
+	out := &pageWriter{file: tmp}
+
+	err = fill(out)
+	if err == nil {
+		err = out.write(pageRecord{Trailer: &trailer})
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (w *pageWriter) write(record pageRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode page record: %w", err)
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	_, err = w.file.Write(append(data, '\n'))
+	return err
+}
+
+// PageReader iterates over the pages of a crawl without loading them all:
+//
+//	for reader.Next() {
+//		page := reader.Page()
+//	}
+//	if err := reader.Err(); err != nil { ... }
+type PageReader struct {
+	file    *os.File
+	reader  *bufio.Reader
+	page    PageData
+	trailer *CrawlTrailer
+	err     error
+}
+
+// OpenPageReader opens the pages.jsonl written in auditDir
+func OpenPageReader(auditDir string) (*PageReader, error) {
+	file, err := os.Open(filepath.Join(auditDir, pagesFileName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open crawl pages: %w", err)
+	}
+	return NewPageReader(file), nil
+}
+
+// NewPageReader reads pages.jsonl records from r. It takes ownership of r
+// when r is an *os.File.
+func NewPageReader(r io.Reader) *PageReader {
+	file, _ := r.(*os.File)
+	return &PageReader{file: file, reader: bufio.NewReader(r)}
+}
+
+// Next advances to the next page and reports false at the end of the pages
+// or on error. A last line cut short by a crash is ignored.
+func (r *PageReader) Next() bool {
+	for r.err == nil {
+		line, err := r.reader.ReadBytes('\n')
+		if err == io.EOF {
+			return false
+		}
+		if err != nil {
+			r.err = err
+			return false
+		}
+
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		var record pageRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			r.err = fmt.Errorf("failed to parse crawl page: %w", err)
+			return false
+		}
+		if record.Trailer != nil {
+			r.trailer = record.Trailer
+			continue
+		}
+		if record.Page != nil {
+			r.page = *record.Page
+			return true
+		}
+	}
+	return false
+}
+
+// Page returns the page read by the last call to Next
+func (r *PageReader) Page() PageData {
+	return r.page
+}
+
+// Trailer returns the crawl trailer once all pages are read, or nil when the
+// crawl did not finish writing
+func (r *PageReader) Trailer() *CrawlTrailer {
+	return r.trailer
+}
+
+// Err returns the first error met by Next
+func (r *PageReader) Err() error {
+	return r.err
+}
+
+// Close closes the underlying file
+func (r *PageReader) Close() error {
+	if r.file == nil {
+		return nil
+	}
+	return r.file.Close()
+}
+
+// ReadCrawlResult loads a whole crawl back from pages.jsonl, along with the
+// records.jsonl of a lean crawl. Prefer a PageReader for large crawls.
+func ReadCrawlResult(auditDir string) (*CrawlResult, error) {
+	reader, err := OpenPageReader(auditDir)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = reader.Close() }()
+
+	result := &CrawlResult{Pages: make([]PageData, 0)}
+	for reader.Next() {
+		result.Pages = append(result.Pages, reader.Page())
+	}
+	if err := reader.Err(); err != nil {
+		return nil, err
+	}
+	if trailer := reader.Trailer(); trailer != nil {
+		result.BlockedURLs = trailer.BlockedURLs
+		result.Redirects = trailer.Redirects
+		result.Excluded = trailer.Excluded
+		result.Traps = trailer.Traps
+		result.Assets = trailer.Assets
+		result.Sitemap = trailer.Sitemap
+		result.Metadata = trailer.Metadata
+	}
+	if err := readCrawlRecords(auditDir, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// indexFileName is the crawl result written as a single JSON document
+const indexFileName = "crawl_index.json"
+
+// saveIndex writes crawl_index.json from the pages streamed to pages.jsonl,
+// so the index never holds more than one page in memory
+func saveIndex(result *CrawlResult, outputDir string) error {
+	reader, err := OpenPageReader(outputDir)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = reader.Close() }()
+
+	return writeCrawlIndex(outputDir, result, func(yield func(PageData) error) error {
+		for reader.Next() {
+			if err := yield(reader.Page()); err != nil {
+				return err
+			}
+		}
+		return reader.Err()
+	})
+}
+
+// writeCrawlIndex writes crawl_index.json with the pages yielded by each in
+// place of result.Pages. The document is the one json.Encoder would write
+// for the whole result, built one page at a time.
+func writeCrawlIndex(outputDir string, result *CrawlResult, each func(yield func(PageData) error) error) error {
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return err
+	}
+	path := filepath.Join(outputDir, indexFileName)
+	file, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+
+	_, _ = w.WriteString("{\n  \"pages\": [")
+	count := 0
+	err = each(func(page PageData) error {
+		data, err := json.MarshalIndent(page, "    ", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode page: %w", err)
+		}
+		if count > 0 {
+			_ = w.WriteByte(',')
+		}
+		count++
+		_, _ = w.WriteString("\n    ")
+		_, err = w.Write(data)
+		return err
+	})
+	if err == nil {
+		if count > 0 {
+			_, _ = w.WriteString("\n  ")
+		}
+		err = writeIndexTail(w, result)
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(file.Name())
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// writeIndexTail closes the pages array and writes the other result fields
+func writeIndexTail(w *bufio.Writer, result *CrawlResult) error {
+	// The shallower Pages field hides the embedded one and is left empty
+	tail := struct {
+		*CrawlResult
+		Pages []PageData `json:"pages,omitempty"`
+	}{CrawlResult: result}
+	data, err := json.MarshalIndent(tail, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode crawl result: %w", err)
+	}
+	_, _ = w.WriteString("],\n")
+	_, _ = w.Write(bytes.TrimPrefix(data, []byte("{\n")))
+	_, err = w.WriteString("\n")
+	return err
+}
@@ -0,0 +1,158 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	appconfig "firesalamander/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPageWriterAndReader(t *testing.T) {
+	dir := t.TempDir()
+
+	writer, err := newPageWriter(dir)
+	require.NoError(t, err)
+	require.NoError(t, writer.WritePage(PageData{URL: "https://example.com/", Title: "Home"}))
+	require.NoError(t, writer.WritePage(PageData{URL: "https://example.com/a", Depth: 1}))
+	require.NoError(t, writer.Close(CrawlTrailer{Metadata: Metadata{TotalPages: 2}}))
+
+	reader, err := OpenPageReader(dir)
+	require.NoError(t, err)
+	defer reader.Close()
+
+	var urls []string
+	for reader.Next() {
+		urls = append(urls, reader.Page().URL)
+	}
+	require.NoError(t, reader.Err())
+	assert.Equal(t, []string{"https://example.com/", "https://example.com/a"}, urls)
+	require.NotNil(t, reader.Trailer())
+	assert.Equal(t, 2, reader.Trailer().Metadata.TotalPages)
+}
+
+func TestPageReaderToleratesInterruptedWrite(t *testing.T) {
+	// A crash mid-write leaves a partial last line and no trailer
+	input := `{"page":{"url":"https://example.com/"}}` + "\n" + `{"page":{"url":"https://exa`
+
+	reader := NewPageReader(strings.NewReader(input))
+	require.True(t, reader.Next())
+	assert.Equal(t, "https://example.com/", reader.Page().URL)
+	assert.False(t, reader.Next())
+	assert.NoError(t, reader.Err())
+	assert.Nil(t, reader.Trailer())
+}
+
+func TestPageReaderReportsCorruptLines(t *testing.T) {
+	reader := NewPageReader(strings.NewReader("not json\n"))
+	assert.False(t, reader.Next())
+	assert.Error(t, reader.Err())
+}
+
+func TestFailedRewriteKeepsStreamedPages(t *testing.T) {
+	dir := t.TempDir()
+
+	writer, err := newPageWriter(dir)
+	require.NoError(t, err)
+	require.NoError(t, writer.WritePage(PageData{URL: "https://example.com/"}))
+
+	// A rewrite that fails halfway must not lose what was streamed
+	err = writer.replace(CrawlTrailer{}, func(out *pageWriter) error {
+		require.NoError(t, out.WritePage(PageData{URL: "https://example.com/", Inlinks: 1}))
+		return os.ErrClosed
+	})
+	assert.ErrorIs(t, err, os.ErrClosed)
+	assert.NoFileExists(t, filepath.Join(dir, pagesFileName+".tmp"))
+
+	result, err := ReadCrawlResult(dir)
+	require.NoError(t, err)
+	require.Len(t, result.Pages, 1)
+	assert.Equal(t, 0, result.Pages[0].Inlinks)
+}
+
+func TestCrawlIndexIsStreamedFromPages(t *testing.T) {
+	dir := t.TempDir()
+
+	writer, err := newPageWriter(dir)
+	require.NoError(t, err)
+	require.NoError(t, writer.WritePage(PageData{URL: "https://example.com/", Title: "Home"}))
+	require.NoError(t, writer.Close(CrawlTrailer{}))
+
+	// The index reads its pages from pages.jsonl, not from the result
+	result := &CrawlResult{Metadata: Metadata{TotalPages: 1}}
+	require.NoError(t, saveIndex(result, dir))
+
+	data, err := os.ReadFile(filepath.Join(dir, indexFileName))
+	require.NoError(t, err)
+	var saved CrawlResult
+	require.NoError(t, json.Unmarshal(data, &saved))
+	require.Len(t, saved.Pages, 1)
+	assert.Equal(t, "Home", saved.Pages[0].Title)
+	assert.Equal(t, 1, saved.Metadata.TotalPages)
+}
+
+func TestCrawlStreamsPages(t *testing.T) {
+	server := newSyntheticSite(2, 2, 0, nil) // 7 pages
+	defer server.Close()
+
+	dir := t.TempDir()
+	result, err := newTestCrawler(func(cfg *appconfig.CrawlerConfig) {
+		cfg.Limits = appconfig.Limits{MaxURLs: 100, MaxDepth: 5}
+		cfg.Performance.ConcurrentRequests = 3
+	}).Crawl(context.Background(), server.URL+"/", dir)
+	require.NoError(t, err)
+
+	streamed, err := ReadCrawlResult(dir)
+	require.NoError(t, err)
+	assert.Len(t, streamed.Pages, 7)
+	assert.Equal(t, result.Metadata.TotalPages, streamed.Metadata.TotalPages)
+	assert.Equal(t, result.Metadata.Strategy, streamed.Metadata.Strategy)
+
+	// Pages are on disk while the crawl runs, not only once it is over
+	info, err := os.Stat(filepath.Join(dir, pagesFileName))
+	require.NoError(t, err)
+	assert.Greater(t, info.Size(), int64(0))
+}
+
+func TestResumeRewritesStreamedPages(t *testing.T) {
+	server := newTestSite(checkpointTestPages)
+	defer server.Close()
+
+	seed := server.URL + "/"
+	auditDir := t.TempDir()
+
+	// pages.jsonl of the interrupted run holds a page the checkpoint missed
+	stale, err := newPageWriter(auditDir)
+	require.NoError(t, err)
+	require.NoError(t, stale.WritePage(PageData{URL: seed}))
+	require.NoError(t, stale.WritePage(PageData{URL: server.URL + "/a"}))
+
+	writer := newTestCrawler(checkpointEveryPage)
+	writer.outputDir = auditDir
+	writer.seedURL = seed
+	writer.runStart = time.Now()
+	writer.markVisited(seed)
+	writer.markVisited(server.URL + "/a")
+	writer.inflight = map[string]CrawlTask{}
+	writer.Queue.Push(CrawlTask{URL: server.URL + "/a", Depth: 1, Parent: seed})
+	writer.Results = []PageData{{URL: seed, Title: "/"}}
+	require.NoError(t, writer.saveCheckpoint())
+
+	_, err = newTestCrawler(checkpointEveryPage).Resume(context.Background(), auditDir)
+	require.NoError(t, err)
+
+	streamed, err := ReadCrawlResult(auditDir)
+	require.NoError(t, err)
+	urls := make([]string, 0, len(streamed.Pages))
+	for _, page := range streamed.Pages {
+		urls = append(urls, page.URL)
+	}
+	assert.ElementsMatch(t, []string{seed, server.URL + "/a"}, urls)
+	assert.True(t, streamed.Metadata.Resumed)
+}
@@ -0,0 +1,493 @@
+package crawler
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"firesalamander/internal/config"
+)
+
+// Crawler trap kinds
+const (
+	TrapRepeatingPath    = "repeating_path"
+	TrapQueryExplosion   = "query_explosion"
+	TrapCalendar         = "calendar"
+	TrapDuplicateContent = "duplicate_content"
+)
+
+// Default trap thresholds, used when the configuration leaves them at zero
+const (
+	defaultMaxSegmentRepeats = 3
+	defaultMaxQueryVariants  = 50
+	defaultMaxDateVariants   = 24
+	defaultMaxDuplicates     = 10
+	maxTrapSamples           = 10
+)
+
+const (
+	// trapSimilarity is the estimated share of three-word shingles two pages
+	// have in common from which they count as the same content
+	trapSimilarity = 0.8
+	// maxContentGroups bounds the distinct contents tracked for each query
+	// pattern. A trap shows one content under many URLs, so the oldest
+	// group makes room for a new one.
+	maxContentGroups = 4
+)
+
+// maxTrackedPatterns bounds the URL patterns the detector keeps counts for,
+// in each of its maps. Past it, one pattern tracked so far is forgotten for
+// every new one, so memory stays flat on sites with endless distinct paths.
+const maxTrackedPatterns = 10000
+
+// dateValue matches a year and month or a full date written with separators,
+// as calendars put them in a path segment or a parameter: 2024-05, 2024_05_17.
+// A bare number such as 2024 or 200512 is more often an ID than a date.
+var dateValue = regexp.MustCompile(`^(19|20)\d{2}[-/_.](0?[1-9]|1[0-2])([-/_.](0?[1-9]|[12]\d|3[01]))?$`)
+
+// yearValue and monthValue match the segments of a /2024/05 style date path
+var (
+	yearValue  = regexp.MustCompile(`^(19|20)\d{2}$`)
+	monthValue = regexp.MustCompile(`^(0?[1-9]|1[0-2])$`)
+)
+
+// dateParams are parameter names holding a part of a date
+var dateParams = map[string]bool{
+	"date": true, "day": true, "month": true, "year": true, "week": true,
+	"d": true, "m": true, "y": true, "jour": true, "mois": true, "annee": true,
+}
+
+// CrawlTrap is a URL pattern the crawler stopped following because it looked
+// like a crawler trap, a waste of crawl budget
+type CrawlTrap struct {
+	Kind        string   `json:"kind"`
+	Pattern     string   `json:"pattern"`
+	Reason      string   `json:"reason"`
+	Quarantined int      `json:"quarantined"`
+	Samples     []string `json:"samples"`
+}
+
+// trapDetector spots crawler traps from the URLs discovered and the content
+// fetched, and quarantines the URLs matching a detected trap. Caller holds
+// c.mutex.
+type trapDetector struct {
+	disabled          bool
+	maxSegmentRepeats int
+	maxQueryVariants  int
+	maxDateVariants   int
+	maxDuplicates     int
+
+	facets       map[string]*facetSpace
+	dateVariants map[string]map[string]bool
+	contents     map[string][]*contentGroup
+	traps        map[string]*CrawlTrap
+	order        []string
+}
+
+func newTrapDetector(cfg config.Traps) *trapDetector {
+	return &trapDetector{
+		disabled:          cfg.Disabled,
+		maxSegmentRepeats: positiveOr(cfg.MaxSegmentRepeats, defaultMaxSegmentRepeats),
+		maxQueryVariants:  positiveOr(cfg.MaxQueryVariants, defaultMaxQueryVariants),
+		maxDateVariants:   positiveOr(cfg.MaxDateVariants, defaultMaxDateVariants),
+		maxDuplicates:     positiveOr(cfg.MaxDuplicates, defaultMaxDuplicates),
+		facets:            make(map[string]*facetSpace),
+		dateVariants:      make(map[string]map[string]bool),
+		contents:          make(map[string][]*contentGroup),
+		traps:             make(map[string]*CrawlTrap),
+	}
+}
+
+func positiveOr(value, fallback int) int {
+	if value > 0 {
+		return value
+	}
+	return fallback
+}
+
+// restore quarantines again the traps of a resumed crawl
+func (d *trapDetector) restore(traps []CrawlTrap) {
+	for _, trap := range traps {
+		d.traps[trap.Pattern] = &trap
+		d.order = append(d.order, trap.Pattern)
+	}
+}
+
+// Traps returns the detected traps in detection order
+func (d *trapDetector) Traps() []CrawlTrap {
+	traps := make([]CrawlTrap, 0, len(d.order))
+	for _, pattern := range d.order {
+		traps = append(traps, *d.traps[pattern])
+	}
+	return traps
+}
+
+// quarantine reports whether a discovered URL falls in a trap, detecting
+// new traps from it on the way
+func (d *trapDetector) quarantine(urlStr string) bool {
+	if d.disabled {
+		return false
+	}
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return false
+	}
+	return d.trapped(u, urlStr) || d.detect(u, urlStr)
+}
+
+// match reports whether a queued URL falls in a trap detected since it was
+// queued
+func (d *trapDetector) match(urlStr string) bool {
+	if d.disabled || len(d.traps) == 0 {
+		return false
+	}
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return false
+	}
+	return d.trapped(u, urlStr)
+}
+
+// trapped counts urlStr against the first known trap it matches
+func (d *trapDetector) trapped(u *url.URL, urlStr string) bool {
+	for _, pattern := range d.patterns(u) {
+		if trap, ok := d.traps[pattern]; ok {
+			trap.Quarantined++
+			trap.addSample(urlStr)
+			return true
+		}
+	}
+	return false
+}
+
+// patterns lists the trap patterns urlStr could belong to. A query made of
+// item IDs and a page number only is no facet, so no query pattern takes it.
+func (d *trapDetector) patterns(u *url.URL) []string {
+	patterns := make([]string, 0, 3)
+	if pattern, _ := d.repeatingPattern(u); pattern != "" {
+		patterns = append(patterns, pattern)
+	}
+	if u.RawQuery != "" && len(facetParams(u)) > 0 {
+		patterns = append(patterns, queryPattern(u))
+	}
+	if pattern := datePattern(u); pattern != "" {
+		patterns = append(patterns, pattern)
+	}
+	return patterns
+}
+
+// detect looks for a new trap around u and reports whether u itself is
+// quarantined by it
+func (d *trapDetector) detect(u *url.URL, urlStr string) bool {
+	if pattern, segment := d.repeatingPattern(u); pattern != "" {
+		d.flag(TrapRepeatingPath, pattern, fmt.Sprintf("path segment %q repeats %d times or more", segment, d.maxSegmentRepeats), []string{urlStr})
+		d.traps[pattern].Quarantined++
+		return true
+	}
+
+	if pattern := datePattern(u); pattern != "" {
+		if _, ok := d.dateVariants[pattern]; !ok {
+			forgetOne(d.dateVariants)
+		}
+		variants := addVariant(d.dateVariants, pattern, urlStr)
+		if len(variants) > d.maxDateVariants {
+			d.flag(TrapCalendar, pattern, fmt.Sprintf("more than %d date variants", d.maxDateVariants), sortedKeys(variants))
+			d.traps[pattern].Quarantined++
+			delete(d.dateVariants, pattern)
+			return true
+		}
+	}
+
+	if facets := facetParams(u); len(facets) > 0 {
+		pattern := queryPattern(u)
+		space, ok := d.facets[pattern]
+		if !ok {
+			forgetOne(d.facets)
+			space = &facetSpace{values: make(map[string]map[string]bool), sets: make(map[string][]string)}
+			d.facets[pattern] = space
+		}
+		space.add(facets, urlStr)
+		if space.combinations(d.maxQueryVariants) > d.maxQueryVariants {
+			d.flag(TrapQueryExplosion, pattern, fmt.Sprintf("more than %d facet combinations", d.maxQueryVariants), space.samples)
+			d.traps[pattern].Quarantined++
+			delete(d.facets, pattern)
+			return true
+		}
+	}
+	return false
+}
+
+// facetSpace is what the query strings of one path have shown of their
+// facets: the sets of parameter names used together and the values each
+// parameter takes
+type facetSpace struct {
+	values  map[string]map[string]bool
+	sets    map[string][]string
+	samples []string
+}
+
+func (s *facetSpace) add(facets url.Values, urlStr string) {
+	names := make([]string, 0, len(facets))
+	for name, values := range facets {
+		names = append(names, name)
+		for _, value := range values {
+			addVariant(s.values, name, value)
+		}
+	}
+	sort.Strings(names)
+	s.sets[strings.Join(names, "&")] = names
+	if len(s.samples) < maxTrapSamples {
+		s.samples = append(s.samples, urlStr)
+	}
+}
+
+// combinations counts the query strings the facets seen so far can build:
+// for each set of names, the product of the values of its parameters. It
+// stops counting past limit.
+func (s *facetSpace) combinations(limit int) int {
+	total := 0
+	for _, names := range s.sets {
+		product := 1
+		for _, name := range names {
+			product *= len(s.values[name])
+			if product > limit {
+				return product
+			}
+		}
+		total += product
+		if total > limit {
+			break
+		}
+	}
+	return total
+}
+
+// contentGroup is the URLs of one query pattern serving near-identical
+// content, with the fingerprint of the first of them
+type contentGroup struct {
+	fingerprint Fingerprint
+	urls        []string
+}
+
+// observePage records the content of a fetched page. When too many URLs of
+// one path differ only by their query yet serve near-identical content,
+// their query strings are a trap: facets that filter nothing, session IDs...
+// Contents are compared by similarity, so a timestamp or a counter on the
+// page does not make every variant unique.
+func (d *trapDetector) observePage(page *PageData) {
+	if d.disabled {
+		return
+	}
+	u, err := url.Parse(page.URL)
+	if err != nil || u.RawQuery == "" || len(facetParams(u)) == 0 {
+		return
+	}
+
+	pattern := queryPattern(u)
+	if _, ok := d.traps[pattern]; ok {
+		return
+	}
+	if _, ok := d.contents[pattern]; !ok {
+		forgetOne(d.contents)
+	}
+
+	fingerprint := contentFingerprint(page)
+	groups := d.contents[pattern]
+	var group *contentGroup
+	for _, g := range groups {
+		if g.fingerprint.Similarity(fingerprint) >= trapSimilarity {
+			group = g
+			break
+		}
+	}
+	if group == nil {
+		group = &contentGroup{fingerprint: fingerprint}
+		if len(groups) >= maxContentGroups {
+			groups = groups[1:]
+		}
+		groups = append(groups, group)
+		d.contents[pattern] = groups
+	}
+	group.urls = append(group.urls, page.URL)
+
+	if len(group.urls) >= d.maxDuplicates {
+		d.flag(TrapDuplicateContent, pattern, fmt.Sprintf("%d URLs with near-identical content", len(group.urls)), group.urls)
+		delete(d.contents, pattern)
+	}
+}
+
+// flag records a new trap
+func (d *trapDetector) flag(kind, pattern, reason string, samples []string) {
+	if _, ok := d.traps[pattern]; ok {
+		return
+	}
+	trap := &CrawlTrap{Kind: kind, Pattern: pattern, Reason: reason, Samples: make([]string, 0, maxTrapSamples)}
+	for _, sample := range samples {
+		trap.addSample(sample)
+	}
+	d.traps[pattern] = trap
+	d.order = append(d.order, pattern)
+}
+
+func (t *CrawlTrap) addSample(urlStr string) {
+	if len(t.Samples) >= maxTrapSamples {
+		return
+	}
+	for _, sample := range t.Samples {
+		if sample == urlStr {
+			return
+		}
+	}
+	t.Samples = append(t.Samples, urlStr)
+}
+
+// repeatingPattern returns the pattern of a path where a segment comes back
+// too often, such as /a/b/a/b/a/b, along with that segment
+func (d *trapDetector) repeatingPattern(u *url.URL) (string, string) {
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	counts := make(map[string]int, len(segments))
+	for _, segment := range segments {
+		if segment == "" {
+			continue
+		}
+		counts[segment]++
+		if counts[segment] >= d.maxSegmentRepeats {
+			// The pattern keeps the path up to the first occurrence
+			prefix := segments[:indexOf(segments, segment)]
+			return fmt.Sprintf("%s://%s/%s", u.Scheme, u.Host, strings.Join(append(prefix, segment+"/**"), "/")), segment
+		}
+	}
+	return "", ""
+}
+
+func indexOf(values []string, value string) int {
+	for i, v := range values {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
+
+// queryPattern stands for every query string of a path
+func queryPattern(u *url.URL) string {
+	return fmt.Sprintf("%s://%s%s?*", u.Scheme, u.Host, u.EscapedPath())
+}
+
+// datePattern returns the URL with its date parts replaced by {date}, or ""
+// when it holds no date. A year segment is a date only when a month segment
+// follows it, as in /agenda/2024/05/17, so /produit/2024 is left alone.
+func datePattern(u *url.URL) string {
+	found := false
+	segments := strings.Split(u.EscapedPath(), "/")
+	inDate := false
+	for i, segment := range segments {
+		switch {
+		case dateValue.MatchString(segment):
+			segments[i], found, inDate = "{date}", true, true
+		case yearValue.MatchString(segment) && i+1 < len(segments) && monthValue.MatchString(segments[i+1]):
+			segments[i], found, inDate = "{date}", true, true
+		case inDate && len(segment) <= 2 && isNumber(segment):
+			segments[i] = "{date}"
+		default:
+			inDate = false
+		}
+	}
+
+	query := u.Query()
+	names := make([]string, 0, len(query))
+	for name, values := range query {
+		if len(values) > 0 && isDateParam(name, values[0]) {
+			names = append(names, name+"={date}")
+			found = true
+		} else {
+			names = append(names, name)
+		}
+	}
+	if !found {
+		return ""
+	}
+
+	pattern := fmt.Sprintf("%s://%s%s", u.Scheme, u.Host, strings.Join(segments, "/"))
+	if len(names) > 0 {
+		sort.Strings(names)
+		pattern += "?" + strings.Join(names, "&")
+	}
+	return pattern
+}
+
+// facetParams is the query of u without its page number, which grows with
+// the content rather than with combinations, and without the IDs of a
+// catalogue, one per item rather than one per filter
+func facetParams(u *url.URL) url.Values {
+	query := u.Query()
+	for _, param := range paginationParams {
+		if isNumber(query.Get(param)) {
+			query.Del(param)
+		}
+	}
+	for name := range query {
+		if isIDParam(name) {
+			query.Del(name)
+		}
+	}
+	return query
+}
+
+// isIDParam reports whether a parameter names an item, as in ?id=42,
+// ?product_id=42 or ?articleId=42
+func isIDParam(name string) bool {
+	lower := strings.ToLower(name)
+	switch {
+	case lower == "id", lower == "pid", lower == "sku":
+		return true
+	case strings.HasSuffix(lower, "_id"), strings.HasSuffix(lower, "-id"):
+		return true
+	}
+	return strings.HasSuffix(name, "Id") || strings.HasSuffix(name, "ID")
+}
+
+func isDateParam(name, value string) bool {
+	if dateValue.MatchString(value) {
+		return true
+	}
+	return dateParams[strings.ToLower(name)] && isNumber(strings.ReplaceAll(value, "-", ""))
+}
+
+// forgetOne makes room for a new pattern in tracked by dropping any one of
+// its entries once it holds maxTrackedPatterns
+func forgetOne[V any](tracked map[string]V) {
+	if len(tracked) < maxTrackedPatterns {
+		return
+	}
+	for key := range tracked {
+		delete(tracked, key)
+		return
+	}
+}
+
+func addVariant(variants map[string]map[string]bool, pattern, value string) map[string]bool {
+	set, ok := variants[pattern]
+	if !ok {
+		set = make(map[string]bool)
+		variants[pattern] = set
+	}
+	set[value] = true
+	return set
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// contentFingerprint fingerprints the visible content of a page
+func contentFingerprint(page *PageData) Fingerprint {
+	return NewFingerprint(page.Title + "\n" + page.H1 + "\n" + page.Content)
+}
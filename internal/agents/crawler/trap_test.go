@@ -0,0 +1,263 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	appconfig "firesalamander/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// trapLimits leave traps room to show up
+func trapLimits(cfg *appconfig.CrawlerConfig) {
+	cfg.Limits = appconfig.Limits{MaxURLs: 300, MaxDepth: 100}
+	cfg.Performance.ConcurrentRequests = 2
+}
+
+func TestTrapDetectorRepeatingPath(t *testing.T) {
+	detector := newTrapDetector(appconfig.Traps{})
+	assert.False(t, detector.quarantine("https://example.com/a/b/a/b"))
+	assert.True(t, detector.quarantine("https://example.com/x/a/b/a/b/a"))
+	assert.True(t, detector.quarantine("https://example.com/x/a/c/a/d/a/e"))
+
+	traps := detector.Traps()
+	require.Len(t, traps, 1)
+	assert.Equal(t, TrapRepeatingPath, traps[0].Kind)
+	assert.Equal(t, "https://example.com/x/a/**", traps[0].Pattern)
+	assert.Equal(t, 2, traps[0].Quarantined)
+}
+
+func TestTrapDetectorQueryExplosion(t *testing.T) {
+	detector := newTrapDetector(appconfig.Traps{MaxQueryVariants: 4})
+
+	// Pagination alone is not a trap
+	for page := 1; page <= 10; page++ {
+		assert.False(t, detector.quarantine(fmt.Sprintf("https://example.com/shoes?page=%d", page)))
+	}
+
+	facets := []string{"color=red", "color=blue", "color=red&size=m", "color=blue&size=m", "color=red&size=l", "size=l"}
+	var quarantined int
+	for _, facet := range facets {
+		if detector.quarantine("https://example.com/shoes?" + facet) {
+			quarantined++
+		}
+	}
+	assert.Equal(t, 2, quarantined)
+	assert.True(t, detector.match("https://example.com/shoes?color=green"))
+	assert.False(t, detector.match("https://example.com/shoes"))
+
+	traps := detector.Traps()
+	require.Len(t, traps, 1)
+	assert.Equal(t, TrapQueryExplosion, traps[0].Kind)
+	assert.Equal(t, "https://example.com/shoes?*", traps[0].Pattern)
+	assert.NotEmpty(t, traps[0].Samples)
+}
+
+func TestTrapDetectorCountsFacetCombinations(t *testing.T) {
+	detector := newTrapDetector(appconfig.Traps{MaxQueryVariants: 20})
+
+	// 3 colors, 3 sizes and 3 sort orders only show up together, but they
+	// already make 27 listings
+	colors, sizes, sorts := []string{"red", "blue", "green"}, []string{"s", "m", "l"}, []string{"asc", "desc", "new"}
+	var quarantined bool
+	for i := 0; i < 3 && !quarantined; i++ {
+		quarantined = detector.quarantine(fmt.Sprintf("https://example.com/shoes?color=%s&size=%s&sort=%s", colors[i], sizes[i], sorts[i]))
+	}
+	assert.True(t, quarantined)
+}
+
+func TestTrapDetectorIgnoresItemIDs(t *testing.T) {
+	detector := newTrapDetector(appconfig.Traps{})
+
+	// A 200-item catalogue served by one script is not a facet explosion
+	for id := 1; id <= 200; id++ {
+		assert.False(t, detector.quarantine(fmt.Sprintf("https://example.com/product.php?id=%d", id)))
+		assert.False(t, detector.quarantine(fmt.Sprintf("https://example.com/index.php?route=product/product&product_id=%d", id)))
+		assert.False(t, detector.quarantine(fmt.Sprintf("https://example.com/item?articleId=%d&lang=fr", id)))
+	}
+	assert.Empty(t, detector.Traps())
+}
+
+func TestCrawlKeepsAnIDCatalogue(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><body>`)
+		if r.URL.Path == "/" {
+			for id := 1; id <= 200; id++ {
+				fmt.Fprintf(w, `<a href="/product.php?id=%d">Item %d</a>`, id, id)
+			}
+		}
+		fmt.Fprintf(w, `<h1>%s</h1></body></html>`, r.URL.RawQuery)
+	}))
+	defer server.Close()
+
+	result, err := newTestCrawler(trapLimits).Crawl(context.Background(), server.URL+"/", "")
+	require.NoError(t, err)
+
+	assert.Empty(t, result.Traps)
+	assert.Len(t, result.Pages, 201)
+}
+
+func TestDatePattern(t *testing.T) {
+	tests := map[string]string{
+		"https://example.com/agenda/2024/05/17":        "https://example.com/agenda/{date}/{date}/{date}",
+		"https://example.com/events?month=2024-05":     "https://example.com/events?month={date}",
+		"https://example.com/cal?y=2024&m=5&view=week": "https://example.com/cal?m={date}&view&y={date}",
+		"https://example.com/products/42":              "",
+		"https://example.com/search?q=shoes":           "",
+		"https://example.com/archives/2024/05":         "https://example.com/archives/{date}/{date}",
+		"https://example.com/produit/2024":             "",
+		"https://example.com/produit/200512":           "",
+		"https://example.com/produit/2024/photos":      "",
+		"https://example.com/produit?id=200512":        "",
+	}
+	for input, expected := range tests {
+		u, err := url.Parse(input)
+		require.NoError(t, err)
+		assert.Equal(t, expected, datePattern(u), input)
+	}
+}
+
+func TestTrapDetectorIgnoresNumericProductIDs(t *testing.T) {
+	detector := newTrapDetector(appconfig.Traps{})
+
+	// Product IDs in the 1900-2099 range are not years
+	for id := 1950; id < 2050; id++ {
+		assert.False(t, detector.quarantine(fmt.Sprintf("https://example.com/produit/%d", id)))
+		assert.False(t, detector.quarantine(fmt.Sprintf("https://example.com/ref/%d%02d", id, id%12+1)))
+	}
+	assert.Empty(t, detector.Traps())
+}
+
+func TestCrawlQuarantinesCalendar(t *testing.T) {
+	// Every month links to the next one, forever
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			fmt.Fprint(w, `<html><body><a href="/calendar?month=2020-01">Agenda</a><a href="/about">About</a></body></html>`)
+			return
+		}
+		if r.URL.Path != "/calendar" {
+			fmt.Fprint(w, `<html><body>About</body></html>`)
+			return
+		}
+		month, _ := time.Parse("2006-01", r.URL.Query().Get("month"))
+		next := month.AddDate(0, 1, 0).Format("2006-01")
+		fmt.Fprintf(w, `<html><head><title>%s</title></head><body><a href="/calendar?month=%s">Next</a></body></html>`, month.Format("January 2006"), next)
+	}))
+	defer server.Close()
+
+	crawler := newTestCrawler(func(cfg *appconfig.CrawlerConfig) {
+		trapLimits(cfg)
+		cfg.Traps = appconfig.Traps{MaxDateVariants: 5}
+	})
+	result, err := crawler.Crawl(context.Background(), server.URL+"/", "")
+	require.NoError(t, err)
+
+	// Home, about and the five months before the trap was detected
+	assert.Len(t, result.Pages, 7)
+	require.Len(t, result.Traps, 1)
+	trap := result.Traps[0]
+	assert.Equal(t, TrapCalendar, trap.Kind)
+	assert.Equal(t, server.URL+"/calendar?month={date}", trap.Pattern)
+	assert.Equal(t, 1, trap.Quarantined)
+	assert.Contains(t, trap.Samples, server.URL+"/calendar?month=2020-06")
+}
+
+func TestCrawlQuarantinesDuplicateContent(t *testing.T) {
+	// Each page hands out a new session token, unknown to the normalizer, for
+	// the same content
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sid := len(r.URL.Query().Get("token")) + 1
+		fmt.Fprintf(w, `<html><head><title>Shop</title></head><body><a href="/shop?token=%s">Shop</a></body></html>`, fmt.Sprintf("%0*d", sid, 0))
+	}))
+	defer server.Close()
+
+	crawler := newTestCrawler(func(cfg *appconfig.CrawlerConfig) {
+		trapLimits(cfg)
+		cfg.Traps = appconfig.Traps{MaxDuplicates: 3}
+	})
+	result, err := crawler.Crawl(context.Background(), server.URL+"/", "")
+	require.NoError(t, err)
+
+	require.Len(t, result.Traps, 1)
+	assert.Equal(t, TrapDuplicateContent, result.Traps[0].Kind)
+	assert.Equal(t, server.URL+"/shop?*", result.Traps[0].Pattern)
+	assert.LessOrEqual(t, len(result.Pages), 6)
+}
+
+func TestTrapDetectorNearIdenticalContent(t *testing.T) {
+	detector := newTrapDetector(appconfig.Traps{MaxDuplicates: 3})
+
+	// The same listing under every sort order, each with its own timestamp
+	// and item counter
+	listing := "Lampes de bureau en laiton, liseuses et appliques murales livrées montées, garanties deux ans et expédiées sous quarante-huit heures depuis notre atelier. " +
+		"Chaque modèle existe en trois finitions et accepte les ampoules LED de toutes puissances, avec un interrupteur tactile à trois niveaux. " +
+		"Les abat-jour en lin se remplacent sans outil, les pieds lestés tiennent sur les bureaux étroits et les bras articulés éclairent les plans de travail."
+	for i, sort := range []string{"asc", "desc", "new"} {
+		detector.observePage(&PageData{
+			URL:     "https://example.com/lamps?sort=" + sort,
+			Title:   "Lamps",
+			Content: fmt.Sprintf("Updated 10:0%d. %d items. %s", i, 40+i, listing),
+		})
+	}
+
+	traps := detector.Traps()
+	require.Len(t, traps, 1)
+	assert.Equal(t, TrapDuplicateContent, traps[0].Kind)
+	assert.Equal(t, "https://example.com/lamps?*", traps[0].Pattern)
+}
+
+func TestTrapDetectorKeepsItemsAndPagesOfATrappedPath(t *testing.T) {
+	detector := newTrapDetector(appconfig.Traps{MaxQueryVariants: 2})
+	for _, facet := range []string{"color=red", "color=blue", "color=green"} {
+		detector.quarantine("https://example.com/catalogue?" + facet)
+	}
+	require.Len(t, detector.Traps(), 1)
+
+	// The facets are quarantined, the items and listing pages are not
+	assert.True(t, detector.match("https://example.com/catalogue?color=black"))
+	assert.False(t, detector.match("https://example.com/catalogue?id=42"))
+	assert.False(t, detector.match("https://example.com/catalogue?product_id=42"))
+	assert.False(t, detector.match("https://example.com/catalogue?page=3"))
+	assert.False(t, detector.quarantine("https://example.com/catalogue?page=4"))
+}
+
+func TestCrawlTrapsDisabled(t *testing.T) {
+	server := newSyntheticSite(2, 1, 0, nil)
+	defer server.Close()
+
+	crawler := newTestCrawler(func(cfg *appconfig.CrawlerConfig) {
+		trapLimits(cfg)
+		cfg.Traps = appconfig.Traps{Disabled: true, MaxSegmentRepeats: 1}
+	})
+	result, err := crawler.Crawl(context.Background(), server.URL+"/", "")
+	require.NoError(t, err)
+	assert.Len(t, result.Pages, 3)
+	assert.Empty(t, result.Traps)
+}
+
+func TestTrapDetectorBoundsTrackedPatterns(t *testing.T) {
+	detector := newTrapDetector(appconfig.Traps{})
+	for i := 0; i < maxTrackedPatterns+100; i++ {
+		detector.quarantine(fmt.Sprintf("https://example.com/list-%d?color=red", i))
+		detector.quarantine(fmt.Sprintf("https://example.com/archive-%d?date=2024-05", i))
+		detector.observePage(&PageData{URL: fmt.Sprintf("https://example.com/item-%d?color=red", i), Title: "Item"})
+	}
+	assert.Len(t, detector.facets, maxTrackedPatterns)
+	assert.Len(t, detector.dateVariants, maxTrackedPatterns)
+	assert.Len(t, detector.contents, maxTrackedPatterns)
+
+	// New patterns are still tracked past the cap
+	for day := 1; day <= defaultMaxDateVariants+1; day++ {
+		detector.quarantine(fmt.Sprintf("https://example.com/calendar/2024-%02d-%02d", day%12+1, day%28+1))
+	}
+	traps := detector.Traps()
+	require.Len(t, traps, 1)
+	assert.Equal(t, TrapCalendar, traps[0].Kind)
+	assert.NotContains(t, detector.dateVariants, traps[0].Pattern)
+}
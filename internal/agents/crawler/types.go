@@ -50,28 +50,110 @@ type PageData struct {
 	OutgoingLinks []string          `json:"outgoing_links"`
 	IncomingLinks []string          `json:"incoming_links"`
 	Content       string            `json:"content"`
+
+	// Content holds the main content of the page, BoilerplateContent the
+	// navigation, footers and banners left out of it
+	BoilerplateContent string `json:"boilerplate_content"`
+
+	InSitemap       bool    `json:"in_sitemap"`
+	SitemapLastMod  string  `json:"sitemap_lastmod,omitempty"`
+	SitemapPriority float64 `json:"sitemap_priority,omitempty"`
+
+	StatusCode  int               `json:"status_code"`
+	Headers     map[string]string `json:"headers"`
+	ContentType string            `json:"content_type"`
+	BodySize    int64             `json:"body_size"`
+	TTFBMs      int64             `json:"ttfb_ms"`
+	DownloadMs  int64             `json:"download_ms"`
+	HTMLRef     string            `json:"html_ref,omitempty"`
+	RawHTML     string            `json:"-"`
+
+	FinalURL      string        `json:"final_url"`
+	FromCache     bool          `json:"from_cache"`
+	// BodyTruncated means the body exceeded Budgets.MaxBodyBytes and only
+	// its beginning was read
+	BodyTruncated bool `json:"body_truncated,omitempty"`
+	RedirectChain []RedirectHop `json:"redirect_chain,omitempty"`
+
+	Hreflang []HreflangLink `json:"hreflang,omitempty"`
+
+	DeclaredCharset  string   `json:"declared_charset,omitempty"`
+	DetectedCharset  string   `json:"detected_charset,omitempty"`
+	CharsetConflicts []string `json:"charset_conflicts,omitempty"`
+
+	Robots             RobotsDirectives `json:"robots"`
+	Indexable          bool             `json:"indexable"`
+	IndexabilityReason string           `json:"indexability_reason,omitempty"`
+
+	// Internal link graph, filled once the crawl is over. Inlinks and
+	// Outlinks count every anchor, the unique counts distinct pages.
+	Inlinks        int `json:"inlinks"`
+	UniqueInlinks  int `json:"unique_inlinks"`
+	Outlinks       int `json:"outlinks"`
+	UniqueOutlinks int `json:"unique_outlinks"`
+	LinkDepth      int `json:"link_depth"`
+
+	Assets []AssetRef `json:"assets,omitempty"`
 }
 
 type Anchor struct {
 	Text string `json:"text"`
 	Href string `json:"href"`
+	// Rel is the rel attribute of the link, such as "nofollow ugc"
+	Rel string `json:"rel,omitempty"`
+	// URL is the resolved, normalized internal target, empty for external
+	// links. It is set by the link graph pass at the end of the crawl.
+	URL string `json:"url,omitempty"`
+}
+
+// NoFollow reports whether the link itself carries rel="nofollow"
+func (a Anchor) NoFollow() bool {
+	return hasRel(a.Rel, "nofollow")
 }
 
 type CrawlResult struct {
-	Pages    []PageData `json:"pages"`
-	Metadata Metadata   `json:"metadata"`
+	Pages       []PageData       `json:"pages"`
+	BlockedURLs []BlockedURL     `json:"blocked_urls"`
+	Redirects   []RedirectRecord `json:"redirects"`
+	Excluded    []ExcludedURL    `json:"excluded_urls"`
+	Sitemap     []SitemapEntry   `json:"sitemap"`
+	Discovered  []string         `json:"discovered_urls,omitempty"`
+	Traps       []CrawlTrap      `json:"traps,omitempty"`
+	Assets      []Asset          `json:"assets,omitempty"`
+	Metadata    Metadata         `json:"metadata"`
 }
 
 type Metadata struct {
-	TotalPages      int  `json:"total_pages"`
-	MaxDepthReached int  `json:"max_depth_reached"`
-	DurationMs      int  `json:"duration_ms"`
-	RobotsRespected bool `json:"robots_respected"`
-	SitemapFound    bool `json:"sitemap_found"`
+	Mode            string  `json:"mode"`
+	TotalPages      int     `json:"total_pages"`
+	MaxDepthReached int     `json:"max_depth_reached"`
+	DurationMs      int     `json:"duration_ms"`
+	RobotsRespected bool    `json:"robots_respected"`
+	SitemapFound    bool    `json:"sitemap_found"`
+	Resumed         bool    `json:"resumed"`
+	Strategy        string  `json:"strategy"`
+	CacheHits       int     `json:"cache_hits"`
+	CacheMisses     int     `json:"cache_misses"`
+	CacheHitRatio   float64 `json:"cache_hit_ratio"`
+	// LeanPages means the pages of the result carry only their summary,
+	// the rest being read from pages.jsonl, links.jsonl and records.jsonl
+	LeanPages bool `json:"lean_pages,omitempty"`
+	// BytesDownloaded counts the page and asset bodies read from the
+	// network, cached pages aside
+	BytesDownloaded int64 `json:"bytes_downloaded"`
+	// Partial means a budget stopped the crawl before its frontier was
+	// exhausted. BudgetsExhausted lists every budget the crawl hit.
+	Partial          bool     `json:"partial,omitempty"`
+	BudgetsExhausted []string `json:"budgets_exhausted,omitempty"`
 }
 
 // CrawlRequest represents the input data for the Crawler agent
 type CrawlRequest struct {
 	SeedURL   string `json:"seed_url"`
 	OutputDir string `json:"output_dir,omitempty"`
+
+	// List mode: fetch exactly these URLs instead of crawling from SeedURL
+	URLs       []string `json:"urls,omitempty"`
+	URLFile    string   `json:"url_file,omitempty"`
+	SitemapURL string   `json:"sitemap_url,omitempty"`
 }
\ No newline at end of file
@@ -0,0 +1,326 @@
+package crawler
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+)
+
+// Past Memory.VisitedURLs, the visited URLs move out of c.Visited into a
+// visitedStore. A Bloom filter answers the lookups of new URLs; a hit is
+// confirmed against sorted runs of 64-bit URL fingerprints on disk, whose
+// sparse indexes stay in memory so a lookup reads a single block per run.
+// Each spill writes a new run, and runs are merged while the previous one is
+// no larger, so there are O(log n) runs and a fingerprint is rewritten
+// O(log n) times over the crawl. Fingerprints may collide, once in billions
+// of URL pairs, in which case a URL is taken for visited.
+
+const (
+	// visitedBlockSize is how many fingerprints an index entry covers
+	visitedBlockSize = 512
+	// bloomBitsPerURL and bloomHashes give about 1% false positives
+	bloomBitsPerURL = 10
+	bloomHashes     = 7
+	// bloomURLsPerPage sizes the Bloom filter: a crawled page discovers
+	// URLs that are never fetched, beyond MaxURLs
+	bloomURLsPerPage = 10
+)
+
+// bloomFilter is a fixed-size Bloom filter over URL fingerprints. It grows
+// less accurate, never wrong, past its capacity.
+type bloomFilter struct {
+	bits []uint64
+	size uint64
+}
+
+func newBloomFilter(capacity int) *bloomFilter {
+	size := uint64(positiveOr(capacity, 1)) * bloomBitsPerURL
+	return &bloomFilter{bits: make([]uint64, (size+63)/64), size: size}
+}
+
+func (b *bloomFilter) add(fingerprint uint64) {
+	h1, h2 := fingerprint, mix64(fingerprint)|1
+	for i := uint64(0); i < bloomHashes; i++ {
+		bit := (h1 + i*h2) % b.size
+		b.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+func (b *bloomFilter) mayContain(fingerprint uint64) bool {
+	h1, h2 := fingerprint, mix64(fingerprint)|1
+	for i := uint64(0); i < bloomHashes; i++ {
+		bit := (h1 + i*h2) % b.size
+		if b.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// urlFingerprint hashes a URL for the visited store
+func urlFingerprint(u string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(u))
+	return h.Sum64()
+}
+
+// mix64 derives a second, independent hash from a fingerprint (splitmix64)
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// visitedStore holds the visited URLs moved out of memory
+type visitedStore struct {
+	mutex      sync.Mutex
+	dir        string
+	bloom      *bloomFilter
+	runs       []visitedRun
+	generation int
+}
+
+// visitedRun is a sorted fingerprint file and the first fingerprint of
+// each of its blocks
+type visitedRun struct {
+	file  *os.File
+	index []uint64
+	count int
+}
+
+func newVisitedStore(dir string, capacity int) *visitedStore {
+	return &visitedStore{dir: dir, bloom: newBloomFilter(capacity)}
+}
+
+// add moves a batch of URLs to the store as a new run, then merges the last
+// two runs while the previous one is no larger
+func (s *visitedStore) add(urls []string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	batch := make([]uint64, 0, len(urls))
+	for _, u := range urls {
+		fingerprint := urlFingerprint(u)
+		s.bloom.add(fingerprint)
+		batch = append(batch, fingerprint)
+	}
+	slices.Sort(batch)
+	run, err := s.writeRun(func() (uint64, bool, error) {
+		if len(batch) == 0 {
+			return 0, false, nil
+		}
+		fingerprint := batch[0]
+		batch = batch[1:]
+		return fingerprint, true, nil
+	})
+	if err != nil {
+		return err
+	}
+	s.runs = append(s.runs, run)
+
+	for n := len(s.runs); n >= 2 && s.runs[n-2].count <= s.runs[n-1].count; n = len(s.runs) {
+		older, newer := s.runs[n-2], s.runs[n-1]
+		merged, err := s.writeRun(mergeFingerprints(older.reader(), newer.reader()))
+		if err != nil {
+			return err
+		}
+		older.remove()
+		newer.remove()
+		s.runs = append(s.runs[:n-2], merged)
+	}
+	return nil
+}
+
+// writeRun writes the sorted fingerprints next returns to a new run,
+// dropping duplicates
+func (s *visitedStore) writeRun(next func() (uint64, bool, error)) (visitedRun, error) {
+	s.generation++
+	file, err := os.Create(filepath.Join(s.dir, fmt.Sprintf("visited-%d.fp", s.generation)))
+	if err != nil {
+		return visitedRun{}, err
+	}
+	fail := func(err error) (visitedRun, error) {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+		return visitedRun{}, err
+	}
+
+	writer := bufio.NewWriter(file)
+	run := visitedRun{file: file}
+	var last uint64
+	var buf [8]byte
+	for {
+		fingerprint, ok, err := next()
+		if err != nil {
+			return fail(err)
+		}
+		if !ok {
+			break
+		}
+		if run.count > 0 && fingerprint == last {
+			continue
+		}
+		if run.count%visitedBlockSize == 0 {
+			run.index = append(run.index, fingerprint)
+		}
+		last = fingerprint
+		run.count++
+		if _, err := writer.Write(binary.LittleEndian.AppendUint64(buf[:0], fingerprint)); err != nil {
+			return fail(err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return fail(err)
+	}
+	return run, nil
+}
+
+// reader returns the fingerprints of the run in order
+func (r visitedRun) reader() func() (uint64, bool, error) {
+	reader := bufio.NewReader(io.NewSectionReader(r.file, 0, int64(r.count)*8))
+	left := r.count
+	return func() (uint64, bool, error) {
+		if left == 0 {
+			return 0, false, nil
+		}
+		var data [8]byte
+		if _, err := io.ReadFull(reader, data[:]); err != nil {
+			return 0, false, err
+		}
+		left--
+		return binary.LittleEndian.Uint64(data[:]), true, nil
+	}
+}
+
+// contains reports whether the run holds a fingerprint
+func (r visitedRun) contains(fingerprint uint64) (bool, error) {
+	// The block starts with the last indexed fingerprint not above ours
+	block := sort.Search(len(r.index), func(i int) bool { return r.index[i] > fingerprint }) - 1
+	if block < 0 {
+		return false, nil
+	}
+	start := block * visitedBlockSize
+	n := min(visitedBlockSize, r.count-start)
+	buf := make([]byte, n*8)
+	if _, err := r.file.ReadAt(buf, int64(start)*8); err != nil {
+		return false, err
+	}
+	i := sort.Search(n, func(i int) bool { return binary.LittleEndian.Uint64(buf[i*8:]) >= fingerprint })
+	return i < n && binary.LittleEndian.Uint64(buf[i*8:]) == fingerprint, nil
+}
+
+func (r visitedRun) remove() {
+	_ = r.file.Close()
+	_ = os.Remove(r.file.Name())
+}
+
+// mergeFingerprints merges two sorted fingerprint sequences
+func mergeFingerprints(a, b func() (uint64, bool, error)) func() (uint64, bool, error) {
+	headA, okA, errA := a()
+	headB, okB, errB := b()
+	return func() (uint64, bool, error) {
+		if errA != nil {
+			return 0, false, errA
+		}
+		if errB != nil {
+			return 0, false, errB
+		}
+		switch {
+		case okA && (!okB || headA <= headB):
+			fingerprint := headA
+			headA, okA, errA = a()
+			return fingerprint, true, nil
+		case okB:
+			fingerprint := headB
+			headB, okB, errB = b()
+			return fingerprint, true, nil
+		}
+		return 0, false, nil
+	}
+}
+
+// contains reports whether a URL was moved to the store. A disk error
+// counts as visited, since the Bloom filter already matched the URL.
+func (s *visitedStore) contains(u string) bool {
+	fingerprint := urlFingerprint(u)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.bloom.mayContain(fingerprint) {
+		return false
+	}
+
+	for i := len(s.runs) - 1; i >= 0; i-- {
+		found, err := s.runs[i].contains(fingerprint)
+		if err != nil {
+			fmt.Printf("Warning: failed to read visited URLs: %v\n", err)
+			return true
+		}
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *visitedStore) close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, run := range s.runs {
+		_ = run.file.Close()
+	}
+}
+
+// isVisited reports whether a URL was already scheduled. Caller holds c.mutex.
+func (c *Crawler) isVisited(u string) bool {
+	if c.Visited[u] {
+		return true
+	}
+	return c.visitedSpill != nil && c.visitedSpill.contains(u)
+}
+
+// markVisited records a scheduled URL, moving the visited URLs to disk once
+// Memory.VisitedURLs of them are in memory. Caller holds c.mutex.
+func (c *Crawler) markVisited(u string) {
+	c.Visited[u] = true
+	c.journalVisited(u)
+	limit := c.Config.Memory.VisitedURLs
+	if limit <= 0 || len(c.Visited) < limit {
+		return
+	}
+
+	if err := c.spillVisited(); err != nil {
+		fmt.Printf("Warning: failed to move visited URLs to disk, keeping them in memory: %v\n", err)
+		c.Config.Memory.VisitedURLs = 0
+	}
+}
+
+func (c *Crawler) spillVisited() error {
+	if c.visitedSpill == nil {
+		dir, err := c.spillPath()
+		if err != nil {
+			return err
+		}
+		c.visitedSpill = newVisitedStore(dir, max(c.Config.Limits.MaxURLs, c.Config.Memory.VisitedURLs)*bloomURLsPerPage)
+	}
+
+	urls := make([]string, 0, len(c.Visited))
+	for u := range c.Visited {
+		urls = append(urls, u)
+	}
+	if err := c.visitedSpill.add(urls); err != nil {
+		return err
+	}
+	c.Visited = make(map[string]bool, len(urls))
+	return nil
+}
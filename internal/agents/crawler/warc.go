@@ -0,0 +1,491 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WARCFileName is the archive of every exchange of a crawl, in the audit
+// directory
+const WARCFileName = "crawl.warc"
+
+// ErrNotArchived is returned when replaying a request the archive has no
+// response for
+var ErrNotArchived = errors.New("not in WARC archive")
+
+// warcWriter appends WARC 1.1 records to out, the archive file unless the
+// records are buffered for a coordinator
+type warcWriter struct {
+	mutex sync.Mutex
+	out   io.Writer
+	file  *os.File
+}
+
+// newWARCWriter creates the archive in outputDir, or appends to it when a
+// resumed crawl continues it
+func newWARCWriter(outputDir string, appendTo bool) (*warcWriter, error) {
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return nil, err
+	}
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if appendTo {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	file, err := os.OpenFile(filepath.Join(outputDir, WARCFileName), flags, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &warcWriter{out: file, file: file}
+	info := "software: Fire Salamander\r\nformat: WARC File Format 1.1\r\n"
+	if err := w.write("warcinfo", "", "application/warc-fields", "", []byte(info)); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// write appends a record under a new ID. concurrentTo links a request
+// record to its response.
+func (w *warcWriter) write(recordType, targetURI, contentType, concurrentTo string, block []byte, extra ...string) error {
+	return w.writeRecord(newRecordID(), recordType, targetURI, contentType, concurrentTo, block, extra...)
+}
+
+func (w *warcWriter) writeRecord(id, recordType, targetURI, contentType, concurrentTo string, block []byte, extra ...string) error {
+	digest := sha1.Sum(block)
+
+	var header strings.Builder
+	header.WriteString("WARC/1.1\r\n")
+	fmt.Fprintf(&header, "WARC-Type: %s\r\n", recordType)
+	fmt.Fprintf(&header, "WARC-Record-ID: %s\r\n", id)
+	fmt.Fprintf(&header, "WARC-Date: %s\r\n", time.Now().UTC().Format("2006-01-02T15:04:05.000000Z"))
+	if targetURI != "" {
+		fmt.Fprintf(&header, "WARC-Target-URI: %s\r\n", targetURI)
+	}
+	if concurrentTo != "" {
+		fmt.Fprintf(&header, "WARC-Concurrent-To: %s\r\n", concurrentTo)
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		fmt.Fprintf(&header, "%s: %s\r\n", extra[i], extra[i+1])
+	}
+	fmt.Fprintf(&header, "WARC-Block-Digest: sha1:%s\r\n", base32.StdEncoding.EncodeToString(digest[:]))
+	fmt.Fprintf(&header, "Content-Type: %s\r\n", contentType)
+	fmt.Fprintf(&header, "Content-Length: %d\r\n\r\n", len(block))
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if _, err := io.WriteString(w.out, header.String()); err != nil {
+		return err
+	}
+	if _, err := w.out.Write(block); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w.out, "\r\n\r\n")
+	return err
+}
+
+// append copies records written by another warcWriter
+func (w *warcWriter) append(records []byte) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	_, err := w.out.Write(records)
+	return err
+}
+
+func (w *warcWriter) Close() error {
+	if w.file == nil {
+		return nil
+	}
+	return w.file.Close()
+}
+
+// newRecordID returns a random UUID URN
+func newRecordID() string {
+	var id [16]byte
+	_, _ = rand.Read(id[:])
+	id[6] = id[6]&0x0f | 0x40
+	id[8] = id[8]&0x3f | 0x80
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", id[0:4], id[4:6], id[6:8], id[8:10], id[10:])
+}
+
+// warcRecorder is a RoundTripper archiving every exchange. The response is
+// written once its body has been read or closed, with only the bytes the
+// crawler read: a body closed early is marked as truncated. A writer in the
+// request context takes precedence, and exchanges with no writer at all are
+// not archived.
+type warcRecorder struct {
+	next   http.RoundTripper
+	writer *warcWriter
+}
+
+type warcWriterKey struct{}
+
+// withWARCWriter archives the exchanges of requests made with ctx to w
+func withWARCWriter(ctx context.Context, w *warcWriter) context.Context {
+	return context.WithValue(ctx, warcWriterKey{}, w)
+}
+
+func (r *warcRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := r.next.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	writer := r.writer
+	if w, ok := req.Context().Value(warcWriterKey{}).(*warcWriter); ok {
+		writer = w
+	}
+	if writer == nil {
+		return resp, nil
+	}
+
+	request, dumpErr := httputil.DumpRequestOut(req, false)
+	if dumpErr != nil {
+		request = []byte(fmt.Sprintf("%s %s HTTP/1.1\r\nHost: %s\r\n\r\n", req.Method, req.URL.RequestURI(), req.URL.Host))
+	}
+	resp.Body = &recordedBody{
+		body:     resp.Body,
+		writer:   writer,
+		url:      req.URL.String(),
+		head:     req.Method == http.MethodHead,
+		request:  request,
+		response: resp,
+	}
+	return resp, nil
+}
+
+// recordedBody keeps what the crawler reads of a response body
+type recordedBody struct {
+	body     io.ReadCloser
+	writer   *warcWriter
+	url      string
+	head     bool
+	request  []byte
+	response *http.Response
+	payload  bytes.Buffer
+	complete bool
+	once     sync.Once
+}
+
+func (b *recordedBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	b.payload.Write(p[:n])
+	if err == io.EOF {
+		b.complete = true
+		b.flush()
+	}
+	return n, err
+}
+
+func (b *recordedBody) Close() error {
+	b.flush()
+	return b.body.Close()
+}
+
+// flush writes the response and request records, once
+func (b *recordedBody) flush() {
+	b.once.Do(func() {
+		resp := b.response
+		var block bytes.Buffer
+		fmt.Fprintf(&block, "HTTP/%d.%d %s\r\n", resp.ProtoMajor, resp.ProtoMinor, resp.Status)
+		_ = resp.Header.Write(&block)
+		block.WriteString("\r\n")
+		block.Write(b.payload.Bytes())
+
+		var extra []string
+		// A HEAD response has no body to truncate
+		if !b.complete && !b.head && resp.ContentLength != 0 {
+			extra = []string{"WARC-Truncated", "length"}
+		}
+
+		responseID := newRecordID()
+		err := b.writer.writeRecord(responseID, "response", b.url, "application/http;msgtype=response", "", block.Bytes(), extra...)
+		if err == nil {
+			err = b.writer.write("request", b.url, "application/http;msgtype=request", responseID, b.request)
+		}
+		if err != nil {
+			fmt.Printf("Warning: failed to archive %s: %v\n", b.url, err)
+		}
+	})
+}
+
+// WARCReplay is a RoundTripper answering requests from a WARC archive, with
+// no network access. Captures of the same request are served in order, the
+// last one being repeated. A HEAD request with no capture of its own gets the
+// headers of a GET capture.
+type WARCReplay struct {
+	file     *os.File
+	mutex    sync.Mutex
+	captures map[string][]warcCapture
+	served   map[string]int
+}
+
+// warcCapture locates an archived HTTP response
+type warcCapture struct {
+	offset int64
+	length int64
+}
+
+// warcRecord is a record header read while indexing an archive
+type warcRecord struct {
+	header textproto.MIMEHeader
+	offset int64
+	length int64
+}
+
+// NewWARCReplay indexes the responses of a WARC archive
+func NewWARCReplay(path string) (*WARCReplay, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open WARC archive: %w", err)
+	}
+
+	replay := &WARCReplay{
+		file:     file,
+		captures: make(map[string][]warcCapture),
+		served:   make(map[string]int),
+	}
+	if err := replay.index(); err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("failed to read WARC archive: %w", err)
+	}
+	return replay, nil
+}
+
+// index lists the response records, keyed by the method of their request
+// record and their URI. Responses without a request record are GETs.
+func (r *WARCReplay) index() error {
+	reader := bufio.NewReader(r.file)
+	var offset int64
+	var order []string
+	responses := make(map[string]warcRecord)
+	methods := make(map[string]string)
+
+	for {
+		record, next, err := readWARCRecord(reader, offset)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		offset = next
+
+		switch record.header.Get("WARC-Type") {
+		case "response":
+			id := record.header.Get("WARC-Record-ID")
+			responses[id] = record
+			order = append(order, id)
+		case "request":
+			block := make([]byte, min(record.length, 64))
+			if _, err := r.file.ReadAt(block, record.offset); err != nil && err != io.EOF {
+				return err
+			}
+			method, _, _ := strings.Cut(string(block), " ")
+			methods[record.header.Get("WARC-Concurrent-To")] = method
+		}
+	}
+
+	for _, id := range order {
+		record := responses[id]
+		method := methods[id]
+		if method == "" {
+			method = http.MethodGet
+		}
+		key := method + " " + record.header.Get("WARC-Target-URI")
+		r.captures[key] = append(r.captures[key], warcCapture{offset: record.offset, length: record.length})
+	}
+	return nil
+}
+
+// readWARCRecord reads the header of the record at offset and skips its block
+func readWARCRecord(reader *bufio.Reader, offset int64) (warcRecord, int64, error) {
+	version, err := reader.ReadString('\n')
+	if err == io.EOF && version == "" {
+		return warcRecord{}, offset, io.EOF
+	}
+	if err != nil {
+		return warcRecord{}, offset, err
+	}
+	if !strings.HasPrefix(version, "WARC/") {
+		return warcRecord{}, offset, fmt.Errorf("invalid record at offset %d", offset)
+	}
+	offset += int64(len(version))
+
+	var header textproto.MIMEHeader = make(map[string][]string)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return warcRecord{}, offset, err
+		}
+		offset += int64(len(line))
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		if key, value, found := strings.Cut(line, ":"); found {
+			header.Add(strings.TrimSpace(key), strings.TrimSpace(value))
+		}
+	}
+
+	length, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+	if err != nil {
+		return warcRecord{}, offset, fmt.Errorf("invalid record length at offset %d", offset)
+	}
+	record := warcRecord{header: header, offset: offset, length: length}
+	if _, err := reader.Discard(int(length)); err != nil {
+		return warcRecord{}, offset, err
+	}
+	offset += length
+
+	// Records end with two CRLF
+	for i := 0; i < 2; i++ {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return warcRecord{}, offset, err
+		}
+		offset += int64(len(line))
+	}
+	return record, offset, nil
+}
+
+// RoundTrip answers req with its archived response
+func (r *WARCReplay) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := req.Method + " " + req.URL.String()
+
+	r.mutex.Lock()
+	captures := r.captures[key]
+	if len(captures) == 0 && req.Method == http.MethodHead {
+		key = http.MethodGet + " " + req.URL.String()
+		captures = r.captures[key]
+	}
+	if len(captures) == 0 {
+		r.mutex.Unlock()
+		return nil, fmt.Errorf("%s %s: %w", req.Method, req.URL, ErrNotArchived)
+	}
+	capture := captures[min(r.served[key], len(captures)-1)]
+	r.served[key]++
+	r.mutex.Unlock()
+
+	block := make([]byte, capture.length)
+	if _, err := r.file.ReadAt(block, capture.offset); err != nil {
+		return nil, fmt.Errorf("failed to read archived response: %w", err)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(block)), req)
+	if err != nil {
+		return nil, fmt.Errorf("invalid archived response for %s: %w", req.URL, err)
+	}
+	return resp, nil
+}
+
+// Close closes the archive
+func (r *WARCReplay) Close() error {
+	return r.file.Close()
+}
+
+// isFile reports whether path is the archive being replayed
+func (r *WARCReplay) isFile(path string) bool {
+	replayed, err := r.file.Stat()
+	if err != nil {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && os.SameFile(replayed, info)
+}
+
+// SetTransport replaces the transport of the crawler's HTTP client, such as
+// with a WARCReplay to re-run an audit offline
+func (c *Crawler) SetTransport(transport http.RoundTripper) {
+	c.client.Transport = transport
+}
+
+// openArchive starts replaying the archive configured as the replay source,
+// then archiving the exchanges of the crawl when the archive option is on
+// and the crawl has an output directory. Archiving over the archive being
+// replayed is refused: it would wipe the source of the replay.
+func (c *Crawler) openArchive() error {
+	if c.Config.Archive.Replay != "" {
+		replay, err := NewWARCReplay(c.Config.Archive.Replay)
+		if err != nil {
+			return err
+		}
+		c.replay, c.replayed = replay, c.client.Transport
+		c.client.Transport = replay
+	}
+	if !c.Config.Archive.WARC || c.outputDir == "" {
+		return nil
+	}
+
+	target := filepath.Join(c.outputDir, WARCFileName)
+	if replay, ok := c.client.Transport.(*WARCReplay); ok && replay.isFile(target) {
+		c.closeArchive()
+		return fmt.Errorf("WARC archive %s is the replay source, archive the replay to another output directory", target)
+	}
+	writer, err := newWARCWriter(c.outputDir, c.resumed)
+	if err != nil {
+		c.closeArchive()
+		return fmt.Errorf("failed to create WARC archive: %w", err)
+	}
+	next := c.client.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	c.client.Transport = &warcRecorder{next: next, writer: writer}
+	return nil
+}
+
+// recordForCoordinator archives the exchanges of a distributed crawl worker
+// to the writers its tasks carry in their context, for the coordinator to
+// append to its archive
+func (c *Crawler) recordForCoordinator() {
+	next := c.client.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	c.client.Transport = &warcRecorder{next: next}
+}
+
+// archiveRecords appends records archived by a worker to the crawl's archive
+func (c *Crawler) archiveRecords(records []byte) {
+	recorder, ok := c.client.Transport.(*warcRecorder)
+	if !ok || recorder.writer == nil || len(records) == 0 {
+		return
+	}
+	if err := recorder.writer.append(records); err != nil {
+		fmt.Printf("Warning: failed to archive worker records: %v\n", err)
+	}
+}
+
+// closeArchive stops archiving and replaying, and closes the archives
+func (c *Crawler) closeArchive() {
+	if recorder, ok := c.client.Transport.(*warcRecorder); ok {
+		c.client.Transport = recorder.next
+		// A worker's recorder has no archive of its own
+		if recorder.writer != nil {
+			if err := recorder.writer.Close(); err != nil {
+				fmt.Printf("Warning: failed to close WARC archive: %v\n", err)
+			}
+		}
+	}
+	if c.replay != nil {
+		c.client.Transport = c.replayed
+		_ = c.replay.Close()
+		c.replay, c.replayed = nil, nil
+	}
+}
@@ -0,0 +1,183 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	appconfig "firesalamander/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newArchivedSite serves a small site with a redirect, a missing page and
+// an image
+func newArchivedSite() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(`<html><head><title>Accueil</title></head><body>
+			<img src="/logo.png"><a href="/old">Ancienne page</a><a href="/missing">Manquante</a></body></html>`))
+	})
+	mux.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/new", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(`<html><head><title>Nouvelle page</title></head><body><p>Déménagée</p></body></html>`))
+	})
+	mux.HandleFunc("/logo.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Content-Length", "2048")
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestCrawlWritesWARCArchive(t *testing.T) {
+	server := newArchivedSite()
+	defer server.Close()
+
+	dir := t.TempDir()
+	crawler := newTestCrawler(func(cfg *appconfig.CrawlerConfig) {
+		cfg.Limits = appconfig.Limits{MaxURLs: 10, MaxDepth: 3}
+		cfg.Archive.WARC = true
+	})
+	_, err := crawler.Crawl(context.Background(), server.URL+"/", dir)
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(filepath.Join(dir, WARCFileName))
+	require.NoError(t, err)
+	archive := string(data)
+
+	assert.True(t, strings.HasPrefix(archive, "WARC/1.1\r\nWARC-Type: warcinfo\r\n"))
+	assert.Contains(t, archive, "WARC-Target-URI: "+server.URL+"/old\r\n")
+	assert.Contains(t, archive, "HTTP/1.1 301 Moved Permanently\r\n")
+	assert.Contains(t, archive, "HEAD /logo.png HTTP/1.1\r\n")
+	assert.Contains(t, archive, "<title>Nouvelle page</title>")
+	assert.Equal(t, strings.Count(archive, "WARC-Type: response\r\n"), strings.Count(archive, "WARC-Type: request\r\n"))
+
+	// The transport is restored once the crawl is over
+	_, archiving := crawler.client.Transport.(*warcRecorder)
+	assert.False(t, archiving)
+}
+
+func TestCrawlReplaysWARCArchive(t *testing.T) {
+	server := newArchivedSite()
+	dir := t.TempDir()
+	recording := newTestCrawler(func(cfg *appconfig.CrawlerConfig) {
+		cfg.Limits = appconfig.Limits{MaxURLs: 10, MaxDepth: 3}
+		cfg.Archive.WARC = true
+	})
+	recorded, err := recording.Crawl(context.Background(), server.URL+"/", dir)
+	require.NoError(t, err)
+	server.Close()
+
+	replay, err := NewWARCReplay(filepath.Join(dir, WARCFileName))
+	require.NoError(t, err)
+	defer replay.Close()
+
+	replaying := newTestCrawler(func(cfg *appconfig.CrawlerConfig) {
+		cfg.Limits = appconfig.Limits{MaxURLs: 10, MaxDepth: 3}
+	})
+	replaying.SetTransport(replay)
+	replayed, err := replaying.Crawl(context.Background(), server.URL+"/", "")
+	require.NoError(t, err)
+
+	titles := func(result *CrawlResult) map[string]string {
+		titles := make(map[string]string)
+		for _, page := range result.Pages {
+			titles[page.URL] = page.Title + " " + page.FinalURL
+		}
+		return titles
+	}
+	assert.Equal(t, titles(recorded), titles(replayed))
+	assert.Equal(t, recorded.Redirects, replayed.Redirects)
+	require.Len(t, replayed.Assets, 1)
+	assert.Equal(t, int64(2048), replayed.Assets[0].Size)
+	assert.Equal(t, "image/png", replayed.Assets[0].ContentType)
+}
+
+func TestCrawlReplaysConfiguredArchive(t *testing.T) {
+	server := newArchivedSite()
+	dir := t.TempDir()
+	recording := newTestCrawler(func(cfg *appconfig.CrawlerConfig) {
+		cfg.Limits = appconfig.Limits{MaxURLs: 10, MaxDepth: 3}
+		cfg.Archive.WARC = true
+	})
+	recorded, err := recording.Crawl(context.Background(), server.URL+"/", dir)
+	require.NoError(t, err)
+	server.Close()
+
+	// The replay source comes from the configuration, as for the CLI -replay
+	replaying := newTestCrawler(func(cfg *appconfig.CrawlerConfig) {
+		cfg.Limits = appconfig.Limits{MaxURLs: 10, MaxDepth: 3}
+		cfg.Archive.Replay = filepath.Join(dir, WARCFileName)
+	})
+	replayed, err := replaying.Crawl(context.Background(), server.URL+"/", "")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, pageURLs(recorded), pageURLs(replayed))
+
+	_, replayingStill := replaying.client.Transport.(*WARCReplay)
+	assert.False(t, replayingStill)
+}
+
+func TestCrawlRefusesToArchiveOverReplaySource(t *testing.T) {
+	server := newArchivedSite()
+	dir := t.TempDir()
+	recording := newTestCrawler(func(cfg *appconfig.CrawlerConfig) {
+		cfg.Limits = appconfig.Limits{MaxURLs: 10, MaxDepth: 3}
+		cfg.Archive.WARC = true
+	})
+	_, err := recording.Crawl(context.Background(), server.URL+"/", dir)
+	require.NoError(t, err)
+	server.Close()
+
+	source := filepath.Join(dir, WARCFileName)
+	before, err := os.ReadFile(source)
+	require.NoError(t, err)
+
+	// Re-running the audit into the same directory would truncate its source
+	replaying := newTestCrawler(func(cfg *appconfig.CrawlerConfig) {
+		cfg.Limits = appconfig.Limits{MaxURLs: 10, MaxDepth: 3}
+		cfg.Archive.WARC = true
+		cfg.Archive.Replay = source
+	})
+	_, err = replaying.Crawl(context.Background(), server.URL+"/", dir)
+	assert.Error(t, err)
+
+	after, err := os.ReadFile(source)
+	require.NoError(t, err)
+	assert.Equal(t, before, after)
+}
+
+func TestWARCReplayWithoutCapture(t *testing.T) {
+	server := newArchivedSite()
+	defer server.Close()
+	dir := t.TempDir()
+	crawler := newTestCrawler(func(cfg *appconfig.CrawlerConfig) {
+		cfg.Limits = appconfig.Limits{MaxURLs: 10, MaxDepth: 3}
+		cfg.Archive.WARC = true
+	})
+	_, err := crawler.Crawl(context.Background(), server.URL+"/", dir)
+	require.NoError(t, err)
+
+	replay, err := NewWARCReplay(filepath.Join(dir, WARCFileName))
+	require.NoError(t, err)
+	defer replay.Close()
+	client := &http.Client{Transport: replay}
+
+	_, err = client.Get(server.URL + "/never-crawled")
+	assert.True(t, errors.Is(err, ErrNotArchived))
+
+	// HEAD falls back on the headers of the GET capture
+	resp, err := client.Head(server.URL + "/")
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+}
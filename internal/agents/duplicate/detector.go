@@ -0,0 +1,365 @@
+package duplicate
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"firesalamander/internal/agents"
+	"firesalamander/internal/agents/crawler"
+	"firesalamander/internal/constants"
+)
+
+// Types de groupes de doublons
+const (
+	ClusterExact = "exact"
+	ClusterNear  = "near"
+)
+
+// États de consolidation canonique d'un groupe
+const (
+	CanonicalConsolidated = "consolidated"
+	CanonicalMissing      = "missing"
+	CanonicalConflicting  = "conflicting"
+	CanonicalSelf         = "self_referencing"
+	CanonicalBrokenTarget = "broken_target"
+)
+
+const (
+	// defaultSimilarityThreshold est la part de bardeaux de trois mots
+	// communs à deux pages à partir de laquelle elles sont quasi dupliquées
+	defaultSimilarityThreshold = 0.8
+	// defaultMinWords écarte des quasi-doublons les pages trop courtes, que
+	// leur seul gabarit ferait se ressembler
+	defaultMinWords = 20
+)
+
+// DuplicateCluster représente un groupe de pages au contenu identique ou proche
+type DuplicateCluster struct {
+	Type           string   `json:"type"`
+	Representative string   `json:"representative"`
+	URLs           []string `json:"urls"`
+	// Similarity est la plus faible similarité entre deux pages du groupe
+	Similarity      float64  `json:"similarity"`
+	Canonical       string   `json:"canonical"`
+	CanonicalTarget string   `json:"canonical_target,omitempty"`
+	CanonicalIssues []string `json:"canonical_issues,omitempty"`
+}
+
+// DuplicateReport représente le rapport de contenu dupliqué d'un crawl
+type DuplicateReport struct {
+	PagesAnalyzed  int                `json:"pages_analyzed"`
+	Threshold      float64            `json:"threshold"`
+	DuplicatePages int                `json:"duplicate_pages"`
+	Clusters       []DuplicateCluster `json:"clusters"`
+	Counts         map[string]int     `json:"counts"`
+	// Empreintes par URL, pour les appelants Go : hors du rapport JSON, où
+	// elles pèseraient ~1 Ko par page sans aucun consommateur
+	Fingerprints map[string]crawler.Fingerprint `json:"-"`
+}
+
+// DuplicateDetector implémente l'agent de détection du contenu dupliqué
+type DuplicateDetector struct {
+	name      string
+	threshold float64
+	minWords  int
+}
+
+// NewDuplicateDetector crée une nouvelle instance de DuplicateDetector
+func NewDuplicateDetector() *DuplicateDetector {
+	return NewDuplicateDetectorWithThreshold(defaultSimilarityThreshold)
+}
+
+// NewDuplicateDetectorWithThreshold crée un DuplicateDetector regroupant les
+// pages dont la similarité atteint threshold. Un seuil hors de ]0, 1] est
+// remplacé par le seuil par défaut.
+func NewDuplicateDetectorWithThreshold(threshold float64) *DuplicateDetector {
+	if threshold <= 0 || threshold > 1 {
+		threshold = defaultSimilarityThreshold
+	}
+	return &DuplicateDetector{
+		name:      constants.AgentNameDuplicate,
+		threshold: threshold,
+		minWords:  defaultMinWords,
+	}
+}
+
+// Name retourne le nom de l'agent
+func (d *DuplicateDetector) Name() string {
+	return d.name
+}
+
+// Process traite les données d'entrée et regroupe les pages dupliquées
+func (d *DuplicateDetector) Process(ctx context.Context, data interface{}) (*agents.AgentResult, error) {
+	startTime := time.Now()
+
+	crawlResult, ok := data.(*crawler.CrawlResult)
+	if !ok || crawlResult == nil {
+		return &agents.AgentResult{
+			AgentName: d.name,
+			Status:    constants.StatusFailed,
+			Errors:    []string{"invalid input data type, expected *crawler.CrawlResult"},
+			Duration:  time.Since(startTime).Milliseconds(),
+		}, nil
+	}
+
+	return &agents.AgentResult{
+		AgentName: d.name,
+		Status:    constants.StatusCompleted,
+		Data: map[string]interface{}{
+			"duplicate_report": d.Detect(crawlResult),
+		},
+		Duration: time.Since(startTime).Milliseconds(),
+	}, nil
+}
+
+// HealthCheck vérifie la santé de l'agent
+func (d *DuplicateDetector) HealthCheck() error {
+	// Test simple : deux pages identiques forment un seul groupe exact
+	content := strings.Repeat("la salamandre de feu vit dans les forêts humides ", 5)
+	report := d.Detect(&crawler.CrawlResult{Pages: []crawler.PageData{
+		{URL: "https://example.com/a", StatusCode: http.StatusOK, Content: content},
+		{URL: "https://example.com/b", StatusCode: http.StatusOK, Content: content},
+	}})
+	if len(report.Clusters) != 1 || report.Clusters[0].Type != ClusterExact {
+		return fmt.Errorf("health check failed: identical pages not grouped")
+	}
+	return nil
+}
+
+// member est une page analysée
+type member struct {
+	url         string
+	page        *crawler.PageData
+	fingerprint crawler.Fingerprint
+}
+
+// Detect calcule les empreintes du contenu principal de chaque page, regroupe
+// les doublons exacts et les quasi-doublons, de proche en proche, puis vérifie que les balises
+// canoniques de chaque groupe le consolident vers une seule URL
+func (d *DuplicateDetector) Detect(result *crawler.CrawlResult) *DuplicateReport {
+	report := &DuplicateReport{
+		Threshold:    d.threshold,
+		Clusters:     make([]DuplicateCluster, 0),
+		Counts:       make(map[string]int),
+		Fingerprints: make(map[string]crawler.Fingerprint),
+	}
+
+	crawled := make(map[string]*crawler.PageData, len(result.Pages))
+	members := make([]member, 0, len(result.Pages))
+	for i := range result.Pages {
+		page := &result.Pages[i]
+		normalized := crawler.NormalizeURL(page.ServedURL())
+		// Plusieurs URL redirigées vers la même page ne sont pas des doublons
+		if _, ok := crawled[normalized]; ok {
+			continue
+		}
+		crawled[normalized] = page
+		// Une canonique peut viser l'URL d'origine d'une page redirigée
+		if requested := crawler.NormalizeURL(page.URL); requested != normalized {
+			if _, ok := crawled[requested]; !ok {
+				crawled[requested] = page
+			}
+		}
+
+		if (page.StatusCode != 0 && page.StatusCode != http.StatusOK) || strings.TrimSpace(page.Content) == "" {
+			continue
+		}
+		fingerprint := crawler.NewFingerprint(page.Content)
+		members = append(members, member{url: normalized, page: page, fingerprint: fingerprint})
+		report.Fingerprints[normalized] = fingerprint
+	}
+	report.PagesAnalyzed = len(members)
+
+	parent := make([]int, len(members))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	union := func(i, j int) {
+		parent[find(j)] = find(i)
+	}
+
+	byHash := make(map[string]int, len(members))
+	for i, m := range members {
+		if first, ok := byHash[m.fingerprint.Hash]; ok {
+			union(first, i)
+		} else {
+			byHash[m.fingerprint.Hash] = i
+		}
+	}
+	// Seules les pages partageant une bande LSH sont comparées
+	buckets := make(map[string][]int)
+	for i, m := range members {
+		if m.fingerprint.Words < d.minWords {
+			continue
+		}
+		for _, band := range m.fingerprint.Bands() {
+			buckets[band] = append(buckets[band], i)
+		}
+	}
+	compared := make(map[[2]int]bool)
+	for _, bucket := range buckets {
+		for x, i := range bucket {
+			for _, j := range bucket[x+1:] {
+				if compared[[2]int{i, j}] || find(i) == find(j) {
+					continue
+				}
+				compared[[2]int{i, j}] = true
+				if members[i].fingerprint.Similarity(members[j].fingerprint) >= d.threshold {
+					union(i, j)
+				}
+			}
+		}
+	}
+
+	groups := make(map[int][]member)
+	for i, m := range members {
+		root := find(i)
+		groups[root] = append(groups[root], m)
+	}
+	for _, group := range groups {
+		if len(group) < 2 {
+			continue
+		}
+		cluster := newCluster(group, crawled)
+		report.Clusters = append(report.Clusters, cluster)
+		report.DuplicatePages += len(group)
+		report.Counts[cluster.Type]++
+		report.Counts[cluster.Canonical]++
+	}
+	sort.Slice(report.Clusters, func(i, j int) bool {
+		if len(report.Clusters[i].URLs) != len(report.Clusters[j].URLs) {
+			return len(report.Clusters[i].URLs) > len(report.Clusters[j].URLs)
+		}
+		return report.Clusters[i].Representative < report.Clusters[j].Representative
+	})
+
+	return report
+}
+
+// newCluster décrit un groupe de pages dupliquées
+func newCluster(group []member, crawled map[string]*crawler.PageData) DuplicateCluster {
+	sort.Slice(group, func(i, j int) bool { return group[i].url < group[j].url })
+
+	cluster := DuplicateCluster{
+		Type:       ClusterExact,
+		URLs:       make([]string, len(group)),
+		Similarity: 1,
+	}
+	for i, m := range group {
+		cluster.URLs[i] = m.url
+		for _, other := range group[i+1:] {
+			cluster.Similarity = min(cluster.Similarity, m.fingerprint.Similarity(other.fingerprint))
+		}
+		if m.fingerprint.Hash != group[0].fingerprint.Hash {
+			cluster.Type = ClusterNear
+		}
+	}
+
+	cluster.Canonical, cluster.CanonicalTarget, cluster.CanonicalIssues = consolidation(group, crawled)
+	cluster.Representative = cluster.CanonicalTarget
+	if cluster.Representative == "" {
+		cluster.Representative = representative(group)
+	}
+	return cluster
+}
+
+// consolidation vérifie que les balises canoniques du groupe désignent une
+// seule URL, servie en 200 et canonique elle-même
+func consolidation(group []member, crawled map[string]*crawler.PageData) (string, string, []string) {
+	targets := make(map[string][]string)
+	var missing []string
+	selfOnly := true
+	for _, m := range group {
+		canonical := m.page.CanonicalURL()
+		if canonical == "" {
+			missing = append(missing, m.url)
+			continue
+		}
+		targets[canonical] = append(targets[canonical], m.url)
+		selfOnly = selfOnly && canonical == m.url
+	}
+
+	switch {
+	case len(targets) == 0:
+		return CanonicalMissing, "", []string{"No page of the group declares a canonical URL"}
+	case len(targets) > 1 && selfOnly && len(missing) == 0:
+		return CanonicalSelf, "", []string{"Every page of the group declares itself canonical"}
+	case len(targets) > 1:
+		return CanonicalConflicting, "", []string{fmt.Sprintf("Pages of the group canonicalize to %d different URLs: %s",
+			len(targets), strings.Join(sortedKeys(targets), ", "))}
+	}
+
+	target := sortedKeys(targets)[0]
+	// La cible peut se passer de balise : les autres pages la désignent
+	var undeclared []string
+	for _, pageURL := range missing {
+		if pageURL != target {
+			undeclared = append(undeclared, pageURL)
+		}
+	}
+	if len(undeclared) > 0 {
+		return CanonicalMissing, target, []string{fmt.Sprintf("%d pages do not declare %s as canonical: %s",
+			len(undeclared), target, strings.Join(undeclared, ", "))}
+	}
+
+	if page, ok := crawled[target]; ok {
+		if page.StatusCode != 0 && page.StatusCode != http.StatusOK {
+			return CanonicalBrokenTarget, target, []string{fmt.Sprintf("Canonical URL %s returns HTTP %d", target, page.StatusCode)}
+		}
+		if final := crawler.NormalizeURL(page.ServedURL()); final != target {
+			return CanonicalBrokenTarget, target, []string{fmt.Sprintf("Canonical URL %s redirects to %s", target, final)}
+		}
+		if canonical := page.CanonicalURL(); canonical != "" && canonical != target {
+			return CanonicalBrokenTarget, target, []string{fmt.Sprintf("Canonical URL %s is itself canonicalized to %s", target, canonical)}
+		}
+	}
+	return CanonicalConsolidated, target, nil
+}
+
+// representative choisit la page la plus liée du groupe, puis la moins
+// profonde, puis l'URL la plus courte
+func representative(group []member) string {
+	best := group[0]
+	for _, m := range group[1:] {
+		if better(m, best) {
+			best = m
+		}
+	}
+	return best.url
+}
+
+func better(a, b member) bool {
+	if a.page.UniqueInlinks != b.page.UniqueInlinks {
+		return a.page.UniqueInlinks > b.page.UniqueInlinks
+	}
+	if depthA, depthB := a.page.LinkDepth, b.page.LinkDepth; depthA != depthB {
+		if depthA == crawler.UnreachableLinkDepth || depthB == crawler.UnreachableLinkDepth {
+			return depthB == crawler.UnreachableLinkDepth
+		}
+		return depthA < depthB
+	}
+	if len(a.url) != len(b.url) {
+		return len(a.url) < len(b.url)
+	}
+	return a.url < b.url
+}
+
+func sortedKeys(set map[string][]string) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
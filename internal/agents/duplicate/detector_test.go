@@ -0,0 +1,231 @@
+package duplicate
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"firesalamander/internal/agents/crawler"
+	"firesalamander/internal/constants"
+)
+
+const productText = `La lampe Salamandre est une lampe de bureau en laiton brossé, avec un abat-jour
+orientable et une ampoule LED de huit watts fournie. Son pied lesté assure une bonne stabilité, son
+interrupteur tactile propose trois niveaux d'intensité. Livrée montée, garantie deux ans, elle
+convient aussi bien au salon qu'au bureau ou à la chambre d'enfant.`
+
+func product(pageURL, canonical, content string) crawler.PageData {
+	return crawler.PageData{URL: pageURL, StatusCode: http.StatusOK, Canonical: canonical, Content: content}
+}
+
+func clusterOf(report *DuplicateReport, pageURL string) *DuplicateCluster {
+	for i, cluster := range report.Clusters {
+		for _, u := range cluster.URLs {
+			if u == pageURL {
+				return &report.Clusters[i]
+			}
+		}
+	}
+	return nil
+}
+
+func TestDuplicateDetector_Name(t *testing.T) {
+	if name := NewDuplicateDetector().Name(); name != constants.AgentNameDuplicate {
+		t.Errorf("Expected name %s, got %s", constants.AgentNameDuplicate, name)
+	}
+}
+
+func TestDuplicateDetector_HealthCheck(t *testing.T) {
+	if err := NewDuplicateDetector().HealthCheck(); err != nil {
+		t.Errorf("HealthCheck failed: %v", err)
+	}
+}
+
+func TestDuplicateDetector_Process(t *testing.T) {
+	detector := NewDuplicateDetector()
+
+	result, err := detector.Process(context.Background(), "invalid")
+	if err != nil || result.Status != constants.StatusFailed {
+		t.Errorf("Expected failed status for invalid input, got %v (%v)", result.Status, err)
+	}
+
+	result, err = detector.Process(context.Background(), &crawler.CrawlResult{})
+	if err != nil || result.Status != constants.StatusCompleted {
+		t.Fatalf("Expected completed status, got %v (%v)", result.Status, err)
+	}
+	if _, ok := result.Data["duplicate_report"].(*DuplicateReport); !ok {
+		t.Error("Expected duplicate_report in result data")
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	base := crawler.NewFingerprint(productText)
+	if reformatted := crawler.NewFingerprint(strings.ToUpper(strings.ReplaceAll(productText, ",", " ;"))); reformatted.Hash != base.Hash {
+		t.Error("Expected case and punctuation to be ignored by the exact hash")
+	}
+
+	edited := crawler.NewFingerprint(strings.Replace(productText, "huit watts", "dix watts", 1))
+	if edited.Hash == base.Hash {
+		t.Error("Expected an edited text to change the exact hash")
+	}
+	if similarity := base.Similarity(edited); similarity < defaultSimilarityThreshold {
+		t.Errorf("Expected a one word edit to stay above the threshold, got %.2f", similarity)
+	}
+
+	other := crawler.NewFingerprint("Le tapis Phénix est tissé main en laine vierge, dans des tons ocre et rouille, et se décline en trois tailles pour l'entrée, le salon ou la chambre. Un traitement antitache protège ses fibres.")
+	if similarity := base.Similarity(other); similarity >= defaultSimilarityThreshold {
+		t.Errorf("Expected unrelated texts below the threshold, got %.2f", similarity)
+	}
+}
+
+func TestDetectGroupsProductUnderCategoryPaths(t *testing.T) {
+	report := NewDuplicateDetector().Detect(&crawler.CrawlResult{Pages: []crawler.PageData{
+		product("https://shop.example/lampe-salamandre", "/lampe-salamandre", productText),
+		product("https://shop.example/luminaires/lampe-salamandre", "https://shop.example/lampe-salamandre", productText),
+		product("https://shop.example/bureau/lampe-salamandre", "https://shop.example/lampe-salamandre", productText),
+		product("https://shop.example/tapis-phenix", "", "Le tapis Phénix est tissé main en laine vierge."),
+	}})
+
+	if report.PagesAnalyzed != 4 || len(report.Clusters) != 1 {
+		t.Fatalf("Expected 1 cluster out of 4 pages, got %d out of %d", len(report.Clusters), report.PagesAnalyzed)
+	}
+	cluster := report.Clusters[0]
+	if cluster.Type != ClusterExact || len(cluster.URLs) != 3 || cluster.Similarity != 1 {
+		t.Errorf("Expected an exact cluster of 3 pages, got %+v", cluster)
+	}
+	if cluster.Canonical != CanonicalConsolidated || cluster.Representative != "https://shop.example/lampe-salamandre" {
+		t.Errorf("Expected the cluster consolidated to the product URL, got %s to %s", cluster.Canonical, cluster.Representative)
+	}
+	if report.DuplicatePages != 3 || report.Counts[ClusterExact] != 1 {
+		t.Errorf("Unexpected counts: %d pages, %v", report.DuplicatePages, report.Counts)
+	}
+	if len(report.Fingerprints) != 4 {
+		t.Errorf("Expected a fingerprint per page, got %d", len(report.Fingerprints))
+	}
+	data, err := json.Marshal(report)
+	if err != nil {
+		t.Fatalf("Failed to encode report: %v", err)
+	}
+	if strings.Contains(string(data), "fingerprint") {
+		t.Errorf("Fingerprints leaked into the JSON report: %s", data)
+	}
+}
+
+func TestDetectNearDuplicates(t *testing.T) {
+	colour := strings.Replace(productText, "laiton brossé", "laiton noir", 1)
+	pages := []crawler.PageData{
+		product("https://shop.example/lampe-laiton", "https://shop.example/lampe-laiton", productText),
+		product("https://shop.example/lampe-noire", "https://shop.example/lampe-noire", colour),
+	}
+	pages[1].UniqueInlinks = 4
+
+	report := NewDuplicateDetector().Detect(&crawler.CrawlResult{Pages: pages})
+	cluster := clusterOf(report, "https://shop.example/lampe-noire")
+	if cluster == nil || cluster.Type != ClusterNear {
+		t.Fatalf("Expected a near duplicate cluster, got %+v", report.Clusters)
+	}
+	if cluster.Similarity >= 1 || cluster.Similarity < defaultSimilarityThreshold {
+		t.Errorf("Unexpected similarity %.2f", cluster.Similarity)
+	}
+	if cluster.Canonical != CanonicalSelf {
+		t.Errorf("Expected self referencing canonicals, got %s", cluster.Canonical)
+	}
+	if cluster.Representative != "https://shop.example/lampe-noire" {
+		t.Errorf("Expected the most linked page as representative, got %s", cluster.Representative)
+	}
+
+	strict := NewDuplicateDetectorWithThreshold(1).Detect(&crawler.CrawlResult{Pages: pages})
+	if len(strict.Clusters) != 0 {
+		t.Errorf("Expected no cluster with a threshold of 1, got %+v", strict.Clusters)
+	}
+}
+
+func TestDetectIgnoresShortPagesForNearDuplicates(t *testing.T) {
+	report := NewDuplicateDetector().Detect(&crawler.CrawlResult{Pages: []crawler.PageData{
+		product("https://shop.example/a", "", "Produit indisponible pour le moment"),
+		product("https://shop.example/b", "", "Produit indisponible pour le moment !"),
+		product("https://shop.example/c", "", "Produit épuisé pour le moment"),
+	}})
+
+	if len(report.Clusters) != 1 || len(report.Clusters[0].URLs) != 2 || report.Clusters[0].Type != ClusterExact {
+		t.Errorf("Expected only the exact short duplicates grouped, got %+v", report.Clusters)
+	}
+}
+
+func TestDetectCanonicalConsolidation(t *testing.T) {
+	tests := []struct {
+		name      string
+		pages     []crawler.PageData
+		canonical string
+	}{
+		{
+			name: "missing",
+			pages: []crawler.PageData{
+				product("https://shop.example/a", "", productText),
+				product("https://shop.example/b", "", productText),
+			},
+			canonical: CanonicalMissing,
+		},
+		{
+			name: "partially missing",
+			pages: []crawler.PageData{
+				product("https://shop.example/a", "", productText),
+				product("https://shop.example/b", "https://shop.example/a", productText),
+				product("https://shop.example/c", "", productText),
+			},
+			canonical: CanonicalMissing,
+		},
+		{
+			name: "target without tag",
+			pages: []crawler.PageData{
+				product("https://shop.example/a", "", productText),
+				product("https://shop.example/b", "https://shop.example/a", productText),
+			},
+			canonical: CanonicalConsolidated,
+		},
+		{
+			name: "conflicting",
+			pages: []crawler.PageData{
+				product("https://shop.example/a", "https://shop.example/b", productText),
+				product("https://shop.example/b", "https://shop.example/c", productText),
+			},
+			canonical: CanonicalConflicting,
+		},
+		{
+			name: "target redirects",
+			pages: []crawler.PageData{
+				product("https://shop.example/a", "https://shop.example/old", productText),
+				product("https://shop.example/b", "https://shop.example/old", productText),
+				{URL: "https://shop.example/old", FinalURL: "https://shop.example/new", StatusCode: http.StatusOK},
+			},
+			canonical: CanonicalBrokenTarget,
+		},
+		{
+			name: "target not found",
+			pages: []crawler.PageData{
+				product("https://shop.example/a", "https://shop.example/gone", productText),
+				product("https://shop.example/b", "https://shop.example/gone", productText),
+				{URL: "https://shop.example/gone", StatusCode: http.StatusNotFound},
+			},
+			canonical: CanonicalBrokenTarget,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := NewDuplicateDetector().Detect(&crawler.CrawlResult{Pages: tt.pages})
+			cluster := clusterOf(report, "https://shop.example/a")
+			if cluster == nil {
+				t.Fatalf("Expected a cluster, got none")
+			}
+			if cluster.Canonical != tt.canonical {
+				t.Errorf("Expected %s, got %s (%v)", tt.canonical, cluster.Canonical, cluster.CanonicalIssues)
+			}
+			if tt.canonical != CanonicalConsolidated && len(cluster.CanonicalIssues) == 0 {
+				t.Error("Expected canonical issues to be described")
+			}
+		})
+	}
+}
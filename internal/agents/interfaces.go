@@ -61,6 +61,8 @@ type PageData struct {
 	URL     string `json:"url"`
 	HTML    string `json:"html"`
 	Headers map[string]string `json:"headers"`
+	// CharsetConflicts liste les désaccords d'encodage relevés par le crawler
+	CharsetConflicts []string `json:"charset_conflicts,omitempty"`
 }
 
 // TechnicalReport représente le rapport d'audit technique
@@ -167,7 +169,10 @@ type BrokenLinksReport struct {
 	TotalChecked int          `json:"total_checked"`
 	BrokenCount  int          `json:"broken_count"`
 	BrokenLinks  []BrokenLink `json:"broken_links"`
-	CheckedAt    string       `json:"checked_at"`
+	// UncheckedLinks liste les URLs dont le statut n'a pas pu être établi,
+	// comme les liens absents de l'archive WARC rejouée
+	UncheckedLinks []string `json:"unchecked_links,omitempty"`
+	CheckedAt      string   `json:"checked_at"`
 }
 
 // BrokenLink représente un lien brisé
@@ -183,6 +188,8 @@ type LinkStatus struct {
 	URL        string `json:"url"`
 	StatusCode int    `json:"status_code"`
 	IsValid    bool   `json:"is_valid"`
-	Error      string `json:"error,omitempty"`
-	CheckedAt  string `json:"checked_at"`
+	// Unchecked signale un lien qui n'a pas pu être vérifié, sans être brisé
+	Unchecked bool   `json:"unchecked,omitempty"`
+	Error     string `json:"error,omitempty"`
+	CheckedAt string `json:"checked_at"`
 }
\ No newline at end of file
@@ -0,0 +1,274 @@
+package international
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"firesalamander/internal/agents"
+	"firesalamander/internal/agents/crawler"
+	"firesalamander/internal/constants"
+)
+
+// Types d'anomalies hreflang
+const (
+	IssueInvalidCode        = "invalid_hreflang_code"
+	IssueMissingSelf        = "missing_self_reference"
+	IssueMissingXDefault    = "missing_x_default"
+	IssueMissingReturnLink  = "missing_return_link"
+	IssueTargetNotOK        = "hreflang_target_not_ok"
+	IssueTargetNotCanonical = "hreflang_target_not_canonical"
+	IssueLangMismatch       = "html_lang_mismatch"
+)
+
+// xDefault est la valeur hreflang de la version par défaut
+const xDefault = "x-default"
+
+// defaultMaxTargetChecks borne les requêtes HTTP vers les cibles non crawlées
+const defaultMaxTargetChecks = 200
+
+// TargetChecker vérifie une cible non crawlée comme le ferait le crawler :
+// robots.txt, User-Agent et politesse par hôte. *crawler.Crawler l'implémente.
+type TargetChecker interface {
+	TargetStatus(ctx context.Context, target string) (status int, finalURL string, err error)
+}
+
+// HreflangIssue représente une anomalie hreflang détectée sur une page
+type HreflangIssue struct {
+	Type        string `json:"type"`
+	Severity    string `json:"severity"`
+	PageURL     string `json:"page_url"`
+	Target      string `json:"target,omitempty"`
+	Description string `json:"description"`
+}
+
+// HreflangReport représente le rapport SEO international d'un crawl
+type HreflangReport struct {
+	PagesWithHreflang int             `json:"pages_with_hreflang"`
+	Issues            []HreflangIssue `json:"issues"`
+	Counts            map[string]int  `json:"counts"`
+	// Cibles non crawlées dont le statut n'a pas pu être vérifié
+	UncheckedTargets []string `json:"unchecked_targets,omitempty"`
+}
+
+// InternationalAuditor implémente l'agent d'audit SEO international (hreflang)
+type InternationalAuditor struct {
+	name      string
+	checker   TargetChecker
+	maxChecks int
+}
+
+// NewInternationalAuditor crée une nouvelle instance d'InternationalAuditor
+func NewInternationalAuditor() *InternationalAuditor {
+	return &InternationalAuditor{
+		name:      constants.AgentNameInternational,
+		maxChecks: defaultMaxTargetChecks,
+	}
+}
+
+// SetTargetChecker fait vérifier les cibles non crawlées par checker, en
+// général le crawler de l'audit. Sans lui, ces cibles sont seulement listées
+// comme non vérifiées.
+func (a *InternationalAuditor) SetTargetChecker(checker TargetChecker) {
+	a.checker = checker
+}
+
+// Name retourne le nom de l'agent
+func (a *InternationalAuditor) Name() string {
+	return a.name
+}
+
+// Process traite les données d'entrée et audite les annotations hreflang
+func (a *InternationalAuditor) Process(ctx context.Context, data interface{}) (*agents.AgentResult, error) {
+	startTime := time.Now()
+
+	crawlResult, ok := data.(*crawler.CrawlResult)
+	if !ok || crawlResult == nil {
+		return &agents.AgentResult{
+			AgentName: a.name,
+			Status:    constants.StatusFailed,
+			Errors:    []string{"invalid input data type, expected *crawler.CrawlResult"},
+			Duration:  time.Since(startTime).Milliseconds(),
+		}, nil
+	}
+
+	return &agents.AgentResult{
+		AgentName: a.name,
+		Status:    constants.StatusCompleted,
+		Data: map[string]interface{}{
+			"hreflang_report": a.Audit(ctx, crawlResult),
+		},
+		Duration: time.Since(startTime).Milliseconds(),
+	}, nil
+}
+
+// HealthCheck vérifie la santé de l'agent
+func (a *InternationalAuditor) HealthCheck() error {
+	// Test simple : une paire FR/EN réciproque ne doit produire aucune anomalie
+	pages := []crawler.PageData{
+		{URL: "https://example.com/fr", Lang: "fr", StatusCode: http.StatusOK, Hreflang: []crawler.HreflangLink{
+			{Lang: "fr", URL: "https://example.com/fr"}, {Lang: "en", URL: "https://example.com/en"}, {Lang: xDefault, URL: "https://example.com/fr"},
+		}},
+		{URL: "https://example.com/en", Lang: "en", StatusCode: http.StatusOK, Hreflang: []crawler.HreflangLink{
+			{Lang: "fr", URL: "https://example.com/fr"}, {Lang: "en", URL: "https://example.com/en"}, {Lang: xDefault, URL: "https://example.com/fr"},
+		}},
+	}
+	report := a.Audit(context.Background(), &crawler.CrawlResult{Pages: pages})
+	if len(report.Issues) > 0 {
+		return fmt.Errorf("health check failed: unexpected %s issue", report.Issues[0].Type)
+	}
+	return nil
+}
+
+// Audit vérifie la réciprocité des annotations, l'auto-référence, x-default,
+// les codes langue/région, le statut et la canonicité des cibles ainsi que la
+// cohérence avec <html lang>
+func (a *InternationalAuditor) Audit(ctx context.Context, result *crawler.CrawlResult) *HreflangReport {
+	report := &HreflangReport{
+		Issues: make([]HreflangIssue, 0),
+		Counts: make(map[string]int),
+	}
+	add := func(issueType, severity, pageURL, target, description string) {
+		report.Issues = append(report.Issues, HreflangIssue{
+			Type:        issueType,
+			Severity:    severity,
+			PageURL:     pageURL,
+			Target:      target,
+			Description: description,
+		})
+		report.Counts[issueType]++
+	}
+
+	crawled := make(map[string]*crawler.PageData, len(result.Pages))
+	for i := range result.Pages {
+		crawled[crawler.NormalizeURL(result.Pages[i].URL)] = &result.Pages[i]
+	}
+	// Une cible peut viser l'URL finale d'une page atteinte par redirection
+	for i := range result.Pages {
+		final := crawler.NormalizeURL(result.Pages[i].ServedURL())
+		if _, ok := crawled[final]; !ok {
+			crawled[final] = &result.Pages[i]
+		}
+	}
+	redirected := make(map[string]crawler.RedirectRecord, len(result.Redirects))
+	for _, record := range result.Redirects {
+		redirected[crawler.NormalizeURL(record.SourceURL)] = record
+	}
+
+	checked := make(map[string]bool)
+	checks := 0
+
+	for _, page := range result.Pages {
+		if len(page.Hreflang) == 0 {
+			continue
+		}
+		report.PagesWithHreflang++
+
+		self := crawler.NormalizeURL(page.ServedURL())
+		hasSelf, hasXDefault := false, false
+		selfLang := ""
+
+		for _, link := range page.Hreflang {
+			if !validHreflang(link.Lang) {
+				add(IssueInvalidCode, "high", page.URL, link.URL,
+					fmt.Sprintf("Invalid hreflang value %q: expected an ISO 639-1 language, optionally followed by an ISO 3166-1 region", link.Lang))
+			}
+			if strings.EqualFold(link.Lang, xDefault) {
+				hasXDefault = true
+			}
+
+			target := crawler.NormalizeURL(link.URL)
+			if target == self {
+				hasSelf = true
+				if !strings.EqualFold(link.Lang, xDefault) {
+					selfLang = link.Lang
+				}
+				continue
+			}
+
+			if targetPage, ok := crawled[target]; ok {
+				if !linksTo(*targetPage, self) {
+					add(IssueMissingReturnLink, "high", page.URL, link.URL,
+						fmt.Sprintf("%s does not link back to this page with hreflang", link.URL))
+				}
+			}
+
+			// Statut et canonique ne dépendent que de la cible
+			if checked[target] {
+				continue
+			}
+			checked[target] = true
+
+			if targetPage, ok := crawled[target]; ok {
+				if problem := targetStatusProblem(*targetPage, target); problem != "" {
+					add(IssueTargetNotOK, "high", page.URL, link.URL, problem)
+				} else if canonical := targetPage.CanonicalURL(); canonical != "" && canonical != target {
+					add(IssueTargetNotCanonical, "high", page.URL, link.URL,
+						fmt.Sprintf("hreflang target is canonicalized to %s", canonical))
+				}
+				continue
+			}
+			if record, ok := redirected[target]; ok {
+				add(IssueTargetNotOK, "high", page.URL, link.URL,
+					fmt.Sprintf("hreflang target redirects to %s (HTTP %d)", record.FinalURL, record.FinalStatus))
+				continue
+			}
+			if a.checker == nil || checks >= a.maxChecks {
+				report.UncheckedTargets = append(report.UncheckedTargets, link.URL)
+				continue
+			}
+			checks++
+			status, final, err := a.checker.TargetStatus(ctx, link.URL)
+			switch {
+			case errors.Is(err, crawler.ErrBlockedByRobots):
+				report.UncheckedTargets = append(report.UncheckedTargets, link.URL)
+			case err != nil:
+				add(IssueTargetNotOK, "high", page.URL, link.URL, fmt.Sprintf("hreflang target unreachable: %v", err))
+			case crawler.NormalizeURL(final) != target:
+				// Une cible hreflang qui redirige est une anomalie
+				add(IssueTargetNotOK, "high", page.URL, link.URL,
+					fmt.Sprintf("hreflang target redirects to %s (HTTP %d)", final, status))
+			case status != http.StatusOK:
+				add(IssueTargetNotOK, "high", page.URL, link.URL, fmt.Sprintf("hreflang target returns HTTP %d", status))
+			}
+		}
+
+		if !hasSelf {
+			add(IssueMissingSelf, "medium", page.URL, "", "hreflang annotations do not include the page itself")
+		}
+		if !hasXDefault {
+			add(IssueMissingXDefault, "low", page.URL, "", "No x-default hreflang for users matching no listed language")
+		}
+		if selfLang != "" && page.Lang != "" && page.Lang != "unknown" &&
+			primaryLanguage(page.Lang) != primaryLanguage(selfLang) {
+			add(IssueLangMismatch, "medium", page.URL, "",
+				fmt.Sprintf("<html lang=%q> does not match the page's own hreflang %q", page.Lang, selfLang))
+		}
+	}
+
+	return report
+}
+
+// linksTo indique si la page déclare target parmi ses alternatives
+func linksTo(page crawler.PageData, target string) bool {
+	for _, link := range page.Hreflang {
+		if crawler.NormalizeURL(link.URL) == target {
+			return true
+		}
+	}
+	return false
+}
+
+// targetStatusProblem décrit pourquoi une cible crawlée n'est pas une page 200
+func targetStatusProblem(page crawler.PageData, target string) string {
+	if page.StatusCode != 0 && page.StatusCode != http.StatusOK {
+		return fmt.Sprintf("hreflang target returns HTTP %d", page.StatusCode)
+	}
+	if page.FinalURL != "" && crawler.NormalizeURL(page.FinalURL) != target {
+		return fmt.Sprintf("hreflang target redirects to %s", page.FinalURL)
+	}
+	return ""
+}
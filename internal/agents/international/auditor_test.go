@@ -0,0 +1,225 @@
+package international
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"firesalamander/internal/agents/crawler"
+	"firesalamander/internal/config"
+	"firesalamander/internal/constants"
+)
+
+func alternates(urls map[string]string) []crawler.HreflangLink {
+	links := make([]crawler.HreflangLink, 0, len(urls))
+	for lang, u := range urls {
+		links = append(links, crawler.HreflangLink{Lang: lang, URL: u, Source: crawler.HreflangSourceHTML})
+	}
+	return links
+}
+
+func issuesOfType(report *HreflangReport, issueType string) []HreflangIssue {
+	var issues []HreflangIssue
+	for _, issue := range report.Issues {
+		if issue.Type == issueType {
+			issues = append(issues, issue)
+		}
+	}
+	return issues
+}
+
+func TestInternationalAuditor_Name(t *testing.T) {
+	auditor := NewInternationalAuditor()
+
+	if auditor.Name() != constants.AgentNameInternational {
+		t.Errorf("Expected name %s, got %s", constants.AgentNameInternational, auditor.Name())
+	}
+}
+
+func TestInternationalAuditor_HealthCheck(t *testing.T) {
+	if err := NewInternationalAuditor().HealthCheck(); err != nil {
+		t.Errorf("HealthCheck failed: %v", err)
+	}
+}
+
+func TestInternationalAuditor_Process(t *testing.T) {
+	auditor := NewInternationalAuditor()
+
+	result, err := auditor.Process(context.Background(), "invalid")
+	if err != nil || result.Status != constants.StatusFailed {
+		t.Errorf("Expected failed status for invalid input, got %v (%v)", result.Status, err)
+	}
+
+	result, err = auditor.Process(context.Background(), &crawler.CrawlResult{})
+	if err != nil || result.Status != constants.StatusCompleted {
+		t.Fatalf("Expected completed status, got %v (%v)", result.Status, err)
+	}
+	if _, ok := result.Data["hreflang_report"].(*HreflangReport); !ok {
+		t.Error("Expected hreflang_report in result data")
+	}
+}
+
+func TestInternationalAuditor_ValidSet(t *testing.T) {
+	set := map[string]string{
+		"fr-FR":  "https://example.com/fr",
+		"en":     "https://example.com/en",
+		xDefault: "https://example.com/fr",
+	}
+
+	pages := []crawler.PageData{
+		{URL: "https://example.com/fr", Lang: "fr", StatusCode: 200, Hreflang: alternates(set)},
+		{URL: "https://example.com/en", Lang: "en", StatusCode: 200, Hreflang: alternates(set)},
+	}
+
+	report := NewInternationalAuditor().Audit(context.Background(), &crawler.CrawlResult{Pages: pages})
+	if len(report.Issues) != 0 {
+		t.Errorf("Expected no issues, got %+v", report.Issues)
+	}
+	if report.PagesWithHreflang != 2 {
+		t.Errorf("Expected 2 pages with hreflang, got %d", report.PagesWithHreflang)
+	}
+}
+
+func TestInternationalAuditor_DetectsIssues(t *testing.T) {
+	pages := []crawler.PageData{
+		{
+			URL: "https://example.com/fr", Lang: "en", StatusCode: 200,
+			Hreflang: alternates(map[string]string{
+				"fr":    "https://example.com/fr",
+				"en-UK": "https://example.com/en",
+				"de":    "https://example.com/de",
+				"es":    "https://example.com/es",
+			}),
+		},
+		// No return link to /fr, no self reference, no x-default
+		{URL: "https://example.com/en", Lang: "en", StatusCode: 200,
+			Hreflang: alternates(map[string]string{"de": "https://example.com/de"})},
+		// Canonicalized to another page
+		{URL: "https://example.com/de", Lang: "de", StatusCode: 200, Canonical: "/de-de",
+			Hreflang: alternates(map[string]string{"fr": "https://example.com/fr", "de": "https://example.com/de"})},
+	}
+	redirects := []crawler.RedirectRecord{
+		{SourceURL: "https://example.com/es", FinalURL: "https://example.com/es/", FinalStatus: 200},
+	}
+
+	report := NewInternationalAuditor().Audit(context.Background(), &crawler.CrawlResult{Pages: pages, Redirects: redirects})
+
+	expected := map[string]int{
+		IssueInvalidCode:        1, // en-UK
+		IssueMissingReturnLink:  2, // /en -> /fr, /en -> /de
+		IssueTargetNotCanonical: 1, // /de
+		IssueTargetNotOK:        1, // /es redirects
+		IssueMissingSelf:        1, // /en
+		IssueMissingXDefault:    3,
+		IssueLangMismatch:       1, // /fr declares lang="en"
+	}
+	for issueType, count := range expected {
+		if got := len(issuesOfType(report, issueType)); got != count {
+			t.Errorf("Expected %d %s issues, got %d: %+v", count, issueType, got, issuesOfType(report, issueType))
+		}
+	}
+}
+
+func TestInternationalAuditor_ChecksExternalTargets(t *testing.T) {
+	var userAgent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			w.Write([]byte("User-agent: *\nDisallow: /private\n"))
+		case "/ok":
+			userAgent = r.UserAgent()
+			w.WriteHeader(http.StatusOK)
+		case "/moved":
+			http.Redirect(w, r, "/ok", http.StatusMovedPermanently)
+		case "/private":
+			t.Error("target disallowed by robots.txt was requested")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	pages := []crawler.PageData{{
+		URL: "https://example.com/", Lang: "fr", StatusCode: 200,
+		Hreflang: alternates(map[string]string{
+			"fr":     "https://example.com/",
+			"en":     server.URL + "/ok",
+			"de":     server.URL + "/moved",
+			"es":     server.URL + "/gone",
+			"it":     server.URL + "/private",
+			xDefault: "https://example.com/",
+		}),
+	}}
+
+	// Les cibles passent par le crawler : robots.txt, User-Agent, politesse
+	c := crawler.NewCrawler(config.CrawlerConfig{
+		UserAgent:   "Test-Bot/1.0",
+		Respect:     config.Respect{RobotsTxt: true},
+		Performance: config.Performance{RequestTimeout: 5 * time.Second},
+	})
+	auditor := NewInternationalAuditor()
+	auditor.SetTargetChecker(c)
+	report := auditor.Audit(context.Background(), &crawler.CrawlResult{Pages: pages})
+
+	issues := issuesOfType(report, IssueTargetNotOK)
+	if len(issues) != 2 {
+		t.Fatalf("Expected 2 non-200 targets, got %+v", issues)
+	}
+	for _, issue := range issues {
+		if issue.Target == server.URL+"/ok" {
+			t.Errorf("200 target reported: %+v", issue)
+		}
+	}
+	if userAgent != "Test-Bot/1.0" {
+		t.Errorf("Expected the crawler's user agent, got %q", userAgent)
+	}
+	if len(report.UncheckedTargets) != 1 || report.UncheckedTargets[0] != server.URL+"/private" {
+		t.Errorf("Expected the disallowed target to be unchecked, got %v", report.UncheckedTargets)
+	}
+}
+
+func TestInternationalAuditor_ReportsUncheckedTargets(t *testing.T) {
+	pages := []crawler.PageData{{
+		URL: "https://example.com/", Lang: "fr", StatusCode: 200,
+		Hreflang: alternates(map[string]string{
+			"fr": "https://example.com/",
+			"en": "https://example.org/en",
+		}),
+	}}
+
+	// Sans vérificateur, aucune requête n'est envoyée vers les cibles
+	report := NewInternationalAuditor().Audit(context.Background(), &crawler.CrawlResult{Pages: pages})
+
+	if len(issuesOfType(report, IssueTargetNotOK)) != 0 {
+		t.Errorf("Unchecked target reported as an issue: %+v", report.Issues)
+	}
+	if len(report.UncheckedTargets) != 1 || report.UncheckedTargets[0] != "https://example.org/en" {
+		t.Errorf("Expected https://example.org/en to be unchecked, got %v", report.UncheckedTargets)
+	}
+}
+
+func TestValidHreflang(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected bool
+	}{
+		{"fr", true},
+		{"fr-CA", true},
+		{"EN-gb", true},
+		{"zh-Hant-TW", true},
+		{"x-default", true},
+		{"en-UK", false},
+		{"fr_FR", false},
+		{"english", false},
+		{"xx", false},
+		{"es-419", false},
+	}
+
+	for _, tt := range tests {
+		if got := validHreflang(tt.value); got != tt.expected {
+			t.Errorf("validHreflang(%q) = %v, expected %v", tt.value, got, tt.expected)
+		}
+	}
+}
@@ -146,6 +146,11 @@ func (l *LinkingMapper) AnalyzeLinkStructure(links []agents.Link) (*agents.LinkA
 
 // extractLinksFromPage extrait tous les liens d'une page donnée
 func (l *LinkingMapper) extractLinksFromPage(page crawler.PageData, baseDomain string) []agents.Link {
+	// Les ancres résolues par le crawler forment le graphe de liens partagé
+	if len(page.Anchors) > 0 {
+		return l.linksFromAnchors(page, baseDomain)
+	}
+
 	var links []agents.Link
 
 	// Expression régulière pour les liens
@@ -199,6 +204,38 @@ func (l *LinkingMapper) extractLinksFromPage(page crawler.PageData, baseDomain s
 	return links
 }
 
+// linksFromAnchors construit les liens d'une page à partir de ses ancres.
+// Une ancre dont le crawler a résolu l'URL est interne ; les autres sont
+// résolues ici et classées selon leur domaine. Un lien est nofollow par son
+// attribut rel ou par la directive robots de la page.
+func (l *LinkingMapper) linksFromAnchors(page crawler.PageData, baseDomain string) []agents.Link {
+	var links []agents.Link
+	for _, anchor := range page.Anchors {
+		href := strings.TrimSpace(anchor.Href)
+		if href == "" || strings.HasPrefix(href, "javascript:") || strings.HasPrefix(href, "#") {
+			continue
+		}
+
+		target, linkType := anchor.URL, "internal"
+		if target == "" {
+			target = l.resolveURL(href, page.URL)
+			if target == "" {
+				continue
+			}
+			linkType = l.determineLinkType(target, baseDomain)
+		}
+
+		links = append(links, agents.Link{
+			Source:     page.URL,
+			Target:     target,
+			AnchorText: anchor.Text,
+			Type:       linkType,
+			IsNoFollow: page.Robots.NoFollow || anchor.NoFollow(),
+		})
+	}
+	return links
+}
+
 // resolveURL résout une URL relative en URL absolue
 func (l *LinkingMapper) resolveURL(href, baseURL string) string {
 	// URL déjà absolue
@@ -456,4 +456,75 @@ func TestLinkingMapper_CleanHTML(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestLinkingMapper_MapLinksFromCrawlGraph(t *testing.T) {
+	mapper := NewLinkingMapper()
+
+	// Anchors resolved by the crawler's link graph pass
+	crawlResult := &crawler.CrawlResult{
+		Pages: []crawler.PageData{
+			{
+				URL: "https://example.com/",
+				Anchors: []crawler.Anchor{
+					{Text: "Services", Href: "services/?utm_source=nav", URL: "https://example.com/services"},
+					{Text: "Partner", Href: "https://partner.org/"},
+					{Text: "Top", Href: "#top"},
+				},
+			},
+		},
+	}
+
+	linkMap, err := mapper.MapLinks(crawlResult)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(linkMap.InternalLinks) != 1 || linkMap.InternalLinks[0].Target != "https://example.com/services" {
+		t.Errorf("Expected the normalized internal target, got %+v", linkMap.InternalLinks)
+	}
+	if len(linkMap.ExternalLinks) != 1 || linkMap.ExternalLinks[0].Target != "https://partner.org/" {
+		t.Errorf("Expected one external link, got %+v", linkMap.ExternalLinks)
+	}
+}
+
+func TestLinkingMapper_MapLinksKeepsAnchorNoFollow(t *testing.T) {
+	mapper := NewLinkingMapper()
+
+	crawlResult := &crawler.CrawlResult{
+		Pages: []crawler.PageData{
+			{
+				URL: "https://example.com/",
+				Anchors: []crawler.Anchor{
+					{Text: "Services", Href: "/services", URL: "https://example.com/services"},
+					{Text: "Login", Href: "/login", Rel: "nofollow", URL: "https://example.com/login"},
+				},
+			},
+			{
+				URL:    "https://example.com/services",
+				Robots: crawler.RobotsDirectives{NoFollow: true},
+				Anchors: []crawler.Anchor{
+					{Text: "Home", Href: "/", URL: "https://example.com/"},
+				},
+			},
+		},
+	}
+
+	linkMap, err := mapper.MapLinks(crawlResult)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	nofollow := make(map[string]bool)
+	for _, link := range linkMap.InternalLinks {
+		nofollow[link.Target] = link.IsNoFollow
+	}
+	expected := map[string]bool{
+		"https://example.com/services": false,
+		"https://example.com/login":    true,
+		"https://example.com/":         true,
+	}
+	for target, want := range expected {
+		if got, ok := nofollow[target]; !ok || got != want {
+			t.Errorf("Expected %s nofollow=%v, got %v (found %v)", target, want, got, ok)
+		}
+	}
+}
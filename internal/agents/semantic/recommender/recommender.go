@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"firesalamander/internal/agents"
+	"firesalamander/internal/agents/crawler"
 )
 
 // Ensure SemanticRecommender implements the Agent interface
@@ -118,6 +119,22 @@ func (sr *SemanticRecommender) parseInput(data interface{}) (*RecommendationRequ
 	return &request, nil
 }
 
+// ContentFromPage builds the content analysis of a crawled page, with its
+// place in the crawl link graph
+func ContentFromPage(page crawler.PageData) ContentAnalysis {
+	return ContentAnalysis{
+		URL:      page.URL,
+		Title:    page.Title,
+		Content:  page.Content,
+		Language: page.Lang,
+		Links: &LinkMetrics{
+			UniqueInlinks:  page.UniqueInlinks,
+			UniqueOutlinks: page.UniqueOutlinks,
+			LinkDepth:      page.LinkDepth,
+		},
+	}
+}
+
 // generateRecommendations creates comprehensive recommendations based on content analysis
 func (sr *SemanticRecommender) generateRecommendations(request RecommendationRequest) []Recommendation {
 	var allRecommendations []Recommendation
@@ -439,6 +456,62 @@ func (sr *SemanticRecommender) generateTechnicalRecommendations(content ContentA
 		recID++
 	}
 
+	// Internal linking, from the crawl link graph
+	if content.Links != nil && content.Links.LinkDepth != 0 {
+		if content.Links.UniqueInlinks <= 1 {
+			recommendations = append(recommendations, Recommendation{
+				ID:          fmt.Sprintf("technical_%d", recID),
+				Title:       "Strengthen Internal Linking",
+				Description: fmt.Sprintf("Only %d internal page(s) link to this page, which limits its discovery and the authority it receives.", content.Links.UniqueInlinks),
+				Category:    "technical",
+				Type:        "internal_linking",
+				Impact:      6.0,
+				Confidence:  0.8,
+				Priority:    "medium",
+				Effort:      "low",
+				Tags:        []string{"links", "internal-linking", "technical"},
+				Implementation: Implementation{
+					Steps: []string{
+						"Link to this page from related content",
+						"Add it to relevant category or hub pages",
+						"Use descriptive anchor text",
+					},
+					TimeEstimate: "30 minutes",
+					Difficulty:   "low",
+				},
+			})
+			recID++
+		}
+
+		if content.Links.LinkDepth < 0 || content.Links.LinkDepth > 3 {
+			description := fmt.Sprintf("This page is %d clicks away from the home page.", content.Links.LinkDepth)
+			if content.Links.LinkDepth < 0 {
+				description = "No internal link path leads to this page from the home page."
+			}
+			recommendations = append(recommendations, Recommendation{
+				ID:          fmt.Sprintf("technical_%d", recID),
+				Title:       "Reduce Click Depth",
+				Description: description,
+				Category:    "technical",
+				Type:        "click_depth",
+				Impact:      5.0,
+				Confidence:  0.7,
+				Priority:    "medium",
+				Effort:      "medium",
+				Tags:        []string{"links", "architecture", "technical"},
+				Implementation: Implementation{
+					Steps: []string{
+						"Link to this page from higher level pages",
+						"Review menus and breadcrumbs",
+					},
+					TimeEstimate: "1 hour",
+					Difficulty:   "medium",
+				},
+			})
+			recID++
+		}
+	}
+
 	return recommendations
 }
 
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"firesalamander/internal/agents"
+	"firesalamander/internal/agents/crawler"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -292,4 +293,29 @@ func BenchmarkSemanticRecommenderProcess(b *testing.B) {
 			b.Fatal(err)
 		}
 	}
-}
\ No newline at end of file
+}
+
+func TestInternalLinkingRecommendations(t *testing.T) {
+	recommender := NewSemanticRecommender()
+
+	content := ContentFromPage(crawler.PageData{
+		URL:           "https://example.com/deep/page",
+		Title:         "Deep page",
+		UniqueInlinks: 1,
+		LinkDepth:     5,
+	})
+	types := make(map[string]bool)
+	for _, rec := range recommender.generateTechnicalRecommendations(content) {
+		types[rec.Type] = true
+	}
+	assert.True(t, types["internal_linking"])
+	assert.True(t, types["click_depth"])
+
+	// The home page and pages without link data get neither
+	home := ContentFromPage(crawler.PageData{URL: "https://example.com/", LinkDepth: 0})
+	for _, rec := range recommender.generateTechnicalRecommendations(home) {
+		assert.NotEqual(t, "internal_linking", rec.Type)
+		assert.NotEqual(t, "click_depth", rec.Type)
+	}
+	assert.Empty(t, recommender.generateTechnicalRecommendations(ContentAnalysis{URL: "https://example.com/about"}))
+}
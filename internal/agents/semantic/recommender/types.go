@@ -17,6 +17,15 @@ type ContentAnalysis struct {
 	WordCount   int      `json:"word_count"`
 	ReadingTime int      `json:"reading_time_minutes"`
 	Language    string   `json:"language,omitempty"`
+	// Links places the page in the crawl link graph, when known
+	Links *LinkMetrics `json:"links,omitempty"`
+}
+
+// LinkMetrics are the internal link figures of a page computed by the crawler
+type LinkMetrics struct {
+	UniqueInlinks  int `json:"unique_inlinks"`
+	UniqueOutlinks int `json:"unique_outlinks"`
+	LinkDepth      int `json:"link_depth"` // -1 when no crawled link leads to the page
 }
 
 // AnalysisContext provides contextual information for recommendations
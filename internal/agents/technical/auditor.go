@@ -420,6 +420,15 @@ func (t *TechnicalAuditor) collectIssues(page *agents.PageData) []agents.Technic
 		})
 	}
 
+	// Issues d'encodage : le charset déclaré ne correspond pas au document
+	for _, conflict := range page.CharsetConflicts {
+		issues = append(issues, agents.TechnicalIssue{
+			Type:        "encoding",
+			Severity:    "medium",
+			Description: conflict,
+		})
+	}
+
 	// Issues d'optimisation
 	if !strings.Contains(page.HTML, `<meta name="robots"`) {
 		issues = append(issues, agents.TechnicalIssue{
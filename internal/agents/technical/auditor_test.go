@@ -470,4 +470,30 @@ func TestTechnicalAuditor_ExtractAttribute(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestTechnicalAuditor_CharsetConflicts(t *testing.T) {
+	auditor := NewTechnicalAuditor()
+
+	report, err := auditor.AuditPage(&agents.PageData{
+		URL:              "https://example.com",
+		HTML:             "<html><head><title>Réservation</title></head><body></body></html>",
+		CharsetConflicts: []string{"Page declares utf-8 but is encoded as windows-1252"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	found := false
+	for _, issue := range report.Issues {
+		if issue.Type == "encoding" {
+			found = true
+			if issue.Severity != "medium" {
+				t.Errorf("Expected medium severity, got %s", issue.Severity)
+			}
+		}
+	}
+	if !found {
+		t.Error("Expected an encoding issue for the charset conflict")
+	}
+}
@@ -3,6 +3,9 @@ package config
 import (
 	"fmt"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"firesalamander/internal/constants"
@@ -10,11 +13,26 @@ import (
 )
 
 type CrawlerConfig struct {
-	Performance Performance `yaml:"performance"`
-	Respect     Respect     `yaml:"respect"`
-	Limits      Limits      `yaml:"limits"`
-	UserAgent   string      `yaml:"user_agent"`
-	Exclusions  Exclusions  `yaml:"exclusions"`
+	Performance   Performance   `yaml:"performance"`
+	Respect       Respect       `yaml:"respect"`
+	Limits        Limits        `yaml:"limits"`
+	UserAgent     string        `yaml:"user_agent"`
+	Exclusions    Exclusions    `yaml:"exclusions"`
+	Checkpoint    Checkpoint    `yaml:"checkpoint"`
+	Sampling      Sampling      `yaml:"sampling"`
+	Normalization Normalization `yaml:"normalization"`
+	Scope         Scope         `yaml:"scope"`
+	List          List          `yaml:"list"`
+	Traps         Traps         `yaml:"traps"`
+	Assets        Assets        `yaml:"assets"`
+	Archive       Archive       `yaml:"archive"`
+	Distributed   Distributed   `yaml:"distributed"`
+	Memory        Memory        `yaml:"memory"`
+	Budgets       Budgets       `yaml:"budgets"`
+	Auth          Auth          `yaml:"auth"`
+	// HostOverrides maps a hostname to the IP (or IP:port) to connect to,
+	// so a staging server can be crawled under the production hostname
+	HostOverrides map[string]string `yaml:"host_overrides"`
 }
 
 type Performance struct {
@@ -22,6 +40,8 @@ type Performance struct {
 	RequestTimeout     time.Duration `yaml:"request_timeout"`
 	RetryAttempts      int           `yaml:"retry_attempts"`
 	CacheTTL           time.Duration `yaml:"cache_ttl"`
+	RateLimit          string        `yaml:"rate_limit"`
+	CacheDir           string        `yaml:"cache_dir"`
 }
 
 type Respect struct {
@@ -36,11 +56,146 @@ type Limits struct {
 	Strategy string `yaml:"strategy"`
 }
 
+// Sampling decides which URLs a capped crawl fetches first. Quotas left at
+// zero are derived from Limits.MaxURLs.
+type Sampling struct {
+	Strategy       string   `yaml:"strategy"`
+	PriorityPages  []string `yaml:"priority_pages"`
+	DirectoryQuota int      `yaml:"directory_quota"`
+	TemplateQuota  int      `yaml:"template_quota"`
+}
+
+// Checkpoint controls periodic snapshots of the crawl frontier so an
+// interrupted crawl can be resumed
+type Checkpoint struct {
+	Enabled       bool `yaml:"enabled"`
+	IntervalPages int  `yaml:"interval_pages"`
+}
+
 type Exclusions struct {
 	Extensions []string `yaml:"extensions"`
 	Patterns   []string `yaml:"patterns"`
 }
 
+// Normalization is the URL canonicalization policy. The zero value lowercases
+// the host, drops default ports, sorts the query, strips tracking parameters
+// and trailing slashes. StripSessionParams also drops session IDs such as
+// PHPSESSID, JSESSIONID or sid.
+type Normalization struct {
+	KeepHostCase       bool     `yaml:"keep_host_case"`
+	KeepDefaultPort    bool     `yaml:"keep_default_port"`
+	KeepQueryOrder     bool     `yaml:"keep_query_order"`
+	KeepTrailingSlash  bool     `yaml:"keep_trailing_slash"`
+	StripSessionParams bool     `yaml:"strip_session_params"`
+	AllowParams        []string `yaml:"allow_params"`
+	DenyParams         []string `yaml:"deny_params"`
+	WWW                string   `yaml:"www"`
+	Scheme             string   `yaml:"scheme"`
+}
+
+// List configures list mode crawls, which fetch a fixed set of URLs.
+// RecordLinks keeps the internal links found on those pages, unfetched.
+type List struct {
+	RecordLinks bool `yaml:"record_links"`
+}
+
+// Traps tunes crawler trap detection. Thresholds left at zero use the
+// crawler defaults.
+type Traps struct {
+	Disabled bool `yaml:"disabled"`
+	// MaxSegmentRepeats is how many times a path segment may appear in a URL
+	MaxSegmentRepeats int `yaml:"max_segment_repeats"`
+	// MaxQueryVariants is how many facet combinations a path may have, item
+	// IDs and page numbers aside
+	MaxQueryVariants int `yaml:"max_query_variants"`
+	// MaxDateVariants is how many dates a calendar-like URL may take
+	MaxDateVariants int `yaml:"max_date_variants"`
+	// MaxDuplicates is how many URLs of a path may share the same content
+	MaxDuplicates int `yaml:"max_duplicates"`
+}
+
+// Assets controls the pass checking the images, stylesheets, scripts and
+// PDFs referenced by crawled pages once the crawl is over. Limits left at
+// zero use the crawler defaults.
+type Assets struct {
+	Disabled bool `yaml:"disabled"`
+	// MaxAssets is how many distinct assets are checked
+	MaxAssets int `yaml:"max_assets"`
+	// MaxBytes caps the download of an asset whose size HEAD does not give
+	MaxBytes int64 `yaml:"max_bytes"`
+}
+
+// Archive controls the WARC archive of a crawl. With WARC on, every request
+// and response is written to crawl.warc in the audit directory, so the audit
+// can be replayed offline. With Replay set, the crawl is answered from that
+// archive instead of the network.
+type Archive struct {
+	WARC   bool   `yaml:"warc"`
+	Replay string `yaml:"replay"`
+}
+
+// Distributed tunes coordinator/worker crawls, where worker processes lease
+// batches of URLs from the coordinator over HTTP. Values left at zero use
+// the crawler defaults.
+type Distributed struct {
+	// LeaseTTL is how long a worker may hold a batch before it is handed to
+	// another worker
+	LeaseTTL time.Duration `yaml:"lease_ttl"`
+	// BatchSize is how many URLs a worker leases at once
+	BatchSize int `yaml:"batch_size"`
+	// MaxInFlight is how many URLs may be leased across all workers
+	MaxInFlight int `yaml:"max_in_flight"`
+	// Token is the shared secret workers present to the coordinator API.
+	// ${NAME} references are read from the environment.
+	Token string `yaml:"token"`
+}
+
+// Budgets cap the resources of an audit. A crawl hitting MaxTotalBytes or
+// MaxDuration stops with a partial result; MaxPagesPerDirectory only skips
+// the pages over budget. Budgets left at zero are unlimited, except
+// MaxBodyBytes which uses the crawler default.
+type Budgets struct {
+	// MaxBodyBytes truncates larger responses, which are flagged
+	MaxBodyBytes int64 `yaml:"max_body_bytes"`
+	// MaxTotalBytes caps the page and asset bytes downloaded by the audit
+	MaxTotalBytes int64         `yaml:"max_total_bytes"`
+	MaxDuration   time.Duration `yaml:"max_duration"`
+	// MaxPagesPerDirectory caps the pages crawled under a first path segment
+	MaxPagesPerDirectory int `yaml:"max_pages_per_directory"`
+}
+
+// Memory bounds what a crawl keeps in memory, for sites of hundreds of
+// thousands of URLs. Limits left at zero keep everything in memory. Memory
+// still grows with the number of crawled pages: even lean, each one keeps
+// its summary, around 1 KB, and the link graph built at the end of the crawl
+// indexes their URLs, so a 200,000-page crawl needs a few hundred MB.
+type Memory struct {
+	// FrontierURLs is how many queued URLs stay in memory, the others wait
+	// in segment files
+	FrontierURLs int `yaml:"frontier_urls"`
+	// VisitedURLs is how many visited URLs stay in memory before moving to
+	// a Bloom filter backed by disk
+	VisitedURLs int `yaml:"visited_urls"`
+	// LeanPages keeps only the summary fields of crawled pages in memory,
+	// their text and lists staying in pages.jsonl. The link graph goes to
+	// links.jsonl, and the blocked, redirected and excluded URLs to
+	// records.jsonl. It needs an output directory, and the crawl result then
+	// carries only page summaries. Off by default, as the analyses need the
+	// text of the pages in memory.
+	LeanPages bool `yaml:"lean_pages"`
+	// SpillDir holds the spilled frontier and visited URLs, by default in
+	// the audit output directory or a temporary directory
+	SpillDir string `yaml:"spill_dir"`
+}
+
+// Scope restricts the crawl beyond the seed host. Include and Exclude rules
+// are substrings, globs ("/blog/*") or regexes prefixed with "re:".
+type Scope struct {
+	IncludeSubdomains bool     `yaml:"include_subdomains"`
+	Include           []string `yaml:"include"`
+	Exclude           []string `yaml:"exclude"`
+}
+
 func LoadCrawlerConfig(path string) (*CrawlerConfig, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -68,10 +223,147 @@ func LoadCrawlerConfig(path string) (*CrawlerConfig, error) {
 	if wrapper.Crawler.Limits.MaxDepth == 0 {
 		wrapper.Crawler.Limits.MaxDepth = 3
 	}
+	if _, err := ParseRateLimit(wrapper.Crawler.Performance.RateLimit); err != nil {
+		return nil, err
+	}
+	switch wrapper.Crawler.CrawlStrategy() {
+	case constants.CrawlStrategyBFS, constants.CrawlStrategySmart, constants.CrawlStrategyAggressive:
+	default:
+		return nil, fmt.Errorf("unknown crawl strategy %q", wrapper.Crawler.CrawlStrategy())
+	}
+	if err := wrapper.Crawler.validateURLRules(); err != nil {
+		return nil, err
+	}
+	if err := wrapper.Crawler.Budgets.validate(); err != nil {
+		return nil, err
+	}
+	wrapper.Crawler.Auth.expandSecrets()
+	wrapper.Crawler.Distributed.Token = expandEnv(wrapper.Crawler.Distributed.Token)
 
 	return &wrapper.Crawler, nil
 }
 
+func (b Budgets) validate() error {
+	if b.MaxBodyBytes < 0 || b.MaxTotalBytes < 0 || b.MaxDuration < 0 || b.MaxPagesPerDirectory < 0 {
+		return fmt.Errorf("crawl budgets must not be negative")
+	}
+	return nil
+}
+
+// CrawlStrategy returns the frontier strategy to use. Limits.Strategy wins
+// over sampling.strategy; "none" or nothing means plain breadth-first.
+func (c CrawlerConfig) CrawlStrategy() string {
+	strategy := c.Limits.Strategy
+	if strategy == "" {
+		strategy = c.Sampling.Strategy
+	}
+	strategy = strings.ToLower(strings.TrimSpace(strategy))
+	if strategy == "" || strategy == "none" {
+		return constants.CrawlStrategyBFS
+	}
+	return strategy
+}
+
+// Auth gives access to sites behind HTTP authentication or a login form,
+// such as staging environments. Values may reference environment variables
+// as ${NAME} to keep secrets out of the file.
+type Auth struct {
+	BasicUser     string            `yaml:"basic_user"`
+	BasicPassword string            `yaml:"basic_password"`
+	Headers       map[string]string `yaml:"headers"`
+	Cookies       map[string]string `yaml:"cookies"`
+	Login         FormLogin         `yaml:"login"`
+}
+
+// FormLogin posts credentials to a login form before crawling and keeps the
+// session cookies. Hidden fields of the form, such as CSRF tokens, are sent
+// along with Fields.
+type FormLogin struct {
+	URL           string            `yaml:"url"`
+	Action        string            `yaml:"action"`
+	Fields        map[string]string `yaml:"fields"`
+	SuccessCookie string            `yaml:"success_cookie"`
+}
+
+// envReference matches the ${NAME} form, the only one expanded in secrets
+var envReference = regexp.MustCompile(`\$\{[A-Za-z_][A-Za-z0-9_]*\}`)
+
+// expandEnv replaces ${NAME} references with the environment values and
+// leaves any other "$" alone, so that a literal password like p@$$w0rd
+// survives
+func expandEnv(value string) string {
+	return envReference.ReplaceAllStringFunc(value, func(ref string) string {
+		return os.Getenv(ref[2 : len(ref)-1])
+	})
+}
+
+// expandSecrets replaces ${NAME} references in credentials with the
+// environment values
+func (a *Auth) expandSecrets() {
+	a.BasicUser = expandEnv(a.BasicUser)
+	a.BasicPassword = expandEnv(a.BasicPassword)
+	for _, values := range []map[string]string{a.Headers, a.Cookies, a.Login.Fields} {
+		for key, value := range values {
+			values[key] = expandEnv(value)
+		}
+	}
+}
+
+// validateURLRules rejects normalization modes and scope regexes that the
+// crawler could not apply
+func (c CrawlerConfig) validateURLRules() error {
+	switch c.Normalization.WWW {
+	case "", "add", "strip":
+	default:
+		return fmt.Errorf("invalid normalization.www %q", c.Normalization.WWW)
+	}
+	switch c.Normalization.Scheme {
+	case "", "http", "https":
+	default:
+		return fmt.Errorf("invalid normalization.scheme %q", c.Normalization.Scheme)
+	}
+
+	rules := append(append([]string(nil), c.Scope.Include...), c.Scope.Exclude...)
+	rules = append(rules, c.Exclusions.Patterns...)
+	for _, rule := range rules {
+		if expr, ok := strings.CutPrefix(rule, "re:"); ok {
+			if _, err := regexp.Compile(expr); err != nil {
+				return fmt.Errorf("invalid scope rule %q: %w", rule, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ParseRateLimit converts a rate such as "10/s", "100/m" or "60/h" into
+// requests per second. An empty string means no limit and returns 0.
+func ParseRateLimit(rate string) (float64, error) {
+	rate = strings.TrimSpace(rate)
+	if rate == "" {
+		return 0, nil
+	}
+
+	count, unit, hasUnit := strings.Cut(rate, "/")
+	value, err := strconv.ParseFloat(strings.TrimSpace(count), 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid rate limit %q", rate)
+	}
+	if !hasUnit {
+		return value, nil
+	}
+
+	switch strings.TrimSpace(unit) {
+	case "s":
+		return value, nil
+	case "m":
+		return value / 60, nil
+	case "h":
+		return value / 3600, nil
+	default:
+		return 0, fmt.Errorf("invalid rate limit unit in %q", rate)
+	}
+}
+
 // Config represents the main application configuration
 type Config struct {
 	Server ServerConfig `yaml:"server"`
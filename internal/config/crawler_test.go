@@ -0,0 +1,163 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+		wantErr  bool
+		name     string
+	}{
+		{"", 0, false, "empty means unlimited"},
+		{"10/s", 10, false, "per second"},
+		{"120/m", 2, false, "per minute"},
+		{"3600/h", 1, false, "per hour"},
+		{"5", 5, false, "bare number"},
+		{"ten/s", 0, true, "invalid count"},
+		{"10/d", 0, true, "invalid unit"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rate, err := ParseRateLimit(tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.InDelta(t, tt.expected, rate, 0.0001)
+		})
+	}
+}
+
+func TestCrawlStrategy(t *testing.T) {
+	assert.Equal(t, "bfs", CrawlerConfig{}.CrawlStrategy())
+	assert.Equal(t, "bfs", CrawlerConfig{Sampling: Sampling{Strategy: "none"}}.CrawlStrategy())
+	assert.Equal(t, "smart", CrawlerConfig{Sampling: Sampling{Strategy: "Smart"}}.CrawlStrategy())
+	assert.Equal(t, "aggressive", CrawlerConfig{
+		Limits:   Limits{Strategy: "aggressive"},
+		Sampling: Sampling{Strategy: "smart"},
+	}.CrawlStrategy())
+}
+
+func TestValidateURLRules(t *testing.T) {
+	valid := CrawlerConfig{
+		Normalization: Normalization{WWW: "strip", Scheme: "https"},
+		Scope:         Scope{Include: []string{"/blog/*", `re:^https://example\.com/p/\d+$`}},
+	}
+	require.NoError(t, valid.validateURLRules())
+
+	assert.Error(t, CrawlerConfig{Normalization: Normalization{WWW: "maybe"}}.validateURLRules())
+	assert.Error(t, CrawlerConfig{Normalization: Normalization{Scheme: "ftp"}}.validateURLRules())
+	assert.Error(t, CrawlerConfig{Scope: Scope{Exclude: []string{"re:("}}}.validateURLRules())
+	assert.Error(t, CrawlerConfig{Exclusions: Exclusions{Patterns: []string{"re:[a-"}}}.validateURLRules())
+}
+
+func TestAuthExpandSecrets(t *testing.T) {
+	t.Setenv("STAGING_PASSWORD", "s3cret")
+	t.Setenv("PREVIEW_TOKEN", "abc")
+
+	auth := Auth{
+		BasicUser:     "staging",
+		BasicPassword: "${STAGING_PASSWORD}",
+		Headers:       map[string]string{"X-Preview-Token": "${PREVIEW_TOKEN}"},
+		Cookies:       map[string]string{"session": "${STAGING_PASSWORD}-${PREVIEW_TOKEN}"},
+		Login:         FormLogin{Fields: map[string]string{"password": "$STAGING_PASSWORD"}},
+	}
+	auth.expandSecrets()
+
+	assert.Equal(t, "staging", auth.BasicUser)
+	assert.Equal(t, "s3cret", auth.BasicPassword)
+	assert.Equal(t, "abc", auth.Headers["X-Preview-Token"])
+	assert.Equal(t, "s3cret-abc", auth.Cookies["session"])
+	// Only the ${NAME} form is expanded
+	assert.Equal(t, "$STAGING_PASSWORD", auth.Login.Fields["password"])
+}
+
+func TestAuthExpandSecretsKeepsLiteralDollars(t *testing.T) {
+	t.Setenv("w0rd", "oops")
+
+	auth := Auth{
+		BasicUser:     "admin",
+		BasicPassword: "p@$$w0rd",
+		Login:         FormLogin{Fields: map[string]string{"password": "$w0rd ${ and $$"}},
+	}
+	auth.expandSecrets()
+
+	assert.Equal(t, "p@$$w0rd", auth.BasicPassword)
+	assert.Equal(t, "$w0rd ${ and $$", auth.Login.Fields["password"])
+}
+
+func TestLoadCrawlerConfigExpandsToken(t *testing.T) {
+	t.Setenv("CRAWLER_TOKEN", "s3cret")
+
+	cfg, err := LoadCrawlerConfig("../../config/crawler.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret", cfg.Distributed.Token)
+
+	// A literal token keeps its dollars
+	path := filepath.Join(t.TempDir(), "crawler.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("crawler:\n  distributed:\n    token: 'to$$k3n$CRAWLER_TOKEN'\n"), 0644))
+	cfg, err = LoadCrawlerConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, "to$$k3n$CRAWLER_TOKEN", cfg.Distributed.Token)
+}
+
+func TestLoadTechRules(t *testing.T) {
+	rules, err := LoadTechRules("../../config/tech_rules.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, DefaultTechRules(), *rules)
+
+	path := filepath.Join(t.TempDir(), "tech_rules.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("tech_audit:\n  images:\n    max_size_kb: 200\n"), 0644))
+	rules, err = LoadTechRules(path)
+	require.NoError(t, err)
+	assert.Equal(t, 200, rules.Images.MaxSizeKB)
+	assert.Equal(t, "medium", rules.Images.OversizedSeverity)
+	assert.Equal(t, 0.8, rules.Duplicates.SimilarityThreshold)
+
+	require.NoError(t, os.WriteFile(path, []byte("tech_audit:\n  duplicates:\n    similarity_threshold: 0.95\n"), 0644))
+	rules, err = LoadTechRules(path)
+	require.NoError(t, err)
+	assert.Equal(t, 0.95, rules.Duplicates.SimilarityThreshold)
+
+	require.NoError(t, os.WriteFile(path, []byte("tech_audit:\n  duplicates:\n    similarity_threshold: 1.5\n"), 0644))
+	_, err = LoadTechRules(path)
+	assert.Error(t, err)
+}
+
+func TestLoadCrawlerConfigBudgets(t *testing.T) {
+	cfg, err := LoadCrawlerConfig("../../config/crawler.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, int64(10485760), cfg.Budgets.MaxBodyBytes)
+
+	path := filepath.Join(t.TempDir(), "crawler.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("crawler:\n  budgets:\n    max_duration: 30m\n    max_pages_per_directory: 500\n"), 0644))
+	cfg, err = LoadCrawlerConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, 30*time.Minute, cfg.Budgets.MaxDuration)
+	assert.Equal(t, 500, cfg.Budgets.MaxPagesPerDirectory)
+
+	require.NoError(t, os.WriteFile(path, []byte("crawler:\n  budgets:\n    max_total_bytes: -1\n"), 0644))
+	_, err = LoadCrawlerConfig(path)
+	assert.Error(t, err)
+}
+
+func TestDefaultCrawlerConfigHasNoExclusions(t *testing.T) {
+	// The default exclusions used to sit outside "crawler:" and were never
+	// applied, so enabling them would silently narrow existing audits
+	cfg, err := LoadCrawlerConfig("../../config/crawler.yaml")
+	require.NoError(t, err)
+	assert.Empty(t, cfg.Exclusions.Extensions)
+	assert.Empty(t, cfg.Exclusions.Patterns)
+	assert.False(t, cfg.Normalization.StripSessionParams)
+}
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TechRules holds the thresholds of the technical audit from tech_rules.yaml.
+// Only the sections backed by code are read.
+type TechRules struct {
+	Images     ImageRules     `yaml:"images"`
+	Duplicates DuplicateRules `yaml:"duplicates"`
+}
+
+// ImageRules are the image thresholds of the technical audit
+type ImageRules struct {
+	AltMissingSeverity string `yaml:"alt_missing_severity"`
+	OversizedSeverity  string `yaml:"oversized_severity"`
+	MaxSizeKB          int    `yaml:"max_size_kb"`
+}
+
+// DuplicateRules tune the duplicate content detection
+type DuplicateRules struct {
+	// SimilarityThreshold is the share of shingles two pages must have in
+	// common to be near duplicates
+	SimilarityThreshold float64 `yaml:"similarity_threshold"`
+}
+
+// DefaultTechRules returns the rules shipped in config/tech_rules.yaml
+func DefaultTechRules() TechRules {
+	return TechRules{
+		Images: ImageRules{
+			AltMissingSeverity: "high",
+			OversizedSeverity:  "medium",
+			MaxSizeKB:          500,
+		},
+		Duplicates: DuplicateRules{
+			SimilarityThreshold: 0.8,
+		},
+	}
+}
+
+// LoadTechRules reads tech_rules.yaml. Missing values keep their defaults.
+func LoadTechRules(path string) (*TechRules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tech rules: %w", err)
+	}
+
+	wrapper := struct {
+		TechAudit TechRules `yaml:"tech_audit"`
+	}{TechAudit: DefaultTechRules()}
+
+	if err := yaml.Unmarshal(data, &wrapper); err != nil {
+		return nil, fmt.Errorf("failed to parse tech rules: %w", err)
+	}
+	if wrapper.TechAudit.Images.MaxSizeKB < 0 {
+		return nil, fmt.Errorf("images.max_size_kb must not be negative")
+	}
+	if threshold := wrapper.TechAudit.Duplicates.SimilarityThreshold; threshold <= 0 || threshold > 1 {
+		return nil, fmt.Errorf("duplicates.similarity_threshold must be in ]0, 1]")
+	}
+
+	return &wrapper.TechAudit, nil
+}
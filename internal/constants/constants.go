@@ -37,6 +37,8 @@ const (
 	AgentNameTechnical  = "technical_auditor"
 	AgentNameLinking    = "linking_mapper"
 	AgentNameBrokenLinks = "broken_links_detector"
+	AgentNameInternational = "international_auditor"
+	AgentNameDuplicate = "duplicate_detector"
 )
 
 // Keyword extraction constants
@@ -86,6 +88,13 @@ const (
 	ProgressFullComplete      = 100.0
 )
 
+// Crawl frontier strategies
+const (
+	CrawlStrategyBFS        = "bfs"
+	CrawlStrategySmart      = "smart"
+	CrawlStrategyAggressive = "aggressive"
+)
+
 // Analysis types
 const (
 	AnalysisTypeQuick = "quick"
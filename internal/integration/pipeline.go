@@ -38,6 +38,7 @@ type AuditExecution struct {
 	Error       string                 `json:"error,omitempty"`
 	Results     map[string]interface{} `json:"results"`
 	OutputDir   string                 `json:"output_dir"`
+	Resumed     bool                   `json:"resumed"`
 }
 
 // JSONRPCMessage represents a JSON-RPC 2.0 message
@@ -84,6 +85,9 @@ func NewPipeline(cfg *config.Config) (*Pipeline, error) {
 	
 	semanticClient := semantic.NewSemanticClient(constants.DefaultSemanticServiceURL)
 	reportEngine := report.NewReportEngine()
+	if rules, err := config.LoadTechRules("config/tech_rules.yaml"); err == nil {
+		reportEngine.SetTechRules(*rules)
+	}
 
 	return &Pipeline{
 		config:    cfg,
@@ -95,11 +99,19 @@ func NewPipeline(cfg *config.Config) (*Pipeline, error) {
 	}, nil
 }
 
-// StartAudit begins a complete audit pipeline
+// StartAudit begins a complete audit pipeline. An audit whose output
+// directory holds a crawl checkpoint, left by a crash or a server restart,
+// resumes its crawl from there when the checkpoint is a crawl of the same
+// seed URL, or whatever it holds when the "resume" option is set.
 func (p *Pipeline) StartAudit(ctx context.Context, request v2.AuditRequest) error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
+	outputDir := filepath.Join("audits", request.AuditID)
+	resumed := p.crawler.CanResume(outputDir, request.SeedURL, false)
+	if resume, _ := request.Options["resume"].(bool); resume {
+		resumed = crawler.HasCheckpoint(outputDir)
+	}
 	execution := &AuditExecution{
 		AuditID:     request.AuditID,
 		Status:      "pending",
@@ -107,7 +119,11 @@ func (p *Pipeline) StartAudit(ctx context.Context, request v2.AuditRequest) erro
 		CurrentStep: "initializing",
 		StartTime:   time.Now(),
 		Results:     make(map[string]interface{}),
-		OutputDir:   filepath.Join("audits", request.AuditID),
+		OutputDir:   outputDir,
+		Resumed:     resumed,
+	}
+	if resumed {
+		execution.CurrentStep = "resuming"
 	}
 
 	p.audits[request.AuditID] = execution
@@ -183,7 +199,13 @@ func (p *Pipeline) runCrawlStep(ctx context.Context, request v2.AuditRequest, ex
 
 	// Execute crawl using existing crawler
 	outputDir := filepath.Join("audits", request.AuditID)
-	crawlResult, err := p.crawler.Crawl(ctx, request.SeedURL, outputDir)
+	var crawlResult *crawler.CrawlResult
+	var err error
+	if execution.Resumed {
+		crawlResult, err = p.crawler.Resume(ctx, outputDir)
+	} else {
+		crawlResult, err = p.crawler.Crawl(ctx, request.SeedURL, outputDir)
+	}
 
 	if err != nil {
 		return fmt.Errorf("crawl failed: %w", err)
@@ -191,6 +213,7 @@ func (p *Pipeline) runCrawlStep(ctx context.Context, request v2.AuditRequest, ex
 
 	// Save crawl results
 	execution.Results["crawl"] = crawlResult
+	execution.Results["redirects"] = p.crawler.AuditRedirects(crawlResult)
 	p.updateProgress(execution, 30.0)
 
 	return nil
@@ -199,19 +222,37 @@ func (p *Pipeline) runCrawlStep(ctx context.Context, request v2.AuditRequest, ex
 func (p *Pipeline) runTechnicalStep(ctx context.Context, request v2.AuditRequest, execution *AuditExecution) error {
 	p.updateStatus(execution, "analyzing_tech", "technical analysis", "")
 
-	crawlData, ok := execution.Results["crawl"].(*crawler.CrawlResult)
-	if !ok {
-		return fmt.Errorf("invalid crawl data")
+	// Read the crawled pages one by one rather than from the in-memory result
+	pages, err := crawler.OpenPageReader(execution.OutputDir)
+	if err != nil {
+		return fmt.Errorf("invalid crawl data: %w", err)
 	}
+	defer func() { _ = pages.Close() }()
 
 	// Use new technical auditor interface
 	var technicalResults []*agents.AgentResult
-	for _, page := range crawlData.Pages {
+	// Pages whose stored document cannot be read are reported, not audited
+	skipped := make(map[string]string)
+	for pages.Next() {
+		page := pages.Page()
+		// Audit the real document and response headers, not the extracted text
+		html, err := crawler.LoadRawHTML(execution.OutputDir, page)
+		if err != nil {
+			fmt.Printf("Warning: technical audit skipped %s: %v\n", page.URL, err)
+			skipped[page.URL] = err.Error()
+			continue
+		}
+		headers := page.Headers
+		if headers == nil {
+			headers = make(map[string]string)
+		}
+
 		// Convert crawler.PageData to agents.PageData
 		agentPageData := &agents.PageData{
-			URL:     page.URL,
-			HTML:    page.Content, // Use HTML field
-			Headers: make(map[string]string),
+			URL:              page.URL,
+			HTML:             crawler.DecodeHTML([]byte(html), page.DetectedCharset),
+			Headers:          headers,
+			CharsetConflicts: page.CharsetConflicts,
 		}
 		
 		result, err := p.technical.Process(context.Background(), agentPageData)
@@ -219,10 +260,14 @@ func (p *Pipeline) runTechnicalStep(ctx context.Context, request v2.AuditRequest
 			technicalResults = append(technicalResults, result)
 		}
 	}
+	if err := pages.Err(); err != nil {
+		return fmt.Errorf("failed to read crawl pages: %w", err)
+	}
 
 	execution.Results["technical"] = map[string]interface{}{
 		"audit_id": request.AuditID,
 		"results": technicalResults,
+		"skipped":  skipped,
 		"status":   "completed",
 	}
 	p.updateProgress(execution, 60.0)
@@ -257,14 +302,21 @@ func (p *Pipeline) runReportStep(ctx context.Context, request v2.AuditRequest, e
 	crawlData := execution.Results["crawl"].(*crawler.CrawlResult)
 	techResults := execution.Results["technical"].(map[string]interface{})
 	semanticResults := execution.Results["semantic"].(*semantic.SemanticResult)
-	
+	redirects := execution.Results["redirects"].(*crawler.RedirectReport)
+
+	// The report reads the pages from pages.jsonl in the audit directory
+	crawlSummary := *crawlData
+	crawlSummary.Pages = nil
+
 	auditResults := report.AuditResults{
 		AuditID:         request.AuditID,
 		SiteURL:         request.SeedURL,
 		StartedAt:       execution.StartTime.Format(time.RFC3339),
 		Duration:        time.Since(execution.StartTime).String(),
-		TotalPages:      len(crawlData.Pages),
-		CrawlData:       *crawlData,
+		TotalPages:      crawlData.Metadata.TotalPages,
+		CrawlData:       crawlSummary,
+		CrawlDir:        execution.OutputDir,
+		Redirects:       redirects,
 		TechResults:     techResults["results"],
 		SemanticResults: *semanticResults,
 	}
@@ -13,12 +13,14 @@ import (
 	"time"
 
 	"firesalamander/internal/agents/crawler"
+	"firesalamander/internal/config"
 	"firesalamander/internal/agents/semantic"
 )
 
 // ReportEngine handles report generation in multiple formats
 type ReportEngine struct {
 	htmlTemplate *template.Template
+	techRules    config.TechRules
 }
 
 // AuditResults contains all data needed for report generation
@@ -29,6 +31,10 @@ type AuditResults struct {
 	Duration        string                    `json:"duration"`
 	TotalPages      int                       `json:"total_pages"`
 	CrawlData       crawler.CrawlResult       `json:"crawl_data"`
+	// CrawlDir is the audit directory holding pages.jsonl. When set, pages
+	// are read from it one by one instead of from CrawlData.Pages.
+	CrawlDir        string                    `json:"crawl_dir,omitempty"`
+	Redirects       *crawler.RedirectReport   `json:"redirects,omitempty"`
 	TechResults     interface{}               `json:"tech_results"`
 	SemanticResults semantic.SemanticResult   `json:"semantic_results"`
 }
@@ -45,6 +51,8 @@ type TemplateData struct {
 	MediumIssues   int              `json:"medium_issues"`
 	LowIssues      int              `json:"low_issues"`
 	OverallScore   float64          `json:"overall_score"`
+	// Deprecated: page rows are rendered as the pages are read, see
+	// AuditResults.CrawlDir. Pages set here are rendered before them.
 	Pages          []PageSummary    `json:"pages"`
 	Issues         []IssueSummary   `json:"issues"`
 	Keywords       []KeywordSummary `json:"keywords"`
@@ -59,6 +67,10 @@ type PageSummary struct {
 	IssuesCount      int     `json:"issues_count"`
 	PerformanceScore float64 `json:"performance_score"`
 	Depth            int     `json:"depth"`
+	Indexable          bool   `json:"indexable"`
+	IndexabilityReason string `json:"indexability_reason"`
+	UniqueInlinks      int    `json:"unique_inlinks"`
+	LinkDepth          int    `json:"link_depth"`
 }
 
 // IssueSummary represents an SEO issue in the report
@@ -98,17 +110,28 @@ func NewReportEngine() *ReportEngine {
 	
 	return &ReportEngine{
 		htmlTemplate: template.Must(tmpl.Parse(htmlTemplateContent)),
+		techRules:    config.DefaultTechRules(),
 	}
 }
 
+// SetTechRules replaces the technical audit thresholds
+func (re *ReportEngine) SetTechRules(rules config.TechRules) {
+	re.techRules = rules
+}
+
 // GenerateHTML generates an HTML report
 func (re *ReportEngine) GenerateHTML(results AuditResults) (string, error) {
 	if err := re.validateAuditResults(results); err != nil {
 		return "", err
 	}
 
+	// Page rows are rendered as the pages are read, never held together
 	templateData := re.prepareTemplateData(results)
-	return re.renderHTMLTemplate(templateData)
+	return re.renderHTMLPages(templateData, func(yield func(PageSummary) error) error {
+		return eachPage(results, func(page crawler.PageData) error {
+			return yield(re.pageSummary(page, results.TechResults))
+		})
+	})
 }
 
 // GenerateJSON generates a JSON report
@@ -135,29 +158,19 @@ func (re *ReportEngine) GenerateCSV(results AuditResults) (string, error) {
 	writer := csv.NewWriter(&buf)
 
 	// Header
-	headers := []string{"URL", "Title", "H1", "Depth", "Issues", "Performance", "Accessibility", "SEO"}
-	if err := writer.Write(headers); err != nil {
+	if err := writer.Write(csvHeaders); err != nil {
 		return "", fmt.Errorf("failed to write CSV header: %w", err)
 	}
 
 	// Data rows
-	for _, page := range results.CrawlData.Pages {
-		issuesCount := re.countPageIssues(page.URL, results.TechResults)
-		
-		row := []string{
-			page.URL,
-			page.Title,
-			page.H1,
-			strconv.Itoa(page.Depth),
-			strconv.Itoa(issuesCount),
-			"N/A", // Performance score per page not available in current structure
-			"N/A", // Accessibility score per page not available
-			"N/A", // SEO score per page not available
-		}
-		
-		if err := writer.Write(row); err != nil {
-			return "", fmt.Errorf("failed to write CSV row: %w", err)
+	err := eachPage(results, func(page crawler.PageData) error {
+		if err := writer.Write(re.csvRow(page, results.TechResults)); err != nil {
+			return fmt.Errorf("failed to write CSV row: %w", err)
 		}
+		return nil
+	})
+	if err != nil {
+		return "", err
 	}
 
 	writer.Flush()
@@ -168,6 +181,60 @@ func (re *ReportEngine) GenerateCSV(results AuditResults) (string, error) {
 	return buf.String(), nil
 }
 
+// eachPage calls fn on every crawled page, read from pages.jsonl in CrawlDir
+// when it is set so the report never holds the whole crawl in memory
+func eachPage(results AuditResults, fn func(crawler.PageData) error) error {
+	if results.CrawlDir == "" {
+		for _, page := range results.CrawlData.Pages {
+			if err := fn(page); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	pages, err := crawler.OpenPageReader(results.CrawlDir)
+	if err != nil {
+		return fmt.Errorf("invalid crawl data: %w", err)
+	}
+	defer func() { _ = pages.Close() }()
+
+	for pages.Next() {
+		if err := fn(pages.Page()); err != nil {
+			return err
+		}
+	}
+	if err := pages.Err(); err != nil {
+		return fmt.Errorf("failed to read crawl pages: %w", err)
+	}
+	return nil
+}
+
+// csvHeaders are the columns of the CSV report
+var csvHeaders = []string{"URL", "Title", "H1", "Depth", "Indexable", "Indexability Reason", "Inlinks", "Unique Inlinks", "Unique Outlinks", "Link Depth", "Issues", "Performance", "Accessibility", "SEO"}
+
+// csvRow builds the CSV report line of a page
+func (re *ReportEngine) csvRow(page crawler.PageData, techResults interface{}) []string {
+	issuesCount := re.countPageIssues(page.URL, techResults)
+
+	return []string{
+		page.URL,
+		page.Title,
+		page.H1,
+		strconv.Itoa(page.Depth),
+		strconv.FormatBool(page.Indexable),
+		page.IndexabilityReason,
+		strconv.Itoa(page.Inlinks),
+		strconv.Itoa(page.UniqueInlinks),
+		strconv.Itoa(page.UniqueOutlinks),
+		strconv.Itoa(page.LinkDepth),
+		strconv.Itoa(issuesCount),
+		"N/A", // Performance score per page not available in current structure
+		"N/A", // Accessibility score per page not available
+		"N/A", // SEO score per page not available
+	}
+}
+
 // SaveReport saves a report to disk in the specified format
 func (re *ReportEngine) SaveReport(results AuditResults, format string, outputDir string) (string, error) {
 	if err := re.validateAuditResults(results); err != nil {
@@ -216,22 +283,11 @@ func (re *ReportEngine) prepareTemplateData(results AuditResults) TemplateData {
 	// Demo overall score
 	overallScore := 75.0
 
-	// Prepare page summaries
-	pages := make([]PageSummary, len(results.CrawlData.Pages))
-	for i, page := range results.CrawlData.Pages {
-		issuesCount := re.countPageIssues(page.URL, results.TechResults)
-		pages[i] = PageSummary{
-			URL:              page.URL,
-			Title:            page.Title,
-			H1:               page.H1,
-			IssuesCount:      issuesCount,
-			PerformanceScore: 75, // Demo score
-			Depth:            page.Depth,
-		}
-	}
-
 	// Prepare issue summaries
 	issues := re.groupIssuesByType(results.TechResults)
+	issues = append(issues, re.crawlTrapIssues(results.CrawlData.Traps)...)
+	issues = append(issues, re.redirectIssues(results.Redirects)...)
+	issues = append(issues, re.assetIssues(results.CrawlData.Assets)...)
 
 	// Prepare keyword summaries
 	keywords := make([]KeywordSummary, len(results.SemanticResults.Suggestions))
@@ -269,17 +325,58 @@ func (re *ReportEngine) prepareTemplateData(results AuditResults) TemplateData {
 		MediumIssues:   mediumCount,
 		LowIssues:      lowCount,
 		OverallScore:   overallScore,
-		Pages:          pages,
 		Issues:         issues,
 		Keywords:       keywords,
 		Topics:         topics,
 	}
 }
 
-// renderHTMLTemplate renders the HTML template
+// pageSummary converts a crawled page to its row in the report
+func (re *ReportEngine) pageSummary(page crawler.PageData, techResults interface{}) PageSummary {
+	return PageSummary{
+		URL:                page.URL,
+		Title:              page.Title,
+		H1:                 page.H1,
+		IssuesCount:        re.countPageIssues(page.URL, techResults),
+		PerformanceScore:   75, // Demo score
+		Depth:              page.Depth,
+		Indexable:          page.Indexable,
+		IndexabilityReason: page.IndexabilityReason,
+		UniqueInlinks:      page.UniqueInlinks,
+		LinkDepth:          page.LinkDepth,
+	}
+}
+
+// renderHTMLTemplate renders the HTML template with the rows of data.Pages
 func (re *ReportEngine) renderHTMLTemplate(data TemplateData) (string, error) {
+	return re.renderHTMLPages(data, nil)
+}
+
+// renderHTMLPages renders the HTML template, with a row for every page of
+// data.Pages, then for every page that pages, when set, yields, between the
+// report header and footer
+func (re *ReportEngine) renderHTMLPages(data TemplateData, pages func(yield func(PageSummary) error) error) (string, error) {
 	var buf bytes.Buffer
-	if err := re.htmlTemplate.Execute(&buf, data); err != nil {
+	if err := re.htmlTemplate.ExecuteTemplate(&buf, "report", data); err != nil {
+		return "", fmt.Errorf("failed to execute template: %w", err)
+	}
+	row := func(page PageSummary) error {
+		if err := re.htmlTemplate.ExecuteTemplate(&buf, "page", page); err != nil {
+			return fmt.Errorf("failed to execute page template: %w", err)
+		}
+		return nil
+	}
+	for _, page := range data.Pages {
+		if err := row(page); err != nil {
+			return "", err
+		}
+	}
+	if pages != nil {
+		if err := pages(row); err != nil {
+			return "", err
+		}
+	}
+	if err := re.htmlTemplate.ExecuteTemplate(&buf, "footer", data); err != nil {
 		return "", fmt.Errorf("failed to execute template: %w", err)
 	}
 	return buf.String(), nil
@@ -333,6 +430,95 @@ func (re *ReportEngine) groupIssuesByType(results interface{}) []IssueSummary {
 	return issues
 }
 
+// crawlTrapIssues reports each quarantined crawler trap as crawl budget
+// waste, with sample URLs
+func (re *ReportEngine) crawlTrapIssues(traps []crawler.CrawlTrap) []IssueSummary {
+	issues := make([]IssueSummary, 0, len(traps))
+	for _, trap := range traps {
+		issues = append(issues, IssueSummary{
+			ID:       "crawl-budget-waste",
+			Severity: "high",
+			Message:  fmt.Sprintf("Crawl budget waste: %s trap on %s (%s)", trap.Kind, trap.Pattern, trap.Reason),
+			Count:    trap.Quarantined,
+			Pages:    trap.Samples,
+		})
+	}
+	return issues
+}
+
+// redirectMessages describe each type of redirect issue in the report
+var redirectMessages = map[string]string{
+	crawler.RedirectIssueChain:     "Redirect chain of more than one hop",
+	crawler.RedirectIssueTemporary: "Temporary redirect",
+	crawler.RedirectIssueProtocol:  "HTTP/HTTPS inconsistency in redirects",
+	crawler.RedirectIssueLoop:      "Redirect loop",
+	crawler.RedirectIssueToError:   "Redirect ending on an error",
+}
+
+// redirectIssues groups the issues of the redirect audit by type and
+// severity, with the source URLs as pages
+func (re *ReportEngine) redirectIssues(report *crawler.RedirectReport) []IssueSummary {
+	issues := make([]IssueSummary, 0)
+	if report == nil {
+		return issues
+	}
+
+	index := make(map[[2]string]int)
+	for _, issue := range report.Issues {
+		key := [2]string{issue.Type, issue.Severity}
+		i, ok := index[key]
+		if !ok {
+			message := redirectMessages[issue.Type]
+			if message == "" {
+				message = issue.Type
+			}
+			i = len(issues)
+			index[key] = i
+			issues = append(issues, IssueSummary{
+				ID:       strings.ReplaceAll(issue.Type, "_", "-"),
+				Severity: issue.Severity,
+				Message:  message,
+				Pages:    []string{},
+			})
+		}
+		issues[i].Count++
+		issues[i].Pages = append(issues[i].Pages, issue.SourceURL)
+	}
+	return issues
+}
+
+// assetIssues reports the assets that fail to load and the images heavier
+// than the images.max_size_kb tech rule, with the pages using them
+func (re *ReportEngine) assetIssues(assets []crawler.Asset) []IssueSummary {
+	issues := make([]IssueSummary, 0)
+	maxSize := int64(re.techRules.Images.MaxSizeKB) * 1024
+	for _, asset := range assets {
+		switch {
+		case asset.Broken():
+			problem := asset.Error
+			if problem == "" {
+				problem = fmt.Sprintf("HTTP %d", asset.StatusCode)
+			}
+			issues = append(issues, IssueSummary{
+				ID:       "broken-asset",
+				Severity: "high",
+				Message:  fmt.Sprintf("Broken %s: %s (%s)", asset.Type, asset.URL, problem),
+				Count:    len(asset.Pages),
+				Pages:    asset.Pages,
+			})
+		case asset.Type == crawler.AssetImage && maxSize > 0 && asset.Size > maxSize:
+			issues = append(issues, IssueSummary{
+				ID:       "oversized-image",
+				Severity: re.techRules.Images.OversizedSeverity,
+				Message:  fmt.Sprintf("Image over %d KB: %s (%d KB)", re.techRules.Images.MaxSizeKB, asset.URL, asset.Size/1024),
+				Count:    len(asset.Pages),
+				Pages:    asset.Pages,
+			})
+		}
+	}
+	return issues
+}
+
 // HTML template content
 const htmlTemplateContent = `<!DOCTYPE html>
 <html lang="fr">
@@ -552,19 +738,25 @@ const htmlTemplateContent = `<!DOCTYPE html>
                         <th>Titre</th>
                         <th>H1</th>
                         <th>Profondeur</th>
+                        <th>Indexable</th>
+                        <th>Liens entrants</th>
                         <th>Problèmes</th>
                     </tr>
                 </thead>
                 <tbody>
-                    {{range .Pages}}
+{{- /* Page rows are rendered one by one between the report and its footer */ -}}
+{{define "page"}}
                     <tr>
                         <td><a href="{{.URL}}" target="_blank">{{.URL}}</a></td>
                         <td>{{.Title}}</td>
                         <td>{{.H1}}</td>
                         <td>{{.Depth}}</td>
+                        <td>{{if .Indexable}}Oui{{else}}Non ({{.IndexabilityReason}}){{end}}</td>
+                        <td>{{.UniqueInlinks}}</td>
                         <td>{{.IssuesCount}}</td>
                     </tr>
-                    {{end}}
+{{- end}}
+{{define "footer"}}
                 </tbody>
             </table>
         </div>
@@ -575,4 +767,4 @@ const htmlTemplateContent = `<!DOCTYPE html>
         <p>🦎 Audit SEO nouvelle génération</p>
     </div>
 </body>
-</html>`
\ No newline at end of file
+</html>{{end}}`
\ No newline at end of file
@@ -43,22 +43,15 @@ func TestGenerateReport(t *testing.T) {
 				DurationMs:      2500,
 			},
 		},
-		TechResults: audit.TechResult{
-			AuditID: "test_audit_123",
-			Findings: []audit.Finding{
-				{
-					ID:       "missing-meta-description",
-					Severity: "medium",
-					Message:  "Balise meta description manquante",
-					Evidence: []string{"https://example.com/"},
+		TechResults: []*agents.AgentResult{
+			{
+				AgentName: "technical-auditor",
+				Status:    "success",
+				Data: map[string]interface{}{
+					"url":    "https://example.com/",
+					"issues": []string{"Balise meta description manquante"},
 				},
 			},
-			Scores: audit.Scores{
-				Performance:   0.85,
-				Accessibility: 0.92,
-				BestPractices: 0.88,
-				SEO:           0.76,
-			},
 		},
 		SemanticResults: semantic.SemanticResult{
 			AuditID:      "test_audit_123",
@@ -225,4 +218,52 @@ func TestUnsupportedFormat(t *testing.T) {
 	_, err := engine.SaveReport(auditResults, "xml", "/tmp")
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "unsupported format")
-}
\ No newline at end of file
+}
+
+func TestGenerateCSVReadsPagesFromCrawlDir(t *testing.T) {
+	engine := NewReportEngine()
+
+	dir := t.TempDir()
+	pages := `{"page":{"url":"https://example.com/a","title":"A"}}` + "\n" +
+		`{"page":{"url":"https://example.com/b","title":"B"}}` + "\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "pages.jsonl"), []byte(pages), 0644))
+
+	csvReport, err := engine.GenerateCSV(AuditResults{AuditID: "test_stream", SiteURL: "https://example.com", CrawlDir: dir})
+	require.NoError(t, err)
+	assert.Contains(t, csvReport, "https://example.com/a,A")
+	assert.Contains(t, csvReport, "https://example.com/b,B")
+
+	htmlReport, err := engine.GenerateHTML(AuditResults{AuditID: "test_stream", SiteURL: "https://example.com", CrawlDir: dir})
+	require.NoError(t, err)
+	assert.Contains(t, htmlReport, "https://example.com/a")
+	assert.Contains(t, htmlReport, "https://example.com/b")
+	assert.Contains(t, htmlReport, "</html>")
+
+	_, err = engine.GenerateHTML(AuditResults{AuditID: "test_stream", SiteURL: "https://example.com", CrawlDir: filepath.Join(dir, "missing")})
+	assert.Error(t, err)
+}
+
+func TestRedirectIssuesInReport(t *testing.T) {
+	engine := NewReportEngine()
+
+	redirects := &crawler.RedirectReport{
+		TotalRedirects: 3,
+		Issues: []crawler.RedirectIssue{
+			{Type: crawler.RedirectIssueChain, Severity: "medium", SourceURL: "https://example.com/a"},
+			{Type: crawler.RedirectIssueChain, Severity: "medium", SourceURL: "https://example.com/b"},
+			{Type: crawler.RedirectIssueLoop, Severity: "critical", SourceURL: "https://example.com/loop"},
+		},
+	}
+
+	issues := engine.redirectIssues(redirects)
+	require.Len(t, issues, 2)
+	assert.Equal(t, "redirect-chain", issues[0].ID)
+	assert.Equal(t, 2, issues[0].Count)
+	assert.Equal(t, []string{"https://example.com/a", "https://example.com/b"}, issues[0].Pages)
+	assert.Equal(t, "critical", issues[1].Severity)
+
+	htmlReport, err := engine.GenerateHTML(AuditResults{AuditID: "test_redirects", SiteURL: "https://example.com", Redirects: redirects})
+	require.NoError(t, err)
+	assert.Contains(t, htmlReport, "Redirect loop")
+	assert.Contains(t, htmlReport, "https://example.com/loop")
+}